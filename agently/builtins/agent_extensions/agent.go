@@ -3,6 +3,7 @@ package agentextensions
 import (
 	"context"
 
+	"github.com/AgentEra/Agently-Go/agently/builtins/mcp"
 	"github.com/AgentEra/Agently-Go/agently/core"
 	"github.com/AgentEra/Agently-Go/agently/types"
 	"github.com/AgentEra/Agently-Go/agently/utils"
@@ -12,6 +13,7 @@ type Agent struct {
 	*core.BaseAgent
 
 	sessionExt         *SessionExtension
+	memoryExt          *MemoryExtension
 	toolExt            *ToolExtension
 	configurePromptExt *ConfigurePromptExtension
 	keyWaiterExt       *KeyWaiterExtension
@@ -23,6 +25,13 @@ func NewAgent(pluginManager *core.PluginManager, parentSettings *utils.Settings,
 	base := core.NewBaseAgent(pluginManager, parentSettings, name)
 	a := &Agent{BaseAgent: base}
 	a.sessionExt = NewSessionExtension(base)
+	a.memoryExt = NewMemoryExtension(base)
+	a.memoryExt.sessionScope = func() string {
+		if active := a.sessionExt.ActiveSession(); active != nil {
+			return active.ID()
+		}
+		return ""
+	}
 	a.toolExt = NewToolExtension(base)
 	a.configurePromptExt = NewConfigurePromptExtension(base)
 	a.keyWaiterExt = NewKeyWaiterExtension(base)
@@ -36,11 +45,58 @@ func (a *Agent) ActivateSession(sessionID string) *Agent {
 	return a
 }
 
+func (a *Agent) ActivateSessionWithContext(ctx context.Context, sessionID string) error {
+	return a.sessionExt.ActivateSessionWithContext(ctx, sessionID)
+}
+
+func (a *Agent) UseSessionStore(store core.SessionStore) *Agent {
+	a.sessionExt.UseSessionStore(store)
+	return a
+}
+
+func (a *Agent) SaveSession(ctx context.Context) error {
+	return a.sessionExt.SaveSession(ctx)
+}
+
+func (a *Agent) ForceSaveSession(ctx context.Context) error {
+	return a.sessionExt.ForceSaveSession(ctx)
+}
+
+func (a *Agent) ReloadSession(ctx context.Context) error {
+	return a.sessionExt.ReloadSession(ctx)
+}
+
+func (a *Agent) CloseSession(ctx context.Context, sessionID string) error {
+	return a.sessionExt.CloseSession(ctx, sessionID)
+}
+
+func (a *Agent) ListSessions() []string {
+	return a.sessionExt.ListSessions()
+}
+
+func (a *Agent) EvictIdleSessions(ctx context.Context) int {
+	return a.sessionExt.EvictIdleSessions(ctx)
+}
+
+func (a *Agent) OnSessionEvicted(hook SessionEvictionHook) *Agent {
+	a.sessionExt.OnSessionEvicted(hook)
+	return a
+}
+
+func (a *Agent) ActiveSession() *core.Session {
+	return a.sessionExt.ActiveSession()
+}
+
 func (a *Agent) DeactivateSession() *Agent {
 	a.sessionExt.DeactivateSession()
 	return a
 }
 
+func (a *Agent) UseSessionSummary(summarizer core.SessionSummarizer) *Agent {
+	a.sessionExt.UseSessionSummary(summarizer)
+	return a
+}
+
 func (a *Agent) ResetChatHistory() *Agent {
 	a.sessionExt.ResetChatHistory()
 	return a
@@ -56,19 +112,106 @@ func (a *Agent) AddChatHistory(chatHistory []types.ChatMessage) *Agent {
 	return a
 }
 
+func (a *Agent) RewindChatHistory(n int) *Agent {
+	a.sessionExt.RewindChatHistory(n)
+	return a
+}
+
+func (a *Agent) EditChatHistory(index int, content any) error {
+	return a.sessionExt.EditChatHistory(index, content)
+}
+
+func (a *Agent) ForkSession(ctx context.Context, newID string, turn ...int) error {
+	return a.sessionExt.ForkSession(ctx, newID, turn...)
+}
+
+func (a *Agent) ExportSession(format core.SessionExportFormat, options core.SessionExportOptions) ([]byte, error) {
+	return a.sessionExt.ExportSession(format, options)
+}
+
 func (a *Agent) CleanContextWindow() *Agent {
 	a.sessionExt.CleanContextWindow()
 	return a
 }
 
-func (a *Agent) RegisterTool(info types.ToolInfo, fn any) error {
-	return a.toolExt.RegisterTool(info, fn)
+func (a *Agent) UseMemory(store core.MemoryStore) *Agent {
+	a.memoryExt.UseMemory(store)
+	return a
+}
+
+func (a *Agent) SetMemoryEmbedder(embedder core.Embedder) *Agent {
+	a.memoryExt.SetMemoryEmbedder(embedder)
+	return a
+}
+
+func (a *Agent) SetMemoryExtractor(extractor core.MemoryExtractor) *Agent {
+	a.memoryExt.SetMemoryExtractor(extractor)
+	return a
+}
+
+func (a *Agent) SetMemoryScope(scope string) *Agent {
+	a.memoryExt.SetMemoryScope(scope)
+	return a
+}
+
+func (a *Agent) MemoryScope() string {
+	return a.memoryExt.MemoryScope()
+}
+
+func (a *Agent) WaitMemories() {
+	a.memoryExt.WaitMemories()
+}
+
+func (a *Agent) Remember(ctx context.Context, content string) (core.Memory, error) {
+	return a.memoryExt.Remember(ctx, content)
+}
+
+func (a *Agent) RecallMemories(ctx context.Context, query string) ([]core.MemoryMatch, error) {
+	return a.memoryExt.RecallMemories(ctx, query)
+}
+
+func (a *Agent) ListMemories(ctx context.Context) ([]core.Memory, error) {
+	return a.memoryExt.ListMemories(ctx)
+}
+
+func (a *Agent) DeleteMemory(ctx context.Context, id string) error {
+	return a.memoryExt.DeleteMemory(ctx, id)
+}
+
+func (a *Agent) CorrectMemory(ctx context.Context, id string, content string) (core.Memory, error) {
+	return a.memoryExt.CorrectMemory(ctx, id, content)
+}
+
+func (a *Agent) RegisterTool(info types.ToolInfo, fn any, options ...any) error {
+	return a.toolExt.RegisterTool(info, fn, options...)
+}
+
+func (a *Agent) UnregisterTools(toolNames []string, options ...any) error {
+	return a.toolExt.UnregisterTools(toolNames, options...)
+}
+
+func (a *Agent) UseMCP(ctx context.Context, client *mcp.Client, options ...any) (*mcp.ToolSet, error) {
+	return a.toolExt.UseMCP(ctx, client, options...)
+}
+
+func (a *Agent) SetGlobalTool(tool *core.Tool) *Agent {
+	a.toolExt.SetGlobalTool(tool)
+	return a
 }
 
 func (a *Agent) UseTools(toolNames []string) error {
 	return a.toolExt.UseTools(toolNames)
 }
 
+func (a *Agent) SetToolApprover(approver core.ToolApprover) *Agent {
+	a.toolExt.SetToolApprover(approver)
+	return a
+}
+
+func (a *Agent) UseAsyncToolApproval() *core.ToolApprovalQueue {
+	return a.toolExt.UseAsyncToolApproval()
+}
+
 func (a *Agent) Tool() *core.Tool {
 	return a.toolExt.Tool()
 }
@@ -0,0 +1,272 @@
+package agentextensions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AgentEra/Agently-Go/agently/core"
+	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+// defaultMemoryScope is the scope of memories when neither SetMemoryScope,
+// memory.scope nor an active session names one.
+const defaultMemoryScope = "default"
+
+var errMemoryNotInUse = errors.New("memory is not in use, call UseMemory first")
+
+// MemoryExtension gives an agent long-term memory. Before each request the
+// memories most relevant to the input join the prompt; after each turn the
+// facts worth remembering are extracted and stored, in the background unless
+// memory.async_extract is false.
+type MemoryExtension struct {
+	agent     *core.BaseAgent
+	store     core.MemoryStore
+	embedder  core.Embedder
+	extractor core.MemoryExtractor
+	scope     string
+	// sessionScope returns the active session ID, the scope when no other
+	// one is configured.
+	sessionScope func() string
+	mu           sync.RWMutex
+	// pending tracks background extractions. Each one waits for the
+	// previous one, closing lastExtraction, so turns are stored in order.
+	pending        sync.WaitGroup
+	lastExtraction chan struct{}
+}
+
+func NewMemoryExtension(agent *core.BaseAgent) *MemoryExtension {
+	ext := &MemoryExtension{agent: agent}
+	agent.ExtensionHandlers().AppendRequestPrefix(ext.memoryRequestPrefix)
+	agent.ExtensionHandlers().AppendFinally(ext.memoryFinally)
+	return ext
+}
+
+// UseMemory turns memory on with store, or a LocalMemoryStore when store is
+// nil. Memories are embedded and extracted with the agent's model unless
+// SetMemoryEmbedder or SetMemoryExtractor replaced them.
+func (e *MemoryExtension) UseMemory(store core.MemoryStore) *MemoryExtension {
+	if store == nil {
+		store = core.NewLocalMemoryStore()
+	}
+	e.mu.Lock()
+	e.store = store
+	e.mu.Unlock()
+	return e
+}
+
+func (e *MemoryExtension) SetMemoryEmbedder(embedder core.Embedder) *MemoryExtension {
+	e.mu.Lock()
+	e.embedder = embedder
+	e.mu.Unlock()
+	return e
+}
+
+func (e *MemoryExtension) SetMemoryExtractor(extractor core.MemoryExtractor) *MemoryExtension {
+	e.mu.Lock()
+	e.extractor = extractor
+	e.mu.Unlock()
+	return e
+}
+
+// SetMemoryScope scopes memories to a user or session key. An empty scope
+// falls back to memory.scope, then to the active session ID.
+func (e *MemoryExtension) SetMemoryScope(scope string) *MemoryExtension {
+	e.mu.Lock()
+	e.scope = scope
+	e.mu.Unlock()
+	return e
+}
+
+// MemoryScope returns the scope memories are currently read and written in.
+func (e *MemoryExtension) MemoryScope() string {
+	e.mu.RLock()
+	scope, sessionScope := e.scope, e.sessionScope
+	e.mu.RUnlock()
+	if scope != "" {
+		return scope
+	}
+	if configured, ok := e.agent.Settings().Get("memory.scope", nil, true).(string); ok && configured != "" {
+		return configured
+	}
+	if sessionScope != nil {
+		if sessionID := sessionScope(); sessionID != "" {
+			return sessionID
+		}
+	}
+	return defaultMemoryScope
+}
+
+// MemoryBank returns the bank memories are kept in, or nil before UseMemory.
+func (e *MemoryExtension) MemoryBank() *core.MemoryBank {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.store == nil {
+		return nil
+	}
+	embedder, extractor := e.embedder, e.extractor
+	if embedder == nil {
+		embedder = core.AgentEmbedder(e.agent)
+	}
+	if extractor == nil {
+		extractor = core.AgentMemoryExtractor(e.agent)
+	}
+	return core.NewMemoryBank(e.store, embedder, extractor, e.agent.Settings())
+}
+
+// Remember stores content in the current scope.
+func (e *MemoryExtension) Remember(ctx context.Context, content string) (core.Memory, error) {
+	bank := e.MemoryBank()
+	if bank == nil {
+		return core.Memory{}, errMemoryNotInUse
+	}
+	return bank.Remember(ctx, e.MemoryScope(), content)
+}
+
+// RecallMemories returns the memories of the current scope relevant to query.
+func (e *MemoryExtension) RecallMemories(ctx context.Context, query string) ([]core.MemoryMatch, error) {
+	bank := e.MemoryBank()
+	if bank == nil {
+		return nil, errMemoryNotInUse
+	}
+	return bank.Recall(ctx, e.MemoryScope(), query)
+}
+
+// ListMemories returns the memories of the current scope, oldest first.
+func (e *MemoryExtension) ListMemories(ctx context.Context) ([]core.Memory, error) {
+	bank := e.MemoryBank()
+	if bank == nil {
+		return nil, errMemoryNotInUse
+	}
+	return bank.List(ctx, e.MemoryScope())
+}
+
+func (e *MemoryExtension) DeleteMemory(ctx context.Context, id string) error {
+	bank := e.MemoryBank()
+	if bank == nil {
+		return errMemoryNotInUse
+	}
+	return bank.Delete(ctx, e.MemoryScope(), id)
+}
+
+// CorrectMemory replaces the content of memory id in the current scope.
+func (e *MemoryExtension) CorrectMemory(ctx context.Context, id string, content string) (core.Memory, error) {
+	bank := e.MemoryBank()
+	if bank == nil {
+		return core.Memory{}, errMemoryNotInUse
+	}
+	return bank.Correct(ctx, e.MemoryScope(), id, content)
+}
+
+// memoryRequestPrefix adds the memories relevant to the input to the prompt.
+// Recall failures are reported as warnings and the request goes on without.
+func (e *MemoryExtension) memoryRequestPrefix(ctx context.Context, prompt *core.Prompt, _ *utils.Settings) error {
+	bank := e.MemoryBank()
+	if bank == nil {
+		return nil
+	}
+	input := prompt.Get("input", nil, true)
+	if input == nil {
+		return nil
+	}
+	ctx, cancel := e.memoryContext(ctx)
+	defer cancel()
+	scope := e.MemoryScope()
+	matches, err := bank.Recall(ctx, scope, formatValue(input))
+	if err != nil {
+		e.warn(scope, fmt.Sprintf("memory recall failed: %v", err))
+		return nil
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+	memories := make([]any, 0, len(matches))
+	for _, match := range matches {
+		memories = append(memories, match.Content)
+	}
+	prompt.Set("LONG-TERM MEMORIES", memories)
+	return nil
+}
+
+// memoryFinally extracts and stores the facts of the finished turn unless
+// memory.auto_extract is false. With memory.async_extract, the default, this
+// runs in the background, bounded by memory.timeout but not by the request
+// context, so the reply is not held up by the extraction and embedding
+// requests. Failures are reported as warnings so they do not fail the reply.
+func (e *MemoryExtension) memoryFinally(ctx context.Context, result *core.ModelResponseResult, _ *utils.Settings) error {
+	bank := e.MemoryBank()
+	settings := e.agent.Settings()
+	if bank == nil || settings.Get("memory.auto_extract", true, true) == false {
+		return nil
+	}
+	messages := []types.ChatMessage{}
+	if requestPrompt := result.Prompt(); requestPrompt != nil {
+		if input := requestPrompt.Get("input", nil, true); input != nil {
+			messages = append(messages, types.ChatMessage{Role: "user", Content: formatValue(input)})
+		}
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	if reply, err := result.PeekTextWithContext(ctx); err == nil && strings.TrimSpace(reply) != "" {
+		messages = append(messages, types.ChatMessage{Role: "assistant", Content: reply})
+	}
+
+	scope := e.MemoryScope()
+	if settings.Get("memory.async_extract", true, true) == false {
+		e.memorizeTurn(ctx, bank, scope, messages)
+		return nil
+	}
+	done := make(chan struct{})
+	e.mu.Lock()
+	previous := e.lastExtraction
+	e.lastExtraction = done
+	e.mu.Unlock()
+	e.pending.Add(1)
+	go func() {
+		defer e.pending.Done()
+		defer close(done)
+		if previous != nil {
+			<-previous
+		}
+		e.memorizeTurn(context.WithoutCancel(ctx), bank, scope, messages)
+	}()
+	return nil
+}
+
+// WaitMemories blocks until the background extractions of finished turns
+// are stored, e.g. before shutting down or reading memories in tests.
+func (e *MemoryExtension) WaitMemories() {
+	e.pending.Wait()
+}
+
+func (e *MemoryExtension) memorizeTurn(ctx context.Context, bank *core.MemoryBank, scope string, messages []types.ChatMessage) {
+	ctx, cancel := e.memoryContext(ctx)
+	defer cancel()
+	if _, err := bank.MemorizeTurn(ctx, scope, messages); err != nil {
+		e.warn(scope, fmt.Sprintf("memory extraction failed: %v", err))
+	}
+}
+
+// memoryContext bounds memory requests by memory.timeout seconds.
+func (e *MemoryExtension) memoryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := 0.0
+	switch typed := e.agent.Settings().Get("memory.timeout", nil, true).(type) {
+	case int:
+		timeout = float64(typed)
+	case float64:
+		timeout = typed
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(timeout*float64(time.Second)))
+}
+
+func (e *MemoryExtension) warn(scope string, message string) {
+	_ = core.EmitWarning(e.agent.Settings(), "Memory", map[string]any{"agent_name": e.agent.Name(), "scope": scope}, message)
+}
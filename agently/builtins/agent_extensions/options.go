@@ -1,6 +1,10 @@
 package agentextensions
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/AgentEra/Agently-Go/agently/core"
+)
 
 // ConfigurePromptLoadOptions configures JSON/YAML prompt loading behavior.
 type ConfigurePromptLoadOptions struct {
@@ -104,3 +108,43 @@ func splitKeyWaiterInvokeOptions(raw ...any) (keyWaiterRaw []any, invokeRaw []an
 	}
 	return
 }
+
+// ToolRegisterOptions configures where agent tool registration happens.
+type ToolRegisterOptions struct {
+	Scope core.ToolScope
+}
+
+// ToolRegisterOption is a functional option for ToolRegisterOptions.
+type ToolRegisterOption func(*ToolRegisterOptions)
+
+func WithToolScope(scope core.ToolScope) ToolRegisterOption {
+	return func(options *ToolRegisterOptions) {
+		options.Scope = scope
+	}
+}
+
+func parseToolRegisterOptions(raw ...any) ToolRegisterOptions {
+	options := ToolRegisterOptions{Scope: core.ToolScopeAgent}
+	for _, item := range raw {
+		switch typed := item.(type) {
+		case nil:
+			continue
+		case ToolRegisterOption:
+			typed(&options)
+		case core.ToolScope:
+			options.Scope = typed
+		case ToolRegisterOptions:
+			options = typed
+		case *ToolRegisterOptions:
+			if typed != nil {
+				options = *typed
+			}
+		default:
+			panic(fmt.Sprintf("unsupported tool register option type: %T", item))
+		}
+	}
+	if options.Scope == "" {
+		options.Scope = core.ToolScopeAgent
+	}
+	return options
+}
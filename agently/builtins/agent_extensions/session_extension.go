@@ -1,7 +1,9 @@
 package agentextensions
 
 import (
+	"container/list"
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -14,19 +16,27 @@ import (
 )
 
 type SessionExtension struct {
-	agent    *core.BaseAgent
-	sessions map[string]*core.Session
-	active   *core.Session
-	mu       sync.RWMutex
+	agent *core.BaseAgent
+	// sessions indexes lru, which holds *sessionEntry values, most recently
+	// used first.
+	sessions      map[string]*list.Element
+	lru           *list.List
+	active        *core.Session
+	store         core.SessionStore
+	evictionHooks []SessionEvictionHook
+	mu            sync.RWMutex
 }
 
 func NewSessionExtension(agent *core.BaseAgent) *SessionExtension {
 	ext := &SessionExtension{
 		agent:    agent,
-		sessions: map[string]*core.Session{},
+		sessions: map[string]*list.Element{},
+		lru:      list.New(),
 	}
 	agent.Settings().SetDefault("session.input_keys", nil, true)
 	agent.Settings().SetDefault("session.reply_keys", nil, true)
+	agent.Settings().SetDefault("session.record_tool_calls", true, true)
+	agent.Settings().SetDefault("session.autosave", true, true)
 
 	agent.ExtensionHandlers().AppendRequestPrefix(ext.sessionRequestPrefix)
 	agent.ExtensionHandlers().AppendFinally(ext.sessionFinally)
@@ -39,29 +49,148 @@ func (e *SessionExtension) ActiveSession() *core.Session {
 	return e.active
 }
 
+// ActivateSession activates sessionID, loading it from the session store the
+// first time. When loading fails the session starts empty; saving it then
+// fails with a version conflict instead of overwriting the stored copy.
 func (e *SessionExtension) ActivateSession(sessionID string) *SessionExtension {
-	e.mu.Lock()
-	defer e.mu.Unlock()
 	if sessionID == "" {
 		sessionID = fmt.Sprintf("session-%d", time.Now().UnixNano())
 	}
-	if existing, ok := e.sessions[sessionID]; ok {
-		e.active = existing
-	} else {
-		s := core.NewSession(sessionID, true, e.agent.Settings())
-		e.sessions[sessionID] = s
-		e.active = s
+	if err := e.ActivateSessionWithContext(context.Background(), sessionID); err != nil {
+		e.activate(context.Background(), core.NewSession(sessionID, true, e.agent.Settings()))
+	}
+	return e
+}
+
+// ActivateSessionWithContext is ActivateSession reporting store errors. The
+// active session is left unchanged when loading fails.
+func (e *SessionExtension) ActivateSessionWithContext(ctx context.Context, sessionID string) error {
+	if sessionID == "" {
+		sessionID = fmt.Sprintf("session-%d", time.Now().UnixNano())
+	}
+	e.mu.RLock()
+	session, ok := e.lookupLocked(sessionID)
+	store := e.store
+	e.mu.RUnlock()
+	if !ok && store != nil {
+		loaded, err := core.LoadSessionFromStore(ctx, store, sessionID, e.agent.Settings())
+		if err != nil && !errors.Is(err, core.ErrSessionNotFound) {
+			return err
+		}
+		session = loaded
+	}
+	if session == nil {
+		session = core.NewSession(sessionID, true, e.agent.Settings())
 	}
+	e.activate(ctx, session)
+	return nil
+}
+
+// activate makes session the active one, then evicts the sessions past
+// session.idle_ttl or session.max_sessions.
+func (e *SessionExtension) activate(ctx context.Context, session *core.Session) {
+	e.mu.Lock()
+	if existing, ok := e.lookupLocked(session.ID()); ok {
+		session = existing
+	}
+	e.touchLocked(session)
+	e.active = session
+	core.SetToolResultCache(e.agent.Settings(), types.ToolCacheScopeSession, session.ToolResultCache())
 	e.refillAgentChatHistoryWithSessionLocked()
+	candidates := e.collectEvictionsLocked(time.Now())
+	e.mu.Unlock()
+	e.runEvictions(ctx, candidates)
+}
+
+// UseSessionStore persists sessions in store: they are loaded on activation
+// and, unless session.autosave is false, saved after each turn. A failed
+// autosave is reported as a warning; after a version conflict, call
+// ForceSaveSession or ReloadSession.
+func (e *SessionExtension) UseSessionStore(store core.SessionStore) *SessionExtension {
+	e.mu.Lock()
+	e.store = store
+	e.mu.Unlock()
 	return e
 }
 
+// SaveSession saves the active session to the session store.
+func (e *SessionExtension) SaveSession(ctx context.Context) error {
+	e.mu.RLock()
+	active, store := e.active, e.store
+	e.mu.RUnlock()
+	if active == nil || store == nil {
+		return nil
+	}
+	return core.SaveSessionToStore(ctx, store, active)
+}
+
+// ForceSaveSession saves the active session over the stored copy, dropping
+// what other agents saved since it was loaded. Use it after a
+// core.ErrSessionVersionConflict to keep this agent's conversation;
+// ReloadSession keeps the stored one instead.
+func (e *SessionExtension) ForceSaveSession(ctx context.Context) error {
+	e.mu.RLock()
+	active, store := e.active, e.store
+	e.mu.RUnlock()
+	if active == nil || store == nil {
+		return nil
+	}
+	return core.ForceSaveSessionToStore(ctx, store, active)
+}
+
+// ReloadSession replaces the active session with its stored copy, dropping
+// the changes that were not saved.
+func (e *SessionExtension) ReloadSession(ctx context.Context) error {
+	e.mu.RLock()
+	active, store := e.active, e.store
+	e.mu.RUnlock()
+	if active == nil {
+		return fmt.Errorf("no active session to reload")
+	}
+	if store == nil {
+		return fmt.Errorf("no session store to reload session %s from", active.ID())
+	}
+	loaded, err := core.LoadSessionFromStore(ctx, store, active.ID(), e.agent.Settings())
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if current, ok := e.lookupLocked(active.ID()); !ok || current != active {
+		return nil
+	}
+	e.touchLocked(loaded)
+	if e.active == active {
+		e.active = loaded
+		core.SetToolResultCache(e.agent.Settings(), types.ToolCacheScopeSession, loaded.ToolResultCache())
+		e.refillAgentChatHistoryWithSessionLocked()
+	}
+	return nil
+}
+
 func (e *SessionExtension) DeactivateSession() *SessionExtension {
 	e.mu.Lock()
 	e.active = nil
 	e.mu.Unlock()
+	e.clearActiveSession()
+	return e
+}
+
+func (e *SessionExtension) clearActiveSession() {
+	core.SetToolResultCache(e.agent.Settings(), types.ToolCacheScopeSession, nil)
 	e.agent.AgentPrompt().Delete("chat_history")
 	e.agent.AgentPrompt().Set("chat_history", []any{})
+}
+
+// UseSessionSummary makes sessions fold turns leaving the context window into
+// a rolling summary, injected into later prompts with the session memo. A nil
+// summarizer summarizes with the agent's own model.
+func (e *SessionExtension) UseSessionSummary(summarizer core.SessionSummarizer) *SessionExtension {
+	if summarizer == nil {
+		summarizer = core.AgentSessionSummarizer(e.agent)
+	}
+	e.agent.Settings().SetCover("session.summarizer", summarizer)
+	e.agent.Settings().Set("session.resize_strategy", "summarize")
 	return e
 }
 
@@ -101,7 +230,7 @@ func (e *SessionExtension) AddChatHistory(chatHistory []types.ChatMessage) *Sess
 	e.mu.RUnlock()
 	if active == nil {
 		for _, item := range chatHistory {
-			e.agent.AddChatHistory(map[string]any{"role": item.Role, "content": item.Content})
+			e.agent.AddChatHistory(item.ToMap())
 		}
 		return e
 	}
@@ -112,6 +241,55 @@ func (e *SessionExtension) AddChatHistory(chatHistory []types.ChatMessage) *Sess
 	return e
 }
 
+// RewindChatHistory drops the last n turns of the active session.
+func (e *SessionExtension) RewindChatHistory(n int) *SessionExtension {
+	e.mu.RLock()
+	active := e.active
+	e.mu.RUnlock()
+	if active == nil {
+		return e
+	}
+	active.Rewind(n)
+	e.mu.Lock()
+	e.refillAgentChatHistoryWithSessionLocked()
+	e.mu.Unlock()
+	return e
+}
+
+// EditChatHistory replaces the content of message index of the active session.
+func (e *SessionExtension) EditChatHistory(index int, content any) error {
+	e.mu.RLock()
+	active := e.active
+	e.mu.RUnlock()
+	if active == nil {
+		return fmt.Errorf("no active session to edit")
+	}
+	if err := active.EditMessage(index, content); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.refillAgentChatHistoryWithSessionLocked()
+	e.mu.Unlock()
+	return nil
+}
+
+// ExportSession exports the active session. The agent's system prompt is used
+// when options.System is empty.
+func (e *SessionExtension) ExportSession(format core.SessionExportFormat, options core.SessionExportOptions) ([]byte, error) {
+	e.mu.RLock()
+	active := e.active
+	e.mu.RUnlock()
+	if active == nil {
+		return nil, fmt.Errorf("no active session to export")
+	}
+	if options.System == "" {
+		if system := e.agent.AgentPrompt().Get("system", nil, true); system != nil {
+			options.System = formatValue(system)
+		}
+	}
+	return active.Export(format, options)
+}
+
 func (e *SessionExtension) CleanContextWindow() *SessionExtension {
 	e.mu.RLock()
 	active := e.active
@@ -135,13 +313,18 @@ func (e *SessionExtension) refillAgentChatHistoryWithSessionLocked() {
 	e.agent.AgentPrompt().Set("chat_history", toAnyChat(e.active.ContextWindow()))
 }
 
-func (e *SessionExtension) sessionRequestPrefix(_ context.Context, prompt *core.Prompt, _ *utils.Settings) error {
+// sessionTurnSettingsKey carries the session a response's turn belongs to,
+// the one active when the request started.
+const sessionTurnSettingsKey = "$session.turn_session"
+
+func (e *SessionExtension) sessionRequestPrefix(_ context.Context, prompt *core.Prompt, settings *utils.Settings) error {
 	e.mu.RLock()
 	active := e.active
 	e.mu.RUnlock()
 	if active == nil {
 		return nil
 	}
+	settings.SetCover(sessionTurnSettingsKey, active)
 	prompt.Delete("chat_history")
 	prompt.Set("chat_history", toAnyChat(active.ContextWindow()))
 	if memo := active.Memo(); memo != nil {
@@ -150,10 +333,8 @@ func (e *SessionExtension) sessionRequestPrefix(_ context.Context, prompt *core.
 	return nil
 }
 
-func (e *SessionExtension) sessionFinally(ctx context.Context, result *core.ModelResponseResult, _ *utils.Settings) error {
-	e.mu.RLock()
-	active := e.active
-	e.mu.RUnlock()
+func (e *SessionExtension) sessionFinally(ctx context.Context, result *core.ModelResponseResult, settings *utils.Settings) error {
+	active, _ := settings.Get(sessionTurnSettingsKey, nil, true).(*core.Session)
 	if active == nil {
 		return nil
 	}
@@ -199,19 +380,55 @@ func (e *SessionExtension) sessionFinally(ctx context.Context, result *core.Mode
 		}
 	}
 
+	turn := make([]types.ChatMessage, 0)
 	if strings.TrimSpace(userContent) != "" {
-		active.AddChatHistory([]types.ChatMessage{{Role: "user", Content: userContent}})
+		turn = append(turn, types.ChatMessage{Role: "user", Content: userContent})
+	}
+	if requestPrompt != nil && e.agent.Settings().Get("session.record_tool_calls", true, true) != false {
+		turn = append(turn, sessionToolMessages(requestPrompt)...)
 	}
 	if strings.TrimSpace(assistantContent) != "" {
-		active.AddChatHistory([]types.ChatMessage{{Role: "assistant", Content: assistantContent}})
+		turn = append(turn, types.ChatMessage{Role: "assistant", Content: assistantContent})
+	}
+	// The turn is added at once, so the session resizes, and may summarize
+	// with ctx, only once per turn.
+	if len(turn) > 0 {
+		active.AddChatHistoryWithContext(ctx, turn)
 	}
 
 	e.mu.Lock()
+	if e.active == active {
+		e.touchLocked(active)
+	}
 	e.refillAgentChatHistoryWithSessionLocked()
+	store := e.store
 	e.mu.Unlock()
+
+	// The turn belongs to the session that was active when it started, even
+	// if another one was activated since. A failed save does not fail the
+	// turn: the session stays in memory and the next save retries it.
+	if store == nil || e.agent.Settings().Get("session.autosave", true, true) == false {
+		return nil
+	}
+	if err := core.SaveSessionToStore(ctx, store, active); err != nil {
+		_ = core.EmitWarning(e.agent.Settings(), "Session", map[string]any{"agent_name": e.agent.Name(), "session_id": active.ID()}, fmt.Sprintf("autosave failed: %v", err))
+	}
 	return nil
 }
 
+// sessionToolMessages returns the assistant tool calls and tool results of a
+// native tool loop.
+func sessionToolMessages(prompt *core.Prompt) []types.ChatMessage {
+	raw, _ := prompt.Get(string(types.PromptToolMessages), []any{}, true).([]any)
+	out := make([]types.ChatMessage, 0, len(raw))
+	for _, item := range raw {
+		if message, ok := item.(map[string]any); ok {
+			out = append(out, types.ChatMessageFromMap(message))
+		}
+	}
+	return out
+}
+
 func normalizeSessionKeys(value any) ([]string, bool) {
 	if value == nil {
 		return nil, true
@@ -328,7 +545,7 @@ func formatKeyedContent(items [][2]any) string {
 func toAnyChat(in []types.ChatMessage) []any {
 	out := make([]any, 0, len(in))
 	for _, item := range in {
-		out = append(out, map[string]any{"role": item.Role, "content": item.Content})
+		out = append(out, item.ToMap())
 	}
 	return out
 }
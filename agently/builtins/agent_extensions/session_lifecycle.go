@@ -0,0 +1,259 @@
+package agentextensions
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AgentEra/Agently-Go/agently/core"
+)
+
+// SessionEvictReason tells why a session left an agent's memory.
+type SessionEvictReason string
+
+const (
+	SessionEvictIdle     SessionEvictReason = "idle"
+	SessionEvictCapacity SessionEvictReason = "capacity"
+	SessionEvictClosed   SessionEvictReason = "closed"
+)
+
+// SessionEviction describes a session removed from an agent.
+type SessionEviction struct {
+	Session *core.Session
+	Reason  SessionEvictReason
+	// SaveErr is the last save error of a session evicted without being
+	// saved, after session.evict_save_attempts failed saves.
+	SaveErr error
+}
+
+// SessionEvictionHook is called after a session was removed. Sessions can be
+// flushed to a store from here when no session store is configured.
+type SessionEvictionHook func(ctx context.Context, eviction SessionEviction)
+
+// sessionEvictionCandidate is a session chosen for eviction, evicted only if
+// it is saved and was not used in the meantime.
+type sessionEvictionCandidate struct {
+	item     *list.Element
+	lastUsed time.Time
+	reason   SessionEvictReason
+}
+
+type sessionEntry struct {
+	session  *core.Session
+	lastUsed time.Time
+	// saveFailures counts the failed saves of evictions since it was used.
+	saveFailures int
+}
+
+// OnSessionEvicted registers a hook for evicted and closed sessions.
+func (e *SessionExtension) OnSessionEvicted(hook SessionEvictionHook) *SessionExtension {
+	e.mu.Lock()
+	e.evictionHooks = append(e.evictionHooks, hook)
+	e.mu.Unlock()
+	return e
+}
+
+// ListSessions returns the IDs of the sessions in memory, most recently used
+// first. Stored sessions that were not activated are not listed.
+func (e *SessionExtension) ListSessions() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	ids := make([]string, 0, e.lru.Len())
+	for item := e.lru.Front(); item != nil; item = item.Next() {
+		ids = append(ids, item.Value.(*sessionEntry).session.ID())
+	}
+	return ids
+}
+
+// CloseSession saves sessionID to the session store, if any, and removes it
+// from memory, deactivating it when it is active. It stays in memory when
+// saving fails.
+func (e *SessionExtension) CloseSession(ctx context.Context, sessionID string) error {
+	e.mu.RLock()
+	item, ok := e.sessions[sessionID]
+	store := e.store
+	e.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	session := item.Value.(*sessionEntry).session
+	if store != nil {
+		if err := core.SaveSessionToStore(ctx, store, session); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	if current, ok := e.sessions[sessionID]; !ok || current != item {
+		e.mu.Unlock()
+		return nil
+	}
+	e.removeLocked(item)
+	wasActive := e.active == session
+	if wasActive {
+		e.active = nil
+	}
+	hooks := append([]SessionEvictionHook{}, e.evictionHooks...)
+	e.mu.Unlock()
+
+	if wasActive {
+		e.clearActiveSession()
+	}
+	for _, hook := range hooks {
+		hook(ctx, SessionEviction{Session: session, Reason: SessionEvictClosed})
+	}
+	return nil
+}
+
+// ForkSession copies the active session under newID and activates the copy.
+// With turn, the copy holds the turns before it, as Session.ForkAtTurn.
+func (e *SessionExtension) ForkSession(ctx context.Context, newID string, turn ...int) error {
+	e.mu.RLock()
+	active, store := e.active, e.store
+	_, exists := e.lookupLocked(newID)
+	e.mu.RUnlock()
+	if active == nil {
+		return fmt.Errorf("no active session to fork")
+	}
+	if exists {
+		return fmt.Errorf("session %s already exists", newID)
+	}
+	if store != nil {
+		if _, err := store.Load(ctx, newID); err == nil {
+			return fmt.Errorf("session %s already exists in the session store", newID)
+		} else if !errors.Is(err, core.ErrSessionNotFound) {
+			return err
+		}
+	}
+	var fork *core.Session
+	if len(turn) > 0 {
+		var err error
+		if fork, err = active.ForkAtTurn(newID, turn[0]); err != nil {
+			return err
+		}
+	} else {
+		fork = active.Fork(newID)
+	}
+	e.activate(ctx, fork)
+	return nil
+}
+
+// EvictIdleSessions removes the inactive sessions idle for longer than
+// session.idle_ttl and returns how many were removed. Activating a session
+// does this as well.
+func (e *SessionExtension) EvictIdleSessions(ctx context.Context) int {
+	e.mu.RLock()
+	candidates := e.collectEvictionsLocked(time.Now())
+	e.mu.RUnlock()
+	return e.runEvictions(ctx, candidates)
+}
+
+// touchLocked adds session as the most recently used one.
+func (e *SessionExtension) touchLocked(session *core.Session) {
+	if item, ok := e.sessions[session.ID()]; ok && item.Value.(*sessionEntry).session == session {
+		item.Value.(*sessionEntry).lastUsed = time.Now()
+		item.Value.(*sessionEntry).saveFailures = 0
+		e.lru.MoveToFront(item)
+		return
+	}
+	if item, ok := e.sessions[session.ID()]; ok {
+		e.lru.Remove(item)
+	}
+	e.sessions[session.ID()] = e.lru.PushFront(&sessionEntry{session: session, lastUsed: time.Now()})
+}
+
+func (e *SessionExtension) lookupLocked(sessionID string) (*core.Session, bool) {
+	item, ok := e.sessions[sessionID]
+	if !ok {
+		return nil, false
+	}
+	return item.Value.(*sessionEntry).session, true
+}
+
+func (e *SessionExtension) removeLocked(item *list.Element) {
+	delete(e.sessions, item.Value.(*sessionEntry).session.ID())
+	e.lru.Remove(item)
+}
+
+// collectEvictionsLocked picks the sessions past session.idle_ttl and, least
+// recently used first, past session.max_sessions. The active session stays.
+func (e *SessionExtension) collectEvictionsLocked(now time.Time) []sessionEvictionCandidate {
+	settings := e.agent.Settings()
+	ttl := core.SessionIdleTTL(settings)
+	maxSessions := core.SessionMaxSessions(settings)
+	candidates := []sessionEvictionCandidate{}
+	remaining := e.lru.Len()
+	for item := e.lru.Back(); item != nil; item = item.Prev() {
+		entry := item.Value.(*sessionEntry)
+		if entry.session == e.active {
+			continue
+		}
+		switch {
+		case ttl > 0 && now.Sub(entry.lastUsed) > ttl:
+			candidates = append(candidates, sessionEvictionCandidate{item: item, lastUsed: entry.lastUsed, reason: SessionEvictIdle})
+			remaining--
+		case maxSessions > 0 && remaining > maxSessions:
+			candidates = append(candidates, sessionEvictionCandidate{item: item, lastUsed: entry.lastUsed, reason: SessionEvictCapacity})
+			remaining--
+		}
+	}
+	return candidates
+}
+
+// runEvictions saves the candidates to the session store, unless
+// session.autosave is false, then removes them and calls the eviction hooks.
+// A session whose save fails stays in memory with a warning, until it failed
+// session.evict_save_attempts times: it is then evicted unsaved, with a
+// warning and SessionEviction.SaveErr set, so a broken store cannot grow
+// memory without bound. A session activated in the meantime stays. It returns
+// how many sessions were removed.
+func (e *SessionExtension) runEvictions(ctx context.Context, candidates []sessionEvictionCandidate) int {
+	if len(candidates) == 0 {
+		return 0
+	}
+	e.mu.RLock()
+	store := e.store
+	hooks := append([]SessionEvictionHook{}, e.evictionHooks...)
+	e.mu.RUnlock()
+	settings := e.agent.Settings()
+	autosave := settings.Get("session.autosave", true, true) != false
+	attempts := core.SessionEvictSaveAttempts(settings)
+	removed := 0
+	for _, candidate := range candidates {
+		entry := candidate.item.Value.(*sessionEntry)
+		session := entry.session
+		meta := map[string]any{"agent_name": e.agent.Name(), "session_id": session.ID()}
+		var saveErr error
+		if store != nil && autosave {
+			saveErr = core.SaveSessionToStore(ctx, store, session)
+		}
+		e.mu.Lock()
+		current, ok := e.sessions[session.ID()]
+		evict := ok && current == candidate.item && session != e.active && entry.lastUsed.Equal(candidate.lastUsed)
+		if evict && saveErr != nil {
+			entry.saveFailures++
+			evict = attempts > 0 && entry.saveFailures >= attempts
+		}
+		if evict {
+			e.removeLocked(current)
+		}
+		e.mu.Unlock()
+		if saveErr != nil {
+			if evict {
+				_ = core.EmitWarning(settings, "Session", meta, fmt.Sprintf("session evicted unsaved after %d failed saves: %v", attempts, saveErr))
+			} else {
+				_ = core.EmitWarning(settings, "Session", meta, fmt.Sprintf("session kept in memory, saving it before eviction failed: %v", saveErr))
+			}
+		}
+		if !evict {
+			continue
+		}
+		removed++
+		for _, hook := range hooks {
+			hook(ctx, SessionEviction{Session: session, Reason: candidate.reason, SaveErr: saveErr})
+		}
+	}
+	return removed
+}
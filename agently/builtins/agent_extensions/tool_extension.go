@@ -2,10 +2,14 @@ package agentextensions
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 
+	"github.com/AgentEra/Agently-Go/agently/builtins/mcp"
 	"github.com/AgentEra/Agently-Go/agently/core"
 	"github.com/AgentEra/Agently-Go/agently/types"
 	"github.com/AgentEra/Agently-Go/agently/utils"
@@ -14,42 +18,296 @@ import (
 type ToolExtension struct {
 	agent *core.BaseAgent
 	tool  *core.Tool
+
+	mu         sync.RWMutex
+	globalTool *core.Tool
 }
 
 func NewToolExtension(agent *core.BaseAgent) *ToolExtension {
 	tool, _ := core.NewTool(agent.PluginManager(), agent.Settings())
 	ext := &ToolExtension{agent: agent, tool: tool}
 	agent.ExtensionHandlers().AppendRequestPrefix(ext.requestPrefix)
+	agent.ExtensionHandlers().AppendBroadcastPrefix(ext.broadcastToolTrace)
+	agent.ExtensionHandlers().SetToolCallHandler(ext.handleToolCalls)
 	return ext
 }
 
 func (e *ToolExtension) Tool() *core.Tool { return e.tool }
 
-func (e *ToolExtension) RegisterTool(info types.ToolInfo, fn any) error {
-	if e.tool == nil || e.tool.Manager() == nil {
-		return errors.New("tool manager not configured")
+// SetToolApprover sets the approver asked before tools marked
+// requires_approval run. Nil removes it, which denies such calls.
+func (e *ToolExtension) SetToolApprover(approver core.ToolApprover) {
+	core.SetToolApprover(e.agent.Settings(), approver)
+}
+
+// UseAsyncToolApproval parks calls that need approval until they are resolved
+// by ID on the returned queue. Pending calls are announced as TOOL_APPROVAL
+// system messages.
+func (e *ToolExtension) UseAsyncToolApproval() *core.ToolApprovalQueue {
+	queue := core.NewToolApprovalQueue(e.agent.Settings())
+	e.SetToolApprover(queue.Approve)
+	return queue
+}
+
+// SetGlobalTool attaches the shared tool registry used by the global scope.
+func (e *ToolExtension) SetGlobalTool(tool *core.Tool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.globalTool = tool
+}
+
+func (e *ToolExtension) GlobalTool() *core.Tool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.globalTool
+}
+
+// RegisterTool registers a tool in the agent scope, or in the scope chosen by
+// WithToolScope. Global tools are shared with other agents but only visible to
+// the agents that registered or used them. Request-scoped tools go to the
+// agent's next response; concurrent handlers should instead register them on
+// their own request from CreateRequest.
+func (e *ToolExtension) RegisterTool(info types.ToolInfo, fn any, options ...any) error {
+	switch parseToolRegisterOptions(options...).Scope {
+	case core.ToolScopeRequest:
+		return e.agent.Request().RegisterTool(info, fn)
+	case core.ToolScopeGlobal:
+		manager, err := e.globalManager()
+		if err != nil {
+			return err
+		}
+		if err := manager.Register(info, fn); err != nil {
+			return err
+		}
+		return manager.Tag([]string{info.Name}, []string{e.globalTag()})
+	default:
+		if e.tool == nil || e.tool.Manager() == nil {
+			return errors.New("tool manager not configured")
+		}
+		if err := e.tool.Manager().Register(info, fn); err != nil {
+			return err
+		}
+		return e.tool.Manager().Tag([]string{info.Name}, []string{e.agentTag()})
 	}
-	if err := e.tool.Manager().Register(info, fn); err != nil {
-		return err
+}
+
+// UnregisterTools removes tools from the agent scope, or from the scope chosen
+// by WithToolScope. Global tools are only detached from this agent.
+func (e *ToolExtension) UnregisterTools(toolNames []string, options ...any) error {
+	switch parseToolRegisterOptions(options...).Scope {
+	case core.ToolScopeRequest:
+		tool, err := e.agent.Request().RequestTool()
+		if err != nil {
+			return err
+		}
+		return core.UnregisterTools(tool.Manager(), toolNames)
+	case core.ToolScopeGlobal:
+		manager, err := e.globalManager()
+		if err != nil {
+			return err
+		}
+		return core.UntagTools(manager, toolNames, []string{e.globalTag()})
+	default:
+		if e.tool == nil || e.tool.Manager() == nil {
+			return errors.New("tool manager not configured")
+		}
+		return core.UnregisterTools(e.tool.Manager(), toolNames)
 	}
-	return e.tool.Manager().Tag([]string{info.Name}, []string{"agent-" + e.agent.Name()})
 }
 
+// UseMCP registers the tools of a connected MCP client in the agent scope, or
+// in the scope chosen by WithToolScope. The tools follow the server's tool
+// list until the returned set is closed.
+func (e *ToolExtension) UseMCP(ctx context.Context, client *mcp.Client, options ...any) (*mcp.ToolSet, error) {
+	switch parseToolRegisterOptions(options...).Scope {
+	case core.ToolScopeRequest:
+		tool, err := e.agent.Request().RequestTool()
+		if err != nil {
+			return nil, err
+		}
+		return mcp.RegisterTools(ctx, client, tool.Manager())
+	case core.ToolScopeGlobal:
+		manager, err := e.globalManager()
+		if err != nil {
+			return nil, err
+		}
+		return mcp.RegisterTools(ctx, client, manager, e.globalTag())
+	}
+	if e.tool == nil || e.tool.Manager() == nil {
+		return nil, errors.New("tool manager not configured")
+	}
+	return mcp.RegisterTools(ctx, client, e.tool.Manager(), e.agentTag())
+}
+
+// UseTools makes registered tools visible to this agent. Names are looked up
+// in the agent registry first, then in the global one.
 func (e *ToolExtension) UseTools(toolNames []string) error {
 	if e.tool == nil || e.tool.Manager() == nil {
 		return errors.New("tool manager not configured")
 	}
-	return e.tool.Manager().Tag(toolNames, []string{"agent-" + e.agent.Name()})
+	local := make([]string, 0, len(toolNames))
+	global := make([]string, 0)
+	for _, name := range toolNames {
+		if _, ok := e.tool.Manager().GetToolFunc(name); ok {
+			local = append(local, name)
+			continue
+		}
+		if manager, err := e.globalManager(); err == nil {
+			if _, ok := manager.GetToolFunc(name); ok {
+				global = append(global, name)
+				continue
+			}
+		}
+		return fmt.Errorf("tool %s not found", name)
+	}
+	if len(global) > 0 {
+		manager, _ := e.globalManager()
+		if err := manager.Tag(global, []string{e.globalTag()}); err != nil {
+			return err
+		}
+	}
+	return e.tool.Manager().Tag(local, []string{e.agentTag()})
 }
 
-func (e *ToolExtension) requestPrefix(ctx context.Context, prompt *core.Prompt, _ *utils.Settings) error {
-	if e.tool == nil || e.tool.Manager() == nil {
-		return nil
+func (e *ToolExtension) agentTag() string { return "agent-" + e.agent.Name() }
+
+// globalTag marks global tools used by this agent. It uses the agent ID so
+// agents sharing a name do not share tools.
+func (e *ToolExtension) globalTag() string { return "agent-id-" + e.agent.ID() }
+
+func (e *ToolExtension) globalManager() (core.ToolManager, error) {
+	global := e.GlobalTool()
+	if global == nil || global.Manager() == nil {
+		return nil, errors.New("global tool manager not configured")
+	}
+	return global.Manager(), nil
+}
+
+// scopedManagers returns the registries visible to a response, widest first,
+// with the tag that selects this agent's tools (empty for all tools).
+func (e *ToolExtension) scopedManagers(settings *utils.Settings) []scopedToolManager {
+	scopes := make([]scopedToolManager, 0, 3)
+	if manager, err := e.globalManager(); err == nil {
+		scopes = append(scopes, scopedToolManager{manager: manager, tags: []string{e.globalTag()}})
+	}
+	if e.tool != nil && e.tool.Manager() != nil {
+		scopes = append(scopes, scopedToolManager{manager: e.tool.Manager(), tags: []string{e.agentTag()}})
+	}
+	if requestTool := core.RequestScopedTool(settings); requestTool != nil && requestTool.Manager() != nil {
+		scopes = append(scopes, scopedToolManager{manager: requestTool.Manager()})
+	}
+	return scopes
+}
+
+type scopedToolManager struct {
+	manager core.ToolManager
+	tags    []string
+}
+
+// visibleTools lists the tools a response may use. Narrower scopes shadow
+// wider ones on name collisions.
+func (e *ToolExtension) visibleTools(settings *utils.Settings) []types.ToolInfo {
+	byName := map[string]types.ToolInfo{}
+	for _, scope := range e.scopedManagers(settings) {
+		for _, info := range scope.manager.GetToolList(scope.tags) {
+			byName[info.Name] = info
+		}
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]types.ToolInfo, 0, len(names))
+	for _, name := range names {
+		out = append(out, byName[name])
+	}
+	return out
+}
+
+// resolveToolManager returns the narrowest registry that exposes name.
+func (e *ToolExtension) resolveToolManager(settings *utils.Settings, name string) core.ToolManager {
+	scopes := e.scopedManagers(settings)
+	for i := len(scopes) - 1; i >= 0; i-- {
+		if _, ok := scopes[i].manager.GetToolInfo(scopes[i].tags)[name]; ok {
+			return scopes[i].manager
+		}
+	}
+	return nil
+}
+
+func (e *ToolExtension) callTool(ctx context.Context, settings *utils.Settings, name string, kwargs map[string]any) (any, error) {
+	manager := e.resolveToolManager(settings, name)
+	if manager == nil {
+		return nil, fmt.Errorf("tool %s not found", name)
+	}
+	return manager.CallTool(core.WithToolCallSettings(ctx, settings), name, kwargs)
+}
+
+// callToolWithKwargsRetry calls a tool and, when its kwargs fail validation
+// and `tool.kwargs.retry` is on, asks the model once for corrected kwargs and
+// calls again. It returns the kwargs of the last attempt.
+func (e *ToolExtension) callToolWithKwargsRetry(ctx context.Context, prompt *core.Prompt, settings *utils.Settings, name string, kwargs map[string]any) (any, map[string]any, error) {
+	result, err := e.callTool(ctx, settings, name, kwargs)
+	var kwargsErr *utils.KwargsError
+	if err == nil || !errors.As(err, &kwargsErr) || !core.ToolKwargsRetry(settings) {
+		return result, kwargs, err
+	}
+	fixed, fixErr := e.fixToolKwargs(ctx, prompt, settings, name, kwargs, kwargsErr)
+	if fixErr != nil {
+		return result, kwargs, err
+	}
+	result, err = e.callTool(ctx, settings, name, fixed)
+	return result, fixed, err
+}
+
+func (e *ToolExtension) fixToolKwargs(ctx context.Context, prompt *core.Prompt, settings *utils.Settings, name string, kwargs map[string]any, kwargsErr *utils.KwargsError) (map[string]any, error) {
+	manager := e.resolveToolManager(settings, name)
+	if manager == nil {
+		return nil, fmt.Errorf("tool %s not found", name)
+	}
+	info := manager.GetToolInfo(nil)[name]
+	fixReq := core.NewModelRequest(e.agent.PluginManager(), e.agent.Name()+"-tool-kwargs-fix", e.agent.Settings(), nil, nil)
+	fixReq.SetPrompt("input", prompt.Get("input", nil, true))
+	fixReq.SetPrompt("info", map[string]any{
+		"tool":            map[string]any{"name": info.Name, "desc": info.Desc, "kwargs": info.Kwargs},
+		"rejected_kwargs": kwargs,
+		"problems":        kwargsErr.Error(),
+	})
+	fixReq.SetPrompt("instruct", "The kwargs you gave to the tool were rejected. Fix every problem listed and return the complete corrected kwargs for the tool.")
+	fixReq.SetPrompt("output", map[string]any{
+		"tool_kwargs": types.OutputTuple{"object", "corrected kwargs for the tool"},
+	})
+	data, err := fixReq.GetData(ctx, core.GetDataOptions{
+		Type:       "parsed",
+		MaxRetries: 1,
+	})
+	if err != nil {
+		return nil, err
 	}
-	toolList := e.tool.Manager().GetToolList([]string{"agent-" + e.agent.Name()})
+	fixed, ok := data.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected kwargs fix %T", data)
+	}
+	return normalizeKwargs(fixed["tool_kwargs"]), nil
+}
+
+func (e *ToolExtension) requestPrefix(ctx context.Context, prompt *core.Prompt, settings *utils.Settings) error {
+	toolList := e.visibleTools(settings)
 	if len(toolList) == 0 {
 		return nil
 	}
+	if core.ToolMode(settings) == core.ToolModeNative {
+		tools := make([]any, 0, len(toolList))
+		for _, info := range toolList {
+			tools = append(tools, utils.ToolInfoToOpenAITool(info))
+		}
+		prompt.Set("options.tools", tools)
+		if prompt.Get("options.tool_choice", nil, true) == nil {
+			prompt.Set("options.tool_choice", "auto")
+		}
+		return nil
+	}
 	entries := make([]any, 0, len(toolList))
 	for _, info := range toolList {
 		entries = append(entries, map[string]any{
@@ -60,13 +318,16 @@ func (e *ToolExtension) requestPrefix(ctx context.Context, prompt *core.Prompt,
 		})
 	}
 	prompt.Set("tools", entries)
-	if err := e.tryRunToolJudgementAndAppendResult(ctx, prompt); err != nil {
+	if core.ToolMode(settings) == core.ToolModeReAct {
+		return e.runReActLoop(ctx, prompt, settings)
+	}
+	if err := e.tryRunToolJudgementAndAppendResult(ctx, prompt, settings); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (e *ToolExtension) tryRunToolJudgementAndAppendResult(ctx context.Context, prompt *core.Prompt) error {
+func (e *ToolExtension) tryRunToolJudgementAndAppendResult(ctx context.Context, prompt *core.Prompt, settings *utils.Settings) error {
 	input := prompt.Get("input", nil, true)
 	if input == nil {
 		return nil
@@ -116,7 +377,7 @@ func (e *ToolExtension) tryRunToolJudgementAndAppendResult(ctx context.Context,
 		purpose = toolName
 	}
 	kwargs := normalizeKwargs(command["tool_kwargs"])
-	toolResult, callErr := e.tool.Manager().CallTool(ctx, toolName, kwargs)
+	toolResult, kwargs, callErr := e.callToolWithKwargsRetry(ctx, prompt, settings, toolName, kwargs)
 	if callErr != nil {
 		toolResult = map[string]any{"error": callErr.Error()}
 	}
@@ -138,6 +399,207 @@ func (e *ToolExtension) tryRunToolJudgementAndAppendResult(ctx context.Context,
 	return nil
 }
 
+// runReActLoop asks the model for one action at a time until it answers
+// "final", repeats an identical call or reaches tool.react.max_steps. Tool
+// observations are collected into action_results for the main request and
+// the full trace is kept on the response settings for broadcastToolTrace.
+func (e *ToolExtension) runReActLoop(ctx context.Context, prompt *core.Prompt, settings *utils.Settings) error {
+	input := prompt.Get("input", nil, true)
+	if input == nil {
+		return nil
+	}
+	maxSteps := core.ToolReActMaxSteps(settings)
+	trace := make([]types.ToolTraceStep, 0, maxSteps)
+	actionResults := map[string]any{}
+	seenCalls := map[string]struct{}{}
+	for step := 1; step <= maxSteps; step++ {
+		plan, err := e.planReActStep(ctx, prompt, trace)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			break
+		}
+		record := types.ToolTraceStep{
+			Step:    step,
+			Thought: strings.TrimSpace(stringOrEmpty(plan["thought"])),
+			Action:  strings.TrimSpace(stringOrEmpty(plan["action"])),
+		}
+		if record.Action == "" || strings.EqualFold(record.Action, "final") {
+			record.Action = "final"
+			trace = append(trace, record)
+			break
+		}
+		record.Kwargs = normalizeKwargs(plan["kwargs"])
+		callKey := reActCallKey(record.Action, record.Kwargs)
+		if _, repeated := seenCalls[callKey]; repeated {
+			record.Error = "repeated identical tool call, loop stopped"
+			trace = append(trace, record)
+			break
+		}
+		seenCalls[callKey] = struct{}{}
+
+		result, fixedKwargs, callErr := e.callToolWithKwargsRetry(ctx, prompt, settings, record.Action, record.Kwargs)
+		record.Kwargs = fixedKwargs
+		if callErr != nil {
+			record.Error = callErr.Error()
+			actionResults[reActResultKey(record)] = map[string]any{"error": record.Error}
+		} else {
+			record.Observation = result
+			actionResults[reActResultKey(record)] = result
+		}
+		if core.IsToolLogsEnabled(settings) {
+			_ = core.EmitSystemMessage(settings, types.SystemEventTool, map[string]any{
+				"step":      record.Step,
+				"thought":   record.Thought,
+				"tool_name": record.Action,
+				"kwargs":    record.Kwargs,
+				"result":    record.Observation,
+				"error":     record.Error,
+			})
+		}
+		trace = append(trace, record)
+	}
+
+	if len(trace) > 0 {
+		settings.SetCover("$tool.react_trace", trace)
+	}
+	if len(actionResults) > 0 {
+		prompt.Set("action_results", actionResults)
+		prompt.Set(
+			"extra_instruction",
+			"NOTICE: MUST QUOTE KEY INFO OR MARK SOURCE (PREFER URL INCLUDED) FROM {action_results} IN REPLY IF YOU USE {action_results} TO IMPROVE REPLY!",
+		)
+	}
+	return nil
+}
+
+func (e *ToolExtension) planReActStep(ctx context.Context, prompt *core.Prompt, trace []types.ToolTraceStep) (map[string]any, error) {
+	planReq := core.NewModelRequest(e.agent.PluginManager(), e.agent.Name()+"-tool-react", e.agent.Settings(), nil, nil)
+	planReq.SetPrompt("input", prompt.Get("input", nil, true))
+	if extraInstruction := prompt.Get("instruct", nil, true); extraInstruction != nil {
+		planReq.SetPrompt("extra instruction", extraInstruction)
+	}
+	planReq.SetPrompt("tools", prompt.Get("tools", []any{}, true))
+	if len(trace) > 0 {
+		previous := make([]any, 0, len(trace))
+		for _, step := range trace {
+			previous = append(previous, map[string]any{
+				"thought":     step.Thought,
+				"action":      step.Action,
+				"kwargs":      step.Kwargs,
+				"observation": step.Observation,
+				"error":       step.Error,
+			})
+		}
+		planReq.SetPrompt("action_results", previous)
+	}
+	planReq.SetPrompt("instruct", "Decide the next step to collect information for responding {input}. Pick ONE tool from {tools} with its kwargs, or \"final\" when {action_results} already cover what is needed. Never repeat a call that is already in {action_results}.")
+	planReq.SetPrompt("output", map[string]any{
+		"thought": types.OutputTuple{"string", "what is known so far and what is still missing"},
+		"action":  types.OutputTuple{"string", "tool name to call next, or \"final\""},
+		"kwargs":  types.OutputTuple{"object", "kwargs for the tool, {} when action is \"final\""},
+	})
+
+	planData, err := planReq.GetData(ctx, core.GetDataOptions{
+		Type:       "parsed",
+		MaxRetries: 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	plan, ok := planData.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected react plan %T", planData)
+	}
+	return plan, nil
+}
+
+// broadcastToolTrace exposes the ReAct trace as the `tool_trace` extra of the
+// response result.
+func (e *ToolExtension) broadcastToolTrace(_ context.Context, _ *types.ModelResult, settings *utils.Settings) ([]types.ResponseMessage, error) {
+	trace, ok := settings.Get("$tool.react_trace", nil, true).([]types.ToolTraceStep)
+	if !ok || len(trace) == 0 {
+		return nil, nil
+	}
+	return []types.ResponseMessage{{
+		Event: types.ResponseEventExtra,
+		Data:  map[string]any{"tool_trace": append([]types.ToolTraceStep(nil), trace...)},
+	}}, nil
+}
+
+func reActCallKey(action string, kwargs map[string]any) string {
+	encoded, _ := json.Marshal(kwargs)
+	return action + ":" + string(encoded)
+}
+
+func reActResultKey(step types.ToolTraceStep) string {
+	return fmt.Sprintf("step %d: %s", step.Step, step.Action)
+}
+
+func stringOrEmpty(value any) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// handleToolCalls executes native tool calls returned by the model
+// concurrently, keeping call order. Calls share one `tool.concurrency` limit
+// whichever manager runs them. Failures are reported in the step so the model
+// can see them.
+func (e *ToolExtension) handleToolCalls(ctx context.Context, calls []types.ToolCall, settings *utils.Settings) ([]types.ToolStep, error) {
+	steps := make([]types.ToolStep, len(calls))
+	managers := make([]core.ToolManager, len(calls))
+	for i, call := range calls {
+		steps[i] = types.ToolStep{CallID: call.ID, Name: call.Name}
+		kwargs, err := core.ParseToolCallArguments(call)
+		if err != nil {
+			steps[i].Error = err.Error()
+			continue
+		}
+		steps[i].Kwargs = kwargs
+		managers[i] = e.resolveToolManager(settings, call.Name)
+		if managers[i] == nil {
+			steps[i].Error = fmt.Sprintf("tool %s not found", call.Name)
+		}
+	}
+
+	concurrency := core.ToolConcurrency(settings)
+	if concurrency <= 0 || concurrency > len(calls) {
+		concurrency = max(len(calls), 1)
+	}
+	ctx = core.WithToolCallSettings(ctx, settings)
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, manager := range managers {
+		if manager == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, manager core.ToolManager) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			steps[i] = core.CallTools(ctx, manager, steps[i:i+1], 1)[0]
+		}(i, manager)
+	}
+	wg.Wait()
+
+	if core.IsToolLogsEnabled(settings) {
+		for _, step := range steps {
+			_ = core.EmitSystemMessage(settings, types.SystemEventTool, map[string]any{
+				"tool_name": step.Name,
+				"kwargs":    step.Kwargs,
+				"call_id":   step.CallID,
+				"result":    step.Result,
+				"error":     step.Error,
+			})
+		}
+	}
+	return steps, nil
+}
+
 func normalizeKwargs(raw any) map[string]any {
 	switch typed := raw.(type) {
 	case map[string]any:
@@ -48,6 +48,8 @@ func (h *SystemMessageHooker) Handler(message types.EventMessage) {
 		h.handleModelMessage(settings, data)
 	case types.SystemEventTool:
 		h.handleToolMessage(settings, data)
+	case types.SystemEventToolApproval:
+		h.handleToolApprovalMessage(settings, data)
 	case types.SystemEventTriggerFlow:
 		h.handleTriggerFlowMessage(settings, data)
 	}
@@ -124,6 +126,23 @@ func (h *SystemMessageHooker) handleToolMessage(settings *utils.Settings, data a
 	h.logger.Info(fmt.Sprintf("%s\n%s", title, body))
 }
 
+func (h *SystemMessageHooker) handleToolApprovalMessage(settings *utils.Settings, data any) {
+	if !core.IsToolLogsEnabled(settings) {
+		return
+	}
+	request, ok := data.(types.ToolApprovalRequest)
+	if !ok {
+		return
+	}
+	title := colorText("[Tool Waiting For Approval]:", "magenta", true, false)
+	body := colorText(formatLogData(map[string]any{
+		"id":     request.ID,
+		"tool":   request.Tool,
+		"kwargs": request.Kwargs,
+	}), "gray", false, false)
+	h.logger.Info(fmt.Sprintf("%s\n%s", title, body))
+}
+
 func (h *SystemMessageHooker) handleTriggerFlowMessage(settings *utils.Settings, data any) {
 	if !core.IsTriggerFlowLogsEnabled(settings) {
 		return
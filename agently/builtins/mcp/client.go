@@ -0,0 +1,405 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultNotifyTimeout = 2 * time.Second
+
+// ErrClientClosed is returned for calls on a closed or disconnected client.
+var ErrClientClosed = errors.New("mcp client closed")
+
+// Implementation identifies an MCP client or server.
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Tool is a tool published by an MCP server.
+type Tool struct {
+	Name         string         `json:"name"`
+	Title        string         `json:"title,omitempty"`
+	Description  string         `json:"description,omitempty"`
+	InputSchema  map[string]any `json:"inputSchema"`
+	OutputSchema map[string]any `json:"outputSchema,omitempty"`
+	Annotations  map[string]any `json:"annotations,omitempty"`
+}
+
+// Content is one content block of a tool result.
+type Content struct {
+	Type     string         `json:"type"`
+	Text     string         `json:"text,omitempty"`
+	Data     string         `json:"data,omitempty"`
+	MimeType string         `json:"mimeType,omitempty"`
+	Resource map[string]any `json:"resource,omitempty"`
+}
+
+// CallToolResult is the result of tools/call.
+type CallToolResult struct {
+	Content           []Content `json:"content"`
+	StructuredContent any       `json:"structuredContent,omitempty"`
+	IsError           bool      `json:"isError,omitempty"`
+}
+
+// Value turns the result into a plain Go value: structured content when the
+// server sent it, otherwise the text of the content blocks. Results flagged
+// with isError become errors.
+func (r *CallToolResult) Value() (any, error) {
+	texts := make([]string, 0, len(r.Content))
+	allText := true
+	for _, content := range r.Content {
+		if content.Type != "text" {
+			allText = false
+			continue
+		}
+		texts = append(texts, content.Text)
+	}
+	if r.IsError {
+		if len(texts) == 0 {
+			return nil, errors.New("mcp tool returned an error")
+		}
+		return nil, errors.New(strings.Join(texts, "\n"))
+	}
+	if r.StructuredContent != nil {
+		return r.StructuredContent, nil
+	}
+	if allText {
+		return strings.Join(texts, "\n"), nil
+	}
+	return r.Content, nil
+}
+
+// ClientOptions configures a Client.
+type ClientOptions struct {
+	ClientInfo Implementation
+}
+
+// ClientOption is a functional option for ClientOptions.
+type ClientOption func(*ClientOptions)
+
+func WithClientInfo(info Implementation) ClientOption {
+	return func(options *ClientOptions) {
+		options.ClientInfo = info
+	}
+}
+
+// Client is an MCP client bound to one server. It is safe for concurrent use.
+type Client struct {
+	name      string
+	transport Transport
+	options   ClientOptions
+
+	nextID  atomic.Int64
+	mu      sync.Mutex
+	pending map[string]chan jsonrpcMessage
+
+	serverInfo      Implementation
+	capabilities    map[string]any
+	instructions    string
+	protocolVersion string
+	toolsChanged    []toolsChangedHandler
+	nextHandlerID   int
+
+	closeOnce sync.Once
+	done      chan struct{}
+	closeErr  error
+}
+
+// NewClient creates a client for the server reachable through transport. The
+// name identifies the server in tool tags.
+func NewClient(name string, transport Transport, options ...ClientOption) *Client {
+	config := ClientOptions{ClientInfo: Implementation{Name: "agently-go", Version: "1.0.0"}}
+	for _, option := range options {
+		if option != nil {
+			option(&config)
+		}
+	}
+	return &Client{
+		name:      name,
+		transport: transport,
+		options:   config,
+		pending:   map[string]chan jsonrpcMessage{},
+		done:      make(chan struct{}),
+	}
+}
+
+// NewStdioClient creates a client that spawns the server as a subprocess.
+func NewStdioClient(name string, command string, args []string, options ...ClientOption) *Client {
+	return NewClient(name, NewStdioTransport(command, args...), options...)
+}
+
+// NewHTTPClient creates a client for a streamable HTTP server endpoint.
+func NewHTTPClient(name string, url string, options ...ClientOption) *Client {
+	return NewClient(name, NewHTTPTransport(url), options...)
+}
+
+func (c *Client) Name() string { return c.name }
+
+func (c *Client) Transport() Transport { return c.transport }
+
+func (c *Client) ServerInfo() Implementation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.serverInfo
+}
+
+func (c *Client) Instructions() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.instructions
+}
+
+// Connect starts the transport and runs the initialize handshake.
+func (c *Client) Connect(ctx context.Context) error {
+	if err := c.transport.Start(ctx, c.receive, c.disconnected); err != nil {
+		return err
+	}
+	var result struct {
+		ProtocolVersion string         `json:"protocolVersion"`
+		Capabilities    map[string]any `json:"capabilities"`
+		ServerInfo      Implementation `json:"serverInfo"`
+		Instructions    string         `json:"instructions"`
+	}
+	err := c.call(ctx, "initialize", map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      c.options.ClientInfo,
+	}, &result)
+	if err != nil {
+		_ = c.Close()
+		return fmt.Errorf("mcp initialize %s: %w", c.name, err)
+	}
+	c.mu.Lock()
+	c.serverInfo = result.ServerInfo
+	c.capabilities = result.Capabilities
+	c.instructions = result.Instructions
+	c.protocolVersion = result.ProtocolVersion
+	c.mu.Unlock()
+
+	httpTransport, isHTTP := c.transport.(*HTTPTransport)
+	if isHTTP {
+		httpTransport.setProtocolVersion(result.ProtocolVersion)
+	}
+	if err := c.notify(ctx, "notifications/initialized", nil); err != nil {
+		_ = c.Close()
+		return err
+	}
+	if isHTTP {
+		httpTransport.listen()
+	}
+	return nil
+}
+
+// ListTools returns every tool of the server, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	tools := make([]Tool, 0)
+	cursor := ""
+	for {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var page struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := c.call(ctx, "tools/list", params, &page); err != nil {
+			return nil, err
+		}
+		tools = append(tools, page.Tools...)
+		if page.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CallTool invokes a server tool. Cancelling ctx sends a cancellation
+// notification to the server.
+func (c *Client) CallTool(ctx context.Context, name string, arguments map[string]any) (*CallToolResult, error) {
+	if arguments == nil {
+		arguments = map[string]any{}
+	}
+	result := &CallToolResult{}
+	if err := c.call(ctx, "tools/call", map[string]any{"name": name, "arguments": arguments}, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+type toolsChangedHandler struct {
+	id int
+	fn func()
+}
+
+// OnToolsChanged registers a callback for notifications/tools/list_changed.
+// The returned function removes it.
+func (c *Client) OnToolsChanged(handler func()) (remove func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextHandlerID++
+	id := c.nextHandlerID
+	c.toolsChanged = append(c.toolsChanged, toolsChangedHandler{id: id, fn: handler})
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.toolsChanged = slices.DeleteFunc(c.toolsChanged, func(h toolsChangedHandler) bool { return h.id == id })
+	}
+}
+
+// Done is closed when the client is closed or the server goes away.
+func (c *Client) Done() <-chan struct{} { return c.done }
+
+func (c *Client) Close() error {
+	err := c.transport.Close()
+	c.disconnected(nil)
+	return err
+}
+
+func (c *Client) call(ctx context.Context, method string, params any, result any) error {
+	select {
+	case <-c.done:
+		return c.closedError()
+	default:
+	}
+	id := json.RawMessage(fmt.Sprintf("%d", c.nextID.Add(1)))
+	encodedParams, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	message, err := json.Marshal(jsonrpcMessage{JSONRPC: "2.0", ID: id, Method: method, Params: encodedParams})
+	if err != nil {
+		return err
+	}
+	reply := make(chan jsonrpcMessage, 1)
+	c.mu.Lock()
+	c.pending[idKey(id)] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, idKey(id))
+		c.mu.Unlock()
+	}()
+
+	sendErr := make(chan error, 1)
+	go func() { sendErr <- c.transport.Send(ctx, message) }()
+
+	for {
+		select {
+		case response := <-reply:
+			if response.Error != nil {
+				return response.Error
+			}
+			if result == nil || len(response.Result) == 0 {
+				return nil
+			}
+			return json.Unmarshal(response.Result, result)
+		case err := <-sendErr:
+			if err != nil {
+				return err
+			}
+			sendErr = nil
+		case <-ctx.Done():
+			notifyCtx, cancel := context.WithTimeout(context.Background(), defaultNotifyTimeout)
+			_ = c.notify(notifyCtx, "notifications/cancelled", map[string]any{
+				"requestId": json.RawMessage(id),
+				"reason":    ctx.Err().Error(),
+			})
+			cancel()
+			return ctx.Err()
+		case <-c.done:
+			return c.closedError()
+		}
+	}
+}
+
+func (c *Client) notify(ctx context.Context, method string, params any) error {
+	message := jsonrpcMessage{JSONRPC: "2.0", Method: method}
+	if params != nil {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		message.Params = encoded
+	}
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return c.transport.Send(ctx, encoded)
+}
+
+func (c *Client) receive(data []byte) {
+	messages, err := decodeMessages(data)
+	if err != nil {
+		return
+	}
+	for _, message := range messages {
+		switch {
+		case message.isResponse():
+			c.mu.Lock()
+			reply, ok := c.pending[idKey(message.ID)]
+			c.mu.Unlock()
+			if ok {
+				reply <- message
+			}
+		case message.isRequest():
+			go c.answerServerRequest(message)
+		case message.isNotification():
+			if message.Method == "notifications/tools/list_changed" {
+				c.mu.Lock()
+				handlers := append([]toolsChangedHandler{}, c.toolsChanged...)
+				c.mu.Unlock()
+				for _, handler := range handlers {
+					go handler.fn()
+				}
+			}
+		}
+	}
+}
+
+// answerServerRequest replies to requests the server sends to the client.
+// Only ping is supported.
+func (c *Client) answerServerRequest(message jsonrpcMessage) {
+	var (
+		response []byte
+		err      error
+	)
+	if message.Method == "ping" {
+		response, err = encodeResponse(message.ID, map[string]any{}, nil)
+	} else {
+		response, err = encodeResponse(message.ID, nil, &RPCError{Code: codeMethodNotFound, Message: "method not found: " + message.Method})
+	}
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultNotifyTimeout)
+	defer cancel()
+	_ = c.transport.Send(ctx, response)
+}
+
+func (c *Client) disconnected(err error) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closeErr = err
+		c.mu.Unlock()
+		close(c.done)
+	})
+}
+
+func (c *Client) closedError() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closeErr != nil {
+		return fmt.Errorf("%w: %v", ErrClientClosed, c.closeErr)
+	}
+	return ErrClientClosed
+}
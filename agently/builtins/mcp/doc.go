@@ -0,0 +1,7 @@
+// Package mcp connects Agently tools with the Model Context Protocol.
+//
+// Client talks to MCP servers over stdio or streamable HTTP, and ToolSet keeps
+// a core.ToolManager in sync with the tools a server publishes. Server goes the
+// other way and publishes a core.ToolManager, plus optional agents, to MCP
+// hosts.
+package mcp
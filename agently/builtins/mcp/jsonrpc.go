@@ -0,0 +1,81 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ProtocolVersion is the MCP revision requested during initialize.
+const ProtocolVersion = "2025-06-18"
+
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+type jsonrpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+func (m jsonrpcMessage) isRequest() bool      { return m.Method != "" && len(m.ID) > 0 }
+func (m jsonrpcMessage) isNotification() bool { return m.Method != "" && len(m.ID) == 0 }
+func (m jsonrpcMessage) isResponse() bool     { return m.Method == "" && len(m.ID) > 0 }
+
+// RPCError is a JSON-RPC error returned by the peer.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+// decodeMessages accepts a single JSON-RPC message or a batch.
+func decodeMessages(data []byte) ([]jsonrpcMessage, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(trimmed, "[") {
+		batch := make([]jsonrpcMessage, 0)
+		if err := json.Unmarshal([]byte(trimmed), &batch); err != nil {
+			return nil, err
+		}
+		return batch, nil
+	}
+	var message jsonrpcMessage
+	if err := json.Unmarshal([]byte(trimmed), &message); err != nil {
+		return nil, err
+	}
+	return []jsonrpcMessage{message}, nil
+}
+
+func idKey(id json.RawMessage) string {
+	return strings.TrimSpace(string(id))
+}
+
+func encodeResponse(id json.RawMessage, result any, rpcErr *RPCError) ([]byte, error) {
+	message := jsonrpcMessage{JSONRPC: "2.0", ID: id, Error: rpcErr}
+	if rpcErr == nil {
+		if result == nil {
+			result = map[string]any{}
+		}
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		message.Result = encoded
+	}
+	return json.Marshal(message)
+}
@@ -0,0 +1,641 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AgentEra/Agently-Go/agently/core"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+const (
+	codeRequestCancelled = -32800
+
+	// DefaultSessionIdleTimeout is how long an HTTP session may sit unused
+	// before it is dropped.
+	DefaultSessionIdleTimeout = 30 * time.Minute
+
+	// DefaultMaxRequestBytes caps the body of an HTTP request.
+	DefaultMaxRequestBytes = 4 << 20
+)
+
+// supportedProtocolVersions are the MCP revisions the server accepts during
+// initialize, newest first.
+var supportedProtocolVersions = []string{ProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// ServerOptions configures a Server.
+type ServerOptions struct {
+	// Tags limits the published tools to those carrying any of the tags.
+	// Empty publishes every tool of the manager.
+	Tags         []string
+	Instructions string
+	// AllowedOrigins lists the browser origins, such as
+	// "https://app.example.com", that may call the HTTP transport. Requests
+	// without an Origin header and same-origin requests are always accepted;
+	// "*" accepts any origin.
+	AllowedOrigins []string
+	// SessionIdleTimeout drops HTTP sessions with no request, running tool or
+	// open notification stream for this long. Defaults to
+	// DefaultSessionIdleTimeout; negative keeps sessions until DELETE.
+	SessionIdleTimeout time.Duration
+	// MaxRequestBytes caps the body of an HTTP POST; larger requests get 413.
+	// Defaults to DefaultMaxRequestBytes; negative removes the cap.
+	MaxRequestBytes int64
+}
+
+// ServerOption is a functional option for ServerOptions.
+type ServerOption func(*ServerOptions)
+
+func WithToolTags(tags ...string) ServerOption {
+	return func(options *ServerOptions) {
+		options.Tags = tags
+	}
+}
+
+func WithInstructions(instructions string) ServerOption {
+	return func(options *ServerOptions) {
+		options.Instructions = instructions
+	}
+}
+
+func WithAllowedOrigins(origins ...string) ServerOption {
+	return func(options *ServerOptions) {
+		options.AllowedOrigins = origins
+	}
+}
+
+func WithSessionIdleTimeout(timeout time.Duration) ServerOption {
+	return func(options *ServerOptions) {
+		options.SessionIdleTimeout = timeout
+	}
+}
+
+func WithMaxRequestBytes(limit int64) ServerOption {
+	return func(options *ServerOptions) {
+		options.MaxRequestBytes = limit
+	}
+}
+
+// Server publishes the tools of a ToolManager, and optionally agents, to MCP
+// hosts over stdio (ServeStdio) or streamable HTTP (ServeHTTP).
+type Server struct {
+	info    Implementation
+	manager core.ToolManager
+	options ServerOptions
+
+	mu       sync.Mutex
+	agents   map[string]agentTool
+	sessions map[string]*serverSession
+}
+
+type agentTool struct {
+	description string
+	agent       *core.BaseAgent
+}
+
+type serverSession struct {
+	id            string
+	mu            sync.Mutex
+	inflight      map[string]context.CancelFunc
+	notifications chan []byte
+	// lastUsed and streams are guarded by mu and drive idle expiry.
+	lastUsed time.Time
+	streams  int
+}
+
+func newServerSession(id string) *serverSession {
+	return &serverSession{
+		id:            id,
+		inflight:      map[string]context.CancelFunc{},
+		notifications: make(chan []byte, 16),
+		lastUsed:      time.Now(),
+	}
+}
+
+func (session *serverSession) touch() {
+	session.mu.Lock()
+	session.lastUsed = time.Now()
+	session.mu.Unlock()
+}
+
+// idle reports a session with nothing running that was last used before
+// cutoff.
+func (session *serverSession) idle(cutoff time.Time) bool {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.streams == 0 && len(session.inflight) == 0 && session.lastUsed.Before(cutoff)
+}
+
+func NewServer(info Implementation, manager core.ToolManager, options ...ServerOption) *Server {
+	config := ServerOptions{SessionIdleTimeout: DefaultSessionIdleTimeout}
+	for _, option := range options {
+		if option != nil {
+			option(&config)
+		}
+	}
+	if config.MaxRequestBytes == 0 {
+		config.MaxRequestBytes = DefaultMaxRequestBytes
+	}
+	return &Server{
+		info:     info,
+		manager:  manager,
+		options:  config,
+		agents:   map[string]agentTool{},
+		sessions: map[string]*serverSession{},
+	}
+}
+
+// AddAgent publishes an agent as a tool that takes an `input` string and
+// returns the agent's text reply. Each call runs on a fresh request that
+// inherits the agent prompt and extension handlers.
+func (s *Server) AddAgent(name string, description string, agent *core.BaseAgent) {
+	s.mu.Lock()
+	s.agents[name] = agentTool{description: description, agent: agent}
+	s.mu.Unlock()
+	s.NotifyToolsChanged()
+}
+
+// NotifyToolsChanged tells connected hosts to re-list the tools. Call it after
+// registering or removing tools in the manager.
+func (s *Server) NotifyToolsChanged() {
+	message, _ := json.Marshal(jsonrpcMessage{JSONRPC: "2.0", Method: "notifications/tools/list_changed"})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, session := range s.sessions {
+		select {
+		case session.notifications <- message:
+		default:
+		}
+	}
+}
+
+func (s *Server) tools() []Tool {
+	tools := make([]Tool, 0)
+	if s.manager != nil {
+		for _, info := range s.manager.GetToolList(s.options.Tags) {
+			tools = append(tools, Tool{
+				Name:        info.Name,
+				Description: info.Desc,
+				InputSchema: utils.KwargsToJSONSchema(info.Kwargs),
+			})
+		}
+	}
+	s.mu.Lock()
+	for name, agent := range s.agents {
+		tools = append(tools, Tool{
+			Name:        name,
+			Description: agent.description,
+			InputSchema: utils.KwargsToJSONSchema(map[string]any{"input": []any{"string", "message for the agent"}}),
+		})
+	}
+	s.mu.Unlock()
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools
+}
+
+func (s *Server) hasTool(name string) bool {
+	s.mu.Lock()
+	_, isAgent := s.agents[name]
+	s.mu.Unlock()
+	if isAgent {
+		return true
+	}
+	if s.manager == nil {
+		return false
+	}
+	_, ok := s.manager.GetToolInfo(s.options.Tags)[name]
+	return ok
+}
+
+func (s *Server) callTool(ctx context.Context, name string, arguments map[string]any) (any, error) {
+	s.mu.Lock()
+	agent, isAgent := s.agents[name]
+	s.mu.Unlock()
+	if isAgent {
+		request := agent.agent.CreateRequest(name, core.InheritAgentPrompt(), core.InheritExtensionHandlers())
+		request.Input(arguments["input"])
+		return request.GetTextWithContext(ctx)
+	}
+	return s.manager.CallTool(ctx, name, arguments)
+}
+
+// handle processes one incoming message. It returns the encoded response, or
+// nil for notifications and requests cancelled by the client.
+func (s *Server) handle(ctx context.Context, session *serverSession, message jsonrpcMessage) []byte {
+	if message.isNotification() {
+		if message.Method == "notifications/cancelled" {
+			var params struct {
+				RequestID json.RawMessage `json:"requestId"`
+			}
+			if json.Unmarshal(message.Params, &params) == nil {
+				session.mu.Lock()
+				if cancel, ok := session.inflight[idKey(params.RequestID)]; ok {
+					cancel()
+				}
+				session.mu.Unlock()
+			}
+		}
+		return nil
+	}
+	if !message.isRequest() {
+		return nil
+	}
+
+	var (
+		result any
+		rpcErr *RPCError
+	)
+	switch message.Method {
+	case "initialize":
+		result = s.initializeResult(message.Params)
+	case "ping":
+		result = map[string]any{}
+	case "tools/list":
+		result = map[string]any{"tools": s.tools()}
+	case "tools/call":
+		requestCtx, cancel := context.WithCancel(ctx)
+		key := idKey(message.ID)
+		session.mu.Lock()
+		session.inflight[key] = cancel
+		session.mu.Unlock()
+		result, rpcErr = s.handleToolCall(requestCtx, message.Params)
+		session.mu.Lock()
+		delete(session.inflight, key)
+		session.mu.Unlock()
+		cancelled := requestCtx.Err() != nil && ctx.Err() == nil
+		cancel()
+		if cancelled {
+			return nil
+		}
+	default:
+		rpcErr = &RPCError{Code: codeMethodNotFound, Message: "method not found: " + message.Method}
+	}
+	response, err := encodeResponse(message.ID, result, rpcErr)
+	if err != nil {
+		response, _ = encodeResponse(message.ID, nil, &RPCError{Code: codeInternalError, Message: err.Error()})
+	}
+	return response
+}
+
+func (s *Server) initializeResult(rawParams json.RawMessage) map[string]any {
+	var params struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	_ = json.Unmarshal(rawParams, &params)
+	version := ProtocolVersion
+	for _, supported := range supportedProtocolVersions {
+		if params.ProtocolVersion == supported {
+			version = supported
+		}
+	}
+	result := map[string]any{
+		"protocolVersion": version,
+		"capabilities":    map[string]any{"tools": map[string]any{"listChanged": true}},
+		"serverInfo":      s.info,
+	}
+	if s.options.Instructions != "" {
+		result["instructions"] = s.options.Instructions
+	}
+	return result
+}
+
+// handleToolCall runs a tool. Tool failures are reported in the result with
+// isError so the host's model can see them; unknown tools are protocol errors.
+func (s *Server) handleToolCall(ctx context.Context, rawParams json.RawMessage) (any, *RPCError) {
+	var params struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	}
+	if err := json.Unmarshal(rawParams, &params); err != nil {
+		return nil, &RPCError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	if !s.hasTool(params.Name) {
+		return nil, &RPCError{Code: codeInvalidParams, Message: "unknown tool: " + params.Name}
+	}
+	value, err := s.callTool(ctx, params.Name, params.Arguments)
+	if err != nil {
+		return CallToolResult{Content: []Content{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+	}
+	return toolResultFromValue(value), nil
+}
+
+func toolResultFromValue(value any) CallToolResult {
+	if text, ok := value.(string); ok {
+		return CallToolResult{Content: []Content{{Type: "text", Text: text}}}
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return CallToolResult{Content: []Content{{Type: "text", Text: fmt.Sprint(value)}}}
+	}
+	result := CallToolResult{Content: []Content{{Type: "text", Text: string(encoded)}}}
+	if isJSONObject(value) {
+		var structured map[string]any
+		if json.Unmarshal(encoded, &structured) == nil {
+			result.StructuredContent = structured
+		}
+	}
+	return result
+}
+
+func isJSONObject(value any) bool {
+	if value == nil {
+		return false
+	}
+	t := reflect.TypeOf(value)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Map || t.Kind() == reflect.Struct
+}
+
+// ServeStdio serves one host over newline-delimited JSON until in ends or ctx
+// is done. Requests run concurrently; cancelling ctx cancels running tools.
+func (s *Server) ServeStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	session := newServerSession(newSessionID())
+	// The session counts as streaming while ServeStdio runs, so it never
+	// expires as idle.
+	session.streams++
+	s.addSession(session)
+	defer s.removeSession(session.id)
+
+	var writeMu sync.Mutex
+	write := func(message []byte) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		_, _ = out.Write(append(message, '\n'))
+	}
+	go func() {
+		for {
+			select {
+			case message := <-session.notifications:
+				write(message)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(strings.TrimSpace(string(line))) > 0 {
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					err = nil
+				}
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		select {
+		case line := <-lines:
+			messages, err := decodeMessages(line)
+			if err != nil {
+				response, _ := encodeResponse(json.RawMessage("null"), nil, &RPCError{Code: codeParseError, Message: err.Error()})
+				write(response)
+				continue
+			}
+			for _, message := range messages {
+				wg.Add(1)
+				go func(message jsonrpcMessage) {
+					defer wg.Done()
+					if response := s.handle(ctx, session, message); response != nil {
+						write(response)
+					}
+				}(message)
+			}
+		case err := <-readErr:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ServeHTTP implements the streamable HTTP transport on a single endpoint:
+// POST carries client messages, GET opens the notification stream and DELETE
+// ends the session.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.allowedOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodPost {
+		s.servePost(w, r)
+		return
+	}
+	session := s.session(r.Header.Get("Mcp-Session-Id"))
+	if session == nil {
+		http.Error(w, "unknown or missing Mcp-Session-Id", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusMethodNotAllowed)
+			return
+		}
+		session.mu.Lock()
+		session.streams++
+		session.mu.Unlock()
+		defer func() {
+			session.mu.Lock()
+			session.streams--
+			session.lastUsed = time.Now()
+			session.mu.Unlock()
+		}()
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		for {
+			select {
+			case message := <-session.notifications:
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", message)
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	case http.MethodDelete:
+		s.removeSession(session.id)
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) servePost(w http.ResponseWriter, r *http.Request) {
+	if s.options.MaxRequestBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.options.MaxRequestBytes)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	messages, err := decodeMessages(body)
+	if err != nil || len(messages) == 0 {
+		response, _ := encodeResponse(json.RawMessage("null"), nil, &RPCError{Code: codeParseError, Message: "invalid JSON-RPC message"})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(response)
+		return
+	}
+
+	var session *serverSession
+	if len(messages) == 1 && messages[0].Method == "initialize" {
+		session = newServerSession(newSessionID())
+		s.addSession(session)
+		w.Header().Set("Mcp-Session-Id", session.id)
+	} else if session = s.session(r.Header.Get("Mcp-Session-Id")); session == nil {
+		http.Error(w, "unknown or missing Mcp-Session-Id", http.StatusNotFound)
+		return
+	}
+
+	defer session.touch()
+	responses := make([][]byte, 0, len(messages))
+	for _, message := range messages {
+		response := s.handle(r.Context(), session, message)
+		if response == nil && message.isRequest() {
+			response, _ = encodeResponse(message.ID, nil, &RPCError{Code: codeRequestCancelled, Message: "request cancelled"})
+		}
+		if response != nil {
+			responses = append(responses, response)
+		}
+	}
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if len(responses) == 1 {
+		_, _ = w.Write(responses[0])
+		return
+	}
+	_, _ = w.Write([]byte("[" + string(joinMessages(responses)) + "]"))
+}
+
+func joinMessages(messages [][]byte) []byte {
+	parts := make([]string, 0, len(messages))
+	for _, message := range messages {
+		parts = append(parts, string(message))
+	}
+	return []byte(strings.Join(parts, ","))
+}
+
+// allowedOrigin guards against DNS rebinding and cross-site requests from
+// browsers: an Origin must match the request host or AllowedOrigins.
+func (s *Server) allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range s.options.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	return strings.EqualFold(parsed.Host, r.Host)
+}
+
+func (s *Server) addSession(session *serverSession) {
+	s.expireSessions()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.id] = session
+}
+
+// expireSessions removes sessions idle for longer than SessionIdleTimeout.
+func (s *Server) expireSessions() {
+	if s.options.SessionIdleTimeout <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-s.options.SessionIdleTimeout)
+	s.mu.Lock()
+	expired := make([]string, 0)
+	for id, session := range s.sessions {
+		if session.idle(cutoff) {
+			expired = append(expired, id)
+		}
+	}
+	s.mu.Unlock()
+	for _, id := range expired {
+		s.removeSession(id)
+	}
+}
+
+func (s *Server) removeSession(id string) {
+	s.mu.Lock()
+	session, ok := s.sessions[id]
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	for _, cancel := range session.inflight {
+		cancel()
+	}
+}
+
+func (s *Server) session(id string) *serverSession {
+	if id == "" {
+		return nil
+	}
+	s.expireSessions()
+	s.mu.Lock()
+	session := s.sessions[id]
+	s.mu.Unlock()
+	if session != nil {
+		session.touch()
+	}
+	return session
+}
+
+func newSessionID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,202 @@
+package mcp
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AgentEra/Agently-Go/agently/core"
+	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+// ToolSet keeps the tools of one MCP server registered in a ToolManager.
+// Calls through ToolManager.CallTool are routed to the server, and the set is
+// refreshed whenever the server reports a changed tool list.
+//
+// The set only replaces or removes tools it registered itself. A server tool
+// whose name is taken by another tool is registered as `<client name>_<tool>`;
+// if that name is taken too, `tool.name_collision` of the manager decides.
+type ToolSet struct {
+	client  *Client
+	manager core.ToolManager
+	tags    []string
+	ownTag  string
+
+	mu sync.Mutex
+	// names maps server tool names to the names registered in the manager.
+	names  map[string]string
+	closed bool
+	// stopWatching removes the set's OnToolsChanged callback from the client.
+	stopWatching func()
+}
+
+// RegisterTools lists the server's tools and registers them in manager with
+// the given tags plus `mcp-<client name>`.
+func RegisterTools(ctx context.Context, client *Client, manager core.ToolManager, tags ...string) (*ToolSet, error) {
+	ownTag := "mcp-" + client.Name()
+	set := &ToolSet{
+		client:  client,
+		manager: manager,
+		tags:    append(append([]string{}, tags...), ownTag),
+		ownTag:  ownTag,
+		names:   map[string]string{},
+	}
+	if err := set.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	stopWatching := client.OnToolsChanged(func() {
+		refreshCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = set.Refresh(refreshCtx)
+	})
+	set.mu.Lock()
+	set.stopWatching = stopWatching
+	set.mu.Unlock()
+	return set, nil
+}
+
+// Refresh re-lists the server's tools, registering new or changed ones and
+// removing the ones the server dropped. Tools the set already owns are
+// replaced in place, so they stay callable during a refresh. Refresh does
+// nothing once the set is closed.
+func (s *ToolSet) Refresh(ctx context.Context) error {
+	tools, err := s.client.ListTools(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	current := map[string]string{}
+	for _, tool := range tools {
+		name := s.registrationNameLocked(tool.Name)
+		info := ToolInfoFromMCP(tool, s.tags...)
+		info.Name = name
+		if s.ownsLocked(name) {
+			err = core.ReplaceTool(s.manager, info, s.toolFunc(tool.Name))
+		} else {
+			err = s.manager.Register(info, s.toolFunc(tool.Name))
+		}
+		if err != nil {
+			return err
+		}
+		// The "keep" collision policy leaves the other tool in place.
+		if s.ownsLocked(name) {
+			current[tool.Name] = name
+		}
+	}
+	for serverName, name := range s.names {
+		if current[serverName] != name && s.ownsLocked(name) {
+			_ = core.UnregisterTools(s.manager, []string{name})
+		}
+	}
+	s.names = current
+	return nil
+}
+
+// registrationNameLocked returns the name a server tool is registered under:
+// the name it had, its own name when free, or the server-prefixed name.
+func (s *ToolSet) registrationNameLocked(serverName string) string {
+	if name, ok := s.names[serverName]; ok && s.ownsLocked(name) {
+		return name
+	}
+	if _, taken := s.manager.GetToolInfo(nil)[serverName]; !taken || s.ownsLocked(serverName) {
+		return serverName
+	}
+	return toolNamePrefix(s.client.Name()) + "_" + serverName
+}
+
+// ownsLocked reports whether name is registered in the manager by this set,
+// recognized by the `mcp-<client name>` tag in its ToolInfo. Tag mappings are
+// not enough: they outlive a tool replaced under the same name.
+func (s *ToolSet) ownsLocked(name string) bool {
+	info, ok := s.manager.GetToolInfo(nil)[name]
+	return ok && slices.Contains(info.Tags, s.ownTag)
+}
+
+// Names returns the registered tool names in order.
+func (s *ToolSet) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.names))
+	for _, name := range s.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close stops following the server's tool list and unregisters the tools the
+// set still owns. It does not close the client.
+func (s *ToolSet) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.stopWatching != nil {
+		s.stopWatching()
+		s.stopWatching = nil
+	}
+	names := make([]string, 0, len(s.names))
+	for _, name := range s.names {
+		if s.ownsLocked(name) {
+			names = append(names, name)
+		}
+	}
+	s.names = map[string]string{}
+	if len(names) == 0 {
+		return nil
+	}
+	return core.UnregisterTools(s.manager, names)
+}
+
+func (s *ToolSet) toolFunc(name string) func(context.Context, map[string]any) (any, error) {
+	return func(ctx context.Context, kwargs map[string]any) (any, error) {
+		result, err := s.client.CallTool(ctx, name, kwargs)
+		if err != nil {
+			return nil, err
+		}
+		return result.Value()
+	}
+}
+
+// ToolInfoFromMCP converts an MCP tool description into a ToolInfo.
+func ToolInfoFromMCP(tool Tool, tags ...string) types.ToolInfo {
+	desc := tool.Description
+	if desc == "" {
+		desc = tool.Title
+	}
+	info := types.ToolInfo{
+		Name:   tool.Name,
+		Desc:   desc,
+		Kwargs: utils.JSONSchemaToKwargs(tool.InputSchema),
+		Tags:   append([]string{}, tags...),
+	}
+	if len(tool.OutputSchema) > 0 {
+		info.Returns = utils.JSONSchemaToKwargs(tool.OutputSchema)
+	}
+	return info
+}
+
+// toolNamePrefix keeps the characters of a client name that model APIs accept
+// in tool names.
+func toolNamePrefix(clientName string) string {
+	prefix := strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, clientName)
+	if prefix == "" {
+		return "mcp"
+	}
+	return prefix
+}
@@ -0,0 +1,325 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transport moves raw JSON-RPC messages between a Client and a server.
+// Start delivers every incoming message to receive and calls closed once when
+// the connection ends.
+type Transport interface {
+	Start(ctx context.Context, receive func([]byte), closed func(error)) error
+	Send(ctx context.Context, message []byte) error
+	Close() error
+}
+
+// StdioTransport runs the server as a subprocess and exchanges
+// newline-delimited JSON over its stdin and stdout.
+type StdioTransport struct {
+	Command string
+	Args    []string
+	Env     []string
+	Dir     string
+	// Stderr receives the server's stderr. Nil discards it.
+	Stderr io.Writer
+
+	mu    sync.Mutex
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	done  chan struct{}
+}
+
+func NewStdioTransport(command string, args ...string) *StdioTransport {
+	return &StdioTransport{Command: command, Args: args}
+}
+
+func (t *StdioTransport) Start(_ context.Context, receive func([]byte), closed func(error)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cmd != nil {
+		return errors.New("stdio transport already started")
+	}
+	cmd := exec.Command(t.Command, t.Args...)
+	cmd.Dir = t.Dir
+	if len(t.Env) > 0 {
+		cmd.Env = append(os.Environ(), t.Env...)
+	}
+	cmd.Stderr = t.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start mcp server %s: %w", t.Command, err)
+	}
+	t.cmd, t.stdin, t.done = cmd, stdin, make(chan struct{})
+
+	go func() {
+		reader := bufio.NewReader(stdout)
+		var readErr error
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				receive(line)
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					readErr = err
+				}
+				break
+			}
+		}
+		waitErr := cmd.Wait()
+		close(t.done)
+		if readErr == nil {
+			readErr = waitErr
+		}
+		closed(readErr)
+	}()
+	return nil
+}
+
+func (t *StdioTransport) Send(_ context.Context, message []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stdin == nil {
+		return errors.New("stdio transport not started")
+	}
+	if _, err := t.stdin.Write(append(bytes.TrimSpace(message), '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Close closes the server's stdin and kills it if it does not exit promptly.
+func (t *StdioTransport) Close() error {
+	t.mu.Lock()
+	stdin, cmd, done := t.stdin, t.cmd, t.done
+	t.stdin = nil
+	t.mu.Unlock()
+	if cmd == nil {
+		return nil
+	}
+	if stdin != nil {
+		_ = stdin.Close()
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		_ = cmd.Process.Kill()
+		<-done
+	}
+	return nil
+}
+
+// HTTPTransport speaks the streamable HTTP transport: each message is POSTed
+// to URL and answered with JSON or an SSE stream. Server-initiated messages
+// are read from a GET stream once the session is initialized.
+type HTTPTransport struct {
+	URL    string
+	Header http.Header
+	Client *http.Client
+
+	mu        sync.Mutex
+	sessionID string
+	version   string
+	receive   func([]byte)
+	closed    func(error)
+	ctx       context.Context
+	cancel    context.CancelFunc
+	listening bool
+}
+
+func NewHTTPTransport(url string) *HTTPTransport {
+	return &HTTPTransport{URL: url}
+}
+
+func (t *HTTPTransport) Start(_ context.Context, receive func([]byte), closed func(error)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.receive != nil {
+		return errors.New("http transport already started")
+	}
+	t.receive, t.closed = receive, closed
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	return nil
+}
+
+func (t *HTTPTransport) httpClient() *http.Client {
+	if t.Client != nil {
+		return t.Client
+	}
+	return http.DefaultClient
+}
+
+func (t *HTTPTransport) newRequest(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range t.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	if t.version != "" {
+		req.Header.Set("MCP-Protocol-Version", t.version)
+	}
+	t.mu.Unlock()
+	return req, nil
+}
+
+// Send POSTs one message and delivers whatever the server answers with before
+// returning.
+func (t *HTTPTransport) Send(ctx context.Context, message []byte) error {
+	if t.receive == nil {
+		return errors.New("http transport not started")
+	}
+	req, err := t.newRequest(ctx, http.MethodPost, bytes.NewReader(message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	resp, err := t.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if sessionID := resp.Header.Get("Mcp-Session-Id"); sessionID != "" {
+		t.mu.Lock()
+		t.sessionID = sessionID
+		t.mu.Unlock()
+	}
+	switch {
+	case resp.StatusCode == http.StatusAccepted:
+		return nil
+	case resp.StatusCode >= 400:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("mcp http status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return readSSE(resp.Body, t.receive)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		t.receive(body)
+	}
+	return nil
+}
+
+// setProtocolVersion records the negotiated version sent on later requests.
+func (t *HTTPTransport) setProtocolVersion(version string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.version = version
+}
+
+// listen opens the GET stream used for server notifications. Servers that do
+// not offer the stream are silently skipped.
+func (t *HTTPTransport) listen() {
+	t.mu.Lock()
+	if t.listening || t.ctx == nil {
+		t.mu.Unlock()
+		return
+	}
+	t.listening = true
+	ctx := t.ctx
+	t.mu.Unlock()
+
+	go func() {
+		req, err := t.newRequest(ctx, http.MethodGet, nil)
+		if err != nil {
+			return
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		resp, err := t.httpClient().Do(req)
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return
+		}
+		_ = readSSE(resp.Body, t.receive)
+	}()
+}
+
+// Close ends the session on the server and stops the notification stream.
+func (t *HTTPTransport) Close() error {
+	t.mu.Lock()
+	cancel, sessionID, closed := t.cancel, t.sessionID, t.closed
+	t.cancel, t.closed = nil, nil
+	t.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	if sessionID != "" {
+		ctx, stop := context.WithTimeout(context.Background(), 2*time.Second)
+		if req, err := t.newRequest(ctx, http.MethodDelete, nil); err == nil {
+			if resp, err := t.httpClient().Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+		stop()
+	}
+	cancel()
+	if closed != nil {
+		closed(nil)
+	}
+	return nil
+}
+
+// readSSE delivers the data of each server-sent event to receive.
+func readSSE(body io.Reader, receive func([]byte)) error {
+	reader := bufio.NewReader(body)
+	var data bytes.Buffer
+	for {
+		line, err := reader.ReadString('\n')
+		trimmed := strings.TrimRight(line, "\r\n")
+		switch {
+		case trimmed == "":
+			if data.Len() > 0 {
+				receive(append([]byte(nil), data.Bytes()...))
+				data.Reset()
+			}
+		case strings.HasPrefix(trimmed, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(trimmed, "data:"), " "))
+		}
+		if err != nil {
+			if data.Len() > 0 {
+				receive(data.Bytes())
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
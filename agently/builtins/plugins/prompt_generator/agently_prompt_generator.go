@@ -76,8 +76,13 @@ func (g *AgentlyPromptGenerator) ToText(roleMapping map[string]string) (string,
 			} else if mapped, ok := roles["_"]; ok {
 				role = mapped
 			}
-			for _, textLine := range historyContentToTextLines(msg.Content) {
-				lines = append(lines, fmt.Sprintf("[%s]:%s", role, textLine))
+			if msg.Content != nil {
+				for _, textLine := range historyContentToTextLines(msg.Content) {
+					lines = append(lines, fmt.Sprintf("[%s]:%s", role, textLine))
+				}
+			}
+			for _, call := range msg.ToolCalls {
+				lines = append(lines, fmt.Sprintf("[%s]:[tool call %s] %s(%s)", role, call.ID, call.Name, call.Arguments))
 			}
 		}
 		lines = append(lines, "")
@@ -131,6 +136,7 @@ func (g *AgentlyPromptGenerator) ToMessages(options core.PromptMessageOptions) (
 
 	history := make([]map[string]any, 0)
 	lastRole := ""
+	lastMergeable := false
 	for _, msg := range obj.ChatHistory {
 		role := msg.Role
 		if mapped, ok := roles[role]; ok {
@@ -138,18 +144,16 @@ func (g *AgentlyPromptGenerator) ToMessages(options core.PromptMessageOptions) (
 		} else if mapped, ok := roles["_"]; ok {
 			role = mapped
 		}
-		content := historyContentToRich(msg.Content)
-		if options.StrictRoleOrders {
-			if len(history) > 0 && role == lastRole {
-				previous := history[len(history)-1]["content"].([]map[string]any)
-				history[len(history)-1]["content"] = append(previous, content...)
-			} else {
-				history = append(history, map[string]any{"role": role, "content": content})
-			}
+		// Tool calls and tool results are paired by ID, so they are never merged.
+		mergeable := len(msg.ToolCalls) == 0 && msg.ToolCallID == "" && msg.Role != "tool"
+		if options.StrictRoleOrders && mergeable && lastMergeable && len(history) > 0 && role == lastRole {
+			previous := history[len(history)-1]["content"].([]map[string]any)
+			history[len(history)-1]["content"] = append(previous, historyContentToRich(msg.Content)...)
 		} else {
-			history = append(history, map[string]any{"role": role, "content": content})
+			history = append(history, historyMessage(role, msg))
 		}
 		lastRole = role
+		lastMergeable = mergeable
 	}
 	if options.StrictRoleOrders && len(history) > 0 {
 		if fmt.Sprint(history[0]["role"]) != "user" {
@@ -158,7 +162,7 @@ func (g *AgentlyPromptGenerator) ToMessages(options core.PromptMessageOptions) (
 				"content": []map[string]any{{"type": "text", "text": fmt.Sprintf("[%s]", titles["chat_history"])}},
 			}}, history...)
 		}
-		if fmt.Sprint(history[len(history)-1]["role"]) != "assistant" {
+		if fmt.Sprint(history[len(history)-1]["role"]) != "assistant" || history[len(history)-1]["tool_calls"] != nil {
 			history = append(history, map[string]any{
 				"role":    "assistant",
 				"content": []map[string]any{{"type": "text", "text": "[User continue input]"}},
@@ -166,21 +170,23 @@ func (g *AgentlyPromptGenerator) ToMessages(options core.PromptMessageOptions) (
 		}
 	}
 
-	if options.RichContent {
-		for _, item := range history {
-			messages = append(messages, map[string]any{"role": item["role"], "content": item["content"]})
+	for _, item := range history {
+		message := make(map[string]any, len(item))
+		for k, v := range item {
+			message[k] = v
 		}
-	} else {
-		for _, item := range history {
-			simplified := simplifyHistoryContent(item["content"])
-			messages = append(messages, map[string]any{"role": item["role"], "content": simplified})
+		content, isRich := item["content"].([]map[string]any)
+		toolRelated := item["tool_calls"] != nil || item["tool_call_id"] != nil
+		if isRich && (!options.RichContent || toolRelated) {
+			message["content"] = simplifyHistoryContent(content)
 		}
+		messages = append(messages, message)
 	}
 
 	onlyInput := obj.Input != nil && obj.Tools == nil && obj.ActionResult == nil && obj.Info == nil && obj.Instruct == nil && obj.Output == nil && len(obj.Extra) == 0 && len(obj.Attachment) == 0
 	if onlyInput {
 		messages = append(messages, map[string]any{"role": roles["user"], "content": prependCurrentTimeText(g.serializeContent(obj.Input))})
-		return messages, nil
+		return appendToolMessages(messages, obj.ToolMessages), nil
 	}
 
 	onlyAttachment := len(obj.Attachment) > 0 && obj.Input == nil && obj.Tools == nil && obj.ActionResult == nil && obj.Info == nil && obj.Instruct == nil && obj.Output == nil && len(obj.Extra) == 0
@@ -188,14 +194,14 @@ func (g *AgentlyPromptGenerator) ToMessages(options core.PromptMessageOptions) (
 		if options.RichContent {
 			content := prependCurrentTimeRich(attachmentsToRichContent(obj.Attachment))
 			messages = append(messages, map[string]any{"role": roles["user"], "content": content})
-			return messages, nil
+			return appendToolMessages(messages, obj.ToolMessages), nil
 		}
 		for _, att := range obj.Attachment {
 			if att.Type == "text" && att.Text != "" {
 				messages = append(messages, map[string]any{"role": roles["user"], "content": prependCurrentTimeText(att.Text)})
 			}
 		}
-		return messages, nil
+		return appendToolMessages(messages, obj.ToolMessages), nil
 	}
 
 	mainPrompt := strings.Join(g.generateMainPrompt(obj), "\n")
@@ -205,7 +211,7 @@ func (g *AgentlyPromptGenerator) ToMessages(options core.PromptMessageOptions) (
 			content = append(content, attachmentsToRichContent(obj.Attachment)...)
 		}
 		messages = append(messages, map[string]any{"role": roles["user"], "content": content})
-		return messages, nil
+		return appendToolMessages(messages, obj.ToolMessages), nil
 	}
 
 	for _, att := range obj.Attachment {
@@ -214,7 +220,44 @@ func (g *AgentlyPromptGenerator) ToMessages(options core.PromptMessageOptions) (
 		}
 	}
 	messages = append(messages, map[string]any{"role": roles["user"], "content": prependCurrentTimeText(mainPrompt)})
-	return messages, nil
+	return appendToolMessages(messages, obj.ToolMessages), nil
+}
+
+// historyMessage converts a chat history message. Tool calls of assistant
+// messages without content keep a null content, as chat APIs expect.
+func historyMessage(role string, msg types.ChatMessage) map[string]any {
+	message := map[string]any{"role": role}
+	if len(msg.ToolCalls) > 0 {
+		calls := make([]any, 0, len(msg.ToolCalls))
+		for _, call := range msg.ToolCalls {
+			calls = append(calls, call.ToOpenAI())
+		}
+		message["tool_calls"] = calls
+		if msg.Content == nil || msg.Content == "" {
+			message["content"] = nil
+			return message
+		}
+	}
+	if msg.ToolCallID != "" {
+		message["tool_call_id"] = msg.ToolCallID
+	}
+	if msg.Name != "" && msg.Role == "tool" {
+		message["name"] = msg.Name
+	}
+	message["content"] = historyContentToRich(msg.Content)
+	return message
+}
+
+// appendToolMessages places native tool loop messages after the main prompt.
+func appendToolMessages(messages []map[string]any, toolMessages []map[string]any) []map[string]any {
+	for _, item := range toolMessages {
+		copied := make(map[string]any, len(item))
+		for k, v := range item {
+			copied[k] = v
+		}
+		messages = append(messages, copied)
+	}
+	return messages
 }
 
 func (g *AgentlyPromptGenerator) ToOutputModelSchema() (any, error) {
@@ -335,6 +378,15 @@ func (g *AgentlyPromptGenerator) generateMainPrompt(obj types.PromptObject) []st
 				fmt.Sprintf("[%s]:", titles["output_requirement"]),
 				"Data Format: markdown text",
 			)
+		case types.OutputMarkdownSections:
+			lines = append(lines,
+				fmt.Sprintf("[%s]:", titles["output_requirement"]),
+				"Data Format: markdown sections",
+				"Write one \"## <key>\" heading for every key below in this order and put its content under the heading. Use \"- \" bullets for lists and deeper headings or \"key: value\" lines for nested objects.",
+				"Sections:",
+				g.generateMarkdownSectionsOutputPrompt(obj.Output, 2),
+				"",
+			)
 		case types.OutputText:
 			// Do not inject output requirement for text mode.
 		}
@@ -413,6 +465,62 @@ func (g *AgentlyPromptGenerator) generateJSONOutputPrompt(output any, layer int)
 	return fmt.Sprintf("<%v>", utils.DataFormatterSanitize(output, false))
 }
 
+func (g *AgentlyPromptGenerator) generateMarkdownSectionsOutputPrompt(output any, level int) string {
+	if tuple, ok := output.(types.OutputTuple); ok && len(tuple) >= 1 {
+		output = tuple[0]
+	}
+	m, ok := toStringMap(output)
+	if !ok {
+		return fmt.Sprintf("<%v>", utils.DataFormatterSanitize(output, false))
+	}
+	lines := make([]string, 0, len(m)*2)
+	for _, key := range mapKeysSorted(m) {
+		value := m[key]
+		descStr := ""
+		if tuple, ok := value.(types.OutputTuple); ok && len(tuple) >= 1 {
+			if len(tuple) > 1 {
+				if desc := strings.TrimSpace(fmt.Sprint(tuple[1])); desc != "" && desc != "<nil>" {
+					descStr = " // " + desc
+				}
+			}
+			value = tuple[0]
+		}
+		lines = append(lines, fmt.Sprintf("%s %s", strings.Repeat("#", level), key))
+		if _, ok := toStringMap(value); ok {
+			if descStr != "" {
+				lines = append(lines, strings.TrimSpace(descStr))
+			}
+			lines = append(lines, g.generateMarkdownSectionsOutputPrompt(value, level+1))
+			continue
+		}
+		if list, ok := toAnySlice(value); ok {
+			item := any("string")
+			if len(list) > 0 {
+				item = list[0]
+			}
+			lines = append(lines, "- "+g.generateMarkdownBulletPrompt(item)+descStr, "- ...")
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("<%v>%s", utils.DataFormatterSanitize(value, false), descStr))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (g *AgentlyPromptGenerator) generateMarkdownBulletPrompt(item any) string {
+	if tuple, ok := item.(types.OutputTuple); ok && len(tuple) >= 1 {
+		item = tuple[0]
+	}
+	m, ok := toStringMap(item)
+	if !ok {
+		return strings.ReplaceAll(g.generateJSONOutputPrompt(item, 0), "\n", "\n  ")
+	}
+	parts := make([]string, 0, len(m))
+	for _, key := range mapKeysSorted(m) {
+		parts = append(parts, fmt.Sprintf("%s: %s", key, strings.ReplaceAll(g.generateJSONOutputPrompt(m[key], 1), "\n", "\n  ")))
+	}
+	return strings.Join(parts, "\n  ")
+}
+
 func (g *AgentlyPromptGenerator) toSerializableOutputPrompt(outputPromptPart any) any {
 	if tuple, ok := outputPromptPart.(types.OutputTuple); ok {
 		switch len(tuple) {
@@ -638,7 +746,7 @@ func (g *AgentlyPromptGenerator) orderedExtraKeys(extra map[string]any) []string
 
 func isStandardPromptSlot(key string) bool {
 	switch key {
-	case "system", "developer", "chat_history", "info", "tools", "action_results", "instruct", "examples", "input", "attachment", "output", "output_format", "options":
+	case "system", "developer", "chat_history", "info", "tools", "action_results", "instruct", "examples", "input", "attachment", "output", "output_format", "options", "tool_messages":
 		return true
 	default:
 		return false
@@ -646,7 +754,7 @@ func isStandardPromptSlot(key string) bool {
 }
 
 func (g *AgentlyPromptGenerator) getRoleMapping(overrides map[string]string) map[string]string {
-	roleMap := map[string]string{"system": "system", "developer": "developer", "assistant": "assistant", "user": "user", "_": "assistant"}
+	roleMap := map[string]string{"system": "system", "developer": "developer", "assistant": "assistant", "user": "user", "tool": "tool", "_": "assistant"}
 	if configured, ok := g.settings.Get("prompt.role_mapping", map[string]any{}, true).(map[string]any); ok {
 		for k, v := range configured {
 			roleMap[k] = fmt.Sprint(v)
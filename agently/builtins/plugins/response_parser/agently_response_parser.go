@@ -24,18 +24,26 @@ type AgentlyResponseParser struct {
 	initErr        error
 
 	promptObject      types.PromptObject
-	streamingParser   *utils.StreamingJSONParser
+	streamingParser   streamingOutputParser
 	fullResultData    *types.ModelResult
 	streamingCanceled bool
 }
 
 const PluginName = "AgentlyResponseParser"
 
+// streamingOutputParser is implemented by the JSON and markdown-sections
+// streaming parsers used for `instant` events.
+type streamingOutputParser interface {
+	ParseChunk(chunk string) ([]types.StreamingData, error)
+	Finalize() []types.StreamingData
+}
+
 var DefaultSettings = map[string]any{
 	"$global": map[string]any{
 		"response": map[string]any{
 			"streaming_parse":            false,
 			"streaming_parse_path_style": "dot",
+			"json_repair":                "lenient",
 		},
 	},
 }
@@ -61,9 +69,12 @@ func New(agentName, responseID string, prompt *core.Prompt, response <-chan type
 			Extra:        map[string]any{},
 		},
 	}
-	if obj.OutputFormat == types.OutputJSON {
-		if schema, ok := obj.Output.(map[string]any); ok {
-			parser.streamingParser = utils.NewStreamingJSONParser(schema)
+	if schema, ok := obj.Output.(map[string]any); ok {
+		switch obj.OutputFormat {
+		case types.OutputJSON:
+			parser.streamingParser = utils.NewStreamingJSONParser(schema).SetRepairMode(parser.jsonRepairMode())
+		case types.OutputMarkdownSections:
+			parser.streamingParser = utils.NewStreamingMarkdownSectionParser(schema)
 		}
 	}
 	return parser
@@ -110,13 +121,10 @@ func (p *AgentlyResponseParser) processMessage(msg types.ResponseMessage) {
 					candidates = append(candidates, text)
 				}
 				for _, candidate := range candidates {
-					cleaned := utils.LocateOutputJSON(candidate, schema)
-					if cleaned == "" {
+					completed, repairs := utils.LocateRepairedOutputJSON(candidate, schema, p.jsonRepairMode())
+					if completed == "" {
 						continue
 					}
-					completer := utils.NewStreamingJSONCompleter()
-					completer.Reset(cleaned)
-					completed := completer.Complete()
 					parsed := map[string]any{}
 					if err := json.Unmarshal([]byte(completed), &parsed); err != nil {
 						continue
@@ -124,6 +132,7 @@ func (p *AgentlyResponseParser) processMessage(msg types.ResponseMessage) {
 					p.fullResultData.Cleaned = completed
 					p.fullResultData.Parsed = parsed
 					p.fullResultData.ResultObject = parsed
+					p.fullResultData.Repairs = repairs
 					parsedDone = true
 					break
 				}
@@ -135,6 +144,19 @@ func (p *AgentlyResponseParser) processMessage(msg types.ResponseMessage) {
 					p.emitModelSystemMessage("Done", "Can not parse this result as requested output schema.", false)
 				}
 			}
+		} else if p.promptObject.OutputFormat == types.OutputMarkdownSections {
+			if schema, ok := p.promptObject.Output.(map[string]any); ok {
+				parsed := utils.ParseMarkdownSections(fmt.Sprint(msg.Data), schema)
+				p.fullResultData.Cleaned = fmt.Sprint(msg.Data)
+				p.fullResultData.Parsed = parsed
+				p.fullResultData.ResultObject = parsed
+			} else {
+				p.fullResultData.Parsed = msg.Data
+				p.fullResultData.ResultObject = msg.Data
+			}
+			if core.IsModelLogsEnabled(p.settings) && p.settings.Get("$log.cancel_logs", false, true) != true {
+				p.emitModelSystemMessage("Done", fmt.Sprint(msg.Data), false)
+			}
 		} else {
 			p.fullResultData.Parsed = msg.Data
 			p.fullResultData.ResultObject = msg.Data
@@ -161,6 +183,10 @@ func (p *AgentlyResponseParser) processMessage(msg types.ResponseMessage) {
 	}
 }
 
+func (p *AgentlyResponseParser) jsonRepairMode() utils.JSONRepairMode {
+	return utils.ParseJSONRepairMode(p.settings.Get("response.json_repair", "lenient", true))
+}
+
 func (p *AgentlyResponseParser) emitModelSystemMessage(stage string, detail any, delta bool) {
 	_ = core.EmitSystemMessage(p.settings, types.SystemEventModelRequest, map[string]any{
 		"agent_name":  p.agentName,
@@ -208,7 +234,7 @@ func (p *AgentlyResponseParser) GetData(ctx context.Context, dataType string) (a
 }
 
 func (p *AgentlyResponseParser) GetDataObject(ctx context.Context) (any, error) {
-	if p.promptObject.OutputFormat != types.OutputJSON {
+	if p.promptObject.OutputFormat != types.OutputJSON && p.promptObject.OutputFormat != types.OutputMarkdownSections {
 		return nil, fmt.Errorf("cannot create data object for non-json output")
 	}
 	if err := p.waitResult(ctx); err != nil {
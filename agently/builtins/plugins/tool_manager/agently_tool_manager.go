@@ -7,18 +7,24 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/AgentEra/Agently-Go/agently/core"
 	"github.com/AgentEra/Agently-Go/agently/types"
 	"github.com/AgentEra/Agently-Go/agently/utils"
 )
 
+// AgentlyToolManager is safe for concurrent use.
 type AgentlyToolManager struct {
 	settings *utils.Settings
 
+	mu          sync.RWMutex
 	toolFuncs   map[string]any
 	toolInfo    map[string]types.ToolInfo
 	tagMappings map[string]map[string]struct{}
+	// cache holds results of tools cached in the global scope.
+	cache *core.ToolResultCache
 }
 
 const PluginName = "AgentlyToolManager"
@@ -31,10 +37,21 @@ func New(settings *utils.Settings) core.ToolManager {
 		toolFuncs:   map[string]any{},
 		toolInfo:    map[string]types.ToolInfo{},
 		tagMappings: map[string]map[string]struct{}{},
+		cache:       core.NewToolResultCache(),
 	}
 }
 
 func (m *AgentlyToolManager) Register(info types.ToolInfo, fn any) error {
+	return m.register(info, fn, false)
+}
+
+// Replace registers the tool regardless of `tool.name_collision`. Tags of the
+// tool it replaces are dropped, so the tool is never missing in between.
+func (m *AgentlyToolManager) Replace(info types.ToolInfo, fn any) error {
+	return m.register(info, fn, true)
+}
+
+func (m *AgentlyToolManager) register(info types.ToolInfo, fn any, replace bool) error {
 	if stringsTrim(info.Name) == "" {
 		return errors.New("tool name is required")
 	}
@@ -44,18 +61,89 @@ func (m *AgentlyToolManager) Register(info types.ToolInfo, fn any) error {
 	if reflect.TypeOf(fn).Kind() != reflect.Func {
 		return fmt.Errorf("tool function for %s must be function, got %T", info.Name, fn)
 	}
+	if argsType, ok := toolArgsStructType(reflect.TypeOf(fn)); ok && len(info.Kwargs) == 0 {
+		info.Kwargs = utils.StructToKwargs(argsType)
+	}
+	if resultType, ok := toolResultType(reflect.TypeOf(fn)); ok && info.Returns == nil {
+		info.Returns = utils.GoTypeToReturns(resultType)
+	}
 	if info.Kwargs == nil {
 		info.Kwargs = map[string]any{}
 	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.toolInfo[info.Name]; exists {
+		if replace {
+			m.untagAllLocked(info.Name)
+		} else {
+			switch core.ToolNameCollisionPolicy(m.settings) {
+			case core.ToolCollisionError:
+				return fmt.Errorf("%w: %s", core.ErrToolNameConflict, info.Name)
+			case core.ToolCollisionKeep:
+				return nil
+			}
+		}
+	}
 	m.toolFuncs[info.Name] = fn
 	m.toolInfo[info.Name] = info
+	m.cache.Forget(info.Name)
 	if len(info.Tags) > 0 {
-		_ = m.Tag([]string{info.Name}, info.Tags)
+		_ = m.tagLocked([]string{info.Name}, info.Tags)
 	}
 	return nil
 }
 
+// Unregister removes tools and their tag mappings.
+func (m *AgentlyToolManager) Unregister(toolNames []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, toolName := range toolNames {
+		if _, ok := m.toolInfo[toolName]; !ok {
+			return fmt.Errorf("tool %s not found", toolName)
+		}
+		delete(m.toolFuncs, toolName)
+		delete(m.toolInfo, toolName)
+		m.cache.Forget(toolName)
+		m.untagAllLocked(toolName)
+	}
+	return nil
+}
+
+func (m *AgentlyToolManager) untagAllLocked(toolName string) {
+	for tag, names := range m.tagMappings {
+		delete(names, toolName)
+		if len(names) == 0 {
+			delete(m.tagMappings, tag)
+		}
+	}
+}
+
 func (m *AgentlyToolManager) Tag(toolNames []string, tags []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tagLocked(toolNames, tags)
+}
+
+// Untag removes tags from tools. Tags a tool does not carry are ignored.
+func (m *AgentlyToolManager) Untag(toolNames []string, tags []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, toolName := range toolNames {
+		if _, ok := m.toolInfo[toolName]; !ok {
+			return fmt.Errorf("tool %s not found", toolName)
+		}
+		for _, tag := range tags {
+			delete(m.tagMappings[tag], toolName)
+			if len(m.tagMappings[tag]) == 0 {
+				delete(m.tagMappings, tag)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *AgentlyToolManager) tagLocked(toolNames []string, tags []string) error {
 	for _, toolName := range toolNames {
 		if _, ok := m.toolInfo[toolName]; !ok {
 			return fmt.Errorf("tool %s not found", toolName)
@@ -71,6 +159,8 @@ func (m *AgentlyToolManager) Tag(toolNames []string, tags []string) error {
 }
 
 func (m *AgentlyToolManager) GetToolInfo(tags []string) map[string]types.ToolInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	if len(tags) == 0 {
 		out := map[string]types.ToolInfo{}
 		for k, v := range m.toolInfo {
@@ -102,16 +192,183 @@ func (m *AgentlyToolManager) GetToolList(tags []string) []types.ToolInfo {
 }
 
 func (m *AgentlyToolManager) GetToolFunc(name string) (any, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	fn, ok := m.toolFuncs[name]
 	return fn, ok
 }
 
+// CallTool runs one tool. Kwargs are first checked against ToolInfo.Kwargs
+// (see core.ToolKwargsValidation) and rejected with a *utils.KwargsError.
+// Tools requiring approval are approved next, on every call, and the kwargs
+// the approver returns are checked again. Results of tools with a cache are
+// reused for the same approved kwargs. The tool's Timeout bounds the call,
+// and a panic inside the tool is returned as an error.
 func (m *AgentlyToolManager) CallTool(ctx context.Context, name string, kwargs map[string]any) (any, error) {
+	value, _, err := m.callTool(ctx, name, kwargs)
+	return value, err
+}
+
+// callTool is CallTool that also reports whether the result came from the
+// tool's result cache.
+func (m *AgentlyToolManager) callTool(ctx context.Context, name string, kwargs map[string]any) (any, bool, error) {
+	m.mu.RLock()
 	fn, ok := m.toolFuncs[name]
+	info := m.toolInfo[name]
+	m.mu.RUnlock()
 	if !ok {
-		return nil, fmt.Errorf("tool %s not found", name)
+		return nil, false, fmt.Errorf("tool %s not found", name)
 	}
-	return invokeTool(ctx, fn, kwargs)
+	kwargs, err := m.checkKwargs(info, kwargs)
+	if err != nil {
+		return nil, false, err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// Approval comes before the cache, so a cached result is never returned
+	// without approval and is keyed on the kwargs the tool really ran with.
+	// Waiting for a human does not count against the tool timeout.
+	if m.requiresApproval(info) {
+		approved, err := core.ApproveToolCall(ctx, m.settings, info, kwargs)
+		if err != nil {
+			return nil, false, err
+		}
+		if kwargs, err = m.checkKwargs(info, approved); err != nil {
+			return nil, false, err
+		}
+	}
+	cache, ttl := m.resultCache(ctx, info)
+	if cache == nil {
+		value, err := m.runTool(ctx, info, fn, kwargs)
+		return value, false, err
+	}
+	key, err := core.ToolCacheKey(name, kwargs)
+	if err != nil {
+		value, err := m.runTool(ctx, info, fn, kwargs)
+		return value, false, err
+	}
+	cache.SetMaxEntries(core.ToolCacheMaxEntries(m.settings))
+	return cache.Do(ctx, name, key, ttl, func() (any, error) {
+		return m.runTool(core.WithToolIdempotencyKey(ctx, cache, key), info, fn, kwargs)
+	})
+}
+
+// resultCache picks the cache for info's scope. Response and session caches
+// come with ctx; calls outside of them are not cached.
+func (m *AgentlyToolManager) resultCache(ctx context.Context, info types.ToolInfo) (*core.ToolResultCache, time.Duration) {
+	config := core.EffectiveToolCache(info)
+	if config == nil {
+		return nil, 0
+	}
+	ttl := time.Duration(config.TTL * float64(time.Second))
+	if config.Scope == types.ToolCacheScopeGlobal {
+		return m.cache, ttl
+	}
+	return core.ToolResultCacheFromContext(ctx, config.Scope), ttl
+}
+
+func (m *AgentlyToolManager) runTool(ctx context.Context, info types.ToolInfo, fn any, kwargs map[string]any) (any, error) {
+	name := info.Name
+	timeout := info.Timeout
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout*float64(time.Second)))
+		defer cancel()
+	}
+
+	type callResult struct {
+		value any
+		err   error
+	}
+	done := make(chan callResult, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				done <- callResult{err: fmt.Errorf("tool %s panicked: %v", name, recovered)}
+			}
+		}()
+		value, err := invokeTool(ctx, fn, kwargs)
+		done <- callResult{value: value, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.value, result.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("tool %s timed out: %w", name, ctx.Err())
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// checkKwargs validates kwargs against info.Kwargs when tool.kwargs.validate
+// is on.
+func (m *AgentlyToolManager) checkKwargs(info types.ToolInfo, kwargs map[string]any) (map[string]any, error) {
+	validate, coerce := core.ToolKwargsValidation(m.settings)
+	if !validate {
+		return kwargs, nil
+	}
+	checked, err := utils.ValidateKwargs(info.Kwargs, kwargs, coerce)
+	if err != nil {
+		var kwargsErr *utils.KwargsError
+		if errors.As(err, &kwargsErr) {
+			kwargsErr.Tool = info.Name
+		}
+		return nil, err
+	}
+	return checked, nil
+}
+
+// requiresApproval reports whether info is marked with RequiresApproval or
+// the requires_approval tag.
+func (m *AgentlyToolManager) requiresApproval(info types.ToolInfo) bool {
+	if info.RequiresApproval {
+		return true
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, tagged := m.tagMappings[types.ToolTagRequiresApproval][info.Name]
+	return tagged
+}
+
+func (m *AgentlyToolManager) CallTools(ctx context.Context, calls []types.ToolStep, concurrency int) []types.ToolStep {
+	out := make([]types.ToolStep, len(calls))
+	copy(out, calls)
+	if len(out) == 0 {
+		return out
+	}
+	if concurrency <= 0 {
+		concurrency = core.ToolConcurrency(m.settings)
+	}
+	if concurrency <= 0 || concurrency > len(out) {
+		concurrency = len(out)
+	}
+
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range out {
+		wg.Add(1)
+		go func(step *types.ToolStep) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			result, cached, err := m.callTool(ctx, step.Name, step.Kwargs)
+			if err != nil {
+				step.Error = err.Error()
+				var kwargsErr *utils.KwargsError
+				if errors.As(err, &kwargsErr) {
+					step.InvalidKwargs = kwargsErr.Issues
+				}
+				return
+			}
+			step.Result = result
+			step.Cached = cached
+		}(&out[i])
+	}
+	wg.Wait()
+	return out
 }
 
 func invokeTool(ctx context.Context, fn any, kwargs map[string]any) (any, error) {
@@ -124,21 +381,37 @@ func invokeTool(ctx context.Context, fn any, kwargs map[string]any) (any, error)
 		return nil, fmt.Errorf("fn must be function, got %T", fn)
 	}
 
+	contextType := reflect.TypeOf((*context.Context)(nil)).Elem()
 	args := make([]reflect.Value, 0, t.NumIn())
 	switch t.NumIn() {
 	case 0:
 	case 1:
 		in0 := t.In(0)
-		if in0 == reflect.TypeOf((*context.Context)(nil)).Elem() {
+		if in0 == contextType {
 			args = append(args, reflect.ValueOf(ctx))
 		} else if in0.Kind() == reflect.Map {
 			args = append(args, reflect.ValueOf(kwargs))
+		} else if isArgsStruct(in0) {
+			arg, err := decodeToolArgs(in0, kwargs)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
 		} else {
 			return nil, fmt.Errorf("unsupported tool signature: %s", t.String())
 		}
 	case 2:
-		if t.In(0) == reflect.TypeOf((*context.Context)(nil)).Elem() && t.In(1).Kind() == reflect.Map {
+		if t.In(0) != contextType {
+			return nil, fmt.Errorf("unsupported tool signature: %s", t.String())
+		}
+		if t.In(1).Kind() == reflect.Map {
 			args = append(args, reflect.ValueOf(ctx), reflect.ValueOf(kwargs))
+		} else if isArgsStruct(t.In(1)) {
+			arg, err := decodeToolArgs(t.In(1), kwargs)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, reflect.ValueOf(ctx), arg)
 		} else {
 			return nil, fmt.Errorf("unsupported tool signature: %s", t.String())
 		}
@@ -164,6 +437,52 @@ func invokeTool(ctx context.Context, fn any, kwargs map[string]any) (any, error)
 	}
 }
 
+// decodeToolArgs builds the Args value of a typed tool from kwargs.
+func decodeToolArgs(argsType reflect.Type, kwargs map[string]any) (reflect.Value, error) {
+	target := reflect.New(argsType)
+	if err := utils.DecodeKwargs(kwargs, target.Interface()); err != nil {
+		return reflect.Value{}, fmt.Errorf("invalid kwargs: %w", err)
+	}
+	return target.Elem(), nil
+}
+
+func isArgsStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// toolArgsStructType returns the Args type of `func(ctx, Args)` or
+// `func(Args)` tools.
+func toolArgsStructType(t reflect.Type) (reflect.Type, bool) {
+	switch t.NumIn() {
+	case 1:
+		if isArgsStruct(t.In(0)) {
+			return t.In(0), true
+		}
+	case 2:
+		if isArgsStruct(t.In(1)) {
+			return t.In(1), true
+		}
+	}
+	return nil, false
+}
+
+// toolResultType returns the first non-error result type of a typed tool.
+func toolResultType(t reflect.Type) (reflect.Type, bool) {
+	if _, ok := toolArgsStructType(t); !ok || t.NumOut() == 0 {
+		return nil, false
+	}
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	if t.Out(0) == errorType {
+		return nil, false
+	}
+	return t.Out(0), true
+}
+
 func stringsTrim(s string) string {
 	return strings.TrimSpace(s)
 }
+
+var _ core.ToolManagerExtension = (*AgentlyToolManager)(nil)
@@ -0,0 +1,282 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+)
+
+const (
+	defaultBrowseTimeout  = 20 * time.Second
+	defaultBrowseMaxBytes = 2 * 1024 * 1024
+	defaultBrowseMaxChars = 20000
+)
+
+// Browse fetches http(s) pages and returns them as readable markdown.
+//
+// Loopback, private, link-local and unspecified addresses are refused unless
+// AllowPrivateNetworks is set. The check runs when connecting, after DNS
+// resolution, so it also covers redirects and names resolving to internal
+// addresses.
+type Browse struct {
+	// Client defaults to a zero http.Client. When its Transport is nil or an
+	// *http.Transport, requests go through a copy that refuses private
+	// addresses and bypasses proxies; any other RoundTripper is used as-is
+	// and must do its own filtering.
+	Client *http.Client
+	// AllowedHosts limits the hosts that may be fetched. Empty allows all
+	// public hosts.
+	AllowedHosts []string
+	// AllowPrivateNetworks allows fetching loopback, private and link-local
+	// addresses, e.g. an intranet wiki.
+	AllowPrivateNetworks bool
+	UserAgent            string
+	// Timeout defaults to 20s.
+	Timeout time.Duration
+	// MaxBytes caps the downloaded body. Defaults to 2MiB.
+	MaxBytes int64
+	// MaxChars caps the returned content. Defaults to 20000.
+	MaxChars int
+}
+
+type BrowseArgs struct {
+	URL string `json:"url" desc:"http or https URL to open"`
+}
+
+type BrowseResult struct {
+	URL       string `json:"url"`
+	Title     string `json:"title"`
+	Content   string `json:"content"`
+	Truncated bool   `json:"truncated"`
+}
+
+func (b *Browse) Tools() []Tool {
+	return []Tool{{
+		Info: types.ToolInfo{Name: "browse", Desc: "Open a web page and read its main text as markdown."},
+		Func: b.Fetch,
+	}}
+}
+
+func (b *Browse) Fetch(ctx context.Context, args BrowseArgs) (BrowseResult, error) {
+	target, err := url.Parse(strings.TrimSpace(args.URL))
+	if err != nil {
+		return BrowseResult{}, fmt.Errorf("invalid url: %w", err)
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return BrowseResult{}, fmt.Errorf("unsupported url scheme %q", target.Scheme)
+	}
+	if !b.hostAllowed(target.Hostname()) {
+		return BrowseResult{}, fmt.Errorf("host %s is not allowed", target.Hostname())
+	}
+	if err := b.checkAddress(target.Hostname()); err != nil {
+		return BrowseResult{}, err
+	}
+
+	timeout := b.Timeout
+	if timeout <= 0 {
+		timeout = defaultBrowseTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return BrowseResult{}, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.9,*/*;q=0.5")
+	if b.UserAgent != "" {
+		req.Header.Set("User-Agent", b.UserAgent)
+	}
+	client, release := b.httpClient()
+	defer release()
+	resp, err := client.Do(req)
+	if err != nil {
+		return BrowseResult{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return BrowseResult{}, fmt.Errorf("browse %s: status %d", target, resp.StatusCode)
+	}
+
+	maxBytes := b.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultBrowseMaxBytes
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return BrowseResult{}, err
+	}
+	truncated := int64(len(body)) > maxBytes
+	if truncated {
+		body = body[:maxBytes]
+	}
+
+	result := BrowseResult{URL: resp.Request.URL.String()}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "" || mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		result.Title, result.Content = htmlToMarkdown(string(body), resp.Request.URL)
+	case strings.HasPrefix(mediaType, "text/") || mediaType == "application/json":
+		result.Content = string(body)
+	default:
+		return BrowseResult{}, fmt.Errorf("browse %s: unsupported content type %s", target, mediaType)
+	}
+
+	maxChars := b.MaxChars
+	if maxChars <= 0 {
+		maxChars = defaultBrowseMaxChars
+	}
+	result.Content = strings.ToValidUTF8(result.Content, "")
+	if utf8.RuneCountInString(result.Content) > maxChars {
+		result.Content = string([]rune(result.Content)[:maxChars])
+		truncated = true
+	}
+	result.Truncated = truncated
+	return result, nil
+}
+
+// httpClient copies the configured client so redirects are held to the same
+// scheme, host and address rules as the requested URL. release closes the
+// idle connections of a transport copied for this fetch.
+func (b *Browse) httpClient() (*http.Client, func()) {
+	client := http.Client{}
+	if b.Client != nil {
+		client = *b.Client
+	}
+	release := func() {}
+	if !b.AllowPrivateNetworks {
+		if transport := publicTransport(client.Transport); transport != nil {
+			client.Transport = transport
+			release = transport.CloseIdleConnections
+		}
+	}
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to unsupported url scheme %q", req.URL.Scheme)
+		}
+		if !b.hostAllowed(req.URL.Hostname()) {
+			return fmt.Errorf("redirect to host %s is not allowed", req.URL.Hostname())
+		}
+		if err := b.checkAddress(req.URL.Hostname()); err != nil {
+			return fmt.Errorf("redirect: %w", err)
+		}
+		return nil
+	}
+	return &client, release
+}
+
+func (b *Browse) hostAllowed(host string) bool {
+	if len(b.AllowedHosts) == 0 {
+		return true
+	}
+	for _, allowed := range b.AllowedHosts {
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAddress rejects private IP literals early, including redirects served
+// by transports it cannot guard. Names are checked once resolved.
+func (b *Browse) checkAddress(host string) error {
+	if b.AllowPrivateNetworks {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && privateIP(ip) {
+		return fmt.Errorf("host %s is a private address; set AllowPrivateNetworks to fetch it", host)
+	}
+	return nil
+}
+
+// publicTransport copies base, or the default transport when base is nil, so
+// it only connects to public addresses. It returns nil for RoundTrippers it
+// cannot guard.
+func publicTransport(base http.RoundTripper) *http.Transport {
+	var transport *http.Transport
+	switch typed := base.(type) {
+	case nil:
+		defaultTransport, ok := http.DefaultTransport.(*http.Transport)
+		if !ok {
+			return nil
+		}
+		transport = defaultTransport.Clone()
+		transport.DialContext = nil
+	case *http.Transport:
+		transport = typed.Clone()
+	default:
+		return nil
+	}
+	// A proxy would connect to private addresses on our behalf.
+	transport.Proxy = nil
+	if dial := transport.DialContext; dial != nil {
+		transport.DialContext = checkedDial(dial)
+	} else {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control: func(_ string, address string, _ syscall.RawConn) error {
+				return checkPublicAddress(address)
+			},
+		}
+		transport.DialContext = dialer.DialContext
+	}
+	if dial := transport.DialTLSContext; dial != nil {
+		transport.DialTLSContext = checkedDial(dial)
+	}
+	return transport
+}
+
+// checkedDial wraps a custom dial function, which cannot take a Control hook,
+// and drops connections whose peer is a private address before anything is
+// sent.
+func checkedDial(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkPublicAddress(conn.RemoteAddr().String()); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+func checkPublicAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("cannot check address %s", address)
+	}
+	if privateIP(ip) {
+		return fmt.Errorf("address %s is private; set AllowPrivateNetworks to fetch it", ip)
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func privateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		sharedAddressSpace.Contains(ip)
+}
@@ -0,0 +1,266 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+)
+
+const (
+	defaultCmdTimeout   = 30 * time.Second
+	defaultCmdMaxOutput = 16 * 1024
+)
+
+// Cmd runs allowlisted binaries without a shell. Commands start in WorkDir or
+// a directory below it, and arguments that are absolute paths or climb out
+// with ".." are rejected, including values after "=" ("--flag=value",
+// "if=value") and values attached to short flags ("-fvalue"). Commands get a
+// minimal environment unless Env or InheritEnv says otherwise. This only
+// confines the working directory and literal path arguments: symlinks below
+// WorkDir, paths read from config files or the environment, and binaries that
+// reach the network are not. The allowlist remains the real guard, so only
+// allow binaries that are safe with any relative path argument.
+type Cmd struct {
+	// AllowedCommands lists the binary names the tool may run. Names with a
+	// path separator are never allowed.
+	AllowedCommands []string
+	WorkDir         string
+	// Env replaces the process environment when set. Commands are then
+	// looked up in its PATH rather than the process PATH.
+	Env []string
+	// InheritEnv passes the process environment through when Env is not set.
+	// By default commands only get PATH, LANG and HOME set to WorkDir.
+	InheritEnv bool
+	// AllowPathArgs passes absolute and ".." arguments through as-is.
+	AllowPathArgs bool
+	// Timeout defaults to 30s.
+	Timeout time.Duration
+	// MaxOutput caps stdout and stderr each, in bytes. Defaults to 16KiB.
+	MaxOutput int
+}
+
+type CmdArgs struct {
+	Command string   `json:"command" desc:"binary to run"`
+	Args    []string `json:"args,omitempty" desc:"command arguments"`
+	Dir     string   `json:"dir,omitempty" desc:"working directory relative to the sandbox root"`
+}
+
+type CmdResult struct {
+	ExitCode  int    `json:"exit_code"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Truncated bool   `json:"truncated"`
+	TimedOut  bool   `json:"timed_out"`
+}
+
+func (c *Cmd) Tools() []Tool {
+	return []Tool{{
+		Info: types.ToolInfo{
+			Name: "cmd",
+			Desc: "Run a command without a shell. Allowed commands: " + strings.Join(c.AllowedCommands, ", "),
+		},
+		Func: c.Run,
+	}}
+}
+
+// Run executes one command. A non-zero exit or a timeout is reported in the
+// result; errors are for commands that could not run at all.
+func (c *Cmd) Run(ctx context.Context, args CmdArgs) (CmdResult, error) {
+	if !c.allowed(args.Command) {
+		return CmdResult{}, fmt.Errorf("command %q is not allowed", args.Command)
+	}
+	if c.WorkDir == "" {
+		return CmdResult{}, errors.New("cmd tool has no work dir configured")
+	}
+	dir, err := resolveInRoots(args.Dir, []string{c.WorkDir})
+	if err != nil {
+		return CmdResult{}, err
+	}
+	if !c.AllowPathArgs {
+		for _, arg := range args.Args {
+			if escapingPathArg(arg) {
+				return CmdResult{}, fmt.Errorf("argument %q points outside the work dir", arg)
+			}
+		}
+	}
+	binary, err := c.lookPath(args.Command)
+	if err != nil {
+		return CmdResult{}, err
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultCmdTimeout
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	maxOutput := c.MaxOutput
+	if maxOutput <= 0 {
+		maxOutput = defaultCmdMaxOutput
+	}
+	stdout := &limitedBuffer{max: maxOutput}
+	stderr := &limitedBuffer{max: maxOutput}
+	cmd := exec.CommandContext(runCtx, binary, args.Args...)
+	cmd.Dir = dir
+	switch {
+	case c.Env != nil:
+		cmd.Env = c.Env
+	case !c.InheritEnv:
+		cmd.Env = minimalEnv(c.WorkDir)
+	}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	cmd.WaitDelay = time.Second
+
+	runErr := cmd.Run()
+	result := CmdResult{
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.truncated || stderr.truncated,
+	}
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		result.TimedOut = true
+		result.ExitCode = -1
+		return result, nil
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case runErr == nil:
+	case errors.As(runErr, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		return result, runErr
+	}
+	return result, nil
+}
+
+func (c *Cmd) allowed(command string) bool {
+	if command == "" || strings.ContainsAny(command, `/\`) {
+		return false
+	}
+	for _, allowed := range c.AllowedCommands {
+		if command == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// lookPath resolves command in the PATH of Env when Env is set, so the binary
+// run is the one the configured environment would find.
+func (c *Cmd) lookPath(command string) (string, error) {
+	if c.Env == nil {
+		return exec.LookPath(command)
+	}
+	path, extensions := "", []string{""}
+	for _, entry := range c.Env {
+		key, value, _ := strings.Cut(entry, "=")
+		switch {
+		case key == "PATH" || (runtime.GOOS == "windows" && strings.EqualFold(key, "PATH")):
+			path = value
+		case runtime.GOOS == "windows" && strings.EqualFold(key, "PATHEXT"):
+			extensions = filepath.SplitList(strings.ToLower(value))
+		}
+	}
+	if runtime.GOOS == "windows" && len(extensions) == 1 && extensions[0] == "" {
+		extensions = []string{".com", ".exe", ".bat", ".cmd"}
+	}
+	for _, dir := range filepath.SplitList(path) {
+		// Relative PATH entries would resolve against the process directory.
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		for _, extension := range extensions {
+			candidate := filepath.Join(dir, command+extension)
+			info, err := os.Stat(candidate)
+			if err == nil && info.Mode().IsRegular() && (runtime.GOOS == "windows" || info.Mode().Perm()&0o111 != 0) {
+				return candidate, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("command %q not found in the PATH of Env", command)
+}
+
+// minimalEnv is the environment of a command when neither Env nor InheritEnv
+// is set: the process PATH and LANG, with HOME pointing at the work dir so
+// "~" and dotfiles do not reach the user's home.
+func minimalEnv(workDir string) []string {
+	keys := []string{"PATH", "LANG"}
+	if runtime.GOOS == "windows" {
+		// Windows binaries need these to start and to resolve extensions.
+		keys = append(keys, "SYSTEMROOT", "PATHEXT")
+	}
+	env := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+value)
+		}
+	}
+	if home, err := filepath.Abs(workDir); err == nil {
+		workDir = home
+	}
+	return append(env, "HOME="+workDir)
+}
+
+// escapingPathArg reports an argument that is an absolute path, a home
+// directory path or climbs out with "..". The same goes for every value after
+// an "=" ("--file=/etc/passwd", "if=/etc/shadow") and for a value attached to
+// a short flag ("-f/etc/passwd", "-o../x"), which is checked at every offset
+// since short flags may be grouped.
+func escapingPathArg(arg string) bool {
+	values := strings.Split(arg, "=")
+	if strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") {
+		for i := 2; i < len(arg); i++ {
+			values = append(values, arg[i:])
+		}
+	}
+	for _, value := range values {
+		if filepath.IsAbs(value) || strings.HasPrefix(value, "/") || strings.HasPrefix(value, `\`) || strings.HasPrefix(value, "~") {
+			return true
+		}
+		if filepath.VolumeName(value) != "" {
+			return true
+		}
+		for _, element := range strings.FieldsFunc(value, func(r rune) bool { return r == '/' || r == '\\' }) {
+			if element == ".." {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// limitedBuffer keeps the first max bytes written and drops the rest.
+type limitedBuffer struct {
+	max       int
+	data      []byte
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - len(b.data); room > 0 {
+		if len(p) > room {
+			b.data = append(b.data, p[:room]...)
+			b.truncated = true
+		} else {
+			b.data = append(b.data, p...)
+		}
+	} else if len(p) > 0 {
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return strings.ToValidUTF8(string(b.data), "")
+}
@@ -0,0 +1,7 @@
+// Package tools provides opt-in built-in tools: a sandboxed `cmd` runner,
+// `read_file`/`list_dir` restricted to configured roots, and a `browse` tool
+// that turns web pages into readable markdown.
+//
+// Nothing is registered by default. Configure a tool value and pass its Tools
+// to Register, or to Agent.RegisterTool one by one.
+package tools
@@ -0,0 +1,140 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+)
+
+const (
+	defaultMaxFileBytes  = 64 * 1024
+	defaultMaxDirEntries = 200
+)
+
+// Files gives read-only access to files below Roots. Paths are resolved with
+// symlinks followed, so links pointing outside the roots are rejected.
+type Files struct {
+	Roots []string
+	// MaxFileBytes caps read_file content. Defaults to 64KiB.
+	MaxFileBytes int
+	// MaxEntries caps list_dir entries. Defaults to 200.
+	MaxEntries int
+}
+
+type ReadFileArgs struct {
+	Path string `json:"path" desc:"file path, relative to an allowed root or absolute inside one"`
+}
+
+type ReadFileResult struct {
+	Path      string `json:"path"`
+	Content   string `json:"content"`
+	Size      int64  `json:"size"`
+	Truncated bool   `json:"truncated"`
+}
+
+type ListDirArgs struct {
+	Path string `json:"path,omitempty" desc:"directory path, defaults to the first root"`
+}
+
+type DirEntry struct {
+	Name string `json:"name"`
+	Type string `json:"type" desc:"file, dir or symlink"`
+	Size int64  `json:"size"`
+}
+
+type ListDirResult struct {
+	Path      string     `json:"path"`
+	Entries   []DirEntry `json:"entries"`
+	Truncated bool       `json:"truncated"`
+}
+
+func (f *Files) Tools() []Tool {
+	return []Tool{
+		{
+			Info: types.ToolInfo{Name: "read_file", Desc: "Read a text file from the allowed directories."},
+			Func: f.ReadFile,
+		},
+		{
+			Info: types.ToolInfo{Name: "list_dir", Desc: "List a directory inside the allowed directories."},
+			Func: f.ListDir,
+		},
+	}
+}
+
+func (f *Files) ReadFile(_ context.Context, args ReadFileArgs) (ReadFileResult, error) {
+	path, err := resolveInRoots(args.Path, f.Roots)
+	if err != nil {
+		return ReadFileResult{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return ReadFileResult{}, err
+	}
+	if info.IsDir() {
+		return ReadFileResult{}, fmt.Errorf("%s is a directory", args.Path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return ReadFileResult{}, err
+	}
+	defer file.Close()
+
+	maxBytes := f.MaxFileBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxFileBytes
+	}
+	data, err := io.ReadAll(io.LimitReader(file, int64(maxBytes)))
+	if err != nil {
+		return ReadFileResult{}, err
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return ReadFileResult{}, fmt.Errorf("%s looks like a binary file", args.Path)
+	}
+	return ReadFileResult{
+		Path:      path,
+		Content:   string(bytes.ToValidUTF8(data, nil)),
+		Size:      info.Size(),
+		Truncated: info.Size() > int64(len(data)),
+	}, nil
+}
+
+func (f *Files) ListDir(_ context.Context, args ListDirArgs) (ListDirResult, error) {
+	path, err := resolveInRoots(args.Path, f.Roots)
+	if err != nil {
+		return ListDirResult{}, err
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return ListDirResult{}, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	maxEntries := f.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxDirEntries
+	}
+	result := ListDirResult{Path: path, Entries: make([]DirEntry, 0, len(entries))}
+	for _, entry := range entries {
+		if len(result.Entries) == maxEntries {
+			result.Truncated = true
+			break
+		}
+		item := DirEntry{Name: entry.Name(), Type: "file"}
+		switch {
+		case entry.Type()&os.ModeSymlink != 0:
+			item.Type = "symlink"
+		case entry.IsDir():
+			item.Type = "dir"
+		}
+		if info, err := entry.Info(); err == nil && item.Type == "file" {
+			item.Size = info.Size()
+		}
+		result.Entries = append(result.Entries, item)
+	}
+	return result, nil
+}
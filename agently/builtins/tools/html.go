@@ -0,0 +1,383 @@
+package tools
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// skippedElements are dropped together with their content.
+var skippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"svg": true, "iframe": true, "head": true, "object": true,
+}
+
+var blockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true,
+	"header": true, "footer": true, "nav": true, "aside": true, "form": true,
+	"table": true, "tr": true, "ul": true, "ol": true, "dl": true, "dd": true,
+	"dt": true, "blockquote": true, "figure": true, "figcaption": true,
+	"details": true, "summary": true, "address": true,
+}
+
+var blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+
+// htmlToMarkdown extracts the title and a markdown rendering of an HTML page.
+// It is a forgiving single pass over the tags, not a full HTML parser: the goal
+// is readable text for a model, with headings, lists, links and code kept.
+func htmlToMarkdown(source string, base *url.URL) (string, string) {
+	c := &htmlConverter{source: source, lower: asciiLower(source), base: base}
+	c.run()
+	markdown := strings.ReplaceAll(c.out.String(), "\u00a0", " ")
+	lines := strings.Split(markdown, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	markdown = blankLinesPattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return c.title, strings.TrimSpace(markdown)
+}
+
+type htmlConverter struct {
+	source string
+	lower  string
+	base   *url.URL
+
+	out   strings.Builder
+	title string
+	pre   int
+	links []string
+	lists []int // 0 for ul, otherwise the next ol item number
+}
+
+func (c *htmlConverter) run() {
+	i := 0
+	for i < len(c.source) {
+		if c.source[i] != '<' {
+			next := strings.IndexByte(c.source[i:], '<')
+			if next < 0 {
+				next = len(c.source) - i
+			}
+			c.text(c.source[i : i+next])
+			i += next
+			continue
+		}
+		switch {
+		case strings.HasPrefix(c.source[i:], "<!--"):
+			end := strings.Index(c.source[i+4:], "-->")
+			if end < 0 {
+				return
+			}
+			i += 4 + end + 3
+		case strings.HasPrefix(c.source[i:], "<!") || strings.HasPrefix(c.source[i:], "<?"):
+			i = c.skipPast(i, ">")
+		default:
+			end := tagEnd(c.source, i)
+			if end < 0 {
+				c.text(c.source[i:])
+				return
+			}
+			name, closing, attrs := parseTag(c.source[i+1 : end])
+			i = end + 1
+			if name == "" {
+				c.text(c.source[i-1 : i])
+				continue
+			}
+			if !closing && (name == "title" || skippedElements[name]) {
+				contentEnd := strings.Index(c.lower[i:], "</"+name)
+				if contentEnd < 0 {
+					contentEnd = len(c.source) - i
+				}
+				if name == "title" && c.title == "" {
+					c.title = collapseSpace(html.UnescapeString(c.source[i : i+contentEnd]))
+				}
+				if name == "head" {
+					c.captureTitle(c.source[i : i+contentEnd])
+				}
+				i = c.skipPast(i+contentEnd, ">")
+				continue
+			}
+			c.tag(name, closing, attrs)
+		}
+	}
+}
+
+func (c *htmlConverter) captureTitle(head string) {
+	lower := asciiLower(head)
+	start := strings.Index(lower, "<title")
+	if start < 0 || c.title != "" {
+		return
+	}
+	open := tagEnd(head, start)
+	if open < 0 {
+		return
+	}
+	end := strings.Index(lower[open:], "</title")
+	if end < 0 {
+		return
+	}
+	c.title = collapseSpace(html.UnescapeString(head[open+1 : open+end]))
+}
+
+func (c *htmlConverter) skipPast(from int, marker string) int {
+	end := strings.Index(c.source[from:], marker)
+	if end < 0 {
+		return len(c.source)
+	}
+	return from + end + len(marker)
+}
+
+func (c *htmlConverter) tag(name string, closing bool, attrs map[string]string) {
+	switch {
+	case len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6':
+		c.block()
+		if !closing {
+			c.out.WriteString(strings.Repeat("#", int(name[1]-'0')) + " ")
+		}
+	case name == "br":
+		c.out.WriteString("\n")
+	case name == "hr":
+		c.block()
+		c.out.WriteString("---")
+		c.block()
+	case name == "li":
+		if closing {
+			return
+		}
+		c.newline()
+		c.out.WriteString(strings.Repeat("  ", max(len(c.lists)-1, 0)))
+		if n := len(c.lists); n > 0 && c.lists[n-1] > 0 {
+			c.out.WriteString(strconv.Itoa(c.lists[n-1]) + ". ")
+			c.lists[n-1]++
+		} else {
+			c.out.WriteString("- ")
+		}
+	case name == "ul" || name == "ol":
+		if closing && len(c.lists) > 0 {
+			c.lists = c.lists[:len(c.lists)-1]
+		}
+		// Nested lists stay attached to their parent item.
+		if len(c.lists) > 0 {
+			c.newline()
+		} else {
+			c.block()
+		}
+		if !closing {
+			start := 0
+			if name == "ol" {
+				start = 1
+			}
+			c.lists = append(c.lists, start)
+		}
+	case name == "pre":
+		if closing {
+			c.pre = max(c.pre-1, 0)
+			c.newline()
+			c.out.WriteString("```")
+			c.block()
+		} else {
+			c.block()
+			c.pre++
+			c.out.WriteString("```\n")
+		}
+	case name == "code":
+		if c.pre == 0 {
+			c.out.WriteString("`")
+		}
+	case name == "strong" || name == "b":
+		c.out.WriteString("**")
+	case name == "em" || name == "i":
+		c.out.WriteString("_")
+	case name == "a":
+		if closing {
+			if len(c.links) == 0 {
+				return
+			}
+			href := c.links[len(c.links)-1]
+			c.links = c.links[:len(c.links)-1]
+			if href != "" {
+				c.out.WriteString("](" + href + ")")
+			}
+			return
+		}
+		href := c.resolve(attrs["href"])
+		c.links = append(c.links, href)
+		if href != "" {
+			c.out.WriteString("[")
+		}
+	case name == "img":
+		if alt := collapseSpace(attrs["alt"]); alt != "" {
+			c.out.WriteString("![" + alt + "](" + c.resolve(attrs["src"]) + ")")
+		}
+	case name == "td" || name == "th":
+		if closing {
+			c.out.WriteString(" | ")
+		}
+	case blockElements[name]:
+		c.block()
+	}
+}
+
+// resolve makes link targets absolute and drops in-page and script links.
+func (c *htmlConverter) resolve(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return ""
+	}
+	if c.base == nil {
+		return href
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	return c.base.ResolveReference(ref).String()
+}
+
+func (c *htmlConverter) text(raw string) {
+	text := html.UnescapeString(raw)
+	if c.pre > 0 {
+		c.out.WriteString(text)
+		return
+	}
+	collapsed := collapseSpace(text)
+	if text != "" && isHTMLSpace(text[0]) {
+		collapsed = " " + collapsed
+	}
+	if collapsed != " " && text != "" && isHTMLSpace(text[len(text)-1]) {
+		collapsed += " "
+	}
+	s := c.out.String()
+	if c.atLineStart() || strings.HasSuffix(s, " ") || strings.HasSuffix(s, "[") {
+		collapsed = strings.TrimLeft(collapsed, " ")
+	}
+	c.out.WriteString(collapsed)
+}
+
+func (c *htmlConverter) atLineStart() bool {
+	s := c.out.String()
+	return s == "" || strings.HasSuffix(s, "\n")
+}
+
+func (c *htmlConverter) newline() {
+	if !c.atLineStart() {
+		c.out.WriteString("\n")
+	}
+}
+
+func (c *htmlConverter) block() {
+	s := c.out.String()
+	switch {
+	case s == "" || strings.HasSuffix(s, "\n\n"):
+	case strings.HasSuffix(s, "\n"):
+		c.out.WriteString("\n")
+	default:
+		c.out.WriteString("\n\n")
+	}
+}
+
+// tagEnd finds the '>' closing the tag that starts at start, skipping quoted
+// attribute values.
+func tagEnd(source string, start int) int {
+	var quote byte
+	for i := start + 1; i < len(source); i++ {
+		switch ch := source[i]; {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseTag splits the inside of `<...>` into a lower-case name, whether it is
+// a closing tag, and its attributes.
+func parseTag(inner string) (string, bool, map[string]string) {
+	closing := strings.HasPrefix(inner, "/")
+	inner = strings.TrimPrefix(inner, "/")
+	inner = strings.TrimSuffix(strings.TrimSpace(inner), "/")
+	end := 0
+	for end < len(inner) && (isASCIILetter(inner[end]) || (end > 0 && inner[end] >= '0' && inner[end] <= '9') || (end > 0 && inner[end] == '-')) {
+		end++
+	}
+	if end == 0 {
+		return "", closing, nil
+	}
+	return asciiLower(inner[:end]), closing, parseAttributes(inner[end:])
+}
+
+func parseAttributes(source string) map[string]string {
+	attrs := map[string]string{}
+	i := 0
+	for i < len(source) {
+		for i < len(source) && (isHTMLSpace(source[i]) || source[i] == '/') {
+			i++
+		}
+		start := i
+		for i < len(source) && source[i] != '=' && !isHTMLSpace(source[i]) && source[i] != '/' {
+			i++
+		}
+		name := asciiLower(source[start:i])
+		for i < len(source) && isHTMLSpace(source[i]) {
+			i++
+		}
+		value := ""
+		if i < len(source) && source[i] == '=' {
+			i++
+			for i < len(source) && isHTMLSpace(source[i]) {
+				i++
+			}
+			if i < len(source) && (source[i] == '"' || source[i] == '\'') {
+				quote := source[i]
+				end := strings.IndexByte(source[i+1:], quote)
+				if end < 0 {
+					end = len(source) - i - 1
+				}
+				value = source[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				start := i
+				for i < len(source) && !isHTMLSpace(source[i]) {
+					i++
+				}
+				value = source[start:i]
+			}
+		}
+		if name != "" {
+			attrs[name] = html.UnescapeString(value)
+		}
+	}
+	return attrs
+}
+
+func collapseSpace(text string) string {
+	return strings.Join(strings.FieldsFunc(text, func(r rune) bool {
+		return r < 128 && isHTMLSpace(byte(r))
+	}), " ")
+}
+
+func isHTMLSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == '\f'
+}
+
+func isASCIILetter(ch byte) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+// asciiLower lower-cases ASCII letters only, so byte offsets stay aligned with
+// the original string.
+func asciiLower(s string) string {
+	out := []byte(s)
+	for i, ch := range out {
+		if ch >= 'A' && ch <= 'Z' {
+			out[i] = ch + ('a' - 'A')
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,91 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AgentEra/Agently-Go/agently/core"
+	"github.com/AgentEra/Agently-Go/agently/types"
+)
+
+// Tag is added to every built-in tool registered through Register.
+const Tag = "agently-builtin"
+
+// Tool pairs a tool description with its function, ready for
+// ToolManager.Register.
+type Tool struct {
+	Info types.ToolInfo
+	Func any
+}
+
+// Register registers tools in manager with Tag plus the given tags.
+func Register(manager core.ToolManager, tools []Tool, tags ...string) error {
+	for _, tool := range tools {
+		info := tool.Info
+		info.Tags = append(append(append([]string{}, info.Tags...), Tag), tags...)
+		if err := manager.Register(info, tool.Func); err != nil {
+			return fmt.Errorf("register builtin tool %s: %w", info.Name, err)
+		}
+	}
+	return nil
+}
+
+// resolveInRoots resolves path inside one of roots, following symlinks so a
+// link cannot point outside them. Relative paths are tried against each root
+// in order.
+func resolveInRoots(path string, roots []string) (string, error) {
+	if len(roots) == 0 {
+		return "", fmt.Errorf("no allowed roots configured")
+	}
+	if strings.TrimSpace(path) == "" {
+		path = "."
+	}
+	candidates := []string{path}
+	if !filepath.IsAbs(path) {
+		candidates = candidates[:0]
+		for _, root := range roots {
+			candidates = append(candidates, filepath.Join(root, path))
+		}
+	}
+	var lastErr error
+	for _, candidate := range candidates {
+		resolved, err := filepath.EvalSymlinks(candidate)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resolved, err = filepath.Abs(resolved)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, root := range roots {
+			if withinRoot(root, resolved) {
+				return resolved, nil
+			}
+		}
+		lastErr = nil
+	}
+	if lastErr != nil && os.IsNotExist(lastErr) {
+		return "", fmt.Errorf("path %s does not exist", path)
+	}
+	return "", fmt.Errorf("path %s is outside the allowed roots", path)
+}
+
+func withinRoot(root string, path string) bool {
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+	resolvedRoot, err = filepath.Abs(resolvedRoot)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(resolvedRoot, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
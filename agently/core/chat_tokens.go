@@ -0,0 +1,84 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+const (
+	// chatMessageTokenOverhead approximates the role and separator tokens chat
+	// formats add to every message.
+	chatMessageTokenOverhead = 4
+	// chatMediaTokenEstimate is charged for each non-text content part, such
+	// as an image.
+	chatMediaTokenEstimate = 85
+)
+
+// CountChatTokens estimates the tokens messages take in a chat request. Nil
+// counter means utils.HeuristicTokenCounter.
+func CountChatTokens(counter utils.TokenCounter, messages []types.ChatMessage) int {
+	total := 0
+	for _, message := range messages {
+		total += countChatMessageTokens(counter, message)
+	}
+	return total
+}
+
+func countChatMessageTokens(counter utils.TokenCounter, message types.ChatMessage) int {
+	if counter == nil {
+		counter = utils.HeuristicTokenCounter{}
+	}
+	text, media := chatMessageText(message)
+	return chatMessageTokenOverhead + counter.CountTokens(text) + media*chatMediaTokenEstimate
+}
+
+// chatMessageLength is the length in characters of a message's text, as
+// measured by session.max_length.
+func chatMessageLength(message types.ChatMessage) int {
+	text, _ := chatMessageText(message)
+	return utf8.RuneCountInString(text)
+}
+
+// chatMessageText flattens a message into the text a model reads and counts
+// its non-text content parts.
+func chatMessageText(message types.ChatMessage) (string, int) {
+	parts := make([]string, 0, 1+len(message.ToolCalls))
+	media := 0
+	var collect func(content any)
+	collect = func(content any) {
+		switch typed := content.(type) {
+		case nil:
+		case string:
+			parts = append(parts, typed)
+		case map[string]any:
+			kind, hasType := typed["type"].(string)
+			switch {
+			case !hasType:
+				parts = append(parts, fmt.Sprint(utils.DataFormatterSanitize(typed, false)))
+			case kind == "text":
+				parts = append(parts, fmt.Sprint(typed["text"]))
+			default:
+				media++
+			}
+		case []map[string]any:
+			for _, item := range typed {
+				collect(item)
+			}
+		case []any:
+			for _, item := range typed {
+				collect(item)
+			}
+		default:
+			parts = append(parts, fmt.Sprint(utils.DataFormatterSanitize(typed, false)))
+		}
+	}
+	collect(message.Content)
+	for _, call := range message.ToolCalls {
+		parts = append(parts, call.Name, call.Arguments)
+	}
+	return strings.Join(parts, "\n"), media
+}
@@ -58,6 +58,16 @@ func EmitSystemMessage(settings *utils.Settings, messageType types.SystemEvent,
 	return center.SystemMessage(messageType, data, settings)
 }
 
+// EmitWarning sends a warning from module through the configured EventCenter.
+// It is a no-op when no EventCenter is bound into settings.
+func EmitWarning(settings *utils.Settings, module string, meta map[string]any, content any) error {
+	center := eventCenterFromSettings(settings)
+	if center == nil {
+		return nil
+	}
+	return center.CreateMessenger(module, meta).Warning(content)
+}
+
 func getBoolSetting(settings *utils.Settings, key string, fallback bool) bool {
 	if settings == nil {
 		return fallback
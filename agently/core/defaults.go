@@ -28,12 +28,75 @@ var DefaultSettings = map[string]any{
 	},
 	"session": map[string]any{
 		"max_length": nil,
+		// max_tokens trims the context window by tokens, leaving
+		// reserved_tokens for the system prompt and the output.
+		"max_tokens": nil,
+		"reserved_tokens": map[string]any{
+			"system": 0,
+			"output": 0,
+		},
+		"bpe_vocab": nil,
+		// resize_strategy runs when the window exceeds the limits: simple_cut
+		// drops old turns, summarize folds them into memo.summary.
+		"resize_strategy": "simple_cut",
+		"summarize": map[string]any{
+			// keep_messages is how many of the newest messages, not turns,
+			// stay in the window; timeout (seconds) bounds each summary.
+			"keep_messages": 4,
+			"max_length":    1000,
+			"prompt":        DefaultSessionSummaryPrompt,
+			"timeout":       60,
+		},
 		"input_keys": nil,
 		"reply_keys": nil,
+		// record_tool_calls keeps native tool calls and results in the session.
+		"record_tool_calls": true,
+		// autosave saves the active session to its store after each turn.
+		"autosave": true,
+		// idle_ttl (seconds) and max_sessions bound the sessions an agent
+		// keeps in memory; inactive sessions are evicted past either.
+		"idle_ttl":     nil,
+		"max_sessions": nil,
+		// evict_save_attempts is how many evictions a session whose save
+		// fails survives before it is evicted unsaved; 0 keeps it until saved.
+		"evict_save_attempts": 3,
+	},
+	"memory": map[string]any{
+		// top_k memories scoring min_score or more join each request.
+		"top_k":     5,
+		"min_score": 0.0,
+		// A new fact scoring merge_score or more against a memory replaces it.
+		// Only near-identical restatements merge by default: lower values
+		// also merge corrections, but distinct facts worded alike as well.
+		"merge_score":  0.98,
+		"auto_extract": true,
+		// async_extract stores the facts of a turn in the background, so
+		// the reply does not wait for the extraction requests.
+		"async_extract":  true,
+		"extract_prompt": DefaultMemoryExtractPrompt,
+		"scope":          nil,
+		"timeout":        60,
+	},
+	// embedding.model is the model of embeddings requests; nil uses the
+	// model requester's default embeddings model.
+	"embedding": map[string]any{
+		"model": nil,
 	},
 	"response": map[string]any{
 		"streaming_parse":            false,
 		"streaming_parse_path_style": "dot",
+		// json_repair is off, basic or lenient; the repairs applied to the
+		// final result are listed in its Repairs, not per streamed chunk.
+		"json_repair": "lenient",
+		"reasoning_tags": map[string]any{
+			"enabled": true,
+			"open":    "<think>",
+			"close":   "</think>",
+			// leading_window bytes of untagged leading text wait for a close
+			// tag without an opener, for templates that put the open tag in
+			// the prompt. 0 streams them right away.
+			"leading_window": 0,
+		},
 	},
 	"runtime": map[string]any{
 		"default_timeout_seconds": 120,
@@ -43,6 +106,25 @@ var DefaultSettings = map[string]any{
 		"show_tool_logs":          false,
 		"show_trigger_flow_logs":  false,
 	},
+	"tool": map[string]any{
+		"mode":           "judge",
+		"max_rounds":     5,
+		"concurrency":    4,
+		"name_collision": "error",
+		// cache.max_entries bounds each tool result cache, least recently
+		// used results dropped first; 0 leaves them unbounded.
+		"cache": map[string]any{
+			"max_entries": DefaultToolCacheMaxEntries,
+		},
+		"kwargs": map[string]any{
+			"validate": true,
+			"coerce":   false,
+			"retry":    false,
+		},
+		"react": map[string]any{
+			"max_steps": 6,
+		},
+	},
 	"plugins": map[string]any{
 		"ToolManager": map[string]any{"activate": "AgentlyToolManager"},
 	},
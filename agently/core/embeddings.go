@@ -0,0 +1,119 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+// Embedder turns texts into embedding vectors, one per text and in order.
+type Embedder func(ctx context.Context, texts []string) ([][]float64, error)
+
+// RequestEmbeddings requests embeddings of texts from the activated model
+// requester, switched to model_type "embeddings". The model is
+// embedding.model when set, otherwise the requester's default embeddings
+// model, so a chat model configured for the agent is not reused.
+func RequestEmbeddings(ctx context.Context, pluginManager *PluginManager, settings *utils.Settings, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return [][]float64{}, nil
+	}
+	if pluginManager == nil {
+		return nil, errors.New("embeddings request needs a plugin manager")
+	}
+	spec, err := pluginManager.GetActivatedPlugin(PluginTypeModelRequester)
+	if err != nil {
+		return nil, err
+	}
+	request := NewModelRequest(pluginManager, "Embeddings Request", settings, nil, nil)
+	requester := request.Settings().Namespace("plugins.ModelRequester." + spec.Name).RuntimeDataNamespace
+	requester.Set("model_type", "embeddings")
+	if model := request.Settings().Get("embedding.model", nil, true); model != nil && fmt.Sprint(model) != "" {
+		requester.Set("model", model)
+	} else if model := requester.Get("default_model.embeddings", nil, true); model != nil {
+		requester.Set("model", model)
+	}
+	inputs := make([]any, len(texts))
+	for i, text := range texts {
+		inputs[i] = text
+	}
+	request.SetPrompt("input", inputs)
+
+	original, err := request.GetDataWithContext(ctx, GetDataOptions{Type: "original"})
+	if err != nil {
+		return nil, err
+	}
+	return parseEmbeddingsResponse(original, len(texts))
+}
+
+// AgentEmbedder embeds with the model requester and settings of agent.
+func AgentEmbedder(agent *BaseAgent) Embedder {
+	return func(ctx context.Context, texts []string) ([][]float64, error) {
+		return RequestEmbeddings(ctx, agent.PluginManager(), agent.Settings(), texts)
+	}
+}
+
+// parseEmbeddingsResponse reads an OpenAI style embeddings response:
+// {"data": [{"index": 0, "embedding": [...]}, ...]}.
+func parseEmbeddingsResponse(original any, want int) ([][]float64, error) {
+	response, ok := original.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected embeddings response: %v", original)
+	}
+	if apiError, ok := response["error"]; ok && apiError != nil {
+		return nil, fmt.Errorf("embeddings request failed: %v", apiError)
+	}
+	items, _ := response["data"].([]any)
+	type indexed struct {
+		index     int
+		embedding []float64
+	}
+	ordered := make([]indexed, 0, len(items))
+	for position, item := range items {
+		entry, _ := item.(map[string]any)
+		values, _ := entry["embedding"].([]any)
+		embedding := make([]float64, 0, len(values))
+		for _, value := range values {
+			number, ok := value.(float64)
+			if !ok {
+				return nil, fmt.Errorf("embedding %d is not a list of numbers", position)
+			}
+			embedding = append(embedding, number)
+		}
+		index := position
+		if number, ok := entry["index"].(float64); ok {
+			index = int(number)
+		}
+		ordered = append(ordered, indexed{index: index, embedding: embedding})
+	}
+	if len(ordered) != want {
+		return nil, fmt.Errorf("embeddings response has %d embeddings for %d inputs", len(ordered), want)
+	}
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].index < ordered[j].index })
+	out := make([][]float64, len(ordered))
+	for i, item := range ordered {
+		out[i] = item.embedding
+	}
+	return out, nil
+}
+
+// CosineSimilarity returns the cosine of the angle between a and b, or 0 when
+// their lengths differ or one of them is zero.
+func CosineSimilarity(a []float64, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
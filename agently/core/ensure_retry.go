@@ -0,0 +1,138 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+const (
+	// RetryModeResend re-sends the identical prompt when ensure checks fail.
+	RetryModeResend = "resend"
+	// RetryModeCorrective re-sends the prompt together with the previous answer
+	// and a message naming every missing or invalid path.
+	RetryModeCorrective = "corrective"
+)
+
+// DefaultCorrectionTemplate is used by corrective retries when
+// GetDataOptions.CorrectionTemplate is empty. Supported placeholders:
+// ${issues}, ${missing_keys}, ${invalid_keys} and ${retry_count}.
+const DefaultCorrectionTemplate = "Your previous response did not meet the output requirement:\n" +
+	"${issues}\n" +
+	"Output the complete result again and fix every problem listed above."
+
+// Prompt keys used to carry corrective retry context into the next request.
+const (
+	correctionPreviousResponseKey = "YOUR PREVIOUS RESPONSE"
+	correctionMessageKey          = "CORRECTION REQUIRED"
+)
+
+// EnsureIssue describes one path that is missing or invalid in parsed data.
+type EnsureIssue struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// EnsureValidator reports invalid paths in parsed data. It runs after
+// EnsureKeys checks and its issues trigger retries the same way.
+type EnsureValidator func(data any) []EnsureIssue
+
+// EnsureRetryRecord is one failed attempt recorded while retrying GetData.
+type EnsureRetryRecord struct {
+	Attempt    int           `json:"attempt"`
+	Mode       string        `json:"mode"`
+	Issues     []EnsureIssue `json:"issues"`
+	Response   string        `json:"response"`
+	Correction string        `json:"correction,omitempty"`
+}
+
+const ensureReasonMissing = "missing"
+
+func collectEnsureIssues(data any, opts GetDataOptions) []EnsureIssue {
+	issues := make([]EnsureIssue, 0)
+	for _, key := range opts.EnsureKeys {
+		marker := &struct{}{}
+		v := utils.LocatePathInData(data, key, opts.KeyStyle, marker)
+		if v == marker {
+			issues = append(issues, EnsureIssue{Path: key, Reason: ensureReasonMissing})
+		}
+	}
+	if opts.Validator != nil && data != nil {
+		issues = append(issues, opts.Validator(data)...)
+	}
+	return issues
+}
+
+func ensureIssuePaths(issues []EnsureIssue, missing bool) []string {
+	out := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		if (issue.Reason == ensureReasonMissing) == missing {
+			out = append(out, issue.Path)
+		}
+	}
+	return out
+}
+
+func renderCorrectionMessage(template string, issues []EnsureIssue, retryCount int) string {
+	if strings.TrimSpace(template) == "" {
+		template = DefaultCorrectionTemplate
+	}
+	lines := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		lines = append(lines, fmt.Sprintf("- %s: %s", issue.Path, issue.Reason))
+	}
+	rendered := utils.DataFormatterSubstitutePlaceholder(template, map[string]any{
+		"issues":       strings.Join(lines, "\n"),
+		"missing_keys": strings.Join(ensureIssuePaths(issues, true), ", "),
+		"invalid_keys": strings.Join(ensureIssuePaths(issues, false), ", "),
+		"retry_count":  retryCount,
+	}, nil)
+	return fmt.Sprint(rendered)
+}
+
+// buildCorrectivePrompt copies prompt and appends the previous answers plus the
+// correction message as extra prompt keys.
+func buildCorrectivePrompt(pluginManager *PluginManager, settings *utils.Settings, prompt *Prompt, history []EnsureRetryRecord, limit int) *Prompt {
+	snapshot, _ := prompt.Get("", map[string]any{}, true).(map[string]any)
+	corrective := NewPrompt(pluginManager, settings, snapshot, nil, "Corrective-Prompt")
+	if limit <= 0 {
+		limit = 1
+	}
+	if len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	last := history[len(history)-1]
+	if len(history) == 1 {
+		corrective.Set(correctionPreviousResponseKey, last.Response)
+	} else {
+		previous := make([]any, 0, len(history))
+		for _, record := range history {
+			previous = append(previous, record.Response)
+		}
+		corrective.Set(correctionPreviousResponseKey, previous)
+	}
+	corrective.Set(correctionMessageKey, last.Correction)
+	return corrective
+}
+
+func ensureRetriesMeta(history []EnsureRetryRecord) []map[string]any {
+	out := make([]map[string]any, 0, len(history))
+	for _, record := range history {
+		issues := make([]any, 0, len(record.Issues))
+		for _, issue := range record.Issues {
+			issues = append(issues, map[string]any{"path": issue.Path, "reason": issue.Reason})
+		}
+		item := map[string]any{
+			"attempt":  record.Attempt,
+			"mode":     record.Mode,
+			"issues":   issues,
+			"response": record.Response,
+		}
+		if record.Correction != "" {
+			item["correction"] = record.Correction
+		}
+		out = append(out, item)
+	}
+	return out
+}
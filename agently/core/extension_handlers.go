@@ -12,11 +12,16 @@ type BroadcastPrefixHandler func(context.Context, *types.ModelResult, *utils.Set
 type BroadcastSuffixHandler func(context.Context, types.ResponseEvent, any, *types.ModelResult, *utils.Settings) ([]types.ResponseMessage, error)
 type FinallyHandler func(context.Context, *ModelResponseResult, *utils.Settings) error
 
+// ToolCallHandler executes the tool calls returned by one model round and
+// returns one step per call, in call order.
+type ToolCallHandler func(context.Context, []types.ToolCall, *utils.Settings) ([]types.ToolStep, error)
+
 type ExtensionHandlers struct {
 	RequestPrefixes   []RequestPrefixHandler
 	BroadcastPrefixes []BroadcastPrefixHandler
 	BroadcastSuffixes map[types.ResponseEvent][]BroadcastSuffixHandler
 	FinallyHandlers   []FinallyHandler
+	ToolCallHandler   ToolCallHandler
 }
 
 func NewExtensionHandlers(parent *ExtensionHandlers) *ExtensionHandlers {
@@ -33,6 +38,7 @@ func NewExtensionHandlers(parent *ExtensionHandlers) *ExtensionHandlers {
 			h.BroadcastSuffixes[event] = append([]BroadcastSuffixHandler{}, handlers...)
 		}
 		h.FinallyHandlers = append(h.FinallyHandlers, parent.FinallyHandlers...)
+		h.ToolCallHandler = parent.ToolCallHandler
 	}
 	return h
 }
@@ -55,3 +61,9 @@ func (h *ExtensionHandlers) AppendBroadcastSuffix(event types.ResponseEvent, han
 func (h *ExtensionHandlers) AppendFinally(handler FinallyHandler) {
 	h.FinallyHandlers = append(h.FinallyHandlers, handler)
 }
+
+// SetToolCallHandler enables the native tool loop for responses created from
+// these handlers.
+func (h *ExtensionHandlers) SetToolCallHandler(handler ToolCallHandler) {
+	h.ToolCallHandler = handler
+}
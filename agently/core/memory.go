@@ -0,0 +1,255 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+// DefaultMemoryExtractPrompt is the instruction of memory.extract_prompt when
+// none is configured.
+const DefaultMemoryExtractPrompt = "List the facts from the new turn worth remembering in later conversations: who the user is, their preferences, plans, decisions and corrections of known memories. Write each fact as one short standalone sentence. Skip small talk, questions and known memories that did not change. Reply with an empty list when nothing is worth remembering."
+
+var (
+	// ErrNoMemoryEmbedder is returned by a MemoryBank without an Embedder.
+	ErrNoMemoryEmbedder = errors.New("memory bank has no embedder")
+	// ErrNoMemoryExtractor is returned by MemorizeTurn without a MemoryExtractor.
+	ErrNoMemoryExtractor = errors.New("memory bank has no extractor")
+)
+
+// MemoryExtractionRequest is what a MemoryExtractor reads facts from.
+type MemoryExtractionRequest struct {
+	Scope string
+	// Messages is the turn to extract facts from.
+	Messages []types.ChatMessage
+	// Known are the memories of the scope most related to the turn, so facts
+	// already remembered can be skipped or corrected.
+	Known []Memory
+	// Prompt is the extraction instruction from memory.extract_prompt.
+	Prompt string
+}
+
+// MemoryExtractor returns the facts of a turn worth remembering, one sentence
+// each.
+type MemoryExtractor func(ctx context.Context, request MemoryExtractionRequest) ([]string, error)
+
+// AgentMemoryExtractor extracts facts with temporary requests of agent. Like
+// AgentSessionSummarizer, they use the agent's model but neither its prompt
+// nor its extension handlers.
+func AgentMemoryExtractor(agent *BaseAgent) MemoryExtractor {
+	return func(ctx context.Context, request MemoryExtractionRequest) ([]string, error) {
+		known := make([]any, 0, len(request.Known))
+		for _, memory := range request.Known {
+			known = append(known, memory.Content)
+		}
+		modelRequest := agent.CreateTempRequest()
+		modelRequest.Input(map[string]any{
+			"known_memories": known,
+			"new_turn":       FormatChatTranscript(request.Messages),
+		})
+		modelRequest.Instruct(request.Prompt)
+		modelRequest.Output(map[string]any{"facts": []any{"string"}})
+		data, err := modelRequest.GetDataWithContext(ctx, GetDataOptions{EnsureKeys: []string{"facts"}})
+		if err != nil {
+			return nil, err
+		}
+		parsed, _ := data.(map[string]any)
+		items, _ := parsed["facts"].([]any)
+		facts := make([]string, 0, len(items))
+		for _, item := range items {
+			facts = append(facts, fmt.Sprint(item))
+		}
+		return facts, nil
+	}
+}
+
+// MemoryBank remembers facts in a MemoryStore, embedded by an Embedder, and
+// reads the memory.* options from its settings.
+type MemoryBank struct {
+	store     MemoryStore
+	embedder  Embedder
+	extractor MemoryExtractor
+	settings  *utils.Settings
+}
+
+var memorySequence atomic.Uint64
+
+func NewMemoryBank(store MemoryStore, embedder Embedder, extractor MemoryExtractor, settings *utils.Settings) *MemoryBank {
+	if store == nil {
+		store = NewLocalMemoryStore()
+	}
+	if settings == nil {
+		settings = NewDefaultSettings(nil)
+	}
+	return &MemoryBank{store: store, embedder: embedder, extractor: extractor, settings: settings}
+}
+
+func (b *MemoryBank) Store() MemoryStore { return b.store }
+
+// Remember stores content in scope. When a memory of scope scores
+// memory.merge_score or more against content it is replaced instead, so
+// restated facts do not pile up.
+func (b *MemoryBank) Remember(ctx context.Context, scope string, content string) (Memory, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return Memory{}, errors.New("memory content is empty")
+	}
+	embeddings, err := b.embed(ctx, []string{content})
+	if err != nil {
+		return Memory{}, err
+	}
+	return b.remember(ctx, scope, content, embeddings[0])
+}
+
+// Recall returns the memory.top_k memories of scope most similar to query
+// that score memory.min_score or more, best first.
+func (b *MemoryBank) Recall(ctx context.Context, scope string, query string) ([]MemoryMatch, error) {
+	if strings.TrimSpace(query) == "" {
+		return []MemoryMatch{}, nil
+	}
+	embeddings, err := b.embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	options := b.options()
+	topK := namespaceInt(options, "top_k")
+	if topK <= 0 {
+		return []MemoryMatch{}, nil
+	}
+	matches, err := b.store.Search(ctx, scope, embeddings[0], topK)
+	if err != nil {
+		return nil, err
+	}
+	minScore := namespaceFloat(options, "min_score")
+	kept := matches[:0]
+	for _, match := range matches {
+		if match.Score >= minScore {
+			kept = append(kept, match)
+		}
+	}
+	return kept, nil
+}
+
+func (b *MemoryBank) List(ctx context.Context, scope string) ([]Memory, error) {
+	return b.store.List(ctx, scope)
+}
+
+func (b *MemoryBank) Delete(ctx context.Context, scope string, id string) error {
+	return b.store.Delete(ctx, scope, id)
+}
+
+// Correct replaces the content of memory id and embeds it again.
+func (b *MemoryBank) Correct(ctx context.Context, scope string, id string, content string) (Memory, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return Memory{}, errors.New("memory content is empty")
+	}
+	memory, err := b.store.Get(ctx, scope, id)
+	if err != nil {
+		return Memory{}, err
+	}
+	embeddings, err := b.embed(ctx, []string{content})
+	if err != nil {
+		return Memory{}, err
+	}
+	memory.Content, memory.Embedding, memory.UpdatedAt = content, embeddings[0], time.Now()
+	return memory, b.store.Put(ctx, memory)
+}
+
+// MemorizeTurn extracts the facts of a turn and remembers each of them. The
+// extractor sees the memories the turn recalls, so it can skip known facts
+// and restate changed ones, which replace the old memory when they score
+// memory.merge_score against it.
+func (b *MemoryBank) MemorizeTurn(ctx context.Context, scope string, messages []types.ChatMessage) ([]Memory, error) {
+	if b.extractor == nil {
+		return nil, ErrNoMemoryExtractor
+	}
+	if len(messages) == 0 {
+		return []Memory{}, nil
+	}
+	known, err := b.Recall(ctx, scope, FormatChatTranscript(messages))
+	if err != nil {
+		return nil, err
+	}
+	knownMemories := make([]Memory, 0, len(known))
+	for _, match := range known {
+		knownMemories = append(knownMemories, match.Memory)
+	}
+	extracted, err := b.extractor(ctx, MemoryExtractionRequest{
+		Scope:    scope,
+		Messages: messages,
+		Known:    knownMemories,
+		Prompt:   sessionStringSetting(b.options(), "extract_prompt", DefaultMemoryExtractPrompt),
+	})
+	if err != nil {
+		return nil, err
+	}
+	facts := make([]string, 0, len(extracted))
+	for _, fact := range extracted {
+		if fact = strings.TrimSpace(fact); fact != "" {
+			facts = append(facts, fact)
+		}
+	}
+	if len(facts) == 0 {
+		return []Memory{}, nil
+	}
+	embeddings, err := b.embed(ctx, facts)
+	if err != nil {
+		return nil, err
+	}
+	memories := make([]Memory, 0, len(facts))
+	for i, fact := range facts {
+		memory, err := b.remember(ctx, scope, fact, embeddings[i])
+		if err != nil {
+			return memories, err
+		}
+		memories = append(memories, memory)
+	}
+	return memories, nil
+}
+
+func (b *MemoryBank) remember(ctx context.Context, scope string, content string, embedding []float64) (Memory, error) {
+	now := time.Now()
+	memory := Memory{
+		ID:        fmt.Sprintf("mem-%d-%d", now.UnixNano(), memorySequence.Add(1)),
+		Scope:     scope,
+		Content:   content,
+		Embedding: embedding,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if mergeScore := namespaceFloat(b.options(), "merge_score"); mergeScore > 0 {
+		matches, err := b.store.Search(ctx, scope, embedding, 1)
+		if err != nil {
+			return Memory{}, err
+		}
+		if len(matches) > 0 && matches[0].Score >= mergeScore {
+			memory.ID, memory.CreatedAt = matches[0].ID, matches[0].CreatedAt
+		}
+	}
+	return memory, b.store.Put(ctx, memory)
+}
+
+func (b *MemoryBank) embed(ctx context.Context, texts []string) ([][]float64, error) {
+	if b.embedder == nil {
+		return nil, ErrNoMemoryEmbedder
+	}
+	embeddings, err := b.embedder(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddings) != len(texts) {
+		return nil, fmt.Errorf("embedder returned %d embeddings for %d texts", len(embeddings), len(texts))
+	}
+	return embeddings, nil
+}
+
+func (b *MemoryBank) options() *utils.RuntimeDataNamespace {
+	return b.settings.Namespace("memory").RuntimeDataNamespace
+}
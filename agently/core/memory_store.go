@@ -0,0 +1,249 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrMemoryNotFound is returned by a MemoryStore for unknown memories.
+var ErrMemoryNotFound = errors.New("memory not found")
+
+// Memory is a fact remembered across sessions. Scope is the user or session
+// key it belongs to; memories are only searched within their scope.
+type Memory struct {
+	ID        string    `json:"id"`
+	Scope     string    `json:"scope"`
+	Content   string    `json:"content"`
+	Embedding []float64 `json:"embedding,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MemoryMatch is a memory found by a search, with its cosine similarity to
+// the query.
+type MemoryMatch struct {
+	Memory
+	Score float64 `json:"score"`
+}
+
+// MemoryStore keeps memories with their embeddings.
+type MemoryStore interface {
+	// Put inserts memory, or replaces the one with the same scope and ID.
+	Put(ctx context.Context, memory Memory) error
+	Get(ctx context.Context, scope string, id string) (Memory, error)
+	Delete(ctx context.Context, scope string, id string) error
+	// List returns the memories of scope, oldest first.
+	List(ctx context.Context, scope string) ([]Memory, error)
+	// Search returns the topK memories of scope most similar to embedding,
+	// best first.
+	Search(ctx context.Context, scope string, embedding []float64, topK int) ([]MemoryMatch, error)
+}
+
+// LocalMemoryStore keeps memories in process and searches them by brute-force
+// cosine similarity. Its memories are lost with the process.
+type LocalMemoryStore struct {
+	scopes map[string]map[string]Memory
+	mu     sync.RWMutex
+}
+
+func NewLocalMemoryStore() *LocalMemoryStore {
+	return &LocalMemoryStore{scopes: map[string]map[string]Memory{}}
+}
+
+func (s *LocalMemoryStore) Put(ctx context.Context, memory Memory) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if memory.ID == "" {
+		return errors.New("memory id is empty")
+	}
+	memory.Embedding = append([]float64(nil), memory.Embedding...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.scopes[memory.Scope] == nil {
+		s.scopes[memory.Scope] = map[string]Memory{}
+	}
+	s.scopes[memory.Scope][memory.ID] = memory
+	return nil
+}
+
+func (s *LocalMemoryStore) Get(ctx context.Context, scope string, id string) (Memory, error) {
+	if err := ctx.Err(); err != nil {
+		return Memory{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	memory, ok := s.scopes[scope][id]
+	if !ok {
+		return Memory{}, ErrMemoryNotFound
+	}
+	return copyMemory(memory), nil
+}
+
+func (s *LocalMemoryStore) Delete(ctx context.Context, scope string, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.scopes[scope][id]; !ok {
+		return ErrMemoryNotFound
+	}
+	delete(s.scopes[scope], id)
+	if len(s.scopes[scope]) == 0 {
+		delete(s.scopes, scope)
+	}
+	return nil
+}
+
+func (s *LocalMemoryStore) List(ctx context.Context, scope string) ([]Memory, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	memories := make([]Memory, 0, len(s.scopes[scope]))
+	for _, memory := range s.scopes[scope] {
+		memories = append(memories, copyMemory(memory))
+	}
+	s.mu.RUnlock()
+	sort.Slice(memories, func(i, j int) bool {
+		if !memories[i].CreatedAt.Equal(memories[j].CreatedAt) {
+			return memories[i].CreatedAt.Before(memories[j].CreatedAt)
+		}
+		return memories[i].ID < memories[j].ID
+	})
+	return memories, nil
+}
+
+func (s *LocalMemoryStore) Search(ctx context.Context, scope string, embedding []float64, topK int) ([]MemoryMatch, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	matches := make([]MemoryMatch, 0, len(s.scopes[scope]))
+	for _, memory := range s.scopes[scope] {
+		matches = append(matches, MemoryMatch{Memory: copyMemory(memory), Score: CosineSimilarity(embedding, memory.Embedding)})
+	}
+	s.mu.RUnlock()
+	sortMemoryMatches(matches)
+	if topK > 0 && len(matches) > topK {
+		matches = matches[:topK]
+	}
+	return matches, nil
+}
+
+func sortMemoryMatches(matches []MemoryMatch) {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ID < matches[j].ID
+	})
+}
+
+func copyMemory(memory Memory) Memory {
+	memory.Embedding = append([]float64(nil), memory.Embedding...)
+	return memory
+}
+
+// VectorMemoryStore keeps memories in a VectorStore, e.g. a LocalVectorStore
+// opened with a path to keep them across restarts. The scope and timestamps
+// of a memory are stored as metadata.
+type VectorMemoryStore struct {
+	store VectorStore
+}
+
+func NewVectorMemoryStore(store VectorStore) *VectorMemoryStore {
+	return &VectorMemoryStore{store: store}
+}
+
+func (s *VectorMemoryStore) Put(ctx context.Context, memory Memory) error {
+	if memory.ID == "" {
+		return errors.New("memory id is empty")
+	}
+	return s.store.Upsert(ctx, VectorDocument{
+		ID:      vectorMemoryID(memory.Scope, memory.ID),
+		Content: memory.Content,
+		Metadata: map[string]any{
+			"kind":       "memory",
+			"scope":      memory.Scope,
+			"memory_id":  memory.ID,
+			"created_at": memory.CreatedAt.Format(time.RFC3339Nano),
+			"updated_at": memory.UpdatedAt.Format(time.RFC3339Nano),
+		},
+		Embedding: memory.Embedding,
+	})
+}
+
+func (s *VectorMemoryStore) Get(ctx context.Context, scope string, id string) (Memory, error) {
+	documents, err := s.store.Get(ctx, vectorMemoryID(scope, id))
+	if err != nil {
+		return Memory{}, err
+	}
+	if len(documents) == 0 {
+		return Memory{}, ErrMemoryNotFound
+	}
+	return memoryFromVectorDocument(documents[0]), nil
+}
+
+func (s *VectorMemoryStore) Delete(ctx context.Context, scope string, id string) error {
+	if _, err := s.Get(ctx, scope, id); err != nil {
+		return err
+	}
+	return s.store.Delete(ctx, vectorMemoryID(scope, id))
+}
+
+func (s *VectorMemoryStore) List(ctx context.Context, scope string) ([]Memory, error) {
+	documents, err := s.store.List(ctx, vectorMemoryFilter(scope))
+	if err != nil {
+		return nil, err
+	}
+	memories := make([]Memory, 0, len(documents))
+	for _, document := range documents {
+		memories = append(memories, memoryFromVectorDocument(document))
+	}
+	sort.SliceStable(memories, func(i, j int) bool {
+		if !memories[i].CreatedAt.Equal(memories[j].CreatedAt) {
+			return memories[i].CreatedAt.Before(memories[j].CreatedAt)
+		}
+		return memories[i].ID < memories[j].ID
+	})
+	return memories, nil
+}
+
+func (s *VectorMemoryStore) Search(ctx context.Context, scope string, embedding []float64, topK int) ([]MemoryMatch, error) {
+	found, err := s.store.Query(ctx, embedding, topK, vectorMemoryFilter(scope))
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]MemoryMatch, 0, len(found))
+	for _, match := range found {
+		matches = append(matches, MemoryMatch{Memory: memoryFromVectorDocument(match.VectorDocument), Score: match.Score})
+	}
+	return matches, nil
+}
+
+func vectorMemoryID(scope string, id string) string {
+	return "memory/" + url.PathEscape(scope) + "/" + id
+}
+
+func vectorMemoryFilter(scope string) VectorFilter {
+	return VectorFilter{"kind": "memory", "scope": scope}
+}
+
+func memoryFromVectorDocument(document VectorDocument) Memory {
+	memory := Memory{Content: document.Content, Embedding: document.Embedding}
+	memory.Scope, _ = document.Metadata["scope"].(string)
+	memory.ID, _ = document.Metadata["memory_id"].(string)
+	if created, ok := document.Metadata["created_at"].(string); ok {
+		memory.CreatedAt, _ = time.Parse(time.RFC3339Nano, created)
+	}
+	if updated, ok := document.Metadata["updated_at"].(string); ok {
+		memory.UpdatedAt, _ = time.Parse(time.RFC3339Nano, updated)
+	}
+	return memory
+}
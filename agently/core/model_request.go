@@ -17,18 +17,39 @@ type GetDataOptions struct {
 	MaxRetries         int
 	RaiseEnsureFailure bool
 	RetryCount         int
+
+	// RetryMode is RetryModeResend (default) or RetryModeCorrective.
+	RetryMode string
+	// CorrectionTemplate overrides DefaultCorrectionTemplate for corrective retries.
+	CorrectionTemplate string
+	// CorrectionHistory caps how many previous answers a corrective retry carries (default 1).
+	CorrectionHistory int
+	// Validator reports invalid paths in parsed data in addition to EnsureKeys.
+	Validator EnsureValidator
+
+	retryHistory []EnsureRetryRecord
+	// dataObject returns the data object of the accepted response instead of
+	// its data.
+	dataObject bool
 }
 
 type ModelResponseResult struct {
-	agentName         string
-	responseID        string
-	prompt            *Prompt
+	agentName  string
+	responseID string
+	prompt     *Prompt
+	// retryPrompt is the prompt as requested, before request prefixes and
+	// tool rounds changed prompt. Ensure and validator retries start from it.
+	retryPrompt       *Prompt
 	pluginManager     *PluginManager
 	settings          *utils.Settings
 	extensionHandlers *ExtensionHandlers
 	parser            ResponseParser
 
 	runFinallyOnce sync.Once
+	cancelRequest  context.CancelFunc
+
+	retryMu      sync.RWMutex
+	retryHistory []EnsureRetryRecord
 }
 
 func (r *ModelResponseResult) runFinally(ctx context.Context) error {
@@ -44,6 +65,33 @@ func (r *ModelResponseResult) runFinally(ctx context.Context) error {
 	return finalErr
 }
 
+// Cancel aborts the upstream model request. Data received so far stays available.
+func (r *ModelResponseResult) Cancel() {
+	if r.cancelRequest != nil {
+		r.cancelRequest()
+	}
+}
+
+func (r *ModelResponseResult) setRetryHistory(history []EnsureRetryRecord) {
+	r.retryMu.Lock()
+	r.retryHistory = append([]EnsureRetryRecord(nil), history...)
+	r.retryMu.Unlock()
+}
+
+// RetryHistory returns the failed attempts recorded by ensure_keys/validator retries.
+func (r *ModelResponseResult) RetryHistory() []EnsureRetryRecord {
+	r.retryMu.RLock()
+	defer r.retryMu.RUnlock()
+	return append([]EnsureRetryRecord(nil), r.retryHistory...)
+}
+
+func (r *ModelResponseResult) decorateMeta(meta map[string]any) map[string]any {
+	if history := r.RetryHistory(); len(history) > 0 {
+		meta["ensure_retries"] = ensureRetriesMeta(history)
+	}
+	return meta
+}
+
 func (r *ModelResponseResult) GetMetaWithContext(ctx context.Context) (map[string]any, error) {
 	meta, err := r.parser.GetMeta(ctx)
 	if err != nil {
@@ -52,7 +100,7 @@ func (r *ModelResponseResult) GetMetaWithContext(ctx context.Context) (map[strin
 	if err := r.runFinally(ctx); err != nil {
 		return nil, err
 	}
-	return meta, nil
+	return r.decorateMeta(meta), nil
 }
 
 func (r *ModelResponseResult) GetMeta(options ...any) (map[string]any, error) {
@@ -62,7 +110,11 @@ func (r *ModelResponseResult) GetMeta(options ...any) (map[string]any, error) {
 }
 
 func (r *ModelResponseResult) PeekMetaWithContext(ctx context.Context) (map[string]any, error) {
-	return r.parser.GetMeta(ctx)
+	meta, err := r.parser.GetMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.decorateMeta(meta), nil
 }
 
 func (r *ModelResponseResult) PeekMeta(options ...any) (map[string]any, error) {
@@ -118,18 +170,11 @@ func (r *ModelResponseResult) GetDataWithContext(ctx context.Context, opts GetDa
 		return nil, err
 	}
 
-	if opts.Type == "parsed" && len(opts.EnsureKeys) > 0 {
-		missing := make([]string, 0)
-		for _, key := range opts.EnsureKeys {
-			marker := &struct{}{}
-			v := utils.LocatePathInData(data, key, opts.KeyStyle, marker)
-			if v == marker {
-				missing = append(missing, key)
-			}
-		}
-		if len(missing) > 0 {
+	if opts.Type == "parsed" && (len(opts.EnsureKeys) > 0 || opts.Validator != nil) {
+		issues := collectEnsureIssues(data, opts)
+		if len(issues) > 0 {
+			retryText, _ := r.parser.GetText(ctx)
 			if IsModelLogsEnabled(r.settings) {
-				retryText, _ := r.parser.GetText(ctx)
 				_ = EmitSystemMessage(r.settings, types.SystemEventModelRequest, map[string]any{
 					"agent_name":  r.agentName,
 					"response_id": r.responseID,
@@ -143,26 +188,53 @@ func (r *ModelResponseResult) GetDataWithContext(ctx context.Context, opts GetDa
 					},
 				})
 			}
-			if opts.RetryCount < opts.MaxRetries {
-				response := NewModelResponse(r.agentName, r.pluginManager, r.settings, r.prompt, r.extensionHandlers)
-				return response.Result.GetDataWithContext(ctx, GetDataOptions{
-					Type:               opts.Type,
-					EnsureKeys:         opts.EnsureKeys,
-					KeyStyle:           opts.KeyStyle,
-					MaxRetries:         opts.MaxRetries,
-					RaiseEnsureFailure: opts.RaiseEnsureFailure,
-					RetryCount:         opts.RetryCount + 1,
-				})
+			record := EnsureRetryRecord{
+				Attempt:  opts.RetryCount,
+				Mode:     opts.RetryMode,
+				Issues:   issues,
+				Response: retryText,
+			}
+			if record.Mode == "" {
+				record.Mode = RetryModeResend
+			}
+			canRetry := opts.RetryCount < opts.MaxRetries
+			if canRetry && record.Mode == RetryModeCorrective {
+				record.Correction = renderCorrectionMessage(opts.CorrectionTemplate, issues, opts.RetryCount+1)
+			}
+			history := append(append([]EnsureRetryRecord(nil), opts.retryHistory...), record)
+			r.setRetryHistory(history)
+
+			if canRetry {
+				retryPrompt := r.retryPrompt
+				if retryPrompt == nil {
+					retryPrompt = r.prompt
+				}
+				if record.Mode == RetryModeCorrective {
+					retryPrompt = buildCorrectivePrompt(r.pluginManager, r.settings, retryPrompt, history, opts.CorrectionHistory)
+				}
+				response := NewModelResponse(r.agentName, r.pluginManager, r.settings, retryPrompt, r.extensionHandlers)
+				response.Result.setRetryHistory(history)
+				next := opts
+				next.RetryCount = opts.RetryCount + 1
+				next.retryHistory = history
+				result, err := response.Result.GetDataWithContext(ctx, next)
+				r.setRetryHistory(response.Result.RetryHistory())
+				return result, err
 			}
 			if opts.RaiseEnsureFailure {
 				if err := r.runFinally(ctx); err != nil {
 					return nil, err
 				}
-				return nil, fmt.Errorf("ensure_keys %v missing after %d retries", missing, opts.MaxRetries)
+				return nil, fmt.Errorf("ensure_keys %v missing or invalid after %d retries", append(ensureIssuePaths(issues, true), ensureIssuePaths(issues, false)...), opts.MaxRetries)
 			}
 		}
 	}
 
+	if opts.dataObject {
+		if data, err = r.parser.GetDataObject(ctx); err != nil {
+			return nil, err
+		}
+	}
 	if err := r.runFinally(ctx); err != nil {
 		return nil, err
 	}
@@ -189,11 +261,14 @@ func (r *ModelResponseResult) PeekData(dataType string, options ...any) (any, er
 	return r.PeekDataWithContext(ctx, dataType)
 }
 
+// GetDataObjectWithContext returns the data object. With EnsureKeys or a
+// Validator the parsed data is checked first and the object comes from the
+// response that passed, retrying like GetDataWithContext.
 func (r *ModelResponseResult) GetDataObjectWithContext(ctx context.Context, opts GetDataOptions) (any, error) {
-	if len(opts.EnsureKeys) > 0 {
-		if _, err := r.GetDataWithContext(ctx, opts); err != nil {
-			return nil, err
-		}
+	if len(opts.EnsureKeys) > 0 || opts.Validator != nil {
+		opts.Type = "parsed"
+		opts.dataObject = true
+		return r.GetDataWithContext(ctx, opts)
 	}
 	obj, err := r.parser.GetDataObject(ctx)
 	if err != nil {
@@ -212,6 +287,48 @@ func (r *ModelResponseResult) GetDataObject(args ...any) (any, error) {
 	return r.GetDataObjectWithContext(ctx, opts)
 }
 
+// GetToolStepsWithContext returns the tool calls executed by the native tool
+// loop, in execution order.
+func (r *ModelResponseResult) GetToolStepsWithContext(ctx context.Context) ([]types.ToolStep, error) {
+	data, err := r.parser.GetData(ctx, "all")
+	if err != nil {
+		return nil, err
+	}
+	result, ok := data.(types.ModelResult)
+	if !ok {
+		return nil, nil
+	}
+	steps, _ := result.Extra["tool_steps"].([]types.ToolStep)
+	return steps, nil
+}
+
+func (r *ModelResponseResult) GetToolSteps(options ...any) ([]types.ToolStep, error) {
+	ctx, cancel := BuildInvokeContext(r.settings, options...)
+	defer cancel()
+	return r.GetToolStepsWithContext(ctx)
+}
+
+// GetToolTraceWithContext returns the thought/action/observation trace of the
+// ReAct tool mode.
+func (r *ModelResponseResult) GetToolTraceWithContext(ctx context.Context) ([]types.ToolTraceStep, error) {
+	data, err := r.parser.GetData(ctx, "all")
+	if err != nil {
+		return nil, err
+	}
+	result, ok := data.(types.ModelResult)
+	if !ok {
+		return nil, nil
+	}
+	trace, _ := result.Extra["tool_trace"].([]types.ToolTraceStep)
+	return trace, nil
+}
+
+func (r *ModelResponseResult) GetToolTrace(options ...any) ([]types.ToolTraceStep, error) {
+	ctx, cancel := BuildInvokeContext(r.settings, options...)
+	defer cancel()
+	return r.GetToolTraceWithContext(ctx)
+}
+
 func (r *ModelResponseResult) Prompt() *Prompt {
 	return r.prompt
 }
@@ -275,9 +392,15 @@ type ModelResponse struct {
 	prompt            *Prompt
 	extensionHandlers *ExtensionHandlers
 	Result            *ModelResponseResult
+
+	cancel context.CancelFunc
 }
 
 func NewModelResponse(agentName string, pluginManager *PluginManager, settings *utils.Settings, prompt *Prompt, extensionHandlers *ExtensionHandlers) *ModelResponse {
+	return newModelResponse(agentName, pluginManager, settings, prompt, extensionHandlers, nil)
+}
+
+func newModelResponse(agentName string, pluginManager *PluginManager, settings *utils.Settings, prompt *Prompt, extensionHandlers *ExtensionHandlers, requestTool *Tool) *ModelResponse {
 	if agentName == "" {
 		agentName = "Directly Request"
 	}
@@ -285,9 +408,17 @@ func NewModelResponse(agentName string, pluginManager *PluginManager, settings *
 	settingsSnapshot, _ := settings.Get("", map[string]any{}, true).(map[string]any)
 	settingsCopy := utils.NewSettings("Response-Settings", settingsSnapshot, nil)
 	settingsCopy.Set("$log.cancel_logs", false)
+	if ToolResultCacheFromSettings(settingsCopy, types.ToolCacheScopeResponse) == nil {
+		SetToolResultCache(settingsCopy, types.ToolCacheScopeResponse, NewToolResultCache())
+	}
+	if requestTool != nil {
+		settingsCopy.SetCover(requestToolSettingsKey, requestTool)
+	}
 
 	promptSnapshot, _ := prompt.Get("", map[string]any{}, true).(map[string]any)
 	promptCopy := NewPrompt(pluginManager, settingsCopy, promptSnapshot, nil, "Response-Prompt")
+	retrySnapshot, _ := prompt.Get("", map[string]any{}, true).(map[string]any)
+	retryPrompt := NewPrompt(pluginManager, settingsCopy, retrySnapshot, nil, "Retry-Prompt")
 
 	handlersCopy := NewExtensionHandlers(extensionHandlers)
 
@@ -300,7 +431,9 @@ func NewModelResponse(agentName string, pluginManager *PluginManager, settings *
 		extensionHandlers: handlersCopy,
 	}
 
-	responseStream := response.getResponseGenerator()
+	requestCtx, cancel := context.WithCancel(context.Background())
+	response.cancel = cancel
+	responseStream := response.getResponseGenerator(requestCtx)
 	spec, err := pluginManager.GetActivatedPlugin(PluginTypeResponseParser)
 	if err != nil {
 		// fallback parser that only forwards text
@@ -308,10 +441,12 @@ func NewModelResponse(agentName string, pluginManager *PluginManager, settings *
 			agentName:         agentName,
 			responseID:        id,
 			prompt:            promptCopy,
+			retryPrompt:       retryPrompt,
 			pluginManager:     pluginManager,
 			settings:          settingsCopy,
 			extensionHandlers: handlersCopy,
 			parser:            NewFallbackResponseParser(responseStream),
+			cancelRequest:     cancel,
 		}
 		return response
 	}
@@ -321,10 +456,12 @@ func NewModelResponse(agentName string, pluginManager *PluginManager, settings *
 			agentName:         agentName,
 			responseID:        id,
 			prompt:            promptCopy,
+			retryPrompt:       retryPrompt,
 			pluginManager:     pluginManager,
 			settings:          settingsCopy,
 			extensionHandlers: handlersCopy,
 			parser:            NewFallbackResponseParser(responseStream),
+			cancelRequest:     cancel,
 		}
 		return response
 	}
@@ -333,23 +470,30 @@ func NewModelResponse(agentName string, pluginManager *PluginManager, settings *
 		agentName:         agentName,
 		responseID:        id,
 		prompt:            promptCopy,
+		retryPrompt:       retryPrompt,
 		pluginManager:     pluginManager,
 		settings:          settingsCopy,
 		extensionHandlers: handlersCopy,
 		parser:            parser,
+		cancelRequest:     cancel,
 	}
 	return response
 }
 
+// Cancel aborts the upstream model request.
+func (r *ModelResponse) Cancel() {
+	r.cancel()
+}
+
 func (r *ModelResponse) CancelLogs() {
 	r.settings.Set("$log.cancel_logs", true)
 }
 
-func (r *ModelResponse) getResponseGenerator() <-chan types.ResponseMessage {
+func (r *ModelResponse) getResponseGenerator(ctx context.Context) <-chan types.ResponseMessage {
 	out := make(chan types.ResponseMessage, 64)
 	go func() {
 		defer close(out)
-		ctx := context.Background()
+		defer r.cancel()
 
 		spec, err := r.pluginManager.GetActivatedPlugin(PluginTypeModelRequester)
 		if err != nil {
@@ -368,18 +512,7 @@ func (r *ModelResponse) getResponseGenerator() <-chan types.ResponseMessage {
 			}
 		}
 
-		requester := creator(r.prompt, r.settings)
-		requestData, err := requester.GenerateRequestData()
-		if err != nil {
-			out <- types.ResponseMessage{Event: types.ResponseEventError, Data: err}
-			return
-		}
-		raw, err := requester.RequestModel(ctx, requestData)
-		if err != nil {
-			out <- types.ResponseMessage{Event: types.ResponseEventError, Data: err}
-			return
-		}
-		broadcast, err := requester.BroadcastResponse(ctx, raw)
+		broadcast, err := r.requestRound(ctx, creator)
 		if err != nil {
 			out <- types.ResponseMessage{Event: types.ResponseEventError, Data: err}
 			return
@@ -397,7 +530,7 @@ func (r *ModelResponse) getResponseGenerator() <-chan types.ResponseMessage {
 			}
 		}
 
-		for msg := range broadcast {
+		forward := func(msg types.ResponseMessage) {
 			out <- msg
 			suffixes := r.extensionHandlers.BroadcastSuffixes[msg.Event]
 			for _, suffix := range suffixes {
@@ -411,16 +544,108 @@ func (r *ModelResponse) getResponseGenerator() <-chan types.ResponseMessage {
 				}
 			}
 		}
+
+		toolHandler := r.extensionHandlers.ToolCallHandler
+		maxRounds := toolLoopMaxRounds(r.settings)
+		steps := make([]types.ToolStep, 0)
+		for round := 0; ; round++ {
+			loopable := toolHandler != nil && ToolMode(r.settings) == ToolModeNative && round < maxRounds
+			calls := newToolCallAccumulator()
+			held := make([]types.ResponseMessage, 0, 3)
+			deltas := make([]types.ResponseMessage, 0)
+			for msg := range broadcast {
+				if msg.Event == types.ResponseEventToolCalls {
+					calls.Add(msg.Data)
+				}
+				if loopable && msg.Event == types.ResponseEventDelta {
+					deltas = append(deltas, msg)
+					continue
+				}
+				if loopable && isToolRoundTerminalEvent(msg.Event) {
+					held = append(held, msg)
+					continue
+				}
+				forward(msg)
+			}
+			roundCalls := calls.Calls()
+			if !loopable || len(roundCalls) == 0 {
+				for _, msg := range append(deltas, held...) {
+					forward(msg)
+				}
+				return
+			}
+
+			roundSteps, err := toolHandler(ctx, roundCalls, r.settings)
+			if err != nil {
+				forward(types.ResponseMessage{Event: types.ResponseEventError, Data: err})
+				for _, msg := range append(deltas, held...) {
+					forward(msg)
+				}
+				return
+			}
+			// The text of a round that called tools is not part of the answer.
+			for _, msg := range deltas {
+				forward(types.ResponseMessage{Event: types.ResponseEventToolRoundDelta, Data: msg.Data})
+			}
+			for i := range roundSteps {
+				roundSteps[i].Round = round + 1
+			}
+			steps = append(steps, roundSteps...)
+			forward(types.ResponseMessage{Event: types.ResponseEventExtra, Data: map[string]any{
+				"tool_steps": append([]types.ToolStep(nil), steps...),
+			}})
+
+			content := ""
+			for _, msg := range held {
+				if msg.Event == types.ResponseEventDone {
+					if text, ok := msg.Data.(string); ok {
+						content = text
+					}
+				}
+			}
+			appendToolRoundMessages(r.prompt, content, roundCalls, roundSteps)
+			if round+1 >= maxRounds {
+				// Last allowed round: ask for an answer instead of more calls.
+				r.prompt.Set("options.tool_choice", "none")
+			}
+			broadcast, err = r.requestRound(ctx, creator)
+			if err != nil {
+				forward(types.ResponseMessage{Event: types.ResponseEventError, Data: err})
+				return
+			}
+		}
 	}()
 	return out
 }
 
+// requestRound builds request data from the current prompt and starts one
+// model request.
+func (r *ModelResponse) requestRound(ctx context.Context, creator ModelRequesterCreator) (<-chan types.ResponseMessage, error) {
+	requester := creator(r.prompt, r.settings)
+	requestData, err := requester.GenerateRequestData()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := requester.RequestModel(ctx, requestData)
+	if err != nil {
+		return nil, err
+	}
+	broadcast, err := requester.BroadcastResponse(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	return splitInlineReasoning(ctx, broadcast, r.settings), nil
+}
+
 type ModelRequest struct {
 	agentName         string
 	pluginManager     *PluginManager
 	settings          *utils.Settings
 	prompt            *Prompt
 	extensionHandlers *ExtensionHandlers
+
+	mu   sync.Mutex
+	tool *Tool
 }
 
 func NewModelRequest(pluginManager *PluginManager, agentName string, parentSettings *utils.Settings, parentPrompt *Prompt, parentExtensionHandlers *ExtensionHandlers) *ModelRequest {
@@ -451,6 +676,61 @@ func (r *ModelRequest) Prompt() *Prompt { return r.prompt }
 
 func (r *ModelRequest) ExtensionHandlers() *ExtensionHandlers { return r.extensionHandlers }
 
+// RequestTool returns the tools scoped to the next response of this request.
+// Like the request prompt, they are handed to that response and then cleared;
+// the response keeps a copy, so later changes only reach the next response.
+func (r *ModelRequest) RequestTool() (*Tool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requestToolLocked()
+}
+
+func (r *ModelRequest) requestToolLocked() (*Tool, error) {
+	if r.tool == nil {
+		tool, err := NewTool(r.pluginManager, r.settings)
+		if err != nil {
+			return nil, err
+		}
+		r.tool = tool
+	}
+	return r.tool, nil
+}
+
+// RegisterTool registers a tool visible only to the next response of this
+// request. Handlers running concurrently should each use their own request,
+// for example from BaseAgent.CreateRequest, rather than a shared one.
+func (r *ModelRequest) RegisterTool(info types.ToolInfo, fn any) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tool, err := r.requestToolLocked()
+	if err != nil {
+		return err
+	}
+	return tool.Manager().Register(info, fn)
+}
+
+// takeRequestTool detaches the request-scoped tools and returns a copy for a
+// new response, or nil when none were registered.
+func (r *ModelRequest) takeRequestTool() *Tool {
+	r.mu.Lock()
+	tool := r.tool
+	r.tool = nil
+	r.mu.Unlock()
+	if tool == nil {
+		return nil
+	}
+	snapshot, err := NewTool(r.pluginManager, r.settings)
+	if err != nil {
+		return tool
+	}
+	for name, info := range tool.Manager().GetToolInfo(nil) {
+		if fn, ok := tool.Manager().GetToolFunc(name); ok {
+			_ = snapshot.Manager().Register(info, fn)
+		}
+	}
+	return snapshot
+}
+
 func (r *ModelRequest) SetPrompt(key string, value any, options ...any) *ModelRequest {
 	config := resolvePromptSetOptions(options...)
 	r.prompt.Set(key, value, config.Mappings)
@@ -521,7 +801,7 @@ func (r *ModelRequest) Attachment(prompt any, options ...any) *ModelRequest {
 }
 
 func (r *ModelRequest) GetResponse() *ModelResponse {
-	response := NewModelResponse(r.agentName, r.pluginManager, r.settings, r.prompt, r.extensionHandlers)
+	response := newModelResponse(r.agentName, r.pluginManager, r.settings, r.prompt, r.extensionHandlers, r.takeRequestTool())
 	r.prompt.Clear()
 	return response
 }
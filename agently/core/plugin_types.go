@@ -61,4 +61,19 @@ type ToolManager interface {
 	CallTool(ctx context.Context, name string, kwargs map[string]any) (any, error)
 }
 
+// ToolManagerExtension is implemented by tool managers that can remove tools
+// and tags, replace a tool in place and run a batch of calls. It is kept out of ToolManager so managers
+// written against that interface keep working; use UnregisterTools, UntagTools,
+// ReplaceTool and CallTools instead of asserting it directly.
+type ToolManagerExtension interface {
+	Unregister(toolNames []string) error
+	Untag(toolNames []string, tags []string) error
+	// Replace registers the tool whatever `tool.name_collision` says, swapping
+	// an existing tool of the same name and its tags in one step.
+	Replace(info types.ToolInfo, fn any) error
+	// CallTools runs the calls concurrently, at most concurrency at a time
+	// (0 uses the `tool.concurrency` setting), and returns them in call order.
+	CallTools(ctx context.Context, calls []types.ToolStep, concurrency int) []types.ToolStep
+}
+
 type ToolManagerCreator func(settings *utils.Settings) ToolManager
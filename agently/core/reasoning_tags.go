@@ -0,0 +1,120 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+func reasoningTagsEnabled(settings *utils.Settings) bool {
+	switch v := settings.Get("response.reasoning_tags.enabled", true, true).(type) {
+	case bool:
+		return v
+	case string:
+		return v != "false" && v != "off" && v != ""
+	default:
+		return v != nil
+	}
+}
+
+func reasoningTagPair(settings *utils.Settings) (string, string) {
+	openTag := fmt.Sprint(settings.Get("response.reasoning_tags.open", utils.DefaultReasoningOpenTag, true))
+	closeTag := fmt.Sprint(settings.Get("response.reasoning_tags.close", utils.DefaultReasoningCloseTag, true))
+	return openTag, closeTag
+}
+
+func newReasoningTagSplitter(settings *utils.Settings) *utils.ReasoningTagSplitter {
+	splitter := utils.NewReasoningTagSplitter(reasoningTagPair(settings))
+	splitter.SetLeadingWindow(settingsInt(settings, "response.reasoning_tags.leading_window", 0))
+	return splitter
+}
+
+// splitInlineReasoning reroutes text wrapped in reasoning tags from delta/done
+// events to reasoning_delta/reasoning_done so parsers only see the answer.
+// With `response.reasoning_tags.leading_window` set, text before a close tag
+// without an opener is reasoning too, as long as it fits the window. The done
+// text is the content the deltas carried, so both follow one split decision.
+func splitInlineReasoning(ctx context.Context, source <-chan types.ResponseMessage, settings *utils.Settings) <-chan types.ResponseMessage {
+	if !reasoningTagsEnabled(settings) {
+		return source
+	}
+	out := make(chan types.ResponseMessage, 64)
+	go func() {
+		defer func() {
+			// Drain on cancellation so the upstream broadcaster never blocks.
+			for range source {
+			}
+		}()
+		defer close(out)
+		splitter := newReasoningTagSplitter(settings)
+		captured := ""
+		streamed := strings.Builder{}
+		streaming := false
+		reasoningDoneSent := false
+
+		emit := func(reasoning string, content string) bool {
+			if reasoning != "" {
+				captured += reasoning
+				if !sendResponseMessage(ctx, out, types.ResponseMessage{Event: types.ResponseEventReasoning, Data: reasoning}) {
+					return false
+				}
+			}
+			if content != "" {
+				streamed.WriteString(content)
+				return sendResponseMessage(ctx, out, types.ResponseMessage{Event: types.ResponseEventDelta, Data: content})
+			}
+			return true
+		}
+
+		for msg := range source {
+			switch msg.Event {
+			case types.ResponseEventDelta:
+				streaming = true
+				if !emit(splitter.Feed(fmt.Sprint(msg.Data))) {
+					return
+				}
+				continue
+			case types.ResponseEventDone:
+				if !emit(splitter.Flush()) {
+					return
+				}
+				if _, ok := msg.Data.(string); ok && streaming {
+					msg.Data = streamed.String()
+				} else if text, ok := msg.Data.(string); ok {
+					done := newReasoningTagSplitter(settings)
+					_, content := done.Feed(text)
+					_, rest := done.Flush()
+					msg.Data = content + rest
+				}
+			case types.ResponseEventReasoningDone:
+				reasoningDoneSent = true
+				if captured != "" {
+					upstream, _ := msg.Data.(string)
+					msg.Data = upstream + captured
+				}
+			}
+			if !sendResponseMessage(ctx, out, msg) {
+				return
+			}
+		}
+		if !emit(splitter.Flush()) {
+			return
+		}
+		if !reasoningDoneSent && captured != "" {
+			sendResponseMessage(ctx, out, types.ResponseMessage{Event: types.ResponseEventReasoningDone, Data: captured})
+		}
+	}()
+	return out
+}
+
+func sendResponseMessage(ctx context.Context, out chan<- types.ResponseMessage, msg types.ResponseMessage) bool {
+	select {
+	case out <- msg:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+)
+
+// Deltas yields answer text chunks as they stream in. Request errors arrive
+// in-band as the second value; breaking out of the loop cancels the request.
+func (r *ModelResponseResult) Deltas(ctx context.Context) iter.Seq2[string, error] {
+	events := []string{string(types.ResponseEventDelta), string(types.ResponseEventError)}
+	return iterateResponseStream(ctx, r, "specific", events, false, func(item any) (string, error, bool) {
+		msg, ok := item.(types.ResponseMessage)
+		if !ok {
+			return "", nil, false
+		}
+		if msg.Event == types.ResponseEventError {
+			return "", responseMessageError(msg), true
+		}
+		return fmt.Sprint(msg.Data), nil, true
+	})
+}
+
+// Instant yields structured streaming events for JSON output. Request errors
+// arrive in-band as the second value; breaking out of the loop cancels the
+// request.
+func (r *ModelResponseResult) Instant(ctx context.Context) iter.Seq2[types.StreamingData, error] {
+	return iterateResponseStream(ctx, r, "instant", nil, true, func(item any) (types.StreamingData, error, bool) {
+		data, ok := item.(types.StreamingData)
+		return data, nil, ok
+	})
+}
+
+// Events yields raw response messages, limited to the given event names when
+// any are passed. Error events are always included and also reported as the
+// second value; breaking out of the loop cancels the request.
+func (r *ModelResponseResult) Events(ctx context.Context, events ...string) iter.Seq2[types.ResponseMessage, error] {
+	streamType := "all"
+	if len(events) > 0 {
+		streamType = "specific"
+		events = append(append([]string(nil), events...), string(types.ResponseEventError))
+	}
+	return iterateResponseStream(ctx, r, streamType, events, false, func(item any) (types.ResponseMessage, error, bool) {
+		msg, ok := item.(types.ResponseMessage)
+		if !ok {
+			return types.ResponseMessage{}, nil, false
+		}
+		if msg.Event == types.ResponseEventError {
+			return msg, responseMessageError(msg), true
+		}
+		return msg, nil, true
+	})
+}
+
+// iterateResponseStream adapts a parser stream to iter.Seq2. When withErrors is
+// set, error events are merged in from a second subscription because the
+// primary stream does not carry them.
+func iterateResponseStream[T any](
+	ctx context.Context,
+	r *ModelResponseResult,
+	streamType string,
+	specific []string,
+	withErrors bool,
+	convert func(item any) (T, error, bool),
+) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		streamCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		items, err := r.parser.GetStream(streamCtx, streamType, specific)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		var errs <-chan any
+		if withErrors {
+			errs, err = r.parser.GetStream(streamCtx, "specific", []string{string(types.ResponseEventError)})
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+		}
+
+		for items != nil || errs != nil {
+			var (
+				value   T
+				itemErr error
+				emit    bool
+			)
+			select {
+			case item, ok := <-items:
+				if !ok {
+					items = nil
+					continue
+				}
+				value, itemErr, emit = convert(item)
+			case item, ok := <-errs:
+				if !ok {
+					errs = nil
+					continue
+				}
+				msg, _ := item.(types.ResponseMessage)
+				itemErr, emit = responseMessageError(msg), true
+			case <-ctx.Done():
+				r.Cancel()
+				yield(zero, ctx.Err())
+				return
+			}
+			if !emit {
+				continue
+			}
+			if !yield(value, itemErr) {
+				r.Cancel()
+				return
+			}
+		}
+		_ = r.runFinally(ctx)
+	}
+}
+
+func responseMessageError(msg types.ResponseMessage) error {
+	if err, ok := msg.Data.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%v", msg.Data)
+}
+
+func (r *ModelRequest) Deltas(ctx context.Context) iter.Seq2[string, error] {
+	return r.GetResponse().Result.Deltas(ctx)
+}
+
+func (r *ModelRequest) Instant(ctx context.Context) iter.Seq2[types.StreamingData, error] {
+	return r.GetResponse().Result.Instant(ctx)
+}
+
+func (r *ModelRequest) Events(ctx context.Context, events ...string) iter.Seq2[types.ResponseMessage, error] {
+	return r.GetResponse().Result.Events(ctx, events...)
+}
+
+func (a *BaseAgent) Deltas(ctx context.Context) iter.Seq2[string, error] {
+	return a.request.Deltas(ctx)
+}
+
+func (a *BaseAgent) Instant(ctx context.Context) iter.Seq2[types.StreamingData, error] {
+	return a.request.Instant(ctx)
+}
+
+func (a *BaseAgent) Events(ctx context.Context, events ...string) iter.Seq2[types.ResponseMessage, error] {
+	return a.request.Events(ctx, events...)
+}
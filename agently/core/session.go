@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -16,18 +17,31 @@ import (
 type AnalysisHandler func(fullContext []types.ChatMessage, contextWindow []types.ChatMessage, memo any, sessionSettings *utils.RuntimeDataNamespace) (string, error)
 type ExecutionHandler func(fullContext []types.ChatMessage, contextWindow []types.ChatMessage, memo any, sessionSettings *utils.RuntimeDataNamespace) ([]types.ChatMessage, []types.ChatMessage, any, error)
 
+// contextExecutionHandler is an ExecutionHandler that also receives the
+// context of the call that resized the session, for strategies making
+// requests such as summarize.
+type contextExecutionHandler func(ctx context.Context, fullContext []types.ChatMessage, contextWindow []types.ChatMessage, memo any, sessionSettings *utils.RuntimeDataNamespace) ([]types.ChatMessage, []types.ChatMessage, any, error)
+
 type Session struct {
 	id             string
 	autoResize     bool
+	parentSettings *utils.Settings
 	settings       *utils.Settings
 	sessionSetting *utils.RuntimeDataNamespace
 
 	analysisHandler  AnalysisHandler
-	executionHandler map[string]ExecutionHandler
+	executionHandler map[string]contextExecutionHandler
+	// Handlers registered by users, which forks keep.
+	customAnalysisHandler   bool
+	customExecutionHandlers map[string]bool
 
 	fullContext   []types.ChatMessage
 	contextWindow []types.ChatMessage
 	memo          any
+	toolCache     *ToolResultCache
+	tokenCounter  utils.TokenCounter
+	summarizer    SessionSummarizer
+	version       int64
 	mu            sync.RWMutex
 }
 
@@ -39,70 +53,240 @@ func NewSession(id string, autoResize bool, settings *utils.Settings) *Session {
 		settings = NewDefaultSettings(nil)
 	}
 	s := &Session{
-		id:               id,
-		autoResize:       autoResize,
-		settings:         utils.NewSettings("Session-Settings", map[string]any{}, settings),
-		sessionSetting:   utils.NewSettings("Session-Settings-NS", map[string]any{}, settings).Namespace("session").RuntimeDataNamespace,
-		executionHandler: map[string]ExecutionHandler{},
-		fullContext:      []types.ChatMessage{},
-		contextWindow:    []types.ChatMessage{},
+		id:                      id,
+		autoResize:              autoResize,
+		parentSettings:          settings,
+		settings:                utils.NewSettings("Session-Settings", map[string]any{}, settings),
+		sessionSetting:          utils.NewSettings("Session-Settings-NS", map[string]any{}, settings).Namespace("session").RuntimeDataNamespace,
+		executionHandler:        map[string]contextExecutionHandler{},
+		customExecutionHandlers: map[string]bool{},
+		fullContext:             []types.ChatMessage{},
+		contextWindow:           []types.ChatMessage{},
+		toolCache:               NewToolResultCache(),
 	}
 	s.sessionSetting.SetDefault("max_length", nil, true)
+	s.sessionSetting.SetDefault("max_tokens", nil, true)
 	s.analysisHandler = s.defaultAnalysisHandler
-	s.executionHandler["simple_cut"] = s.simpleCutExecutionHandler
+	s.executionHandler["simple_cut"] = withoutContext(s.simpleCutExecutionHandler)
+	s.executionHandler["summarize"] = s.summarizeExecutionHandler
 	return s
 }
 
 func (s *Session) ID() string { return s.id }
 
+// SessionIdleTTL returns session.idle_ttl, how long an inactive session may
+// stay unused before it is evicted, or 0 when sessions do not expire.
+func SessionIdleTTL(settings *utils.Settings) time.Duration {
+	switch v := settings.Get("session.idle_ttl", nil, true).(type) {
+	case int:
+		return time.Duration(v) * time.Second
+	case int64:
+		return time.Duration(v) * time.Second
+	case float64:
+		return time.Duration(v * float64(time.Second))
+	}
+	return 0
+}
+
+// SessionMaxSessions returns session.max_sessions, how many sessions an agent
+// keeps in memory before evicting the least recently used, or 0 for no limit.
+func SessionMaxSessions(settings *utils.Settings) int {
+	return max(settingsInt(settings, "session.max_sessions", 0), 0)
+}
+
+// SessionEvictSaveAttempts returns session.evict_save_attempts, how many
+// failed saves keep an evicted session in memory; 0 keeps it until saved.
+func SessionEvictSaveAttempts(settings *utils.Settings) int {
+	return max(settingsInt(settings, "session.evict_save_attempts", 3), 0)
+}
+
+// ToolResultCache holds the results of tools cached in the session scope.
+func (s *Session) ToolResultCache() *ToolResultCache { return s.toolCache }
+
+// defaultAnalysisHandler picks session.resize_strategy, simple_cut unless
+// configured, once the window exceeds max_length or the token budget.
 func (s *Session) defaultAnalysisHandler(fullContext []types.ChatMessage, contextWindow []types.ChatMessage, _ any, sessionSettings *utils.RuntimeDataNamespace) (string, error) {
-	maxLength, _ := sessionSettings.Get("max_length", nil, true).(int)
-	if maxLength > 0 && s.calculateContextLength(contextWindow) > maxLength {
+	limits, err := s.windowLimits(sessionSettings)
+	if err != nil {
+		return "", err
+	}
+	if limits.exceeded(contextWindow) {
+		if strategy, ok := sessionSettings.Get("resize_strategy", nil, true).(string); ok && strings.TrimSpace(strategy) != "" {
+			return strings.TrimSpace(strategy), nil
+		}
 		return "simple_cut", nil
 	}
 	return "", nil
 }
 
+// simpleCutExecutionHandler keeps the newest messages that fit max_length and
+// the token budget. Tool results whose call was cut off are dropped too.
 func (s *Session) simpleCutExecutionHandler(_ []types.ChatMessage, contextWindow []types.ChatMessage, _ any, sessionSettings *utils.RuntimeDataNamespace) ([]types.ChatMessage, []types.ChatMessage, any, error) {
-	maxLength, _ := sessionSettings.Get("max_length", nil, true).(int)
-	if maxLength <= 0 {
-		return nil, nil, nil, nil
-	}
-	newWindow := make([]types.ChatMessage, 0)
-	total := 0
-	for i := len(contextWindow) - 1; i >= 0; i-- {
-		message := contextWindow[i]
-		size := len(fmt.Sprint(message))
-		if total+size > maxLength {
+	limits, err := s.windowLimits(sessionSettings)
+	if err != nil || !limits.enabled() {
+		return nil, nil, nil, err
+	}
+	start := limits.cutStart(contextWindow, len(contextWindow))
+	return nil, append([]types.ChatMessage{}, contextWindow[start:]...), nil, nil
+}
+
+// sessionWindowLimits are the context window limits from the session settings.
+// tokenBudget is -1 when max_tokens is not set.
+type sessionWindowLimits struct {
+	maxLength   int
+	tokenBudget int
+	counter     utils.TokenCounter
+}
+
+func (l sessionWindowLimits) enabled() bool {
+	return l.maxLength > 0 || l.tokenBudget >= 0
+}
+
+// cutStart returns where the newest messages fitting the limits begin, keeping
+// at most keep messages and never starting with an orphan tool result.
+func (l sessionWindowLimits) cutStart(contextWindow []types.ChatMessage, keep int) int {
+	start := len(contextWindow)
+	length, tokens := 0, 0
+	for i := len(contextWindow) - 1; i >= 0 && len(contextWindow)-i <= keep; i-- {
+		length += chatMessageLength(contextWindow[i])
+		if l.tokenBudget >= 0 {
+			tokens += countChatMessageTokens(l.counter, contextWindow[i])
+		}
+		if (l.maxLength > 0 && length > l.maxLength) || (l.tokenBudget >= 0 && tokens > l.tokenBudget) {
 			break
 		}
-		total += size
-		newWindow = append(newWindow, message)
+		start = i
+	}
+	for start < len(contextWindow) && contextWindow[start].Role == "tool" {
+		start++
+	}
+	return start
+}
+
+func (l sessionWindowLimits) exceeded(contextWindow []types.ChatMessage) bool {
+	if l.maxLength > 0 && calculateContextLength(contextWindow) > l.maxLength {
+		return true
+	}
+	return l.tokenBudget >= 0 && CountChatTokens(l.counter, contextWindow) > l.tokenBudget
+}
+
+// windowLimits reads max_length (characters of message content) and
+// max_tokens minus reserved_tokens.system and reserved_tokens.output.
+func (s *Session) windowLimits(sessionSettings *utils.RuntimeDataNamespace) (sessionWindowLimits, error) {
+	limits := sessionWindowLimits{
+		maxLength:   namespaceInt(sessionSettings, "max_length"),
+		tokenBudget: -1,
+	}
+	maxTokens := namespaceInt(sessionSettings, "max_tokens")
+	if maxTokens <= 0 {
+		return limits, nil
 	}
-	for i, j := 0, len(newWindow)-1; i < j; i, j = i+1, j-1 {
-		newWindow[i], newWindow[j] = newWindow[j], newWindow[i]
+	counter, err := s.resolveTokenCounter(sessionSettings)
+	if err != nil {
+		return limits, err
 	}
-	return nil, newWindow, nil, nil
+	limits.counter = counter
+	limits.tokenBudget = max(maxTokens-namespaceInt(sessionSettings, "reserved_tokens.system")-namespaceInt(sessionSettings, "reserved_tokens.output"), 0)
+	return limits, nil
 }
 
-func (s *Session) calculateContextLength(contextWindow []types.ChatMessage) int {
+func calculateContextLength(contextWindow []types.ChatMessage) int {
 	length := 0
 	for _, message := range contextWindow {
-		length += len(fmt.Sprint(message))
+		length += chatMessageLength(message)
 	}
 	return length
 }
 
+func namespaceInt(ns *utils.RuntimeDataNamespace, key string) int {
+	return int(namespaceFloat(ns, key))
+}
+
+func namespaceFloat(ns *utils.RuntimeDataNamespace, key string) float64 {
+	switch typed := ns.Get(key, nil, true).(type) {
+	case int:
+		return float64(typed)
+	case int64:
+		return float64(typed)
+	case float64:
+		return typed
+	}
+	return 0
+}
+
+// SetTokenCounter sets the counter used for max_tokens. By default the
+// session uses session.token_counter, then a BPE vocabulary at
+// session.bpe_vocab, then utils.HeuristicTokenCounter.
+func (s *Session) SetTokenCounter(counter utils.TokenCounter) *Session {
+	s.mu.Lock()
+	s.tokenCounter = counter
+	s.mu.Unlock()
+	return s
+}
+
+// TokenCounter returns the counter the session measures max_tokens with.
+func (s *Session) TokenCounter() (utils.TokenCounter, error) {
+	return s.resolveTokenCounter(s.sessionSetting)
+}
+
+// ContextTokens estimates the tokens of the context window.
+func (s *Session) ContextTokens() (int, error) {
+	counter, err := s.TokenCounter()
+	if err != nil {
+		return 0, err
+	}
+	return CountChatTokens(counter, s.ContextWindow()), nil
+}
+
+func (s *Session) resolveTokenCounter(sessionSettings *utils.RuntimeDataNamespace) (utils.TokenCounter, error) {
+	s.mu.RLock()
+	counter := s.tokenCounter
+	s.mu.RUnlock()
+	if counter != nil {
+		return counter, nil
+	}
+	if configured, ok := sessionSettings.Get("token_counter", nil, true).(utils.TokenCounter); ok {
+		return configured, nil
+	}
+	if path, ok := sessionSettings.Get("bpe_vocab", nil, true).(string); ok && strings.TrimSpace(path) != "" {
+		return loadBPETokenCounter(path)
+	}
+	return utils.HeuristicTokenCounter{}, nil
+}
+
+var bpeTokenCounters sync.Map
+
+// loadBPETokenCounter loads each vocabulary file once per process.
+func loadBPETokenCounter(path string) (utils.TokenCounter, error) {
+	if counter, ok := bpeTokenCounters.Load(path); ok {
+		return counter.(utils.TokenCounter), nil
+	}
+	counter, err := utils.LoadBPETokenCounter(path)
+	if err != nil {
+		return nil, fmt.Errorf("load session.bpe_vocab: %w", err)
+	}
+	actual, _ := bpeTokenCounters.LoadOrStore(path, counter)
+	return actual.(utils.TokenCounter), nil
+}
+
 func (s *Session) RegisterAnalysisHandler(handler AnalysisHandler) *Session {
 	s.analysisHandler = handler
+	s.customAnalysisHandler = true
 	return s
 }
 
 func (s *Session) RegisterExecutionHandler(strategyName string, handler ExecutionHandler) *Session {
-	s.executionHandler[strategyName] = handler
+	s.executionHandler[strategyName] = withoutContext(handler)
+	s.customExecutionHandlers[strategyName] = true
 	return s
 }
 
+func withoutContext(handler ExecutionHandler) contextExecutionHandler {
+	return func(_ context.Context, fullContext []types.ChatMessage, contextWindow []types.ChatMessage, memo any, sessionSettings *utils.RuntimeDataNamespace) ([]types.ChatMessage, []types.ChatMessage, any, error) {
+		return handler(fullContext, contextWindow, memo, sessionSettings)
+	}
+}
+
 func (s *Session) ResetChatHistory() *Session {
 	s.mu.Lock()
 	s.fullContext = []types.ChatMessage{}
@@ -137,13 +321,19 @@ func (s *Session) SetChatHistory(chatHistory []types.ChatMessage) *Session {
 }
 
 func (s *Session) AddChatHistory(chatHistory []types.ChatMessage) *Session {
+	return s.AddChatHistoryWithContext(context.Background(), chatHistory)
+}
+
+// AddChatHistoryWithContext is AddChatHistory resizing with ctx, which bounds
+// the summarize strategy's request.
+func (s *Session) AddChatHistoryWithContext(ctx context.Context, chatHistory []types.ChatMessage) *Session {
 	normalized := normalizeChatMessages(chatHistory)
 	s.mu.Lock()
 	s.fullContext = append(s.fullContext, normalized...)
 	s.contextWindow = append(s.contextWindow, normalized...)
 	s.mu.Unlock()
 	if s.autoResize {
-		s.Resize()
+		s.ResizeWithContext(ctx)
 	}
 	return s
 }
@@ -158,6 +348,12 @@ func (s *Session) AnalyzeContext() (string, error) {
 }
 
 func (s *Session) ExecuteStrategy(strategyName string) error {
+	return s.ExecuteStrategyWithContext(context.Background(), strategyName)
+}
+
+// ExecuteStrategyWithContext is ExecuteStrategy passing ctx to strategies that
+// make requests, such as summarize.
+func (s *Session) ExecuteStrategyWithContext(ctx context.Context, strategyName string) error {
 	handler, ok := s.executionHandler[strategyName]
 	if !ok {
 		return nil
@@ -167,7 +363,7 @@ func (s *Session) ExecuteStrategy(strategyName string) error {
 	windowCopy := append([]types.ChatMessage{}, s.contextWindow...)
 	memoCopy := s.memo
 	s.mu.RUnlock()
-	newFull, newWindow, newMemo, err := handler(fullCopy, windowCopy, memoCopy, s.sessionSetting)
+	newFull, newWindow, newMemo, err := handler(ctx, fullCopy, windowCopy, memoCopy, s.sessionSetting)
 	if err != nil {
 		return err
 	}
@@ -186,12 +382,17 @@ func (s *Session) ExecuteStrategy(strategyName string) error {
 }
 
 func (s *Session) Resize() error {
+	return s.ResizeWithContext(context.Background())
+}
+
+// ResizeWithContext is Resize passing ctx to the chosen strategy.
+func (s *Session) ResizeWithContext(ctx context.Context) error {
 	strategy, err := s.AnalyzeContext()
 	if err != nil {
 		return err
 	}
 	if strings.TrimSpace(strategy) != "" {
-		return s.ExecuteStrategy(strategy)
+		return s.ExecuteStrategyWithContext(ctx, strategy)
 	}
 	return nil
 }
@@ -225,10 +426,38 @@ func (s *Session) ToSerializableData() map[string]any {
 		"full_context":     s.FullContext(),
 		"context_window":   s.ContextWindow(),
 		"memo":             s.Memo(),
-		"session_settings": s.sessionSetting.Data(true),
+		"session_settings": serializableSessionSettings(s.sessionSetting.Data(true)),
 	}
 }
 
+// serializableSessionSettings keeps the plain data of session settings and
+// drops runtime values such as summarizers and token counters.
+func serializableSessionSettings(value any) any {
+	switch typed := value.(type) {
+	case nil, string, bool, int, int64, float64:
+		return typed
+	case map[string]any:
+		out := make(map[string]any, len(typed))
+		for key, item := range typed {
+			if cleaned := serializableSessionSettings(item); cleaned != nil || item == nil {
+				out[key] = cleaned
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, 0, len(typed))
+		for _, item := range typed {
+			if cleaned := serializableSessionSettings(item); cleaned != nil || item == nil {
+				out = append(out, cleaned)
+			}
+		}
+		return out
+	case []string:
+		return append([]string{}, typed...)
+	}
+	return nil
+}
+
 func (s *Session) ToJSON() (string, error) {
 	b, err := json.MarshalIndent(s.ToSerializableData(), "", "  ")
 	if err != nil {
@@ -315,10 +544,7 @@ func parseChatMessages(raw []any) []types.ChatMessage {
 		case types.ChatMessage:
 			out = append(out, typed)
 		case map[string]any:
-			out = append(out, types.ChatMessage{
-				Role:    fmt.Sprint(typed["role"]),
-				Content: typed["content"],
-			})
+			out = append(out, types.ChatMessageFromMap(typed))
 		}
 	}
 	return out
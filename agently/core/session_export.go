@@ -0,0 +1,430 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+// SessionExportFormat names a conversation dataset format.
+type SessionExportFormat string
+
+const (
+	// SessionFormatOpenAI is one OpenAI chat fine-tuning example:
+	// {"messages": [...], "tools": [...]}.
+	SessionFormatOpenAI SessionExportFormat = "openai"
+	// SessionFormatShareGPT is a ShareGPT-style record: {"id", "system",
+	// "tools", "conversations": [{"from", "value"}]}, with tool calls as
+	// function_call and tool results as observation turns.
+	SessionFormatShareGPT SessionExportFormat = "sharegpt"
+	// SessionFormatMarkdown is a readable transcript with one "## role"
+	// section per message.
+	SessionFormatMarkdown SessionExportFormat = "markdown"
+)
+
+// SessionExportOptions adds what the history itself does not hold.
+type SessionExportOptions struct {
+	// System is exported as the system prompt unless the history starts with
+	// a system message.
+	System string
+	// Tools are listed in formats that carry tool definitions.
+	Tools []types.ToolInfo
+	// ContextWindow exports the context window instead of the full context.
+	ContextWindow bool
+}
+
+// Export renders the session in format. OpenAI and ShareGPT records are one
+// line of JSON, ready for JSONL files.
+func (s *Session) Export(format SessionExportFormat, options SessionExportOptions) ([]byte, error) {
+	messages := s.FullContext()
+	if options.ContextWindow {
+		messages = s.ContextWindow()
+	}
+	return ExportChatMessages(s.ID(), messages, format, options)
+}
+
+// ImportSession creates a session from a record in format. An empty id takes
+// the ID of a ShareGPT record, or a random one.
+func ImportSession(id string, format SessionExportFormat, data []byte, settings *utils.Settings) (*Session, error) {
+	messages, recordID, err := importChatMessages(format, data)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		id = recordID
+	}
+	session := NewSession(id, true, settings)
+	session.SetChatHistory(messages)
+	return session, nil
+}
+
+// ExportChatMessages renders messages in format; id names the conversation
+// where the format has a place for it.
+func ExportChatMessages(id string, messages []types.ChatMessage, format SessionExportFormat, options SessionExportOptions) ([]byte, error) {
+	if options.System != "" && (len(messages) == 0 || messages[0].Role != "system") {
+		messages = append([]types.ChatMessage{{Role: "system", Content: options.System}}, messages...)
+	}
+	switch format {
+	case SessionFormatOpenAI:
+		return exportOpenAIChat(messages, options.Tools)
+	case SessionFormatShareGPT:
+		return exportShareGPT(id, messages, options.Tools)
+	case SessionFormatMarkdown:
+		return exportMarkdownTranscript(id, messages), nil
+	}
+	return nil, fmt.Errorf("unsupported session export format %q", format)
+}
+
+// ImportChatMessages reads the messages of a record in format.
+func ImportChatMessages(format SessionExportFormat, data []byte) ([]types.ChatMessage, error) {
+	messages, _, err := importChatMessages(format, data)
+	return messages, err
+}
+
+func importChatMessages(format SessionExportFormat, data []byte) ([]types.ChatMessage, string, error) {
+	switch format {
+	case SessionFormatOpenAI:
+		messages, err := importOpenAIChat(data)
+		return messages, "", err
+	case SessionFormatShareGPT:
+		return importShareGPT(data)
+	case SessionFormatMarkdown:
+		return importMarkdownTranscript(data)
+	}
+	return nil, "", fmt.Errorf("unsupported session import format %q", format)
+}
+
+// ExportStoredSessions writes the sessions ids of store, or all of them when
+// ids is nil, to w as JSONL in the OpenAI or ShareGPT format. It returns how
+// many sessions were written.
+func ExportStoredSessions(ctx context.Context, store SessionStore, ids []string, w io.Writer, format SessionExportFormat, options SessionExportOptions) (int, error) {
+	if format != SessionFormatOpenAI && format != SessionFormatShareGPT {
+		return 0, fmt.Errorf("session export format %q cannot be written as JSONL", format)
+	}
+	if ids == nil {
+		var err error
+		if ids, err = store.List(ctx); err != nil {
+			return 0, err
+		}
+	}
+	writer := bufio.NewWriter(w)
+	written := 0
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		session, err := LoadSessionFromStore(ctx, store, id, nil)
+		if err != nil {
+			return written, err
+		}
+		line, err := session.Export(format, options)
+		if err != nil {
+			return written, fmt.Errorf("export session %s: %w", id, err)
+		}
+		if _, err := writer.Write(append(line, '\n')); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, writer.Flush()
+}
+
+func exportOpenAIChat(messages []types.ChatMessage, tools []types.ToolInfo) ([]byte, error) {
+	items := make([]any, 0, len(messages))
+	for _, message := range messages {
+		items = append(items, message.ToMap())
+	}
+	record := map[string]any{"messages": items}
+	if len(tools) > 0 {
+		record["tools"] = openAITools(tools)
+	}
+	return json.Marshal(record)
+}
+
+func importOpenAIChat(data []byte) ([]types.ChatMessage, error) {
+	record := struct {
+		Messages []map[string]any `json:"messages"`
+	}{}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("decode openai chat record: %w", err)
+	}
+	messages := make([]types.ChatMessage, 0, len(record.Messages))
+	for _, item := range record.Messages {
+		messages = append(messages, types.ChatMessageFromMap(item))
+	}
+	return messages, nil
+}
+
+func openAITools(tools []types.ToolInfo) []any {
+	out := make([]any, 0, len(tools))
+	for _, tool := range tools {
+		out = append(out, utils.ToolInfoToOpenAITool(tool))
+	}
+	return out
+}
+
+var shareGPTRoles = map[string]string{
+	"system": "system",
+	"user":   "human",
+	"human":  "human",
+	"gpt":    "gpt",
+}
+
+func exportShareGPT(id string, messages []types.ChatMessage, tools []types.ToolInfo) ([]byte, error) {
+	record := map[string]any{"id": id}
+	if len(messages) > 0 && messages[0].Role == "system" {
+		record["system"] = messageText(messages[0].Content)
+		messages = messages[1:]
+	}
+	if len(tools) > 0 {
+		encoded, err := json.Marshal(openAITools(tools))
+		if err != nil {
+			return nil, err
+		}
+		record["tools"] = string(encoded)
+	}
+	conversations := make([]any, 0, len(messages))
+	turn := func(from string, value string) {
+		conversations = append(conversations, map[string]any{"from": from, "value": value})
+	}
+	for _, message := range messages {
+		text := messageText(message.Content)
+		switch message.Role {
+		case "assistant":
+			if text != "" || len(message.ToolCalls) == 0 {
+				turn("gpt", text)
+			}
+			if len(message.ToolCalls) > 0 {
+				calls := make([]any, 0, len(message.ToolCalls))
+				for _, call := range message.ToolCalls {
+					calls = append(calls, map[string]any{"name": call.Name, "arguments": toolCallArguments(call.Arguments)})
+				}
+				var value any = calls
+				if len(calls) == 1 {
+					value = calls[0]
+				}
+				encoded, err := json.Marshal(value)
+				if err != nil {
+					return nil, err
+				}
+				turn("function_call", string(encoded))
+			}
+		case "tool":
+			turn("observation", text)
+		default:
+			from, ok := shareGPTRoles[message.Role]
+			if !ok {
+				from = message.Role
+			}
+			turn(from, text)
+		}
+	}
+	record["conversations"] = conversations
+	return json.Marshal(record)
+}
+
+func importShareGPT(data []byte) ([]types.ChatMessage, string, error) {
+	record := struct {
+		ID            any              `json:"id"`
+		System        string           `json:"system"`
+		Conversations []map[string]any `json:"conversations"`
+	}{}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, "", fmt.Errorf("decode sharegpt record: %w", err)
+	}
+	messages := []types.ChatMessage{}
+	if record.System != "" {
+		messages = append(messages, types.ChatMessage{Role: "system", Content: record.System})
+	}
+	pending := []types.ToolCall{}
+	callSeq := 0
+	for _, item := range record.Conversations {
+		from := strings.ToLower(stringOf(item["from"]))
+		value := stringOf(item["value"])
+		switch from {
+		case "human", "user":
+			messages = append(messages, types.ChatMessage{Role: "user", Content: value})
+		case "gpt", "assistant", "model", "chatgpt", "bing", "bard":
+			messages = append(messages, types.ChatMessage{Role: "assistant", Content: value})
+		case "system":
+			messages = append(messages, types.ChatMessage{Role: "system", Content: value})
+		case "function_call", "tool_call":
+			calls := shareGPTToolCalls(value, &callSeq)
+			if last := len(messages) - 1; last >= 0 && messages[last].Role == "assistant" && len(messages[last].ToolCalls) == 0 {
+				messages[last].ToolCalls = calls
+			} else {
+				messages = append(messages, types.ChatMessage{Role: "assistant", ToolCalls: calls})
+			}
+			pending = append(pending, calls...)
+		case "observation", "tool", "function":
+			message := types.ChatMessage{Role: "tool", Content: value}
+			if len(pending) > 0 {
+				message.ToolCallID, message.Name = pending[0].ID, pending[0].Name
+				pending = pending[1:]
+			}
+			messages = append(messages, message)
+		default:
+			return nil, "", fmt.Errorf("sharegpt record has unknown speaker %q", from)
+		}
+	}
+	return messages, stringOf(record.ID), nil
+}
+
+// shareGPTToolCalls reads a function_call value: one {"name", "arguments"}
+// object or a list of them. IDs are generated, as ShareGPT has none.
+func shareGPTToolCalls(value string, seq *int) []types.ToolCall {
+	var decoded any
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		*seq++
+		return []types.ToolCall{{ID: fmt.Sprintf("call-%d", *seq), Name: value}}
+	}
+	items, ok := decoded.([]any)
+	if !ok {
+		items = []any{decoded}
+	}
+	calls := types.ParseToolCalls(items)
+	for i := range calls {
+		*seq++
+		if calls[i].ID == "" {
+			calls[i].ID = fmt.Sprintf("call-%d", *seq)
+		}
+	}
+	return calls
+}
+
+func exportMarkdownTranscript(id string, messages []types.ChatMessage) []byte {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "# Session %s\n", id)
+	for _, message := range messages {
+		heading := "## " + message.Role
+		if message.Role == "tool" {
+			heading += " " + markdownToken(message.ToolCallID) + " " + markdownToken(message.Name)
+		}
+		buffer.WriteString("\n" + heading + "\n")
+		if text := messageText(message.Content); text != "" {
+			buffer.WriteString("\n" + text + "\n")
+		}
+		for _, call := range message.ToolCalls {
+			fmt.Fprintf(&buffer, "\n**Tool call** %s %s\n\n```json\n%s\n```\n", markdownToken(call.ID), markdownToken(call.Name), call.Arguments)
+		}
+	}
+	return buffer.Bytes()
+}
+
+var (
+	markdownRoleHeading = regexp.MustCompile("^## (system|user|assistant|tool)(?: (\\S+) (\\S+))?\\s*$")
+	markdownToolCall    = regexp.MustCompile("^\\*\\*Tool call\\*\\* (\\S+) (\\S+)\\s*$")
+)
+
+// importMarkdownTranscript reads transcripts written by the markdown
+// exporter. Headings inside fenced code blocks are part of the content.
+func importMarkdownTranscript(data []byte) ([]types.ChatMessage, string, error) {
+	messages := []types.ChatMessage{}
+	id := ""
+	var current *types.ChatMessage
+	var content []string
+	var call *types.ToolCall
+	var arguments []string
+	inFence := false
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		if text := strings.TrimSpace(strings.Join(content, "\n")); text != "" {
+			current.Content = text
+		}
+		messages = append(messages, *current)
+		current, content = nil, nil
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(line, "```") {
+			if call != nil {
+				if inFence {
+					call.Arguments = strings.Join(arguments, "\n")
+					current.ToolCalls = append(current.ToolCalls, *call)
+					call, arguments = nil, nil
+				}
+				inFence = !inFence
+				continue
+			}
+			inFence = !inFence
+		}
+		if inFence {
+			if call != nil {
+				arguments = append(arguments, line)
+			} else if current != nil {
+				content = append(content, line)
+			}
+			continue
+		}
+		if match := markdownRoleHeading.FindStringSubmatch(line); match != nil {
+			flush()
+			current = &types.ChatMessage{Role: match[1]}
+			if match[1] == "tool" {
+				current.ToolCallID, current.Name = markdownValue(match[2]), markdownValue(match[3])
+			}
+			continue
+		}
+		if match := markdownToolCall.FindStringSubmatch(line); match != nil && current != nil && current.Role == "assistant" {
+			call = &types.ToolCall{ID: markdownValue(match[1]), Name: markdownValue(match[2])}
+			continue
+		}
+		if current == nil {
+			if title, ok := strings.CutPrefix(line, "# Session "); ok && id == "" {
+				id = strings.TrimSpace(title)
+			}
+			continue
+		}
+		content = append(content, line)
+	}
+	if call != nil || inFence {
+		return nil, "", fmt.Errorf("markdown transcript ends inside a code block")
+	}
+	flush()
+	return messages, id, nil
+}
+
+// markdownToken writes an empty value as "-", so headings keep their shape.
+func markdownToken(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "-"
+	}
+	return strings.Join(strings.Fields(value), "_")
+}
+
+func markdownValue(token string) string {
+	if token == "-" {
+		return ""
+	}
+	return token
+}
+
+// messageText flattens message content to the text datasets carry.
+func messageText(content any) string {
+	text, _ := chatMessageText(types.ChatMessage{Content: content})
+	return text
+}
+
+func toolCallArguments(arguments string) any {
+	var decoded any
+	if err := json.Unmarshal([]byte(arguments), &decoded); err == nil {
+		return decoded
+	}
+	return arguments
+}
+
+func stringOf(value any) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
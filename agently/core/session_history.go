@@ -0,0 +1,156 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+// Turns start at each user message and run up to the next one, so a turn
+// holds the user input, the assistant reply and the tool calls between them.
+// Messages before the first user message belong to no turn and are kept.
+
+// TurnCount returns how many turns the full context holds.
+func (s *Session) TurnCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(turnStarts(s.fullContext))
+}
+
+// Fork copies the session at its current state under newID. The fork keeps
+// the memo, session settings and registered handlers but starts unsaved,
+// with its own tool cache.
+func (s *Session) Fork(newID string) *Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.forkLocked(newID, len(s.fullContext))
+}
+
+// ForkAtTurn copies the session under newID as it was before turn, counted
+// from 0, so the fork holds turns 0 to turn-1. The memo is copied as is, so a
+// summary may mention later turns.
+func (s *Session) ForkAtTurn(newID string, turn int) (*Session, error) {
+	s.mu.RLock()
+	starts := turnStarts(s.fullContext)
+	if turn < 0 || turn > len(starts) {
+		s.mu.RUnlock()
+		return nil, fmt.Errorf("session %s has %d turns, cannot fork at turn %d", s.id, len(starts), turn)
+	}
+	keep := len(s.fullContext)
+	if turn < len(starts) {
+		keep = starts[turn]
+	}
+	fork := s.forkLocked(newID, keep)
+	truncated := keep < len(s.fullContext)
+	s.mu.RUnlock()
+
+	// Resizing may summarize with a model request, so the parent is not
+	// held locked meanwhile.
+	if truncated && fork.autoResize {
+		fork.Resize()
+	}
+	return fork, nil
+}
+
+func (s *Session) forkLocked(newID string, keep int) *Session {
+	fork := NewSession(newID, s.autoResize, s.parentSettings)
+	if own, ok := s.sessionSetting.Data(false).(map[string]any); ok {
+		fork.sessionSetting.Update(own)
+	}
+	if s.customAnalysisHandler {
+		fork.analysisHandler = s.analysisHandler
+		fork.customAnalysisHandler = true
+	}
+	for name := range s.customExecutionHandlers {
+		fork.executionHandler[name] = s.executionHandler[name]
+		fork.customExecutionHandlers[name] = true
+	}
+	fork.tokenCounter = s.tokenCounter
+	fork.summarizer = s.summarizer
+	fork.memo = copyMemo(s.memo)
+	fork.fullContext, fork.contextWindow = truncateContexts(s.fullContext, s.contextWindow, keep)
+	return fork
+}
+
+// Rewind drops the last n turns from the full context and the context window,
+// e.g. to regenerate the last reply.
+func (s *Session) Rewind(n int) *Session {
+	if n <= 0 {
+		return s
+	}
+	s.mu.Lock()
+	starts := turnStarts(s.fullContext)
+	if len(starts) == 0 {
+		s.mu.Unlock()
+		return s
+	}
+	s.fullContext, s.contextWindow = truncateContexts(s.fullContext, s.contextWindow, starts[max(len(starts)-n, 0)])
+	s.mu.Unlock()
+	if s.autoResize {
+		s.Resize()
+	}
+	return s
+}
+
+// EditMessage replaces the content of the message at index in the full
+// context, and its copy in the context window. Later messages are kept;
+// Rewind or ForkAtTurn drop them.
+func (s *Session) EditMessage(index int, content any) error {
+	s.mu.Lock()
+	if index < 0 || index >= len(s.fullContext) {
+		s.mu.Unlock()
+		return fmt.Errorf("session %s has %d messages, cannot edit message %d", s.id, len(s.fullContext), index)
+	}
+	original := s.fullContext[index]
+	full := append([]types.ChatMessage{}, s.fullContext...)
+	full[index].Content = content
+	window := append([]types.ChatMessage{}, s.contextWindow...)
+	if windowIndex := index - (len(full) - len(window)); windowIndex >= 0 && windowIndex < len(window) && sameChatMessage(window[windowIndex], original) {
+		window[windowIndex].Content = content
+	}
+	s.fullContext, s.contextWindow = full, window
+	s.mu.Unlock()
+	if s.autoResize {
+		s.Resize()
+	}
+	return nil
+}
+
+// turnStarts returns the indexes of the user messages.
+func turnStarts(messages []types.ChatMessage) []int {
+	starts := []int{}
+	for i, message := range messages {
+		if message.Role == "user" {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+// truncateContexts keeps the first keep messages of full. The window is a
+// suffix of full, so it loses the same tail; cut back to nothing, it is
+// rebuilt from the kept messages for the next resize to trim.
+func truncateContexts(full []types.ChatMessage, window []types.ChatMessage, keep int) ([]types.ChatMessage, []types.ChatMessage) {
+	keptFull := append([]types.ChatMessage{}, full[:keep]...)
+	keptWindow := append([]types.ChatMessage{}, window[:max(len(window)-(len(full)-keep), 0)]...)
+	if len(keptWindow) == 0 && len(window) > 0 {
+		keptWindow = append([]types.ChatMessage{}, keptFull...)
+	}
+	return keptFull, keptWindow
+}
+
+func sameChatMessage(a types.ChatMessage, b types.ChatMessage) bool {
+	return a.Role == b.Role && a.ToolCallID == b.ToolCallID && fmt.Sprint(utils.DataFormatterSanitize(a.Content, false)) == fmt.Sprint(utils.DataFormatterSanitize(b.Content, false))
+}
+
+func copyMemo(memo any) any {
+	if typed, ok := memo.(map[string]any); ok {
+		out := make(map[string]any, len(typed))
+		for key, value := range typed {
+			out[key] = value
+		}
+		return out
+	}
+	return memo
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+// ErrSessionNotFound is wrapped by SessionStore.Load for unknown sessions.
+var ErrSessionNotFound = errors.New("session not found")
+
+// ErrSessionVersionConflict is wrapped by SessionStore.Save when the stored
+// session changed since it was loaded, usually by another process.
+var ErrSessionVersionConflict = errors.New("session version conflict")
+
+// StoredSession is a session as kept in a SessionStore. Data is the output of
+// Session.ToSerializableData.
+type StoredSession struct {
+	ID        string         `json:"id"`
+	Version   int64          `json:"version"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	Data      map[string]any `json:"data"`
+}
+
+// SessionStore persists sessions across restarts.
+type SessionStore interface {
+	Load(ctx context.Context, id string) (StoredSession, error)
+	// Save writes session if the stored version still equals session.Version,
+	// 0 for a session that is not stored yet, and returns it with the next
+	// version. Otherwise it fails with ErrSessionVersionConflict.
+	Save(ctx context.Context, session StoredSession) (StoredSession, error)
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context) ([]string, error)
+}
+
+// Version is the store version the session was last loaded or saved at, 0
+// when it was never stored.
+func (s *Session) Version() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.version
+}
+
+// LoadSessionFromStore creates a session from its stored copy.
+func LoadSessionFromStore(ctx context.Context, store SessionStore, id string, settings *utils.Settings) (*Session, error) {
+	stored, err := store.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	session := NewSession(id, true, settings)
+	if err := session.LoadSerializableData(stored.Data); err != nil {
+		return nil, fmt.Errorf("load session %s: %w", id, err)
+	}
+	session.mu.Lock()
+	session.version = stored.Version
+	session.mu.Unlock()
+	return session, nil
+}
+
+// SaveSessionToStore saves session and advances its version.
+func SaveSessionToStore(ctx context.Context, store SessionStore, session *Session) error {
+	expected := session.Version()
+	saved, err := store.Save(ctx, StoredSession{
+		ID:        session.ID(),
+		Version:   expected,
+		UpdatedAt: time.Now(),
+		Data:      session.ToSerializableData(),
+	})
+	if err != nil {
+		return err
+	}
+	session.mu.Lock()
+	if session.version == expected {
+		session.version = saved.Version
+	}
+	session.mu.Unlock()
+	return nil
+}
+
+// ForceSaveSessionToStore saves session over the stored version, dropping the
+// changes saved elsewhere since session was loaded. It still fails with
+// ErrSessionVersionConflict if another save lands between its load and save.
+func ForceSaveSessionToStore(ctx context.Context, store SessionStore, session *Session) error {
+	stored, err := store.Load(ctx, session.ID())
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return err
+	}
+	session.mu.Lock()
+	session.version = stored.Version
+	session.mu.Unlock()
+	return SaveSessionToStore(ctx, store, session)
+}
+
+func checkSessionVersion(id string, stored int64, expected int64) error {
+	if stored != expected {
+		return fmt.Errorf("%w: %s is at version %d, not %d", ErrSessionVersionConflict, id, stored, expected)
+	}
+	return nil
+}
+
+// staleSessionLockAge is how old a lock file must be before it is taken to be
+// left over by a crashed process.
+const staleSessionLockAge = 30 * time.Second
+
+// lockSessionFile takes an exclusive lock across processes by creating path,
+// and returns the function releasing it.
+func lockSessionFile(ctx context.Context, path string) (func(), error) {
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_ = file.Close()
+			return func() { _ = os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > staleSessionLockAge {
+			_ = os.Remove(path)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileSessionStore keeps each session as a JSON file in a directory. Saves
+// are atomic renames guarded by a lock file, so several processes can share
+// the directory.
+type FileSessionStore struct {
+	dir string
+}
+
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{dir: dir}, nil
+}
+
+func (s *FileSessionStore) Load(_ context.Context, id string) (StoredSession, error) {
+	return s.read(id)
+}
+
+func (s *FileSessionStore) Save(ctx context.Context, session StoredSession) (StoredSession, error) {
+	unlock, err := lockSessionFile(ctx, s.path(session.ID)+".lock")
+	if err != nil {
+		return StoredSession{}, err
+	}
+	defer unlock()
+
+	current, err := s.read(session.ID)
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return StoredSession{}, err
+	}
+	if err := checkSessionVersion(session.ID, current.Version, session.Version); err != nil {
+		return StoredSession{}, err
+	}
+	session.Version++
+	payload, err := json.Marshal(session)
+	if err != nil {
+		return StoredSession{}, fmt.Errorf("encode session %s: %w", session.ID, err)
+	}
+	temp, err := os.CreateTemp(s.dir, ".session-*")
+	if err != nil {
+		return StoredSession{}, err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(payload); err != nil {
+		_ = temp.Close()
+		return StoredSession{}, err
+	}
+	if err := temp.Sync(); err != nil {
+		_ = temp.Close()
+		return StoredSession{}, err
+	}
+	if err := temp.Close(); err != nil {
+		return StoredSession{}, err
+	}
+	if err := os.Rename(temp.Name(), s.path(session.ID)); err != nil {
+		return StoredSession{}, err
+	}
+	return session, nil
+}
+
+func (s *FileSessionStore) Delete(ctx context.Context, id string) error {
+	unlock, err := lockSessionFile(ctx, s.path(id)+".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List returns the stored session IDs in order.
+func (s *FileSessionStore) List(_ context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		id, err := url.PathUnescape(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s *FileSessionStore) read(id string) (StoredSession, error) {
+	payload, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return StoredSession{}, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return StoredSession{}, err
+	}
+	stored := StoredSession{}
+	if err := json.Unmarshal(payload, &stored); err != nil {
+		return StoredSession{}, fmt.Errorf("decode session %s: %w", id, err)
+	}
+	return stored, nil
+}
+
+// path escapes id, so IDs with separators or dots stay inside the directory.
+func (s *FileSessionStore) path(id string) string {
+	name := url.PathEscape(id)
+	if strings.HasPrefix(name, ".") {
+		name = "%2E" + name[1:]
+	}
+	return filepath.Join(s.dir, name+".json")
+}
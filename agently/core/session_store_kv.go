@@ -0,0 +1,248 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// kvCompactMinGarbage is how many superseded records the log of a
+// KVSessionStore holds before it is compacted.
+const kvCompactMinGarbage = 256
+
+// KVSessionStore keeps sessions in a single-file embedded key-value store: an
+// append-only log of JSON records that is compacted as it grows. Processes
+// sharing the file see each other's writes; a lock file next to it orders them.
+type KVSessionStore struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]StoredSession
+	file    os.FileInfo
+	offset  int64
+	garbage int
+}
+
+type kvSessionRecord struct {
+	Op      string         `json:"op"`
+	ID      string         `json:"id"`
+	Session *StoredSession `json:"session,omitempty"`
+}
+
+// OpenKVSessionStore opens the store at path, creating it when missing.
+func OpenKVSessionStore(path string) (*KVSessionStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	store := &KVSessionStore{path: path, entries: map[string]StoredSession{}}
+	if err := store.withLock(context.Background(), func() error { return nil }); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *KVSessionStore) Load(ctx context.Context, id string) (StoredSession, error) {
+	var stored StoredSession
+	err := s.withLock(ctx, func() error {
+		entry, ok := s.entries[id]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+		}
+		stored = entry
+		return nil
+	})
+	return stored, err
+}
+
+func (s *KVSessionStore) Save(ctx context.Context, session StoredSession) (StoredSession, error) {
+	err := s.withLock(ctx, func() error {
+		if err := checkSessionVersion(session.ID, s.entries[session.ID].Version, session.Version); err != nil {
+			return err
+		}
+		session.Version++
+		return s.append(kvSessionRecord{Op: "put", ID: session.ID, Session: &session})
+	})
+	if err != nil {
+		return StoredSession{}, err
+	}
+	return session, nil
+}
+
+func (s *KVSessionStore) Delete(ctx context.Context, id string) error {
+	return s.withLock(ctx, func() error {
+		if _, ok := s.entries[id]; !ok {
+			return nil
+		}
+		return s.append(kvSessionRecord{Op: "delete", ID: id})
+	})
+}
+
+// List returns the stored session IDs in order.
+func (s *KVSessionStore) List(ctx context.Context) ([]string, error) {
+	var ids []string
+	err := s.withLock(ctx, func() error {
+		ids = make([]string, 0, len(s.entries))
+		for id := range s.entries {
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	sort.Strings(ids)
+	return ids, err
+}
+
+// withLock runs fn holding the process and file locks, with the entries
+// caught up to the end of the log.
+func (s *KVSessionStore) withLock(ctx context.Context, fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := lockSessionFile(ctx, s.path+".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// refresh applies records appended by other processes. It reloads the whole
+// log when the file was replaced by a compaction, and cuts off a record left
+// half-written by a crash.
+func (s *KVSessionStore) refresh() error {
+	file, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if s.file == nil || !os.SameFile(s.file, info) || info.Size() < s.offset {
+		s.entries = map[string]StoredSession{}
+		s.offset, s.garbage = 0, 0
+	}
+	s.file = info
+	if _, err := file.Seek(s.offset, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				return file.Truncate(s.offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			record := kvSessionRecord{}
+			if err := json.Unmarshal(trimmed, &record); err != nil {
+				return fmt.Errorf("session store %s: corrupt record at offset %d: %w", s.path, s.offset, err)
+			}
+			s.apply(record)
+		}
+		s.offset += int64(len(line))
+	}
+}
+
+func (s *KVSessionStore) apply(record kvSessionRecord) {
+	if _, ok := s.entries[record.ID]; ok {
+		s.garbage++
+	}
+	switch record.Op {
+	case "put":
+		if record.Session != nil {
+			s.entries[record.ID] = *record.Session
+		}
+	case "delete":
+		delete(s.entries, record.ID)
+	}
+}
+
+func (s *KVSessionStore) append(record kvSessionRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encode session %s: %w", record.ID, err)
+	}
+	line = append(line, '\n')
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(line); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	s.apply(record)
+	s.offset += int64(len(line))
+	if s.garbage >= kvCompactMinGarbage && s.garbage > len(s.entries) {
+		return s.compact()
+	}
+	return nil
+}
+
+// compact rewrites the log with one record per live session and swaps it in
+// with a rename, which other processes notice on their next refresh.
+func (s *KVSessionStore) compact() error {
+	temp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".compact-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	writer := bufio.NewWriter(temp)
+	var size int64
+	for id, entry := range s.entries {
+		line, err := json.Marshal(kvSessionRecord{Op: "put", ID: id, Session: &entry})
+		if err != nil {
+			_ = temp.Close()
+			return err
+		}
+		line = append(line, '\n')
+		if _, err := writer.Write(line); err != nil {
+			_ = temp.Close()
+			return err
+		}
+		size += int64(len(line))
+	}
+	if err := writer.Flush(); err != nil {
+		_ = temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		_ = temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temp.Name(), s.path); err != nil {
+		return err
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	s.file, s.offset, s.garbage = info, size, 0
+	return nil
+}
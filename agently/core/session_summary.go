@@ -0,0 +1,181 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+// DefaultSessionSummaryPrompt is the instruction of session.summarize.prompt
+// when none is configured.
+const DefaultSessionSummaryPrompt = "Fold the conversation turns into the previous summary. Keep facts, decisions, user preferences, tool results and open tasks; drop greetings and repetition. Reply with the updated summary only."
+
+// defaultSessionSummaryKeepMessages is session.summarize.keep_messages when
+// it is not set.
+const defaultSessionSummaryKeepMessages = 4
+
+// ErrNoSessionSummarizer is returned by the summarize strategy when neither
+// SetSummarizer nor session.summarizer configured a summarizer.
+var ErrNoSessionSummarizer = errors.New("session summarize strategy has no summarizer")
+
+// SessionSummaryRequest is what a SessionSummarizer folds.
+type SessionSummaryRequest struct {
+	// Summary is the rolling summary so far, empty on the first fold.
+	Summary string
+	// Messages are the oldest messages leaving the context window.
+	Messages []types.ChatMessage
+	// Prompt is the summary instruction from session.summarize.prompt.
+	Prompt string
+	// MaxLength is the target summary length in characters.
+	MaxLength int
+}
+
+// SessionSummarizer folds turns leaving the context window into the rolling
+// summary of a session and returns the new summary.
+type SessionSummarizer func(ctx context.Context, request SessionSummaryRequest) (string, error)
+
+// AgentSessionSummarizer summarizes with temporary requests of agent. They
+// use the agent's settings, so its model, but neither its prompt nor its
+// extension handlers, so the agent may be the one the session belongs to.
+func AgentSessionSummarizer(agent *BaseAgent) SessionSummarizer {
+	return func(ctx context.Context, request SessionSummaryRequest) (string, error) {
+		modelRequest := agent.CreateTempRequest()
+		instruct := request.Prompt
+		if request.MaxLength > 0 {
+			instruct += fmt.Sprintf("\nKeep the summary under %d characters.", request.MaxLength)
+		}
+		modelRequest.Input(map[string]any{
+			"previous_summary": request.Summary,
+			"new_turns":        FormatChatTranscript(request.Messages),
+		})
+		modelRequest.Instruct(instruct)
+		text, err := modelRequest.GetTextWithContext(ctx)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(text), nil
+	}
+}
+
+// FormatChatTranscript renders messages as "role: text" lines, with tool calls
+// as "name(arguments)".
+func FormatChatTranscript(messages []types.ChatMessage) string {
+	lines := make([]string, 0, len(messages))
+	for _, message := range messages {
+		text, _ := chatMessageText(types.ChatMessage{Content: message.Content})
+		for _, call := range message.ToolCalls {
+			text = strings.TrimSpace(text + "\n" + call.Name + "(" + call.Arguments + ")")
+		}
+		lines = append(lines, message.Role+": "+text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SetSummarizer sets the summarizer of the summarize strategy. By default the
+// session uses session.summarizer.
+func (s *Session) SetSummarizer(summarizer SessionSummarizer) *Session {
+	s.mu.Lock()
+	s.summarizer = summarizer
+	s.mu.Unlock()
+	return s
+}
+
+// Summary returns the rolling summary kept in the memo, or "".
+func (s *Session) Summary() string {
+	return memoSummary(s.Memo())
+}
+
+// summarizeExecutionHandler folds the oldest messages into the summary stored
+// under "summary" in the memo, keeping the newest
+// session.summarize.keep_messages messages that fit the limits. The summarizer
+// runs with ctx, bounded by session.summarize.timeout. When summarizing fails
+// the window is still trimmed and the previous summary is kept.
+func (s *Session) summarizeExecutionHandler(ctx context.Context, _ []types.ChatMessage, contextWindow []types.ChatMessage, memo any, sessionSettings *utils.RuntimeDataNamespace) ([]types.ChatMessage, []types.ChatMessage, any, error) {
+	limits, err := s.windowLimits(sessionSettings)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	keep := defaultSessionSummaryKeepMessages
+	if sessionSettings.Get("summarize.keep_messages", nil, true) != nil {
+		keep = max(namespaceInt(sessionSettings, "summarize.keep_messages"), 0)
+	}
+	start := limits.cutStart(contextWindow, keep)
+	if start == 0 {
+		return nil, nil, nil, nil
+	}
+	window := append([]types.ChatMessage{}, contextWindow[start:]...)
+
+	summary, err := s.summarize(ctx, sessionSettings, SessionSummaryRequest{
+		Summary:   memoSummary(memo),
+		Messages:  append([]types.ChatMessage{}, contextWindow[:start]...),
+		Prompt:    sessionStringSetting(sessionSettings, "summarize.prompt", DefaultSessionSummaryPrompt),
+		MaxLength: namespaceInt(sessionSettings, "summarize.max_length"),
+	})
+	if err != nil {
+		_ = EmitWarning(s.settings, "Session", map[string]any{"session_id": s.id}, fmt.Sprintf("session summarize failed, falling back to simple_cut: %v", err))
+		return nil, window, nil, nil
+	}
+	return nil, window, memoWithSummary(memo, summary), nil
+}
+
+func (s *Session) summarize(ctx context.Context, sessionSettings *utils.RuntimeDataNamespace, request SessionSummaryRequest) (string, error) {
+	s.mu.RLock()
+	summarizer := s.summarizer
+	s.mu.RUnlock()
+	if summarizer == nil {
+		switch typed := sessionSettings.Get("summarizer", nil, true).(type) {
+		case SessionSummarizer:
+			summarizer = typed
+		case func(context.Context, SessionSummaryRequest) (string, error):
+			summarizer = typed
+		}
+	}
+	if summarizer == nil {
+		return "", ErrNoSessionSummarizer
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if timeout := namespaceFloat(sessionSettings, "summarize.timeout"); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout*float64(time.Second)))
+		defer cancel()
+	}
+	return summarizer(ctx, request)
+}
+
+func sessionStringSetting(ns *utils.RuntimeDataNamespace, key string, fallback string) string {
+	if value, ok := ns.Get(key, nil, true).(string); ok && strings.TrimSpace(value) != "" {
+		return value
+	}
+	return fallback
+}
+
+// memoSummary reads the summary from a memo map, or a string memo as a whole.
+func memoSummary(memo any) string {
+	switch typed := memo.(type) {
+	case string:
+		return typed
+	case map[string]any:
+		summary, _ := typed["summary"].(string)
+		return summary
+	}
+	return ""
+}
+
+// memoWithSummary stores summary in memo, keeping the other keys of a map memo.
+func memoWithSummary(memo any, summary string) map[string]any {
+	out := map[string]any{}
+	if existing, ok := memo.(map[string]any); ok {
+		for key, value := range existing {
+			out[key] = value
+		}
+	}
+	out["summary"] = summary
+	return out
+}
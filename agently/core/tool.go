@@ -1,11 +1,154 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 
+	"github.com/AgentEra/Agently-Go/agently/types"
 	"github.com/AgentEra/Agently-Go/agently/utils"
 )
 
+// ErrToolNameConflict is returned by Register when a tool with the same name
+// exists and the `tool.name_collision` policy is "error".
+var ErrToolNameConflict = errors.New("tool name already registered")
+
+// Tool name collision policies for `tool.name_collision`.
+const (
+	ToolCollisionReplace = "replace"
+	ToolCollisionError   = "error"
+	ToolCollisionKeep    = "keep"
+)
+
+// ToolScope selects where an agent registers a tool. Lookups go from the
+// narrowest scope to the widest: request, then agent, then global.
+type ToolScope string
+
+const (
+	ToolScopeGlobal  ToolScope = "global"
+	ToolScopeAgent   ToolScope = "agent"
+	ToolScopeRequest ToolScope = "request"
+)
+
+// requestToolSettingsKey carries a request-scoped Tool on response settings.
+const requestToolSettingsKey = "$tool.request_scope"
+
+// ToolNameCollisionPolicy returns the configured `tool.name_collision` policy.
+// It defaults to "error", so registering a tool never silently replaces one
+// that another agent or request relies on.
+func ToolNameCollisionPolicy(settings *utils.Settings) string {
+	if settings == nil {
+		return ToolCollisionError
+	}
+	policy := strings.ToLower(strings.TrimSpace(fmt.Sprint(settings.Get("tool.name_collision", ToolCollisionError, true))))
+	switch policy {
+	case ToolCollisionReplace, ToolCollisionKeep:
+		return policy
+	}
+	return ToolCollisionError
+}
+
+// ToolKwargsValidation returns whether tool kwargs are checked against
+// ToolInfo.Kwargs before a call (`tool.kwargs.validate`) and whether
+// mismatches may be coerced (`tool.kwargs.coerce`).
+func ToolKwargsValidation(settings *utils.Settings) (validate bool, coerce bool) {
+	return getBoolSetting(settings, "tool.kwargs.validate", true), getBoolSetting(settings, "tool.kwargs.coerce", false)
+}
+
+// ToolKwargsRetry returns whether the model is asked once to fix kwargs that
+// failed validation (`tool.kwargs.retry`).
+func ToolKwargsRetry(settings *utils.Settings) bool {
+	return getBoolSetting(settings, "tool.kwargs.retry", false)
+}
+
+// ToolConcurrency returns how many tool calls of one model turn may run at
+// once (`tool.concurrency`); zero or less runs them all together.
+func ToolConcurrency(settings *utils.Settings) int {
+	if settings == nil {
+		return 0
+	}
+	return settingsInt(settings, "tool.concurrency", 0)
+}
+
+// RequestScopedTool returns the tools registered on the request a response
+// was created from, or nil.
+func RequestScopedTool(settings *utils.Settings) *Tool {
+	if settings == nil {
+		return nil
+	}
+	tool, _ := settings.Get(requestToolSettingsKey, nil, true).(*Tool)
+	return tool
+}
+
+// UnregisterTools removes tools from manager. It fails when the manager does
+// not implement ToolManagerExtension.
+func UnregisterTools(manager ToolManager, toolNames []string) error {
+	extension, ok := manager.(ToolManagerExtension)
+	if !ok {
+		return fmt.Errorf("tool manager %T cannot unregister tools", manager)
+	}
+	return extension.Unregister(toolNames)
+}
+
+// UntagTools removes tags from tools in manager. It fails when the manager
+// does not implement ToolManagerExtension.
+func UntagTools(manager ToolManager, toolNames []string, tags []string) error {
+	extension, ok := manager.(ToolManagerExtension)
+	if !ok {
+		return fmt.Errorf("tool manager %T cannot untag tools", manager)
+	}
+	return extension.Untag(toolNames, tags)
+}
+
+// ReplaceTool swaps a registered tool for info and fn in one step. It fails
+// when the manager does not implement ToolManagerExtension.
+func ReplaceTool(manager ToolManager, info types.ToolInfo, fn any) error {
+	extension, ok := manager.(ToolManagerExtension)
+	if !ok {
+		return fmt.Errorf("tool manager %T cannot replace tools", manager)
+	}
+	return extension.Replace(info, fn)
+}
+
+// CallTools runs calls through manager.CallTools when the manager implements
+// ToolManagerExtension. Otherwise each call goes through CallTool, at most
+// concurrency at a time (0 or less runs them all together), and results are
+// returned in call order.
+func CallTools(ctx context.Context, manager ToolManager, calls []types.ToolStep, concurrency int) []types.ToolStep {
+	if extension, ok := manager.(ToolManagerExtension); ok {
+		return extension.CallTools(ctx, calls, concurrency)
+	}
+	out := make([]types.ToolStep, len(calls))
+	copy(out, calls)
+	if concurrency <= 0 || concurrency > len(out) {
+		concurrency = max(len(out), 1)
+	}
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range out {
+		wg.Add(1)
+		go func(step *types.ToolStep) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			result, err := manager.CallTool(ctx, step.Name, step.Kwargs)
+			if err != nil {
+				step.Error = err.Error()
+				var kwargsErr *utils.KwargsError
+				if errors.As(err, &kwargsErr) {
+					step.InvalidKwargs = kwargsErr.Issues
+				}
+				return
+			}
+			step.Result = result
+		}(&out[i])
+	}
+	wg.Wait()
+	return out
+}
+
 type Tool struct {
 	settings   *utils.Settings
 	plugin     ToolManager
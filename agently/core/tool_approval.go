@@ -0,0 +1,187 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+// ErrToolCallDenied is wrapped by the error of a tool call that was denied or
+// could not be approved.
+var ErrToolCallDenied = errors.New("tool call denied")
+
+// ErrToolApprovalNotFound is returned when resolving an unknown or already
+// resolved approval.
+var ErrToolApprovalNotFound = errors.New("tool approval not found")
+
+// toolApproverSettingsKey carries the ToolApprover on settings, so tool
+// managers of an agent and its requests share it.
+const toolApproverSettingsKey = "$tool.approver"
+
+// ToolApprover decides on a call to a tool that requires approval. It may
+// block until a human answers; ctx ends with the tool call.
+type ToolApprover func(ctx context.Context, request types.ToolApprovalRequest) (types.ToolApprovalDecision, error)
+
+// SetToolApprover stores approver on settings. Nil removes it.
+func SetToolApprover(settings *utils.Settings, approver ToolApprover) {
+	if settings == nil {
+		return
+	}
+	if approver == nil {
+		settings.SetCover(toolApproverSettingsKey, nil)
+		return
+	}
+	settings.SetCover(toolApproverSettingsKey, approver)
+}
+
+type toolApproverContextKey struct{}
+
+// WithToolApprover returns a context whose tool calls are approved by
+// approver. It takes precedence over the approver on the manager's settings,
+// which lets an agent guard tools of registries it does not own.
+func WithToolApprover(ctx context.Context, approver ToolApprover) context.Context {
+	if approver == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, toolApproverContextKey{}, approver)
+}
+
+// ToolApproverFromSettings returns the approver visible from settings, or nil.
+func ToolApproverFromSettings(settings *utils.Settings) ToolApprover {
+	if settings == nil {
+		return nil
+	}
+	approver, _ := settings.Get(toolApproverSettingsKey, nil, true).(ToolApprover)
+	return approver
+}
+
+var toolApprovalSeq atomic.Int64
+
+// ApproveToolCall asks the approver from ctx or settings about one call and
+// returns the kwargs to run it with. Calls are denied when no approver is
+// configured.
+func ApproveToolCall(ctx context.Context, settings *utils.Settings, info types.ToolInfo, kwargs map[string]any) (map[string]any, error) {
+	approver, _ := ctx.Value(toolApproverContextKey{}).(ToolApprover)
+	if approver == nil {
+		approver = ToolApproverFromSettings(settings)
+	}
+	if approver == nil {
+		return nil, fmt.Errorf("%w: %s requires approval but no approver is configured", ErrToolCallDenied, info.Name)
+	}
+	request := types.ToolApprovalRequest{
+		ID:     fmt.Sprintf("approval-%s-%d", randomID(), toolApprovalSeq.Add(1)),
+		Tool:   info.Name,
+		Desc:   info.Desc,
+		Kwargs: kwargs,
+	}
+	decision, err := approver(ctx, request)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("%w: %s: approval failed: %v", ErrToolCallDenied, info.Name, err)
+	}
+	switch decision.Action {
+	case types.ToolApprovalAllow:
+		return kwargs, nil
+	case types.ToolApprovalEdit:
+		if decision.Kwargs == nil {
+			return map[string]any{}, nil
+		}
+		return decision.Kwargs, nil
+	default:
+		reason := decision.Reason
+		if reason == "" {
+			reason = "not approved"
+		}
+		return nil, fmt.Errorf("%w: %s: %s", ErrToolCallDenied, info.Name, reason)
+	}
+}
+
+// ToolApprovalQueue is a ToolApprover for human-in-the-loop flows. Each call
+// is parked as a pending approval, announced as a TOOL_APPROVAL system message
+// and through OnRequest, and resumed when Resolve is called with its ID.
+type ToolApprovalQueue struct {
+	settings *utils.Settings
+
+	mu        sync.Mutex
+	pending   map[string]*pendingToolApproval
+	onRequest []func(types.ToolApprovalRequest)
+}
+
+type pendingToolApproval struct {
+	request  types.ToolApprovalRequest
+	decision chan types.ToolApprovalDecision
+}
+
+// NewToolApprovalQueue creates a queue. settings selects the EventCenter the
+// system messages go to and may be nil.
+func NewToolApprovalQueue(settings *utils.Settings) *ToolApprovalQueue {
+	return &ToolApprovalQueue{settings: settings, pending: map[string]*pendingToolApproval{}}
+}
+
+// OnRequest registers a callback for new pending approvals. Callbacks must not
+// block; resolve from another goroutine.
+func (q *ToolApprovalQueue) OnRequest(callback func(types.ToolApprovalRequest)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.onRequest = append(q.onRequest, callback)
+}
+
+// Approve implements ToolApprover. It waits for Resolve or the end of ctx.
+func (q *ToolApprovalQueue) Approve(ctx context.Context, request types.ToolApprovalRequest) (types.ToolApprovalDecision, error) {
+	pending := &pendingToolApproval{request: request, decision: make(chan types.ToolApprovalDecision, 1)}
+	q.mu.Lock()
+	q.pending[request.ID] = pending
+	callbacks := append([]func(types.ToolApprovalRequest){}, q.onRequest...)
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.pending, request.ID)
+		q.mu.Unlock()
+	}()
+
+	_ = EmitSystemMessage(q.settings, types.SystemEventToolApproval, request)
+	for _, callback := range callbacks {
+		callback(request)
+	}
+	select {
+	case decision := <-pending.decision:
+		return decision, nil
+	case <-ctx.Done():
+		return types.ToolApprovalDecision{}, ctx.Err()
+	}
+}
+
+// Pending lists the approvals waiting for a decision, ordered by ID.
+func (q *ToolApprovalQueue) Pending() []types.ToolApprovalRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make([]types.ToolApprovalRequest, 0, len(q.pending))
+	for _, pending := range q.pending {
+		out = append(out, pending.request)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Resolve answers a pending approval and resumes its tool call.
+func (q *ToolApprovalQueue) Resolve(id string, decision types.ToolApprovalDecision) error {
+	q.mu.Lock()
+	pending, ok := q.pending[id]
+	if ok {
+		delete(q.pending, id)
+	}
+	q.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrToolApprovalNotFound, id)
+	}
+	pending.decision <- decision
+	return nil
+}
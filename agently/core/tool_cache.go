@@ -0,0 +1,293 @@
+package core
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+// Settings keys carrying the response and session caches. Responses snapshot
+// their settings, so ensure_keys retries share the response cache.
+const (
+	responseToolCacheSettingsKey = "$tool.response_cache"
+	sessionToolCacheSettingsKey  = "$tool.session_cache"
+)
+
+// DefaultToolCacheMaxEntries bounds a ToolResultCache when
+// tool.cache.max_entries is not set.
+const DefaultToolCacheMaxEntries = 1024
+
+// toolCacheMinSweep is how many entries a cache adds before its first sweep
+// of expired results.
+const toolCacheMinSweep = 16
+
+// ToolResultCache holds tool results keyed by tool name and canonical kwargs.
+// Concurrent calls with the same key run the tool once. Expired results are
+// swept as new ones come in, and past SetMaxEntries the least recently used
+// results are dropped.
+type ToolResultCache struct {
+	id string
+
+	mu      sync.Mutex
+	entries map[string]*toolCacheEntry
+	// lru orders the keys, most recently used first.
+	lru        *list.List
+	maxEntries int
+	// inserts counts the entries added since expired ones were last swept.
+	inserts int
+}
+
+type toolCacheEntry struct {
+	tool    string
+	element *list.Element
+	done    chan struct{}
+	value   any
+	err     error
+	expires time.Time
+}
+
+func NewToolResultCache() *ToolResultCache {
+	return &ToolResultCache{id: randomID(), entries: map[string]*toolCacheEntry{}, lru: list.New()}
+}
+
+// ID identifies the cache. Idempotency keys are derived from it.
+func (c *ToolResultCache) ID() string { return c.id }
+
+// SetMaxEntries bounds the cache to n results, dropping the least recently
+// used ones past it. Zero or less leaves it unbounded.
+func (c *ToolResultCache) SetMaxEntries(n int) *ToolResultCache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxEntries = n
+	c.evictLocked()
+	return c
+}
+
+// Len returns the number of cached and in-flight results.
+func (c *ToolResultCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Do returns the cached result for key, or runs fn and caches its result for
+// ttl (forever when zero) if it succeeds. The bool reports a cache hit.
+func (c *ToolResultCache) Do(ctx context.Context, tool string, key string, ttl time.Duration, fn func() (any, error)) (any, bool, error) {
+	for {
+		c.mu.Lock()
+		now := time.Now()
+		entry, ok := c.entries[key]
+		if ok && entry.expiredAt(now) {
+			c.removeLocked(key, entry)
+			ok = false
+		}
+		if !ok {
+			entry = &toolCacheEntry{tool: tool, done: make(chan struct{})}
+			entry.element = c.lru.PushFront(key)
+			c.entries[key] = entry
+			c.inserts++
+			if c.inserts >= max(len(c.entries)/2, toolCacheMinSweep) {
+				c.sweepLocked(now)
+			}
+			c.evictLocked()
+			c.mu.Unlock()
+			return c.fill(key, entry, ttl, fn)
+		}
+		c.lru.MoveToFront(entry.element)
+		c.mu.Unlock()
+
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+		if entry.err == nil {
+			return entry.value, true, nil
+		}
+		// The call that was in flight failed; failures are not cached.
+	}
+}
+
+func (c *ToolResultCache) fill(key string, entry *toolCacheEntry, ttl time.Duration, fn func() (any, error)) (value any, hit bool, err error) {
+	defer func() {
+		c.mu.Lock()
+		if entry.err == nil && ttl > 0 {
+			entry.expires = time.Now().Add(ttl)
+		}
+		if entry.err != nil && c.entries[key] == entry {
+			c.removeLocked(key, entry)
+		}
+		c.mu.Unlock()
+		close(entry.done)
+	}()
+	entry.err = fmt.Errorf("tool %s did not return", entry.tool)
+	value, err = fn()
+	entry.value, entry.err = value, err
+	return value, false, err
+}
+
+// Forget drops the cached results of tool, or all results when tool is empty.
+func (c *ToolResultCache) Forget(tool string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if tool == "" || entry.tool == tool {
+			c.removeLocked(key, entry)
+		}
+	}
+}
+
+// expiredAt reports a result past its TTL. Callers hold the cache lock.
+func (e *toolCacheEntry) expiredAt(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+func (c *ToolResultCache) removeLocked(key string, entry *toolCacheEntry) {
+	delete(c.entries, key)
+	c.lru.Remove(entry.element)
+}
+
+// sweepLocked drops every expired result. It runs once the entries added
+// since the last sweep reach half the cache size, so inserts stay O(1)
+// amortized.
+func (c *ToolResultCache) sweepLocked(now time.Time) {
+	for key, entry := range c.entries {
+		if entry.expiredAt(now) {
+			c.removeLocked(key, entry)
+		}
+	}
+	c.inserts = 0
+}
+
+// evictLocked drops the least recently used results past maxEntries.
+func (c *ToolResultCache) evictLocked() {
+	for c.maxEntries > 0 && len(c.entries) > c.maxEntries {
+		key := c.lru.Back().Value.(string)
+		c.removeLocked(key, c.entries[key])
+	}
+}
+
+// ToolCacheMaxEntries returns tool.cache.max_entries, the bound of each tool
+// result cache; zero or less leaves them unbounded.
+func ToolCacheMaxEntries(settings *utils.Settings) int {
+	if settings == nil {
+		return DefaultToolCacheMaxEntries
+	}
+	return settingsInt(settings, "tool.cache.max_entries", DefaultToolCacheMaxEntries)
+}
+
+// ToolCacheKey returns the cache key for a call: the tool name and its kwargs
+// as canonical JSON (object keys sorted).
+func ToolCacheKey(tool string, kwargs map[string]any) (string, error) {
+	if kwargs == nil {
+		kwargs = map[string]any{}
+	}
+	encoded, err := json.Marshal(kwargs)
+	if err != nil {
+		return "", fmt.Errorf("tool %s kwargs cannot be cached: %w", tool, err)
+	}
+	return tool + "\x00" + string(encoded), nil
+}
+
+// EffectiveToolCache returns the cache configuration of info, taking
+// Idempotent into account, or nil when its results are not cached.
+func EffectiveToolCache(info types.ToolInfo) *types.ToolCache {
+	if info.Cache != nil {
+		cache := *info.Cache
+		if cache.Scope == "" {
+			cache.Scope = types.ToolCacheScopeResponse
+		}
+		return &cache
+	}
+	if info.Idempotent {
+		return &types.ToolCache{Scope: types.ToolCacheScopeResponse}
+	}
+	return nil
+}
+
+// SetToolResultCache binds the response or session cache on settings. Nil
+// removes it.
+func SetToolResultCache(settings *utils.Settings, scope types.ToolCacheScope, cache *ToolResultCache) {
+	key := toolCacheSettingsKey(scope)
+	if settings == nil || key == "" {
+		return
+	}
+	if cache == nil {
+		settings.SetCover(key, nil)
+		return
+	}
+	settings.SetCover(key, cache)
+}
+
+// ToolResultCacheFromSettings returns the response or session cache bound on
+// settings, or nil.
+func ToolResultCacheFromSettings(settings *utils.Settings, scope types.ToolCacheScope) *ToolResultCache {
+	key := toolCacheSettingsKey(scope)
+	if settings == nil || key == "" {
+		return nil
+	}
+	cache, _ := settings.Get(key, nil, true).(*ToolResultCache)
+	return cache
+}
+
+func toolCacheSettingsKey(scope types.ToolCacheScope) string {
+	switch scope {
+	case types.ToolCacheScopeResponse:
+		return responseToolCacheSettingsKey
+	case types.ToolCacheScopeSession:
+		return sessionToolCacheSettingsKey
+	}
+	return ""
+}
+
+type toolCacheContextKey struct{ scope types.ToolCacheScope }
+
+// WithToolResultCache returns a context whose tool calls use cache for tools
+// cached in scope. Tool managers keep the global cache themselves.
+func WithToolResultCache(ctx context.Context, scope types.ToolCacheScope, cache *ToolResultCache) context.Context {
+	if cache == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, toolCacheContextKey{scope}, cache)
+}
+
+// ToolResultCacheFromContext returns the cache bound to ctx for scope, or nil.
+func ToolResultCacheFromContext(ctx context.Context, scope types.ToolCacheScope) *ToolResultCache {
+	cache, _ := ctx.Value(toolCacheContextKey{scope}).(*ToolResultCache)
+	return cache
+}
+
+// WithToolCallSettings carries what tool calls of a response need from its
+// settings into ctx: the tool approver and the response and session caches.
+func WithToolCallSettings(ctx context.Context, settings *utils.Settings) context.Context {
+	ctx = WithToolApprover(ctx, ToolApproverFromSettings(settings))
+	for _, scope := range []types.ToolCacheScope{types.ToolCacheScopeResponse, types.ToolCacheScopeSession} {
+		ctx = WithToolResultCache(ctx, scope, ToolResultCacheFromSettings(settings, scope))
+	}
+	return ctx
+}
+
+type toolIdempotencyKeyContextKey struct{}
+
+// WithToolIdempotencyKey returns a context carrying the idempotency key of a
+// tool call.
+func WithToolIdempotencyKey(ctx context.Context, cache *ToolResultCache, key string) context.Context {
+	sum := sha256.Sum256([]byte(key))
+	return context.WithValue(ctx, toolIdempotencyKeyContextKey{}, cache.ID()+"-"+hex.EncodeToString(sum[:8]))
+}
+
+// ToolIdempotencyKey returns the idempotency key of the running tool call, or
+// "" when its result is not cached. Retries of a call share the key, so tools
+// can pass it on to APIs that deduplicate requests.
+func ToolIdempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(toolIdempotencyKeyContextKey{}).(string)
+	return key
+}
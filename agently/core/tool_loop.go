@@ -0,0 +1,237 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+const (
+	ToolModeJudge  = "judge"
+	ToolModeNative = "native"
+	ToolModeReAct  = "react"
+
+	defaultToolMaxRounds    = 5
+	defaultToolReActMaxStep = 6
+)
+
+// ToolMode returns the configured tool execution mode ("judge", "native" or
+// "react").
+func ToolMode(settings *utils.Settings) string {
+	mode := strings.ToLower(strings.TrimSpace(fmt.Sprint(settings.Get("tool.mode", ToolModeJudge, true))))
+	switch mode {
+	case ToolModeNative, ToolModeReAct:
+		return mode
+	}
+	return ToolModeJudge
+}
+
+func toolLoopMaxRounds(settings *utils.Settings) int {
+	return settingsInt(settings, "tool.max_rounds", defaultToolMaxRounds)
+}
+
+// ToolReActMaxSteps returns how many planning steps the ReAct tool mode may
+// take before it must answer.
+func ToolReActMaxSteps(settings *utils.Settings) int {
+	return settingsInt(settings, "tool.react.max_steps", defaultToolReActMaxStep)
+}
+
+func settingsInt(settings *utils.Settings, path string, fallback int) int {
+	switch v := settings.Get(path, fallback, true).(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	case string:
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+// isToolRoundTerminalEvent reports events that close a model round. They are
+// held back while a round may still turn into tool calls.
+func isToolRoundTerminalEvent(event types.ResponseEvent) bool {
+	switch event {
+	case types.ResponseEventDone, types.ResponseEventReasoningDone, types.ResponseEventOriginalDone:
+		return true
+	}
+	return false
+}
+
+// toolCallAccumulator merges streamed tool_calls fragments into complete calls.
+// Fragments are matched by `index`, then by `id`, then by list position.
+type toolCallAccumulator struct {
+	order []string
+	calls map[string]*types.ToolCall
+}
+
+func newToolCallAccumulator() *toolCallAccumulator {
+	return &toolCallAccumulator{calls: map[string]*types.ToolCall{}}
+}
+
+func (a *toolCallAccumulator) Add(data any) {
+	switch typed := data.(type) {
+	case []any:
+		for position, item := range typed {
+			a.addOne(item, position)
+		}
+	case []map[string]any:
+		for position, item := range typed {
+			a.addOne(item, position)
+		}
+	case []types.ToolCall:
+		for position, item := range typed {
+			a.addOne(item, position)
+		}
+	default:
+		a.addOne(typed, 0)
+	}
+}
+
+func (a *toolCallAccumulator) addOne(item any, position int) {
+	var id, name, arguments, key string
+	switch typed := item.(type) {
+	case types.ToolCall:
+		id, name, arguments = typed.ID, typed.Name, typed.Arguments
+		key = "id:" + id
+	case map[string]any:
+		id = stringField(typed["id"])
+		function, _ := typed["function"].(map[string]any)
+		if function == nil {
+			function = typed
+		}
+		name = stringField(function["name"])
+		switch args := function["arguments"].(type) {
+		case string:
+			arguments = args
+		case nil:
+		default:
+			encoded, _ := json.Marshal(args)
+			arguments = string(encoded)
+		}
+		if index, ok := typed["index"]; ok && index != nil {
+			key = fmt.Sprintf("index:%v", index)
+		} else if id != "" {
+			key = "id:" + id
+		}
+	default:
+		return
+	}
+	if key == "" || key == "id:" {
+		key = fmt.Sprintf("position:%d", position)
+	}
+	call, ok := a.calls[key]
+	if !ok {
+		call = &types.ToolCall{}
+		a.calls[key] = call
+		a.order = append(a.order, key)
+	}
+	if call.ID == "" {
+		call.ID = id
+	}
+	if call.Name == "" {
+		call.Name = name
+	}
+	call.Arguments += arguments
+}
+
+func (a *toolCallAccumulator) Calls() []types.ToolCall {
+	out := make([]types.ToolCall, 0, len(a.order))
+	for i, key := range a.order {
+		call := *a.calls[key]
+		if call.Name == "" {
+			continue
+		}
+		if call.ID == "" {
+			call.ID = fmt.Sprintf("call_%d", i)
+		}
+		out = append(out, call)
+	}
+	return out
+}
+
+func stringField(value any) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// ParseToolCallArguments decodes the raw JSON arguments of a tool call.
+func ParseToolCallArguments(call types.ToolCall) (map[string]any, error) {
+	text := strings.TrimSpace(call.Arguments)
+	if text == "" {
+		return map[string]any{}, nil
+	}
+	kwargs := map[string]any{}
+	if err := json.Unmarshal([]byte(text), &kwargs); err != nil {
+		repaired, _ := utils.RepairJSON(text, utils.JSONRepairLenient)
+		if retryErr := json.Unmarshal([]byte(repaired), &kwargs); retryErr != nil {
+			return nil, fmt.Errorf("invalid arguments for tool %s: %w", call.Name, err)
+		}
+	}
+	return kwargs, nil
+}
+
+// appendToolRoundMessages adds the assistant tool_calls message and one tool
+// role message per executed call to the prompt's tool_messages slot.
+func appendToolRoundMessages(prompt *Prompt, content string, calls []types.ToolCall, steps []types.ToolStep) {
+	messages := make([]any, 0)
+	if existing, ok := prompt.Get("tool_messages", []any{}, true).([]any); ok {
+		messages = append(messages, existing...)
+	}
+	toolCalls := make([]any, 0, len(calls))
+	for _, call := range calls {
+		toolCalls = append(toolCalls, call.ToOpenAI())
+	}
+	var assistantContent any
+	if strings.TrimSpace(content) != "" {
+		assistantContent = content
+	}
+	messages = append(messages, map[string]any{
+		"role":       "assistant",
+		"content":    assistantContent,
+		"tool_calls": toolCalls,
+	})
+	for i, call := range calls {
+		var step types.ToolStep
+		if i < len(steps) {
+			step = steps[i]
+		}
+		messages = append(messages, map[string]any{
+			"role":         "tool",
+			"tool_call_id": call.ID,
+			"name":         call.Name,
+			"content":      toolStepContent(step),
+		})
+	}
+	prompt.Set("tool_messages", messages)
+}
+
+func toolStepContent(step types.ToolStep) string {
+	if step.Error != "" {
+		content := map[string]any{"error": step.Error}
+		if len(step.InvalidKwargs) > 0 {
+			content["invalid_kwargs"] = step.InvalidKwargs
+			content["hint"] = "call the tool again with corrected kwargs"
+		}
+		encoded, _ := json.Marshal(content)
+		return string(encoded)
+	}
+	if text, ok := step.Result.(string); ok {
+		return text
+	}
+	encoded, err := json.Marshal(step.Result)
+	if err != nil {
+		return fmt.Sprint(step.Result)
+	}
+	return string(encoded)
+}
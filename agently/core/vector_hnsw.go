@@ -0,0 +1,257 @@
+package core
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// HNSWOptions configures the HNSW index of a LocalVectorStore. Zero fields
+// take the defaults of DefaultHNSWOptions.
+type HNSWOptions struct {
+	// M is the number of neighbors kept per node and layer, 2*M on layer 0.
+	M int
+	// EfConstruction is the candidate list size while inserting.
+	EfConstruction int
+	// EfSearch is the candidate list size while querying, at least topK.
+	EfSearch int
+	// Seed makes the layer assignment, and so the index, reproducible.
+	Seed int64
+}
+
+var DefaultHNSWOptions = HNSWOptions{M: 16, EfConstruction: 200, EfSearch: 64, Seed: 1}
+
+func (o HNSWOptions) withDefaults() HNSWOptions {
+	if o.M <= 1 {
+		o.M = DefaultHNSWOptions.M
+	}
+	if o.EfConstruction <= 0 {
+		o.EfConstruction = DefaultHNSWOptions.EfConstruction
+	}
+	if o.EfSearch <= 0 {
+		o.EfSearch = DefaultHNSWOptions.EfSearch
+	}
+	if o.Seed == 0 {
+		o.Seed = DefaultHNSWOptions.Seed
+	}
+	return o
+}
+
+type hnswNode struct {
+	id        string
+	vector    []float64
+	neighbors [][]int
+	deleted   bool
+}
+
+// hnswIndex is a Hierarchical Navigable Small World graph over unit vectors,
+// so distances are 1 - cosine similarity. Replaced and deleted documents stay
+// in the graph as deleted nodes, still traversed but never returned, until
+// the store rebuilds the index.
+type hnswIndex struct {
+	options  HNSWOptions
+	levelMul float64
+	random   *rand.Rand
+	nodes    []hnswNode
+	byID     map[string]int
+	entry    int
+	maxLevel int
+	deleted  int
+}
+
+func newHNSWIndex(options HNSWOptions) *hnswIndex {
+	options = options.withDefaults()
+	return &hnswIndex{
+		options:  options,
+		levelMul: 1 / math.Log(float64(options.M)),
+		random:   rand.New(rand.NewSource(options.Seed)),
+		byID:     map[string]int{},
+		entry:    -1,
+	}
+}
+
+func (h *hnswIndex) live() int { return len(h.byID) }
+
+func (h *hnswIndex) remove(id string) {
+	if node, ok := h.byID[id]; ok {
+		h.nodes[node].deleted = true
+		delete(h.byID, id)
+		h.deleted++
+	}
+}
+
+func (h *hnswIndex) insert(id string, embedding []float64) {
+	h.remove(id)
+	vector := unitVector(embedding)
+	level := int(math.Floor(-math.Log(1-h.random.Float64()) * h.levelMul))
+	node := len(h.nodes)
+	h.nodes = append(h.nodes, hnswNode{id: id, vector: vector, neighbors: make([][]int, level+1)})
+	h.byID[id] = node
+	if h.entry < 0 {
+		h.entry, h.maxLevel = node, level
+		return
+	}
+
+	entry := h.entry
+	for layer := h.maxLevel; layer > level; layer-- {
+		entry = h.searchLayer(vector, []int{entry}, 1, layer)[0].node
+	}
+	entries := []int{entry}
+	for layer := min(level, h.maxLevel); layer >= 0; layer-- {
+		candidates := h.searchLayer(vector, entries, h.options.EfConstruction, layer)
+		neighbors := make([]int, 0, h.maxNeighbors(layer))
+		for _, candidate := range candidates {
+			if len(neighbors) == h.maxNeighbors(layer) {
+				break
+			}
+			neighbors = append(neighbors, candidate.node)
+		}
+		h.nodes[node].neighbors[layer] = neighbors
+		for _, neighbor := range neighbors {
+			h.connect(neighbor, node, layer)
+		}
+		entries = entries[:0]
+		for _, candidate := range candidates {
+			entries = append(entries, candidate.node)
+		}
+	}
+	if level > h.maxLevel {
+		h.entry, h.maxLevel = node, level
+	}
+}
+
+func (h *hnswIndex) maxNeighbors(layer int) int {
+	if layer == 0 {
+		return 2 * h.options.M
+	}
+	return h.options.M
+}
+
+// connect links from to node on layer, dropping the farthest neighbor of
+// from when it has too many.
+func (h *hnswIndex) connect(from int, node int, layer int) {
+	neighbors := append(h.nodes[from].neighbors[layer], node)
+	if len(neighbors) > h.maxNeighbors(layer) {
+		origin := h.nodes[from].vector
+		sort.Slice(neighbors, func(i, j int) bool {
+			return h.distance(origin, neighbors[i]) < h.distance(origin, neighbors[j])
+		})
+		neighbors = neighbors[:h.maxNeighbors(layer)]
+	}
+	h.nodes[from].neighbors[layer] = neighbors
+}
+
+// search returns up to ef live nodes closest to embedding, closest first.
+func (h *hnswIndex) search(embedding []float64, ef int) []hnswCandidate {
+	if h.entry < 0 {
+		return nil
+	}
+	vector := unitVector(embedding)
+	entry := h.entry
+	for layer := h.maxLevel; layer > 0; layer-- {
+		entry = h.searchLayer(vector, []int{entry}, 1, layer)[0].node
+	}
+	found := h.searchLayer(vector, []int{entry}, max(ef, h.options.EfSearch), 0)
+	live := found[:0]
+	for _, candidate := range found {
+		if !h.nodes[candidate.node].deleted {
+			live = append(live, candidate)
+		}
+	}
+	return live
+}
+
+// searchLayer is the greedy beam search of HNSW, returning up to ef nodes
+// closest first.
+func (h *hnswIndex) searchLayer(vector []float64, entries []int, ef int, layer int) []hnswCandidate {
+	visited := map[int]bool{}
+	candidates := &hnswHeap{}
+	results := &hnswHeap{farthestFirst: true}
+	for _, entry := range entries {
+		if visited[entry] {
+			continue
+		}
+		visited[entry] = true
+		candidate := hnswCandidate{node: entry, distance: h.distance(vector, entry)}
+		heap.Push(candidates, candidate)
+		heap.Push(results, candidate)
+	}
+	for candidates.Len() > 0 {
+		closest := heap.Pop(candidates).(hnswCandidate)
+		if results.Len() >= ef && closest.distance > results.items[0].distance {
+			break
+		}
+		if layer >= len(h.nodes[closest.node].neighbors) {
+			continue
+		}
+		for _, neighbor := range h.nodes[closest.node].neighbors[layer] {
+			if visited[neighbor] {
+				continue
+			}
+			visited[neighbor] = true
+			candidate := hnswCandidate{node: neighbor, distance: h.distance(vector, neighbor)}
+			if results.Len() < ef || candidate.distance < results.items[0].distance {
+				heap.Push(candidates, candidate)
+				heap.Push(results, candidate)
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+	out := append([]hnswCandidate{}, results.items...)
+	sort.Slice(out, func(i, j int) bool { return out[i].distance < out[j].distance })
+	return out
+}
+
+func (h *hnswIndex) distance(vector []float64, node int) float64 {
+	other := h.nodes[node].vector
+	dot := 0.0
+	for i := range vector {
+		dot += vector[i] * other[i]
+	}
+	return 1 - dot
+}
+
+func unitVector(embedding []float64) []float64 {
+	norm := 0.0
+	for _, value := range embedding {
+		norm += value * value
+	}
+	out := make([]float64, len(embedding))
+	if norm == 0 {
+		return out
+	}
+	norm = math.Sqrt(norm)
+	for i, value := range embedding {
+		out[i] = value / norm
+	}
+	return out
+}
+
+type hnswCandidate struct {
+	node     int
+	distance float64
+}
+
+// hnswHeap is a min-heap by distance, or a max-heap with farthestFirst.
+type hnswHeap struct {
+	items         []hnswCandidate
+	farthestFirst bool
+}
+
+func (h *hnswHeap) Len() int { return len(h.items) }
+func (h *hnswHeap) Less(i, j int) bool {
+	if h.farthestFirst {
+		return h.items[i].distance > h.items[j].distance
+	}
+	return h.items[i].distance < h.items[j].distance
+}
+func (h *hnswHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *hnswHeap) Push(item any) { h.items = append(h.items, item.(hnswCandidate)) }
+func (h *hnswHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
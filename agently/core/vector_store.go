@@ -0,0 +1,647 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// VectorDocument is a document kept in a VectorStore.
+type VectorDocument struct {
+	ID        string         `json:"id"`
+	Content   string         `json:"content,omitempty"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	Embedding []float64      `json:"embedding"`
+}
+
+// VectorMatch is a document found by a query, with its cosine similarity to
+// the query vector.
+type VectorMatch struct {
+	VectorDocument
+	Score float64 `json:"score"`
+}
+
+// VectorFilter keeps the documents whose metadata holds every key with an
+// equal value. A list value matches any of its items. Numbers compare by
+// value, so 1 matches 1.0 read back from disk.
+type VectorFilter map[string]any
+
+// VectorStore keeps documents with their embeddings for retrieval.
+type VectorStore interface {
+	// Upsert inserts documents, replacing the ones with the same IDs.
+	Upsert(ctx context.Context, documents ...VectorDocument) error
+	// Get returns the documents with ids that exist, in the order of ids.
+	Get(ctx context.Context, ids ...string) ([]VectorDocument, error)
+	// List returns the documents matching filter, ordered by ID.
+	List(ctx context.Context, filter VectorFilter) ([]VectorDocument, error)
+	// Query returns the topK documents matching filter most similar to
+	// embedding, best first.
+	Query(ctx context.Context, embedding []float64, topK int, filter VectorFilter) ([]VectorMatch, error)
+	// Delete removes the documents with ids; unknown ids are ignored.
+	Delete(ctx context.Context, ids ...string) error
+}
+
+// Matches reports whether metadata satisfies the filter.
+func (f VectorFilter) Matches(metadata map[string]any) bool {
+	for key, want := range f {
+		got, ok := metadata[key]
+		if !ok {
+			return false
+		}
+		if options, ok := want.([]any); ok {
+			if !vectorValueIn(got, options) {
+				return false
+			}
+			continue
+		}
+		if options := reflect.ValueOf(want); options.Kind() == reflect.Slice && options.Type().Elem().Kind() != reflect.Uint8 {
+			items := make([]any, options.Len())
+			for i := range items {
+				items[i] = options.Index(i).Interface()
+			}
+			if !vectorValueIn(got, items) {
+				return false
+			}
+			continue
+		}
+		if !vectorValueEqual(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+func vectorValueIn(value any, options []any) bool {
+	for _, option := range options {
+		if vectorValueEqual(value, option) {
+			return true
+		}
+	}
+	return false
+}
+
+func vectorValueEqual(a any, b any) bool {
+	if x, ok := vectorNumber(a); ok {
+		y, ok := vectorNumber(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func vectorNumber(value any) (float64, bool) {
+	switch typed := reflect.ValueOf(value); typed.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(typed.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(typed.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return typed.Float(), true
+	}
+	return 0, false
+}
+
+// Retriever embeds texts with an Embedder before storing them in, or
+// querying, a VectorStore.
+type Retriever struct {
+	store    VectorStore
+	embedder Embedder
+}
+
+func NewRetriever(store VectorStore, embedder Embedder) *Retriever {
+	return &Retriever{store: store, embedder: embedder}
+}
+
+func (r *Retriever) Store() VectorStore { return r.store }
+
+// Add upserts documents, embedding the Content of those without an
+// Embedding in one request.
+func (r *Retriever) Add(ctx context.Context, documents ...VectorDocument) error {
+	texts, positions := []string{}, []int{}
+	for i, document := range documents {
+		if len(document.Embedding) == 0 {
+			texts = append(texts, document.Content)
+			positions = append(positions, i)
+		}
+	}
+	if len(texts) > 0 {
+		embeddings, err := r.embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+		documents = append([]VectorDocument{}, documents...)
+		for i, position := range positions {
+			documents[position].Embedding = embeddings[i]
+		}
+	}
+	return r.store.Upsert(ctx, documents...)
+}
+
+// Search returns the topK documents matching filter most similar to query.
+func (r *Retriever) Search(ctx context.Context, query string, topK int, filter VectorFilter) ([]VectorMatch, error) {
+	embeddings, err := r.embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	return r.store.Query(ctx, embeddings[0], topK, filter)
+}
+
+func (r *Retriever) Delete(ctx context.Context, ids ...string) error {
+	return r.store.Delete(ctx, ids...)
+}
+
+func (r *Retriever) embed(ctx context.Context, texts []string) ([][]float64, error) {
+	if r.embedder == nil {
+		return nil, errors.New("retriever has no embedder")
+	}
+	embeddings, err := r.embedder(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddings) != len(texts) {
+		return nil, fmt.Errorf("embedder returned %d embeddings for %d texts", len(embeddings), len(texts))
+	}
+	return embeddings, nil
+}
+
+// localVectorStoreFormat is the version of the log a LocalVectorStore
+// persists to. Format 1 files, a single JSON snapshot, are still read and
+// rewritten as a log.
+const localVectorStoreFormat = 2
+
+// hnswRebuildMinDeleted is how many deleted nodes an HNSW index holds before
+// the store considers rebuilding it.
+const hnswRebuildMinDeleted = 64
+
+// vectorCompactMinGarbage is how many superseded records the log of a
+// LocalVectorStore holds before it is compacted.
+const vectorCompactMinGarbage = 256
+
+// vectorLogRecord is one line of the log: the format header, a batch of
+// upserted documents or a batch of deleted IDs. A format 1 snapshot reads as
+// a record without op.
+type vectorLogRecord struct {
+	Op        string              `json:"op,omitempty"`
+	Format    int                 `json:"format,omitempty"`
+	Documents []vectorLogDocument `json:"documents,omitempty"`
+	IDs       []string            `json:"ids,omitempty"`
+}
+
+type vectorLogDocument struct {
+	ID        string          `json:"id"`
+	Content   string          `json:"content,omitempty"`
+	Metadata  map[string]any  `json:"metadata,omitempty"`
+	Embedding vectorEmbedding `json:"embedding"`
+}
+
+// vectorEmbedding is written as base64 of little-endian float64s, which is
+// exact and several times smaller and faster than JSON numbers. Arrays of
+// numbers are read too.
+type vectorEmbedding []float64
+
+func (e vectorEmbedding) MarshalJSON() ([]byte, error) {
+	raw := make([]byte, 8*len(e))
+	for i, value := range e {
+		binary.LittleEndian.PutUint64(raw[8*i:], math.Float64bits(value))
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(raw))
+}
+
+func (e *vectorEmbedding) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '[' {
+		return json.Unmarshal(data, (*[]float64)(e))
+	}
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	if len(raw)%8 != 0 {
+		return fmt.Errorf("embedding has %d bytes, not a multiple of 8", len(raw))
+	}
+	values := make([]float64, len(raw)/8)
+	for i := range values {
+		values[i] = math.Float64frombits(binary.LittleEndian.Uint64(raw[8*i:]))
+	}
+	*e = values
+	return nil
+}
+
+// LocalVectorStore keeps documents in process and queries them by brute-force
+// cosine similarity, or with an HNSW index after UseHNSW. Opened with a path,
+// every change is appended to a log file before it is applied, and the log is
+// compacted once superseded records outnumber the live documents. One process
+// at a time may use the file.
+type LocalVectorStore struct {
+	path      string
+	documents map[string]VectorDocument
+	dimension int
+	hnsw      *hnswIndex
+	// garbage counts the log records superseded by later ones.
+	garbage int
+	mu      sync.RWMutex
+}
+
+// NewLocalVectorStore returns a store that lives in memory only.
+func NewLocalVectorStore() *LocalVectorStore {
+	return &LocalVectorStore{documents: map[string]VectorDocument{}}
+}
+
+// OpenLocalVectorStore returns a store persisted to path, loading the
+// documents already saved there. A record left half-written by a crash is
+// cut off.
+func OpenLocalVectorStore(path string) (*LocalVectorStore, error) {
+	if path == "" {
+		return nil, errors.New("vector store path is empty")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	store := NewLocalVectorStore()
+	store.path = path
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var offset int64
+	legacy := false
+	for first := true; ; first = false {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) == 0 {
+				break
+			}
+			// A complete record only missing its newline, e.g. a format 1
+			// snapshot, is kept; anything else was torn by a crash.
+			if !json.Valid(line) {
+				if err := file.Truncate(offset); err != nil {
+					return nil, err
+				}
+				break
+			}
+			if _, err := file.WriteAt([]byte{'\n'}, offset+int64(len(line))); err != nil {
+				return nil, err
+			}
+		} else if err != nil {
+			return nil, err
+		}
+		trimmed := bytes.TrimSpace(line)
+		offset += int64(len(line))
+		if len(trimmed) == 0 {
+			continue
+		}
+		record := vectorLogRecord{}
+		if err := json.Unmarshal(trimmed, &record); err != nil {
+			return nil, fmt.Errorf("vector store %s: corrupt record at offset %d: %w", path, offset-int64(len(line)), err)
+		}
+		if first {
+			switch {
+			case record.Op == "" && record.Format == 1:
+				legacy = true
+				record.Op = "put"
+			case record.Op == "format" && record.Format == localVectorStoreFormat:
+				continue
+			default:
+				return nil, fmt.Errorf("vector store %s has unsupported format %d", path, record.Format)
+			}
+		}
+		store.apply(record)
+	}
+	if legacy {
+		if err := store.compact(); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// UseHNSW indexes the documents with HNSW for approximate queries. Filtered
+// queries that the index cannot fill fall back to brute force.
+func (s *LocalVectorStore) UseHNSW(options HNSWOptions) *LocalVectorStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hnsw = newHNSWIndex(options)
+	for _, id := range sortedVectorIDs(s.documents) {
+		s.hnsw.insert(id, s.documents[id].Embedding)
+	}
+	return s
+}
+
+func (s *LocalVectorStore) Upsert(ctx context.Context, documents ...VectorDocument) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dimension := s.dimension
+	if len(s.documents) == 0 {
+		dimension = 0
+	}
+	record := vectorLogRecord{Op: "put", Documents: make([]vectorLogDocument, 0, len(documents))}
+	for _, document := range documents {
+		if document.ID == "" {
+			return errors.New("vector document id is empty")
+		}
+		if len(document.Embedding) == 0 {
+			return fmt.Errorf("vector document %s has no embedding", document.ID)
+		}
+		if dimension == 0 {
+			dimension = len(document.Embedding)
+		}
+		if len(document.Embedding) != dimension {
+			return fmt.Errorf("vector document %s has %d dimensions, the store has %d", document.ID, len(document.Embedding), dimension)
+		}
+		document = copyVectorDocument(document)
+		record.Documents = append(record.Documents, vectorLogDocument{ID: document.ID, Content: document.Content, Metadata: document.Metadata, Embedding: document.Embedding})
+	}
+	if err := s.append(record); err != nil {
+		return err
+	}
+	s.apply(record)
+	if s.hnsw != nil {
+		for _, document := range documents {
+			s.hnsw.insert(document.ID, document.Embedding)
+		}
+		s.maybeRebuildLocked()
+	}
+	return s.maybeCompactLocked()
+}
+
+func (s *LocalVectorStore) Get(ctx context.Context, ids ...string) ([]VectorDocument, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]VectorDocument, 0, len(ids))
+	for _, id := range ids {
+		if document, ok := s.documents[id]; ok {
+			out = append(out, copyVectorDocument(document))
+		}
+	}
+	return out, nil
+}
+
+func (s *LocalVectorStore) List(ctx context.Context, filter VectorFilter) ([]VectorDocument, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []VectorDocument{}
+	for _, id := range sortedVectorIDs(s.documents) {
+		if document := s.documents[id]; filter.Matches(document.Metadata) {
+			out = append(out, copyVectorDocument(document))
+		}
+	}
+	return out, nil
+}
+
+func (s *LocalVectorStore) Query(ctx context.Context, embedding []float64, topK int, filter VectorFilter) ([]VectorMatch, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.documents) == 0 || topK <= 0 {
+		return []VectorMatch{}, nil
+	}
+	if len(embedding) != s.dimension {
+		return nil, fmt.Errorf("query has %d dimensions, the store has %d", len(embedding), s.dimension)
+	}
+	if s.hnsw != nil {
+		ef := s.hnsw.options.EfSearch
+		if len(filter) > 0 {
+			ef *= 4
+		}
+		matches := []VectorMatch{}
+		for _, candidate := range s.hnsw.search(embedding, max(ef, topK)) {
+			document := s.documents[s.hnsw.nodes[candidate.node].id]
+			if filter.Matches(document.Metadata) {
+				matches = append(matches, VectorMatch{VectorDocument: copyVectorDocument(document), Score: CosineSimilarity(embedding, document.Embedding)})
+			}
+		}
+		if len(matches) >= topK || len(matches) == s.countMatchingLocked(filter) {
+			sortVectorMatches(matches)
+			return matches[:min(topK, len(matches))], nil
+		}
+	}
+	matches := []VectorMatch{}
+	for _, document := range s.documents {
+		if filter.Matches(document.Metadata) {
+			matches = append(matches, VectorMatch{VectorDocument: document, Score: CosineSimilarity(embedding, document.Embedding)})
+		}
+	}
+	sortVectorMatches(matches)
+	matches = matches[:min(topK, len(matches))]
+	for i := range matches {
+		matches[i].VectorDocument = copyVectorDocument(matches[i].VectorDocument)
+	}
+	return matches, nil
+}
+
+func (s *LocalVectorStore) Delete(ctx context.Context, ids ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := vectorLogRecord{Op: "delete"}
+	for _, id := range ids {
+		if _, ok := s.documents[id]; ok {
+			record.IDs = append(record.IDs, id)
+		}
+	}
+	if len(record.IDs) == 0 {
+		return nil
+	}
+	if err := s.append(record); err != nil {
+		return err
+	}
+	s.apply(record)
+	if s.hnsw != nil {
+		for _, id := range record.IDs {
+			s.hnsw.remove(id)
+		}
+		s.maybeRebuildLocked()
+	}
+	return s.maybeCompactLocked()
+}
+
+func (s *LocalVectorStore) countMatchingLocked(filter VectorFilter) int {
+	if len(filter) == 0 {
+		return len(s.documents)
+	}
+	count := 0
+	for _, document := range s.documents {
+		if filter.Matches(document.Metadata) {
+			count++
+		}
+	}
+	return count
+}
+
+// maybeRebuildLocked rebuilds the HNSW index once deleted nodes outnumber
+// the live ones.
+func (s *LocalVectorStore) maybeRebuildLocked() {
+	if s.hnsw.deleted < hnswRebuildMinDeleted || s.hnsw.deleted <= s.hnsw.live() {
+		return
+	}
+	index := newHNSWIndex(s.hnsw.options)
+	for _, id := range sortedVectorIDs(s.documents) {
+		index.insert(id, s.documents[id].Embedding)
+	}
+	s.hnsw = index
+}
+
+// apply applies a log record to the documents, counting the records it
+// supersedes.
+func (s *LocalVectorStore) apply(record vectorLogRecord) {
+	switch record.Op {
+	case "put":
+		for _, document := range record.Documents {
+			if _, ok := s.documents[document.ID]; ok {
+				s.garbage++
+			}
+			if len(s.documents) == 0 {
+				s.dimension = len(document.Embedding)
+			}
+			s.documents[document.ID] = VectorDocument{ID: document.ID, Content: document.Content, Metadata: document.Metadata, Embedding: document.Embedding}
+		}
+	case "delete":
+		for _, id := range record.IDs {
+			if _, ok := s.documents[id]; ok {
+				delete(s.documents, id)
+				// The delete record and the put it removes.
+				s.garbage += 2
+			}
+		}
+	}
+}
+
+// append writes record as one line at the end of the log, so a crash loses
+// the whole batch or none of it. An empty log gets the format header first.
+func (s *LocalVectorStore) append(record vectorLogRecord) error {
+	if s.path == "" {
+		return nil
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	buffer := make([]byte, 0, len(line)+32)
+	if info.Size() == 0 {
+		header, _ := json.Marshal(vectorLogRecord{Op: "format", Format: localVectorStoreFormat})
+		buffer = append(append(buffer, header...), '\n')
+	}
+	buffer = append(append(buffer, line...), '\n')
+	if _, err := file.Write(buffer); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (s *LocalVectorStore) maybeCompactLocked() error {
+	if s.path == "" || s.garbage < vectorCompactMinGarbage || s.garbage <= len(s.documents) {
+		return nil
+	}
+	return s.compact()
+}
+
+// compact rewrites the log with one record per live document through a
+// temporary file, so a crash leaves either the old or the new log.
+func (s *LocalVectorStore) compact() error {
+	temp, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	writer := bufio.NewWriter(temp)
+	encoder := json.NewEncoder(writer)
+	err = encoder.Encode(vectorLogRecord{Op: "format", Format: localVectorStoreFormat})
+	for _, id := range sortedVectorIDs(s.documents) {
+		if err != nil {
+			break
+		}
+		document := s.documents[id]
+		err = encoder.Encode(vectorLogRecord{Op: "put", Documents: []vectorLogDocument{{ID: id, Content: document.Content, Metadata: document.Metadata, Embedding: document.Embedding}}})
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = temp.Sync()
+	}
+	if err != nil {
+		_ = temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temp.Name(), s.path); err != nil {
+		return err
+	}
+	s.garbage = 0
+	return nil
+}
+
+func sortedVectorIDs(documents map[string]VectorDocument) []string {
+	ids := make([]string, 0, len(documents))
+	for id := range documents {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func sortVectorMatches(matches []VectorMatch) {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ID < matches[j].ID
+	})
+}
+
+func copyVectorDocument(document VectorDocument) VectorDocument {
+	document.Embedding = append([]float64(nil), document.Embedding...)
+	if document.Metadata != nil {
+		metadata := make(map[string]any, len(document.Metadata))
+		for key, value := range document.Metadata {
+			metadata[key] = value
+		}
+		document.Metadata = metadata
+	}
+	return document
+}
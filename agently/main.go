@@ -101,7 +101,11 @@ func (m *Main) CreateRequest(name string) *core.ModelRequest {
 }
 
 func (m *Main) CreateAgent(name string) *agentextensions.Agent {
-	return agentextensions.NewAgent(m.PluginManager, m.Settings, name)
+	agent := agentextensions.NewAgent(m.PluginManager, m.Settings, name)
+	if m.Tool != nil {
+		agent.SetGlobalTool(m.Tool)
+	}
+	return agent
 }
 
 func (m *Main) CreateTriggerFlow(name string) *triggerflow.TriggerFlow {
@@ -0,0 +1,106 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ToMap returns the message in the chat_history prompt form. Tool calls use
+// the OpenAI shape, so the map is also a valid chat completion message.
+func (m ChatMessage) ToMap() map[string]any {
+	out := map[string]any{"role": m.Role, "content": m.Content}
+	if len(m.ToolCalls) > 0 {
+		calls := make([]any, 0, len(m.ToolCalls))
+		for _, call := range m.ToolCalls {
+			calls = append(calls, call.ToOpenAI())
+		}
+		out["tool_calls"] = calls
+	}
+	if m.ToolCallID != "" {
+		out["tool_call_id"] = m.ToolCallID
+	}
+	if m.Name != "" {
+		out["name"] = m.Name
+	}
+	return out
+}
+
+// ChatMessageFromMap reads a message in the chat_history prompt form or in the
+// serialized ChatMessage form.
+func ChatMessageFromMap(m map[string]any) ChatMessage {
+	msg := ChatMessage{Role: stringValue(m["role"]), Content: m["content"], ToolCalls: ParseToolCalls(m["tool_calls"])}
+	msg.ToolCallID = stringValue(m["tool_call_id"])
+	msg.Name = stringValue(m["name"])
+	return msg
+}
+
+// ToOpenAI returns the call in the OpenAI chat completion tool_calls shape.
+func (c ToolCall) ToOpenAI() map[string]any {
+	return map[string]any{
+		"id":   c.ID,
+		"type": "function",
+		"function": map[string]any{
+			"name":      c.Name,
+			"arguments": c.Arguments,
+		},
+	}
+}
+
+// ParseToolCalls reads tool calls in the ToolCall form or the OpenAI shape.
+// Arguments that are not a string are encoded as JSON.
+func ParseToolCalls(raw any) []ToolCall {
+	var items []any
+	switch typed := raw.(type) {
+	case []ToolCall:
+		return append([]ToolCall(nil), typed...)
+	case []any:
+		items = typed
+	case []map[string]any:
+		for _, item := range typed {
+			items = append(items, item)
+		}
+	default:
+		return nil
+	}
+	out := make([]ToolCall, 0, len(items))
+	for _, item := range items {
+		switch typed := item.(type) {
+		case ToolCall:
+			out = append(out, typed)
+		case map[string]any:
+			call := ToolCall{ID: stringValue(typed["id"]), Name: stringValue(typed["name"])}
+			arguments := typed["arguments"]
+			if function, ok := typed["function"].(map[string]any); ok {
+				call.Name = stringValue(function["name"])
+				arguments = function["arguments"]
+			}
+			call.Arguments = argumentsText(arguments)
+			out = append(out, call)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+func argumentsText(arguments any) string {
+	switch typed := arguments.(type) {
+	case nil:
+		return ""
+	case string:
+		return typed
+	}
+	encoded, err := json.Marshal(arguments)
+	if err != nil {
+		return fmt.Sprint(arguments)
+	}
+	return string(encoded)
+}
+
+func stringValue(value any) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
@@ -18,6 +18,7 @@ type SystemEvent string
 const (
 	SystemEventModelRequest SystemEvent = "MODEL_REQUEST"
 	SystemEventTool         SystemEvent = "TOOL"
+	SystemEventToolApproval SystemEvent = "TOOL_APPROVAL"
 	SystemEventTriggerFlow  SystemEvent = "TRIGGER_FLOW"
 )
 
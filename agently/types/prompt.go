@@ -21,6 +21,9 @@ const (
 	PromptOutput       PromptSlot = "output"
 	PromptOutputFormat PromptSlot = "output_format"
 	PromptOptions      PromptSlot = "options"
+	// PromptToolMessages holds assistant tool_calls and tool role messages that
+	// follow the main prompt during a native tool loop.
+	PromptToolMessages PromptSlot = "tool_messages"
 )
 
 type OutputFormat string
@@ -29,11 +32,19 @@ const (
 	OutputMarkdown OutputFormat = "markdown"
 	OutputText     OutputFormat = "text"
 	OutputJSON     OutputFormat = "json"
+	// OutputMarkdownSections asks for one `## key` markdown section per output key.
+	OutputMarkdownSections OutputFormat = "markdown_sections"
 )
 
 type ChatMessage struct {
 	Role    string `json:"role"`
 	Content any    `json:"content"`
+	// ToolCalls are the calls requested by an assistant message.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty" yaml:"tool_calls,omitempty"`
+	// ToolCallID links a tool role message to the call it answers.
+	ToolCallID string `json:"tool_call_id,omitempty" yaml:"tool_call_id,omitempty"`
+	// Name is the tool name on tool role messages.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
 }
 
 type ToolMeta struct {
@@ -22,6 +22,7 @@ type PromptObject struct {
 	Output       any
 	OutputFormat OutputFormat
 	Options      map[string]any
+	ToolMessages []map[string]any
 	Extra        map[string]any
 }
 
@@ -44,6 +45,17 @@ func PromptObjectFromMap(data map[string]any) PromptObject {
 		obj.Options = opts
 	}
 
+	switch messages := data["tool_messages"].(type) {
+	case []map[string]any:
+		obj.ToolMessages = append(obj.ToolMessages, messages...)
+	case []any:
+		for _, item := range messages {
+			if m, ok := item.(map[string]any); ok {
+				obj.ToolMessages = append(obj.ToolMessages, m)
+			}
+		}
+	}
+
 	if tools, ok := data["tools"].([]any); ok {
 		obj.Tools = make([]ToolMeta, 0, len(tools))
 		for _, t := range tools {
@@ -64,18 +76,18 @@ func PromptObjectFromMap(data map[string]any) PromptObject {
 	case []map[string]any:
 		obj.ChatHistory = make([]ChatMessage, 0, len(history))
 		for _, item := range history {
-			obj.ChatHistory = append(obj.ChatHistory, ChatMessage{Role: fmt.Sprint(item["role"]), Content: item["content"]})
+			obj.ChatHistory = append(obj.ChatHistory, ChatMessageFromMap(item))
 		}
 	case []any:
 		obj.ChatHistory = make([]ChatMessage, 0, len(history))
 		for _, item := range history {
 			switch msg := item.(type) {
 			case map[string]any:
-				obj.ChatHistory = append(obj.ChatHistory, ChatMessage{Role: fmt.Sprint(msg["role"]), Content: msg["content"]})
+				obj.ChatHistory = append(obj.ChatHistory, ChatMessageFromMap(msg))
 			case ChatMessage:
 				obj.ChatHistory = append(obj.ChatHistory, msg)
 			case map[string]string:
-				obj.ChatHistory = append(obj.ChatHistory, ChatMessage{Role: msg["role"], Content: msg["content"]})
+				obj.ChatHistory = append(obj.ChatHistory, ChatMessage{Role: msg["role"], Content: msg["content"], ToolCallID: msg["tool_call_id"], Name: msg["name"]})
 			}
 		}
 	}
@@ -103,7 +115,9 @@ func PromptObjectFromMap(data map[string]any) PromptObject {
 		}
 	}
 
-	if format, ok := data["output_format"].(string); ok && format != "" {
+	if format, ok := data["output_format"].(OutputFormat); ok && format != "" {
+		obj.OutputFormat = format
+	} else if format, ok := data["output_format"].(string); ok && format != "" {
 		obj.OutputFormat = OutputFormat(format)
 	} else {
 		if obj.Output != nil {
@@ -120,7 +134,7 @@ func PromptObjectFromMap(data map[string]any) PromptObject {
 
 	for k, v := range data {
 		switch k {
-		case "system", "developer", "chat_history", "info", "tools", "action_results", "instruct", "examples", "input", "attachment", "output", "output_format", "options":
+		case "system", "developer", "chat_history", "info", "tools", "action_results", "instruct", "examples", "input", "attachment", "output", "output_format", "options", "tool_messages":
 		default:
 			obj.Extra[k] = v
 		}
@@ -24,6 +24,9 @@ const (
 	ResponseEventDone          ResponseEvent = "done"
 	ResponseEventMeta          ResponseEvent = "meta"
 	ResponseEventExtra         ResponseEvent = "extra"
+	// ResponseEventToolRoundDelta carries the text of a native tool loop
+	// round that ended in tool calls. It is not part of the response text.
+	ResponseEventToolRoundDelta ResponseEvent = "tool_round_delta"
 )
 
 type ResponseMessage struct {
@@ -59,4 +62,7 @@ type ModelResult struct {
 	ResultObject any            `json:"result_object"`
 	Errors       []error        `json:"-"`
 	Extra        map[string]any `json:"extra"`
+	// Repairs lists the JSON repairs applied while parsing the final result.
+	// Repairs made to partial chunks during streaming parse are not reported.
+	Repairs []string `json:"repairs,omitempty"`
 }
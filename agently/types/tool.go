@@ -6,4 +6,116 @@ type ToolInfo struct {
 	Kwargs  map[string]any `json:"kwargs"`
 	Returns any            `json:"returns,omitempty"`
 	Tags    []string       `json:"tags,omitempty"`
+	// Timeout limits one call of the tool, in seconds. Zero means no limit.
+	Timeout float64 `json:"timeout,omitempty"`
+	// RequiresApproval makes every call wait for the configured tool approver.
+	// Tagging a tool with ToolTagRequiresApproval has the same effect.
+	RequiresApproval bool `json:"requires_approval,omitempty"`
+	// Cache reuses results of calls with the same kwargs. Nil disables it.
+	Cache *ToolCache `json:"cache,omitempty"`
+	// Idempotent tools run at most once per response for the same kwargs:
+	// retries of the response reuse the first successful result. It implies a
+	// response-scoped Cache when Cache is nil.
+	Idempotent bool `json:"idempotent,omitempty"`
+}
+
+type ToolCacheScope string
+
+const (
+	// ToolCacheScopeResponse shares results within one response, including
+	// its ensure_keys retries.
+	ToolCacheScopeResponse ToolCacheScope = "response"
+	// ToolCacheScopeSession shares results within the agent's active session.
+	ToolCacheScopeSession ToolCacheScope = "session"
+	// ToolCacheScopeGlobal shares results across every caller of the tool
+	// manager that registered the tool.
+	ToolCacheScopeGlobal ToolCacheScope = "global"
+)
+
+// ToolCache configures result caching for a tool. Only successful results are
+// cached.
+type ToolCache struct {
+	// Scope defaults to ToolCacheScopeResponse.
+	Scope ToolCacheScope `json:"scope,omitempty"`
+	// TTL is how long a result is reused, in seconds. Zero keeps it for the
+	// lifetime of the scope.
+	TTL float64 `json:"ttl,omitempty"`
+}
+
+// ToolTagRequiresApproval marks tools whose calls need approval.
+const ToolTagRequiresApproval = "requires_approval"
+
+type ToolApprovalAction string
+
+const (
+	ToolApprovalAllow ToolApprovalAction = "allow"
+	ToolApprovalDeny  ToolApprovalAction = "deny"
+	// ToolApprovalEdit allows the call with the decision's Kwargs instead.
+	ToolApprovalEdit ToolApprovalAction = "edit"
+)
+
+// ToolApprovalRequest describes a pending call to a tool that requires
+// approval.
+type ToolApprovalRequest struct {
+	ID     string         `json:"id"`
+	Tool   string         `json:"tool"`
+	Desc   string         `json:"desc,omitempty"`
+	Kwargs map[string]any `json:"kwargs"`
+}
+
+type ToolApprovalDecision struct {
+	Action ToolApprovalAction `json:"action"`
+	Kwargs map[string]any     `json:"kwargs,omitempty"`
+	Reason string             `json:"reason,omitempty"`
+}
+
+// ToolCall is one function call requested by the model through native tool
+// calling. Arguments holds the raw JSON argument text.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ToolStep records one executed tool call. It is also the unit passed to
+// ToolManager.CallTools, which reads Name and Kwargs and fills Result or Error.
+type ToolStep struct {
+	Round  int            `json:"round"`
+	CallID string         `json:"call_id"`
+	Name   string         `json:"name"`
+	Kwargs map[string]any `json:"kwargs"`
+	Result any            `json:"result,omitempty"`
+	Error  string         `json:"error,omitempty"`
+	// InvalidKwargs lists what was wrong with Kwargs when the call was
+	// rejected before reaching the tool.
+	InvalidKwargs []ToolKwargIssue `json:"invalid_kwargs,omitempty"`
+	// Cached is set when Result was reused from the tool's result cache.
+	Cached bool `json:"cached,omitempty"`
+}
+
+// Problems reported in ToolKwargIssue.
+const (
+	KwargProblemMissing = "missing"
+	KwargProblemType    = "type"
+	KwargProblemEnum    = "enum"
+)
+
+// ToolKwargIssue is one kwarg that does not match the tool's ToolInfo.Kwargs.
+// Kwarg is a dotted path for nested values, e.g. "filter.tags[1]".
+type ToolKwargIssue struct {
+	Kwarg    string `json:"kwarg"`
+	Problem  string `json:"problem"`
+	Expected any    `json:"expected,omitempty"`
+	Got      any    `json:"got,omitempty"`
+}
+
+// ToolTraceStep records one planning step of the ReAct tool mode: the model's
+// thought, the chosen action and what the tool returned.
+type ToolTraceStep struct {
+	Step        int            `json:"step"`
+	Thought     string         `json:"thought,omitempty"`
+	Action      string         `json:"action"`
+	Kwargs      map[string]any `json:"kwargs,omitempty"`
+	Observation any            `json:"observation,omitempty"`
+	Error       string         `json:"error,omitempty"`
 }
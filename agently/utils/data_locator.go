@@ -23,12 +23,22 @@ func LocatePathInData(data any, path string, style string, defaultValue any) any
 }
 
 func LocateAllJSON(originalText string) []string {
+	return locateAllJSON(originalText, JSONRepairOff)
+}
+
+// locateAllJSON finds the JSON blocks in a text. With a repair mode it also
+// skips comments and, in lenient mode, single-quoted strings, so brackets and
+// quotes inside them do not end a block early, and it leaves raw control
+// characters in strings for RepairJSON to escape and report.
+func locateAllJSON(originalText string, mode JSONRepairMode) []string {
+	repair := mode != JSONRepairOff
+	singleQuotes := repair && mode != JSONRepairBasic
 	jsonBlocks := make([]string, 0)
 	stage := 1
 	blockNum := 0
 	layer := 0
 	skipNext := false
-	inQuote := false
+	quote := byte(0)
 
 	for i := 0; i < len(originalText); i++ {
 		char := originalText[i]
@@ -49,7 +59,13 @@ func LocateAllJSON(originalText string) []string {
 			continue
 		}
 
-		if !inQuote {
+		if quote == 0 {
+			if repair && char == '/' && i+1 < len(originalText) && (originalText[i+1] == '/' || originalText[i+1] == '*') {
+				end := jsonCommentEnd(originalText, i)
+				jsonBlocks[blockNum] += originalText[i:end]
+				i = end - 1
+				continue
+			}
 			if char == '\\' {
 				skipNext = true
 				if i+1 < len(originalText) && originalText[i+1] == '"' {
@@ -58,8 +74,8 @@ func LocateAllJSON(originalText string) []string {
 					continue
 				}
 			}
-			if char == '"' {
-				inQuote = true
+			if char == '"' || (singleQuotes && char == '\'') {
+				quote = char
 			}
 			if char == '[' || char == '{' {
 				layer++
@@ -73,16 +89,16 @@ func LocateAllJSON(originalText string) []string {
 				skipNext = true
 				continue
 			}
-			if char == '\n' {
+			if char == '\n' && !repair {
 				jsonBlocks[blockNum] += "\\n"
 				continue
 			}
-			if char == '\t' {
+			if char == '\t' && !repair {
 				jsonBlocks[blockNum] += "\\t"
 				continue
 			}
-			if char == '"' {
-				inQuote = false
+			if char == quote {
+				quote = 0
 			}
 			jsonBlocks[blockNum] += string(char)
 		}
@@ -95,25 +111,69 @@ func LocateAllJSON(originalText string) []string {
 	return jsonBlocks
 }
 
+// jsonCommentEnd returns the index right after the // or /* comment starting
+// at start.
+func jsonCommentEnd(text string, start int) int {
+	if text[start+1] == '/' {
+		if end := strings.IndexAny(text[start:], "\r\n"); end >= 0 {
+			return start + end
+		}
+		return len(text)
+	}
+	if end := strings.Index(text[start+2:], "*/"); end >= 0 {
+		return start + 2 + end + 2
+	}
+	return len(text)
+}
+
 func LocateOutputJSON(originalText string, outputSchema map[string]any) string {
-	all := LocateAllJSON(originalText)
+	located, _ := locateOutputJSON(originalText, outputSchema, JSONRepairOff)
+	return located
+}
+
+// LocateRepairedOutputJSON locates the output JSON like LocateOutputJSON,
+// completes it when truncated and repairs it with RepairJSON. Locating already
+// understands what the repair mode fixes, such as a "}" inside a single-quoted
+// string or a comment. It returns "" when no JSON is found, and the repairs
+// applied to the returned block.
+func LocateRepairedOutputJSON(originalText string, outputSchema map[string]any, mode JSONRepairMode) (string, []string) {
+	if mode == JSONRepairOff {
+		located := LocateOutputJSON(originalText, outputSchema)
+		if located == "" {
+			return "", nil
+		}
+		completer := NewStreamingJSONCompleter()
+		completer.Reset(located)
+		return completer.Complete(), nil
+	}
+	return locateOutputJSON(originalText, outputSchema, mode)
+}
+
+func locateOutputJSON(originalText string, outputSchema map[string]any, mode JSONRepairMode) (string, []string) {
+	all := locateAllJSON(originalText, mode)
 	if len(all) == 0 {
-		return ""
+		return "", nil
 	}
-	if len(all) == 1 {
-		return all[0]
+	prepare := func(block string) (string, []string) {
+		if mode == JSONRepairOff {
+			return block, nil
+		}
+		completer := NewStreamingJSONCompleter()
+		completer.Reset(block)
+		return RepairJSON(completer.Complete(), mode)
 	}
 
 	for i := 0; i < len(all)-1; i++ {
+		block, repairs := prepare(all[i])
 		m := map[string]any{}
-		if err := json.Unmarshal([]byte(all[i]), &m); err != nil {
+		if err := json.Unmarshal([]byte(block), &m); err != nil {
 			continue
 		}
 		for key := range m {
 			if _, ok := outputSchema[key]; ok {
-				return all[i]
+				return block, repairs
 			}
 		}
 	}
-	return all[len(all)-1]
+	return prepare(all[len(all)-1])
 }
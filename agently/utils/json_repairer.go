@@ -0,0 +1,242 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// JSONRepairMode controls how aggressively RepairJSON rewrites model output.
+type JSONRepairMode string
+
+const (
+	// JSONRepairOff leaves the text untouched.
+	JSONRepairOff JSONRepairMode = "off"
+	// JSONRepairBasic strips comments and trailing commas and escapes raw control
+	// characters inside strings.
+	JSONRepairBasic JSONRepairMode = "basic"
+	// JSONRepairLenient additionally converts single-quoted strings, quotes bare
+	// object keys and maps Python literals (True/False/None) to JSON.
+	JSONRepairLenient JSONRepairMode = "lenient"
+)
+
+// Repair names reported by RepairJSON.
+const (
+	JSONRepairComments       = "comments"
+	JSONRepairTrailingCommas = "trailing_commas"
+	JSONRepairControlChars   = "unescaped_control_chars"
+	JSONRepairSingleQuotes   = "single_quotes"
+	JSONRepairUnquotedKeys   = "unquoted_keys"
+	JSONRepairPythonLiterals = "python_literals"
+)
+
+const jsonIdentifierExtraRunes = "_$-"
+
+// ParseJSONRepairMode normalizes a settings value into a JSONRepairMode.
+// Unknown values fall back to lenient; false/"none" disable repair.
+func ParseJSONRepairMode(value any) JSONRepairMode {
+	switch typed := value.(type) {
+	case JSONRepairMode:
+		return ParseJSONRepairMode(string(typed))
+	case bool:
+		if typed {
+			return JSONRepairLenient
+		}
+		return JSONRepairOff
+	case string:
+		switch strings.ToLower(strings.TrimSpace(typed)) {
+		case "off", "none", "false", "strict":
+			return JSONRepairOff
+		case "basic":
+			return JSONRepairBasic
+		}
+	}
+	return JSONRepairLenient
+}
+
+// RepairJSON rewrites common model-output JSON mistakes into valid JSON and
+// returns the repaired text with the names of repairs that were applied.
+// Valid JSON is returned unchanged with no repairs.
+func RepairJSON(text string, mode JSONRepairMode) (string, []string) {
+	if mode == JSONRepairOff || text == "" {
+		return text, nil
+	}
+	r := &jsonRepairer{
+		runes:   []rune(text),
+		lenient: mode != JSONRepairBasic,
+		applied: map[string]struct{}{},
+	}
+	r.run()
+	return r.out.String(), r.repairs
+}
+
+type jsonRepairer struct {
+	runes   []rune
+	pos     int
+	lenient bool
+	out     strings.Builder
+	repairs []string
+	applied map[string]struct{}
+}
+
+func (r *jsonRepairer) record(name string) {
+	if _, ok := r.applied[name]; ok {
+		return
+	}
+	r.applied[name] = struct{}{}
+	r.repairs = append(r.repairs, name)
+}
+
+func (r *jsonRepairer) peek(offset int) rune {
+	if r.pos+offset < len(r.runes) {
+		return r.runes[r.pos+offset]
+	}
+	return 0
+}
+
+func (r *jsonRepairer) run() {
+	for r.pos < len(r.runes) {
+		ch := r.runes[r.pos]
+		switch {
+		case ch == '"':
+			r.readString('"')
+		case ch == '\'' && r.lenient:
+			r.record(JSONRepairSingleQuotes)
+			r.readString('\'')
+		case ch == '/' && (r.peek(1) == '/' || r.peek(1) == '*'):
+			r.record(JSONRepairComments)
+			r.skipComment()
+		case ch == ',':
+			if next := r.nextSignificant(r.pos + 1); next == '}' || next == ']' || next == 0 {
+				r.record(JSONRepairTrailingCommas)
+			} else {
+				r.out.WriteRune(ch)
+			}
+			r.pos++
+		case r.lenient && isJSONIdentifierStart(ch):
+			r.readIdentifier()
+		default:
+			r.out.WriteRune(ch)
+			r.pos++
+		}
+	}
+}
+
+// readString copies a quoted string starting at r.pos, always emitting it with
+// double quotes and escaping raw control characters.
+func (r *jsonRepairer) readString(quote rune) {
+	r.out.WriteRune('"')
+	r.pos++
+	for r.pos < len(r.runes) {
+		ch := r.runes[r.pos]
+		switch {
+		case ch == '\\':
+			next := r.peek(1)
+			if quote == '\'' && next == '\'' {
+				r.out.WriteRune('\'')
+			} else if next != 0 {
+				r.out.WriteRune(ch)
+				r.out.WriteRune(next)
+			}
+			r.pos += 2
+			continue
+		case ch == quote:
+			r.out.WriteRune('"')
+			r.pos++
+			return
+		case ch == '"':
+			// Only reachable for single-quoted strings.
+			r.out.WriteString(`\"`)
+		case ch == '\n':
+			r.record(JSONRepairControlChars)
+			r.out.WriteString(`\n`)
+		case ch == '\r':
+			r.record(JSONRepairControlChars)
+			r.out.WriteString(`\r`)
+		case ch == '\t':
+			r.record(JSONRepairControlChars)
+			r.out.WriteString(`\t`)
+		default:
+			r.out.WriteRune(ch)
+		}
+		r.pos++
+	}
+	// Unterminated string: close it so the result stays parseable.
+	r.out.WriteRune('"')
+}
+
+func (r *jsonRepairer) skipComment() {
+	r.pos = r.commentEnd(r.pos)
+}
+
+// commentEnd returns the index right after the comment starting at start.
+func (r *jsonRepairer) commentEnd(start int) int {
+	if start+1 >= len(r.runes) {
+		return len(r.runes)
+	}
+	if r.runes[start+1] == '/' {
+		for i := start + 2; i < len(r.runes); i++ {
+			if r.runes[i] == '\n' || r.runes[i] == '\r' {
+				return i
+			}
+		}
+		return len(r.runes)
+	}
+	for i := start + 2; i+1 < len(r.runes); i++ {
+		if r.runes[i] == '*' && r.runes[i+1] == '/' {
+			return i + 2
+		}
+	}
+	return len(r.runes)
+}
+
+// nextSignificant returns the next rune at or after start that is neither
+// whitespace nor part of a comment, or 0 at end of input.
+func (r *jsonRepairer) nextSignificant(start int) rune {
+	for i := start; i < len(r.runes); {
+		ch := r.runes[i]
+		if unicode.IsSpace(ch) {
+			i++
+			continue
+		}
+		if ch == '/' && i+1 < len(r.runes) && (r.runes[i+1] == '/' || r.runes[i+1] == '*') {
+			i = r.commentEnd(i)
+			continue
+		}
+		return ch
+	}
+	return 0
+}
+
+func (r *jsonRepairer) readIdentifier() {
+	start := r.pos
+	for r.pos < len(r.runes) && isJSONIdentifierPart(r.runes[r.pos]) {
+		r.pos++
+	}
+	word := string(r.runes[start:r.pos])
+	if r.nextSignificant(r.pos) == ':' {
+		r.record(JSONRepairUnquotedKeys)
+		r.out.WriteString(`"` + word + `"`)
+		return
+	}
+	switch word {
+	case "True":
+		r.record(JSONRepairPythonLiterals)
+		r.out.WriteString("true")
+	case "False":
+		r.record(JSONRepairPythonLiterals)
+		r.out.WriteString("false")
+	case "None":
+		r.record(JSONRepairPythonLiterals)
+		r.out.WriteString("null")
+	default:
+		r.out.WriteString(word)
+	}
+}
+
+func isJSONIdentifierStart(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_' || ch == '$'
+}
+
+func isJSONIdentifierPart(ch rune) bool {
+	return unicode.IsLetter(ch) || unicode.IsDigit(ch) || strings.ContainsRune(jsonIdentifierExtraRunes, ch)
+}
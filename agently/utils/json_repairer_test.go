@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRepairJSONLenient(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   string
+		want    map[string]any
+		repairs []string
+	}{
+		{
+			name:    "trailing commas",
+			input:   `{"a": [1, 2,], "b": "x",}`,
+			want:    map[string]any{"a": []any{1.0, 2.0}, "b": "x"},
+			repairs: []string{JSONRepairTrailingCommas},
+		},
+		{
+			name:    "single quotes and unquoted keys",
+			input:   `{name: 'it\'s "ok"', 'n': 1}`,
+			want:    map[string]any{"name": `it's "ok"`, "n": 1.0},
+			repairs: []string{JSONRepairUnquotedKeys, JSONRepairSingleQuotes},
+		},
+		{
+			name:    "comments",
+			input:   "{\"a\": 1, // first\n/* block */ \"b\": 2}",
+			want:    map[string]any{"a": 1.0, "b": 2.0},
+			repairs: []string{JSONRepairComments},
+		},
+		{
+			name:    "python literals",
+			input:   `{"ok": True, "bad": False, "none": None, "s": "True"}`,
+			want:    map[string]any{"ok": true, "bad": false, "none": nil, "s": "True"},
+			repairs: []string{JSONRepairPythonLiterals},
+		},
+		{
+			name:    "raw newlines in strings",
+			input:   "{\"text\": \"line1\nline2\"}",
+			want:    map[string]any{"text": "line1\nline2"},
+			repairs: []string{JSONRepairControlChars},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			repaired, repairs := RepairJSON(tc.input, JSONRepairLenient)
+			got := map[string]any{}
+			if err := json.Unmarshal([]byte(repaired), &got); err != nil {
+				t.Fatalf("repaired json invalid: %v (%s)", err, repaired)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %#v, got %#v", tc.want, got)
+			}
+			if !reflect.DeepEqual(repairs, tc.repairs) {
+				t.Fatalf("expected repairs %v, got %v", tc.repairs, repairs)
+			}
+		})
+	}
+}
+
+func TestRepairJSONModes(t *testing.T) {
+	valid := `{"a": "x, }", "b": [true, null]}`
+	if repaired, repairs := RepairJSON(valid, JSONRepairLenient); repaired != valid || len(repairs) != 0 {
+		t.Fatalf("valid json must be untouched, got %s %v", repaired, repairs)
+	}
+
+	input := `{a: 1,}`
+	if repaired, _ := RepairJSON(input, JSONRepairOff); repaired != input {
+		t.Fatalf("off mode must not change input, got %s", repaired)
+	}
+	repaired, repairs := RepairJSON(input, JSONRepairBasic)
+	if repaired != `{a: 1}` || !reflect.DeepEqual(repairs, []string{JSONRepairTrailingCommas}) {
+		t.Fatalf("basic mode should only drop trailing comma, got %s %v", repaired, repairs)
+	}
+}
+
+func TestStreamingJSONParserRepairsChunks(t *testing.T) {
+	parser := NewStreamingJSONParser(map[string]any{"answer": "string", "ok": "bool"})
+	if _, err := parser.ParseChunk(`{answer: 'hel`); err != nil {
+		t.Fatalf("parse chunk error: %v", err)
+	}
+	if _, err := parser.ParseChunk(`lo', ok: True,}`); err != nil {
+		t.Fatalf("parse chunk error: %v", err)
+	}
+	found := false
+	for _, evt := range parser.Finalize() {
+		if evt.Path == "answer" && evt.Value == "hello" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected repaired answer=hello done event")
+	}
+}
+
+func TestLocateRepairedOutputJSON(t *testing.T) {
+	schema := map[string]any{"a": "string", "b": "string"}
+	cases := []struct {
+		name    string
+		input   string
+		want    map[string]any
+		repairs []string
+	}{
+		{
+			name:    "closing brace in single quotes",
+			input:   `Here it is: {'a': 'x}y', 'b': 'z'} done`,
+			want:    map[string]any{"a": "x}y", "b": "z"},
+			repairs: []string{JSONRepairSingleQuotes},
+		},
+		{
+			name:    "quote in line comment",
+			input:   "{\"a\": \"x\", // say \"hi\n\"b\": \"z\"}",
+			want:    map[string]any{"a": "x", "b": "z"},
+			repairs: []string{JSONRepairComments},
+		},
+		{
+			name:    "closing brace in block comment",
+			input:   `{"a": "x", /* } */ "b": "z"}`,
+			want:    map[string]any{"a": "x", "b": "z"},
+			repairs: []string{JSONRepairComments},
+		},
+		{
+			name:    "raw newline in string",
+			input:   "```json\n{\"a\": \"line1\nline2\", \"b\": \"z\"}\n```",
+			want:    map[string]any{"a": "line1\nline2", "b": "z"},
+			repairs: []string{JSONRepairControlChars},
+		},
+		{
+			name:    "truncated",
+			input:   `{'a': 'x}`,
+			want:    map[string]any{"a": "x}"},
+			repairs: []string{JSONRepairSingleQuotes},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			located, repairs := LocateRepairedOutputJSON(tc.input, schema, JSONRepairLenient)
+			got := map[string]any{}
+			if err := json.Unmarshal([]byte(located), &got); err != nil {
+				t.Fatalf("located json invalid: %v (%s)", err, located)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %#v, got %#v", tc.want, got)
+			}
+			if !reflect.DeepEqual(repairs, tc.repairs) {
+				t.Fatalf("expected repairs %v, got %v", tc.repairs, repairs)
+			}
+		})
+	}
+
+	if located, repairs := LocateRepairedOutputJSON("{\"a\": \"line1\nline2\"}", schema, JSONRepairOff); located != `{"a": "line1\nline2"}` || repairs != nil {
+		t.Fatalf("off mode should keep the locator's escaping without repairs, got %s %v", located, repairs)
+	}
+}
@@ -0,0 +1,266 @@
+package utils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+)
+
+var (
+	reMarkdownHeading = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	reMarkdownBullet  = regexp.MustCompile(`^(\s*)(?:[-*+]|\d+[.)])\s+(.*)$`)
+	reMarkdownKeyLine = regexp.MustCompile(`^\s*(?:[-*+]\s+)?\**` + "`?" + `([^:：*` + "`" + `]+?)` + "`?" + `\**\s*[:：]\s*(.*)$`)
+)
+
+// ParseMarkdownSections maps a markdown answer written as one `## key` section
+// per output key back onto the output schema. List values are read from bullet
+// lists, nested objects from deeper headings or `key: value` lines.
+func ParseMarkdownSections(text string, schema map[string]any) map[string]any {
+	lines := stripMarkdownFence(strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n"))
+	sections, _ := splitMarkdownSections(lines, schema)
+	out := map[string]any{}
+	for _, section := range sections {
+		out[section.key] = markdownValue(section.body, schema[section.key])
+	}
+	return out
+}
+
+type markdownSection struct {
+	key  string
+	body []string
+}
+
+// splitMarkdownSections groups lines under headings whose titles match schema
+// keys. It also returns the index of the section that is still open (the last
+// one), or -1 when no section was found.
+func splitMarkdownSections(lines []string, schema map[string]any) ([]markdownSection, int) {
+	sections := make([]markdownSection, 0)
+	level := 0
+	for _, line := range lines {
+		if match := reMarkdownHeading.FindStringSubmatch(line); match != nil {
+			key, ok := matchMarkdownKey(match[2], schema)
+			if ok && (level == 0 || len(match[1]) <= level) {
+				level = len(match[1])
+				sections = append(sections, markdownSection{key: key})
+				continue
+			}
+		}
+		if len(sections) > 0 {
+			last := &sections[len(sections)-1]
+			last.body = append(last.body, line)
+		}
+	}
+	return sections, len(sections) - 1
+}
+
+func matchMarkdownKey(title string, schema map[string]any) (string, bool) {
+	title = strings.Trim(strings.TrimSpace(title), "`*_:：")
+	if _, ok := schema[title]; ok {
+		return title, true
+	}
+	for key := range schema {
+		if strings.EqualFold(key, title) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func markdownValue(lines []string, schema any) any {
+	switch typed := unwrapOutputSchema(schema).(type) {
+	case map[string]any:
+		return markdownObject(lines, typed)
+	case []any:
+		var itemSchema any = "string"
+		if len(typed) > 0 {
+			itemSchema = typed[0]
+		}
+		items := make([]any, 0)
+		for _, itemLines := range splitMarkdownBullets(lines) {
+			items = append(items, markdownValue(itemLines, itemSchema))
+		}
+		return items
+	default:
+		return convertMarkdownScalar(strings.TrimSpace(strings.Join(dedentMarkdown(lines), "\n")), typed)
+	}
+}
+
+func markdownObject(lines []string, schema map[string]any) map[string]any {
+	out := map[string]any{}
+	if sections, _ := splitMarkdownSections(lines, schema); len(sections) > 0 {
+		for _, section := range sections {
+			out[section.key] = markdownValue(section.body, schema[section.key])
+		}
+		return out
+	}
+	current := ""
+	bodies := map[string][]string{}
+	for _, line := range dedentMarkdown(lines) {
+		if match := reMarkdownKeyLine.FindStringSubmatch(line); match != nil {
+			if key, ok := matchMarkdownKey(match[1], schema); ok {
+				current = key
+				if _, exists := bodies[key]; !exists {
+					bodies[key] = nil
+				}
+				if rest := strings.TrimSpace(match[2]); rest != "" {
+					bodies[key] = append(bodies[key], rest)
+				}
+				continue
+			}
+		}
+		if current != "" {
+			bodies[current] = append(bodies[current], line)
+		}
+	}
+	for key, body := range bodies {
+		out[key] = markdownValue(body, schema[key])
+	}
+	return out
+}
+
+// splitMarkdownBullets returns the lines of each top-level bullet item with the
+// bullet marker removed and continuation lines dedented.
+func splitMarkdownBullets(lines []string) [][]string {
+	lines = dedentMarkdown(lines)
+	items := make([][]string, 0)
+	for _, line := range lines {
+		if match := reMarkdownBullet.FindStringSubmatch(line); match != nil && match[1] == "" {
+			items = append(items, []string{match[2]})
+			continue
+		}
+		if len(items) > 0 && strings.TrimSpace(line) != "" {
+			items[len(items)-1] = append(items[len(items)-1], line)
+		}
+	}
+	for i, item := range items {
+		if len(item) > 1 {
+			items[i] = append([]string{item[0]}, dedentMarkdown(item[1:])...)
+		}
+	}
+	return items
+}
+
+// dedentMarkdown drops surrounding blank lines and the common indentation.
+func dedentMarkdown(lines []string) []string {
+	start, end := 0, len(lines)
+	for start < end && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	for end > start && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	lines = lines[start:end]
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if len(line) >= indent && indent > 0 {
+			line = line[indent:]
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+func stripMarkdownFence(lines []string) []string {
+	lines = dedentMarkdown(lines)
+	if len(lines) > 0 && strings.HasPrefix(strings.TrimSpace(lines[0]), "```") {
+		lines = lines[1:]
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "```" {
+			lines = lines[:len(lines)-1]
+		}
+	}
+	return lines
+}
+
+func unwrapOutputSchema(schema any) any {
+	if tuple, ok := schema.(types.OutputTuple); ok && len(tuple) > 0 {
+		return tuple[0]
+	}
+	return schema
+}
+
+func convertMarkdownScalar(text string, schema any) any {
+	typeName, _ := schema.(string)
+	switch strings.ToLower(strings.TrimSpace(typeName)) {
+	case "number", "float", "int", "integer":
+		if value, err := strconv.ParseFloat(strings.Trim(text, "*` "), 64); err == nil {
+			return value
+		}
+	case "bool", "boolean":
+		if value, err := strconv.ParseBool(strings.ToLower(strings.Trim(text, "*` "))); err == nil {
+			return value
+		}
+	}
+	return text
+}
+
+// StreamingMarkdownSectionParser turns streamed markdown-sections output into
+// the same delta/done events StreamingJSONParser emits. A section's done events
+// fire as soon as the next section heading arrives.
+type StreamingMarkdownSectionParser struct {
+	schema       map[string]any
+	buffer       strings.Builder
+	currentData  map[string]any
+	previousData map[string]any
+	completed    map[string]struct{}
+}
+
+func NewStreamingMarkdownSectionParser(schema map[string]any) *StreamingMarkdownSectionParser {
+	return &StreamingMarkdownSectionParser{
+		schema:       schema,
+		currentData:  map[string]any{},
+		previousData: map[string]any{},
+		completed:    map[string]struct{}{},
+	}
+}
+
+func (s *StreamingMarkdownSectionParser) ParseChunk(chunk string) ([]types.StreamingData, error) {
+	s.buffer.WriteString(chunk)
+	text := s.buffer.String()
+	// Hold back a trailing partial line that may still turn into a heading.
+	if idx := strings.LastIndex(text, "\n"); idx >= 0 && strings.HasPrefix(strings.TrimSpace(text[idx+1:]), "#") {
+		text = text[:idx]
+	} else if idx < 0 && strings.HasPrefix(strings.TrimSpace(text), "#") {
+		return nil, nil
+	}
+	return s.update(text, false), nil
+}
+
+func (s *StreamingMarkdownSectionParser) Finalize() []types.StreamingData {
+	return s.update(s.buffer.String(), true)
+}
+
+func (s *StreamingMarkdownSectionParser) update(text string, final bool) []types.StreamingData {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if final {
+		lines = stripMarkdownFence(lines)
+	}
+	sections, open := splitMarkdownSections(lines, s.schema)
+	current := map[string]any{}
+	for _, section := range sections {
+		current[section.key] = markdownValue(section.body, s.schema[section.key])
+	}
+	s.previousData = s.currentData
+	s.currentData = current
+
+	out := make([]types.StreamingData, 0)
+	diffStreamingData(current, s.previousData, []any{}, current, &out)
+	for i, section := range sections {
+		if i == open && !final {
+			continue
+		}
+		completeStreamingData(current[section.key], []any{section.key}, current, s.completed, &out)
+	}
+	return out
+}
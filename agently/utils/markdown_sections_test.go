@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+)
+
+var markdownSectionsSchema = map[string]any{
+	"definition": "string",
+	"score":      "number",
+	"tips":       []any{"string"},
+	"practices":  []any{map[string]any{"question": "string", "answer": "string"}},
+	"meta":       map[string]any{"author": "string", "reviewed": "boolean"},
+}
+
+const markdownSectionsAnswer = "```markdown\n" +
+	"## definition\n" +
+	"Recursion is a function calling itself.\n\n" +
+	"It needs a base case.\n" +
+	"## Score\n" +
+	"9.5\n" +
+	"## tips\n" +
+	"- keep a base case\n" +
+	"- shrink the input\n" +
+	"  on every call\n" +
+	"## practices\n" +
+	"- question: What is 0!?\n" +
+	"  answer: 1\n" +
+	"- **question**: Depth limit?\n" +
+	"  answer: stack size\n" +
+	"## meta\n" +
+	"### author\n" +
+	"Ada\n" +
+	"### reviewed\n" +
+	"true\n" +
+	"```"
+
+func TestParseMarkdownSections(t *testing.T) {
+	parsed := ParseMarkdownSections(markdownSectionsAnswer, markdownSectionsSchema)
+	expected := map[string]any{
+		"definition": "Recursion is a function calling itself.\n\nIt needs a base case.",
+		"score":      9.5,
+		"tips":       []any{"keep a base case", "shrink the input\non every call"},
+		"practices": []any{
+			map[string]any{"question": "What is 0!?", "answer": "1"},
+			map[string]any{"question": "Depth limit?", "answer": "stack size"},
+		},
+		"meta": map[string]any{"author": "Ada", "reviewed": true},
+	}
+	if !reflect.DeepEqual(parsed, expected) {
+		t.Fatalf("unexpected parse result:\n%#v", parsed)
+	}
+}
+
+func TestStreamingMarkdownSectionParserCompletesPerSection(t *testing.T) {
+	parser := NewStreamingMarkdownSectionParser(markdownSectionsSchema)
+	completedAt := map[string]int{}
+	deltas := ""
+	chunks := []string{"## defin", "ition\nRecursion is ", "a function calling itself.\n#", "# tips\n- keep a base case\n", "- shrink the input\n"}
+	record := func(step int, events []types.StreamingData) {
+		for _, evt := range events {
+			if evt.Path == "definition" && evt.EventType == types.StreamEventDelta {
+				deltas += evt.Delta
+			}
+			if evt.IsComplete {
+				if _, ok := completedAt[evt.Path]; !ok {
+					completedAt[evt.Path] = step
+				}
+			}
+		}
+	}
+	for i, chunk := range chunks {
+		events, err := parser.ParseChunk(chunk)
+		if err != nil {
+			t.Fatalf("ParseChunk failed: %v", err)
+		}
+		record(i, events)
+	}
+	record(len(chunks), parser.Finalize())
+
+	if deltas != "Recursion is a function calling itself." {
+		t.Fatalf("unexpected definition deltas: %q", deltas)
+	}
+	if completedAt["definition"] != 3 {
+		t.Fatalf("definition should complete when the tips heading arrives, got step %d", completedAt["definition"])
+	}
+	if completedAt["tips"] != len(chunks) || completedAt["tips[1]"] != len(chunks) {
+		t.Fatalf("tips should complete on finalize, got %#v", completedAt)
+	}
+}
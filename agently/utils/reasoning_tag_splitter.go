@@ -0,0 +1,166 @@
+package utils
+
+import "strings"
+
+const (
+	DefaultReasoningOpenTag  = "<think>"
+	DefaultReasoningCloseTag = "</think>"
+)
+
+// ReasoningTagSplitter separates inline reasoning wrapped in open/close tags
+// (for example `<think>...</think>`) from answer content in a text stream.
+// Tags may straddle chunk boundaries: a chunk tail that could be the start of
+// a tag is held back until the next Feed or Flush.
+//
+// Some chat templates put the open tag in the prompt, so the model only
+// emits `reasoning</think>answer`. With a leading window set, untagged
+// leading text is held back up to that many bytes: a close tag arriving first
+// turns it into reasoning, anything else releases it as content.
+type ReasoningTagSplitter struct {
+	openTag  string
+	closeTag string
+
+	inReasoning   bool
+	trimLeading   bool
+	pending       string
+	seenTag       bool
+	leading       string
+	leadingWindow int
+	leadingDone   bool
+}
+
+func NewReasoningTagSplitter(openTag string, closeTag string) *ReasoningTagSplitter {
+	if openTag == "" {
+		openTag = DefaultReasoningOpenTag
+	}
+	if closeTag == "" {
+		closeTag = DefaultReasoningCloseTag
+	}
+	return &ReasoningTagSplitter{openTag: openTag, closeTag: closeTag}
+}
+
+// SetLeadingWindow sets how many bytes of untagged leading text may be held
+// back while waiting for a close tag without an opener. Zero or less, the
+// default, emits leading text right away and keeps such a close tag as
+// content. Call it before the first Feed.
+func (s *ReasoningTagSplitter) SetLeadingWindow(window int) {
+	s.leadingWindow = window
+}
+
+// Feed consumes one chunk and returns the reasoning and content text that can
+// be emitted safely so far.
+func (s *ReasoningTagSplitter) Feed(chunk string) (string, string) {
+	reasoning := strings.Builder{}
+	content := strings.Builder{}
+	buf := s.pending + chunk
+	s.pending = ""
+	for buf != "" {
+		tag := s.openTag
+		if s.inReasoning {
+			tag = s.closeTag
+		}
+		idx := strings.Index(buf, tag)
+		orphan := false
+		if s.holdingLeading() {
+			if closeIdx := strings.Index(buf, s.closeTag); closeIdx >= 0 && (idx < 0 || closeIdx < idx) {
+				idx, tag, orphan = closeIdx, s.closeTag, true
+			}
+		}
+		if idx >= 0 {
+			s.write(&reasoning, &content, buf[:idx])
+			if orphan {
+				reasoning.WriteString(s.leading)
+			} else {
+				content.WriteString(s.leading)
+			}
+			s.leading = ""
+			buf = buf[idx+len(tag):]
+			s.inReasoning = !s.inReasoning && !orphan
+			s.trimLeading = true
+			s.seenTag = true
+			continue
+		}
+		hold := partialTagSuffix(buf, tag)
+		if s.holdingLeading() {
+			hold = max(hold, partialTagSuffix(buf, s.closeTag))
+		}
+		s.write(&reasoning, &content, buf[:len(buf)-hold])
+		s.pending = buf[len(buf)-hold:]
+		break
+	}
+	if s.holdingLeading() && len(s.leading) > s.leadingWindow {
+		s.releaseLeading(&content)
+	}
+	return reasoning.String(), content.String()
+}
+
+// Flush releases any held-back text. An unfinished tag is treated as literal
+// text of the current side, and untagged leading text as content.
+func (s *ReasoningTagSplitter) Flush() (string, string) {
+	reasoning := strings.Builder{}
+	content := strings.Builder{}
+	s.write(&reasoning, &content, s.pending)
+	s.pending = ""
+	s.releaseLeading(&content)
+	return reasoning.String(), content.String()
+}
+
+// SeenTag reports whether any open or close tag has been consumed.
+func (s *ReasoningTagSplitter) SeenTag() bool {
+	return s.seenTag
+}
+
+func (s *ReasoningTagSplitter) write(reasoning *strings.Builder, content *strings.Builder, text string) {
+	if s.trimLeading {
+		text = strings.TrimLeft(text, " \t\r\n")
+		if text == "" {
+			return
+		}
+		s.trimLeading = false
+	}
+	switch {
+	case s.inReasoning:
+		reasoning.WriteString(text)
+	case s.holdingLeading():
+		s.leading += text
+	default:
+		content.WriteString(text)
+	}
+}
+
+// holdingLeading reports whether untagged leading text is still held back
+// for a possible close tag without an opener.
+func (s *ReasoningTagSplitter) holdingLeading() bool {
+	return !s.seenTag && !s.leadingDone && s.leadingWindow > 0
+}
+
+func (s *ReasoningTagSplitter) releaseLeading(content *strings.Builder) {
+	content.WriteString(s.leading)
+	s.leading = ""
+	s.leadingDone = true
+}
+
+// SplitReasoningTags splits a complete text into reasoning and content. Text
+// before a close tag without an opener is reasoning.
+func SplitReasoningTags(text string, openTag string, closeTag string) (string, string) {
+	splitter := NewReasoningTagSplitter(openTag, closeTag)
+	splitter.SetLeadingWindow(len(text))
+	reasoning, content := splitter.Feed(text)
+	restReasoning, restContent := splitter.Flush()
+	return reasoning + restReasoning, content + restContent
+}
+
+// partialTagSuffix returns the length of the longest suffix of text that is a
+// proper prefix of tag.
+func partialTagSuffix(text string, tag string) int {
+	max := len(tag) - 1
+	if max > len(text) {
+		max = len(text)
+	}
+	for n := max; n > 0; n-- {
+		if strings.HasSuffix(text, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,94 @@
+package utils
+
+import "testing"
+
+func TestReasoningTagSplitterStraddlingChunks(t *testing.T) {
+	splitter := NewReasoningTagSplitter("", "")
+	chunks := []string{"<th", "ink>let me ", "think</", "thi", "nk>\n\n{\"a\"", ": 1}<"}
+	reasoning, content := "", ""
+	for _, chunk := range chunks {
+		r, c := splitter.Feed(chunk)
+		reasoning += r
+		content += c
+	}
+	r, c := splitter.Flush()
+	reasoning += r
+	content += c
+	if reasoning != "let me think" {
+		t.Fatalf("unexpected reasoning: %q", reasoning)
+	}
+	if content != "{\"a\": 1}<" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+	if !splitter.SeenTag() {
+		t.Fatalf("expected splitter to report consumed tags")
+	}
+}
+
+func TestSplitReasoningTags(t *testing.T) {
+	cases := []struct {
+		name      string
+		text      string
+		reasoning string
+		content   string
+	}{
+		{name: "no tags", text: "plain answer", reasoning: "", content: "plain answer"},
+		{name: "leading block", text: "<think>\nplan\n</think>\nanswer", reasoning: "plan\n", content: "answer"},
+		{name: "unclosed", text: "<think>still thinking", reasoning: "still thinking", content: ""},
+		{name: "custom tags", text: "[r]why[/r]ok", reasoning: "why", content: "ok"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			openTag, closeTag := "", ""
+			if tc.name == "custom tags" {
+				openTag, closeTag = "[r]", "[/r]"
+			}
+			reasoning, content := SplitReasoningTags(tc.text, openTag, closeTag)
+			if reasoning != tc.reasoning || content != tc.content {
+				t.Fatalf("got reasoning=%q content=%q", reasoning, content)
+			}
+		})
+	}
+}
+
+func TestReasoningTagSplitterStreamsUntaggedTextByDefault(t *testing.T) {
+	splitter := NewReasoningTagSplitter("", "")
+	for _, chunk := range []string{"Hello, ", "this is a ", "normal answer."} {
+		if reasoning, content := splitter.Feed(chunk); reasoning != "" || content != chunk {
+			t.Fatalf("chunk %q should stream right away, got reasoning=%q content=%q", chunk, reasoning, content)
+		}
+	}
+}
+
+func TestReasoningTagSplitterCloseWithoutOpen(t *testing.T) {
+	splitter := NewReasoningTagSplitter("", "")
+	splitter.SetLeadingWindow(64)
+	reasoning, content := "", ""
+	for _, chunk := range []string{"let me ", "think</th", "ink>\n\nanswer"} {
+		r, c := splitter.Feed(chunk)
+		if c != "" && reasoning+r == "" {
+			t.Fatalf("leading text must be held back until a tag decides it, got content %q", c)
+		}
+		reasoning += r
+		content += c
+	}
+	r, c := splitter.Flush()
+	reasoning += r
+	content += c
+	if reasoning != "let me think" || content != "answer" {
+		t.Fatalf("got reasoning=%q content=%q", reasoning, content)
+	}
+
+	if reasoning, content := SplitReasoningTags("plan</think>answer <think>more</think>done", "", ""); reasoning != "planmore" || content != "answer done" {
+		t.Fatalf("got reasoning=%q content=%q", reasoning, content)
+	}
+
+	windowed := NewReasoningTagSplitter("", "")
+	windowed.SetLeadingWindow(4)
+	if _, c := windowed.Feed("plain answer"); c != "plain answer" {
+		t.Fatalf("text past the leading window should stream as content, got %q", c)
+	}
+	if r, c := windowed.Feed(" then </think>"); r != "" || c != " then </think>" {
+		t.Fatalf("a late close tag without an opener stays content, got reasoning=%q content=%q", r, c)
+	}
+}
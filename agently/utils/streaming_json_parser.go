@@ -18,6 +18,7 @@ type StreamingJSONParser struct {
 	fieldCompletion      map[string]struct{}
 	expectedFieldOrder   []string
 	allPossibleFieldPath map[string]struct{}
+	repairMode           JSONRepairMode
 }
 
 func NewStreamingJSONParser(schema map[string]any) *StreamingJSONParser {
@@ -35,13 +36,20 @@ func NewStreamingJSONParser(schema map[string]any) *StreamingJSONParser {
 		fieldCompletion:      map[string]struct{}{},
 		expectedFieldOrder:   orders,
 		allPossibleFieldPath: all,
+		repairMode:           JSONRepairLenient,
 	}
 }
 
+// SetRepairMode changes how chunks are repaired before being decoded. The
+// repairs are not reported: partial chunks are repaired again on every call.
+func (s *StreamingJSONParser) SetRepairMode(mode JSONRepairMode) *StreamingJSONParser {
+	s.repairMode = mode
+	return s
+}
+
 func (s *StreamingJSONParser) ParseChunk(chunk string) ([]types.StreamingData, error) {
 	s.completer.Append(chunk)
-	completedJSON := s.completer.Complete()
-	located := LocateOutputJSON(completedJSON, s.schema)
+	located, _ := LocateRepairedOutputJSON(s.completer.buffer, s.schema, s.repairMode)
 	if located == "" {
 		return nil, nil
 	}
@@ -93,39 +101,47 @@ func (s *StreamingJSONParser) ParseStream(ctx context.Context, chunkStream <-cha
 
 func (s *StreamingJSONParser) Finalize() []types.StreamingData {
 	out := make([]types.StreamingData, 0)
-	var walk func(value any, path []any)
-	walk = func(value any, path []any) {
-		currentPath := BuildDotPath(path)
-		if currentPath != "" {
-			if _, ok := s.fieldCompletion[currentPath]; !ok {
-				evt := types.StreamingData{
-					Path:       currentPath,
-					Value:      deepCopyAny(value),
-					IsComplete: true,
-					EventType:  types.StreamEventDone,
-					FullData:   deepCopyAny(s.currentData),
-				}
-				evt.WildcardPath, evt.Indexes = toWildcard(evt.Path)
-				s.fieldCompletion[currentPath] = struct{}{}
-				out = append(out, evt)
+	completeStreamingData(s.currentData, []any{}, s.currentData, s.fieldCompletion, &out)
+	return out
+}
+
+func (s *StreamingJSONParser) compareAndGenerate(current, previous any, path []any, out *[]types.StreamingData) {
+	diffStreamingData(current, previous, path, s.currentData, out)
+}
+
+// completeStreamingData emits done events for value and every nested path that
+// has not been marked in completed yet.
+func completeStreamingData(value any, path []any, fullData any, completed map[string]struct{}, out *[]types.StreamingData) {
+	currentPath := BuildDotPath(path)
+	if currentPath != "" {
+		if _, ok := completed[currentPath]; !ok {
+			evt := types.StreamingData{
+				Path:       currentPath,
+				Value:      deepCopyAny(value),
+				IsComplete: true,
+				EventType:  types.StreamEventDone,
+				FullData:   deepCopyAny(fullData),
 			}
+			evt.WildcardPath, evt.Indexes = toWildcard(evt.Path)
+			completed[currentPath] = struct{}{}
+			*out = append(*out, evt)
 		}
-		switch typed := value.(type) {
-		case map[string]any:
-			for k, v := range typed {
-				walk(v, append(path, k))
-			}
-		case []any:
-			for i, v := range typed {
-				walk(v, append(path, i))
-			}
+	}
+	switch typed := value.(type) {
+	case map[string]any:
+		for k, v := range typed {
+			completeStreamingData(v, append(path, k), fullData, completed, out)
+		}
+	case []any:
+		for i, v := range typed {
+			completeStreamingData(v, append(path, i), fullData, completed, out)
 		}
 	}
-	walk(s.currentData, []any{})
-	return out
 }
 
-func (s *StreamingJSONParser) compareAndGenerate(current, previous any, path []any, out *[]types.StreamingData) {
+// diffStreamingData emits delta events for every leaf that changed between
+// previous and current.
+func diffStreamingData(current, previous any, path []any, fullData any, out *[]types.StreamingData) {
 	currentPath := BuildDotPath(path)
 	switch curr := current.(type) {
 	case string:
@@ -142,7 +158,7 @@ func (s *StreamingJSONParser) compareAndGenerate(current, previous any, path []a
 					Delta:      delta,
 					IsComplete: false,
 					EventType:  types.StreamEventDelta,
-					FullData:   deepCopyAny(s.currentData),
+					FullData:   deepCopyAny(fullData),
 				}
 				evt.WildcardPath, evt.Indexes = toWildcard(evt.Path)
 				*out = append(*out, evt)
@@ -151,7 +167,7 @@ func (s *StreamingJSONParser) compareAndGenerate(current, previous any, path []a
 	case map[string]any:
 		prevMap, _ := previous.(map[string]any)
 		for k, v := range curr {
-			s.compareAndGenerate(v, prevMap[k], append(path, k), out)
+			diffStreamingData(v, prevMap[k], append(path, k), fullData, out)
 		}
 	case []any:
 		prevList, _ := previous.([]any)
@@ -160,7 +176,7 @@ func (s *StreamingJSONParser) compareAndGenerate(current, previous any, path []a
 			if i < len(prevList) {
 				prevVal = prevList[i]
 			}
-			s.compareAndGenerate(v, prevVal, append(path, i), out)
+			diffStreamingData(v, prevVal, append(path, i), fullData, out)
 		}
 	default:
 		if !reflect.DeepEqual(current, previous) && currentPath != "" {
@@ -170,7 +186,7 @@ func (s *StreamingJSONParser) compareAndGenerate(current, previous any, path []a
 				Delta:      anyToString(current),
 				IsComplete: false,
 				EventType:  types.StreamEventDelta,
-				FullData:   deepCopyAny(s.currentData),
+				FullData:   deepCopyAny(fullData),
 			}
 			evt.WildcardPath, evt.Indexes = toWildcard(evt.Path)
 			*out = append(*out, evt)
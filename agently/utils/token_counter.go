@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// TokenCounter counts how many tokens a text costs in a model context.
+type TokenCounter interface {
+	CountTokens(text string) int
+}
+
+// HeuristicTokenCounter estimates tokens without a vocabulary. It follows the
+// shape of common BPE vocabularies: about four characters per token for
+// words and numbers, one token per punctuation mark and one per CJK character.
+type HeuristicTokenCounter struct{}
+
+func (HeuristicTokenCounter) CountTokens(text string) int {
+	tokens := 0
+	word := 0
+	flush := func() {
+		if word > 0 {
+			tokens += int(math.Ceil(float64(word) / 4))
+			word = 0
+		}
+	}
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flush()
+			tokens++
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// bpePretokenizer splits text the way GPT style vocabularies were trained:
+// contractions, words with their leading space, short digit runs,
+// punctuation runs and whitespace.
+var bpePretokenizer = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)| ?\p{L}+| ?\p{N}{1,3}| ?[^\s\p{L}\p{N}]+|\s+`)
+
+// BPETokenCounter counts tokens with a byte-level BPE vocabulary, offline.
+type BPETokenCounter struct {
+	ranks map[string]int
+
+	mu    sync.Mutex
+	cache map[string]int
+}
+
+// NewBPETokenCounter creates a counter from merge ranks: byte sequences
+// mapped to their rank, lower ranks merging first.
+func NewBPETokenCounter(ranks map[string]int) *BPETokenCounter {
+	return &BPETokenCounter{ranks: ranks, cache: map[string]int{}}
+}
+
+// LoadBPETokenCounter reads a vocabulary in the tiktoken format, one
+// "<base64 token> <rank>" pair per line, such as cl100k_base.tiktoken.
+func LoadBPETokenCounter(path string) (*BPETokenCounter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ranks := map[string]int{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("bpe vocab %s line %d: expected token and rank", path, line)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("bpe vocab %s line %d: %w", path, line, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("bpe vocab %s line %d: %w", path, line, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("bpe vocab %s is empty", path)
+	}
+	return NewBPETokenCounter(ranks), nil
+}
+
+func (c *BPETokenCounter) CountTokens(text string) int {
+	tokens := 0
+	for _, piece := range bpePretokenizer.FindAllString(text, -1) {
+		tokens += c.countPiece(piece)
+	}
+	return tokens
+}
+
+func (c *BPETokenCounter) countPiece(piece string) int {
+	if _, ok := c.ranks[piece]; ok {
+		return 1
+	}
+	c.mu.Lock()
+	count, ok := c.cache[piece]
+	c.mu.Unlock()
+	if ok {
+		return count
+	}
+	count = len(c.merge(piece))
+	c.mu.Lock()
+	if len(c.cache) > 10000 {
+		c.cache = map[string]int{}
+	}
+	c.cache[piece] = count
+	c.mu.Unlock()
+	return count
+}
+
+// merge applies byte pair merges to piece, lowest rank first, and returns the
+// resulting parts.
+func (c *BPETokenCounter) merge(piece string) []string {
+	parts := make([]string, len(piece))
+	for i := 0; i < len(piece); i++ {
+		parts[i] = piece[i : i+1]
+	}
+	for len(parts) > 1 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+1 < len(parts); i++ {
+			if rank, ok := c.ranks[parts[i]+parts[i+1]]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return parts
+}
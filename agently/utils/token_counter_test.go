@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHeuristicTokenCounter(t *testing.T) {
+	counter := HeuristicTokenCounter{}
+	cases := map[string]int{
+		"":               0,
+		"Hello, world!":  6,
+		"你好世界":           4,
+		"tokens 12345  ": 4,
+		"Go 语言":          3,
+	}
+	for text, want := range cases {
+		if got := counter.CountTokens(text); got != want {
+			t.Fatalf("CountTokens(%q)=%d, want %d", text, got, want)
+		}
+	}
+}
+
+func TestBPETokenCounterLoadsTiktokenVocab(t *testing.T) {
+	ranks := []string{"a", "b", " ", "ab", "abab"}
+	lines := make([]string, 0, len(ranks))
+	for rank, token := range ranks {
+		lines = append(lines, fmt.Sprintf("%s %d", base64.StdEncoding.EncodeToString([]byte(token)), rank))
+	}
+	path := filepath.Join(t.TempDir(), "tiny.tiktoken")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatalf("write vocab: %v", err)
+	}
+
+	counter, err := LoadBPETokenCounter(path)
+	if err != nil {
+		t.Fatalf("LoadBPETokenCounter failed: %v", err)
+	}
+	// "abab" merges into one token; " ab" has no " a" merge, so it stays " " + "ab".
+	if got := counter.CountTokens("abab ab"); got != 3 {
+		t.Fatalf("CountTokens=%d, want 3", got)
+	}
+	// Bytes missing from the vocabulary count one token each.
+	if got := counter.CountTokens("xyz"); got != 3 {
+		t.Fatalf("CountTokens(unknown bytes)=%d, want 3", got)
+	}
+
+	if err := os.WriteFile(path, []byte("not-a-pair\n"), 0o644); err != nil {
+		t.Fatalf("write vocab: %v", err)
+	}
+	if _, err := LoadBPETokenCounter(path); err == nil {
+		t.Fatalf("expected malformed vocab to fail")
+	}
+}
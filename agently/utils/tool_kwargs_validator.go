@@ -0,0 +1,329 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+)
+
+// KwargsError reports kwargs that do not match a tool's ToolInfo.Kwargs. Its
+// message is written for the model, so it can be fed back as a tool result.
+type KwargsError struct {
+	Tool   string
+	Issues []types.ToolKwargIssue
+}
+
+func (e *KwargsError) Error() string {
+	missing := make([]string, 0)
+	parts := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		switch issue.Problem {
+		case types.KwargProblemMissing:
+			missing = append(missing, issue.Kwarg)
+		case types.KwargProblemEnum:
+			parts = append(parts, fmt.Sprintf("kwarg %q: expected one of %s, got %s", issue.Kwarg, compactJSON(issue.Expected), compactJSON(issue.Got)))
+		default:
+			parts = append(parts, fmt.Sprintf("kwarg %q: expected %v, got %v", issue.Kwarg, issue.Expected, issue.Got))
+		}
+	}
+	if len(missing) > 0 {
+		parts = append([]string{"missing required kwargs: " + strings.Join(missing, ", ")}, parts...)
+	}
+	prefix := "invalid kwargs"
+	if e.Tool != "" {
+		prefix = "invalid kwargs for tool " + e.Tool
+	}
+	return prefix + ": " + strings.Join(parts, "; ")
+}
+
+// ValidateKwargs checks kwargs against a ToolInfo.Kwargs spec: required keys,
+// types (recursing into objects and arrays) and enums. Unknown kwargs and
+// free-form type names are left alone. With coerce, defaults are filled in and unambiguous mismatches are
+// converted, e.g. "3" for an integer or 3 for a string.
+//
+// It returns the kwargs to call the tool with (a copy when anything was
+// coerced) or a *KwargsError.
+func ValidateKwargs(spec map[string]any, kwargs map[string]any, coerce bool) (map[string]any, error) {
+	if kwargs == nil {
+		kwargs = map[string]any{}
+	}
+	if len(spec) == 0 {
+		return kwargs, nil
+	}
+	v := &kwargsValidator{coerce: coerce}
+	out, _ := v.object(kwargSchemaBuilder{unknownAsAny: true}.object(spec), kwargs, "").(map[string]any)
+	if len(v.issues) > 0 {
+		return nil, &KwargsError{Issues: v.issues}
+	}
+	return out, nil
+}
+
+type kwargsValidator struct {
+	coerce bool
+	issues []types.ToolKwargIssue
+}
+
+func (v *kwargsValidator) fail(path string, problem string, expected any, got any) {
+	v.issues = append(v.issues, types.ToolKwargIssue{Kwarg: path, Problem: problem, Expected: expected, Got: got})
+}
+
+func (v *kwargsValidator) object(schema map[string]any, value map[string]any, path string) any {
+	properties, _ := schema["properties"].(map[string]any)
+	out := make(map[string]any, len(value))
+	for key, item := range value {
+		out[key] = item
+	}
+	required := map[string]bool{}
+	if names, ok := schema["required"].([]string); ok {
+		for _, name := range names {
+			required[name] = true
+		}
+	}
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		propertySchema, _ := properties[name].(map[string]any)
+		item, present := value[name]
+		if !present || item == nil {
+			if fallback, ok := propertySchema["default"]; ok && v.coerce {
+				out[name] = fallback
+				continue
+			}
+			if required[name] {
+				v.fail(joinKwargPath(path, name), types.KwargProblemMissing, schemaTypeName(propertySchema), nil)
+			}
+			continue
+		}
+		out[name] = v.value(propertySchema, item, joinKwargPath(path, name))
+	}
+	return out
+}
+
+func (v *kwargsValidator) value(schema map[string]any, value any, path string) any {
+	expected, _ := schema["type"].(string)
+	if expected != "" && !matchesJSONType(expected, value) {
+		coerced, ok := value, false
+		if v.coerce {
+			coerced, ok = coerceJSONValue(expected, value)
+		}
+		if !ok {
+			v.fail(path, types.KwargProblemType, expected, jsonTypeName(value))
+			return value
+		}
+		value = coerced
+	}
+	if enum, ok := toAnySlice(schema["enum"]); ok && len(enum) > 0 && !enumContains(enum, value) {
+		v.fail(path, types.KwargProblemEnum, enum, value)
+		return value
+	}
+	switch expected {
+	case "object":
+		if _, ok := schema["properties"].(map[string]any); ok {
+			if object, ok := toStringMap(value); ok {
+				return v.object(schema, object, path)
+			}
+		}
+	case "array":
+		items, _ := schema["items"].(map[string]any)
+		list, ok := toAnySlice(value)
+		if !ok || len(items) == 0 {
+			return value
+		}
+		out := make([]any, len(list))
+		for i, item := range list {
+			out[i] = v.value(items, item, fmt.Sprintf("%s[%d]", path, i))
+		}
+		return out
+	}
+	return value
+}
+
+func joinKwargPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func schemaTypeName(schema map[string]any) any {
+	if name, ok := schema["type"].(string); ok {
+		return name
+	}
+	return "any"
+}
+
+func matchesJSONType(expected string, value any) bool {
+	switch expected {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := toJSONNumber(value)
+		return ok
+	case "integer":
+		number, ok := toJSONNumber(value)
+		return ok && number == math.Trunc(number)
+	case "array":
+		_, ok := toAnySlice(value)
+		return ok
+	case "object":
+		_, ok := toStringMap(value)
+		return ok
+	}
+	return true
+}
+
+// coerceJSONValue converts value to the expected JSON type when the intent is
+// unambiguous.
+func coerceJSONValue(expected string, value any) (any, bool) {
+	text, isText := value.(string)
+	text = strings.TrimSpace(text)
+	switch expected {
+	case "number", "integer":
+		if !isText {
+			return nil, false
+		}
+		number, err := strconv.ParseFloat(text, 64)
+		if err != nil || (expected == "integer" && number != math.Trunc(number)) {
+			return nil, false
+		}
+		return number, true
+	case "boolean":
+		if !isText {
+			return nil, false
+		}
+		b, err := strconv.ParseBool(strings.ToLower(text))
+		return b, err == nil
+	case "string":
+		switch typed := value.(type) {
+		case float64, float32, int, int64, int32, bool:
+			return fmt.Sprint(typed), true
+		}
+	case "array", "object":
+		if isText && text != "" {
+			var decoded any
+			if err := json.Unmarshal([]byte(text), &decoded); err == nil && matchesJSONType(expected, decoded) {
+				return decoded, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func jsonTypeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	if _, ok := toJSONNumber(value); ok {
+		return "number"
+	}
+	if _, ok := toAnySlice(value); ok {
+		return "array"
+	}
+	if _, ok := toStringMap(value); ok {
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func toJSONNumber(value any) (float64, bool) {
+	switch typed := value.(type) {
+	case float64:
+		return typed, true
+	case float32:
+		return float64(typed), true
+	case int:
+		return float64(typed), true
+	case int8:
+		return float64(typed), true
+	case int16:
+		return float64(typed), true
+	case int32:
+		return float64(typed), true
+	case int64:
+		return float64(typed), true
+	case uint:
+		return float64(typed), true
+	case uint8:
+		return float64(typed), true
+	case uint16:
+		return float64(typed), true
+	case uint32:
+		return float64(typed), true
+	case uint64:
+		return float64(typed), true
+	case json.Number:
+		number, err := typed.Float64()
+		return number, err == nil
+	}
+	return 0, false
+}
+
+func toAnySlice(value any) ([]any, bool) {
+	if list, ok := value.([]any); ok {
+		return list, true
+	}
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	out := make([]any, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+	return out, true
+}
+
+func toStringMap(value any) (map[string]any, bool) {
+	if object, ok := value.(map[string]any); ok {
+		return object, true
+	}
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() || rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	out := make(map[string]any, rv.Len())
+	for _, key := range rv.MapKeys() {
+		out[key.String()] = rv.MapIndex(key).Interface()
+	}
+	return out, true
+}
+
+func enumContains(enum []any, value any) bool {
+	for _, candidate := range enum {
+		if reflect.DeepEqual(candidate, value) {
+			return true
+		}
+		a, aok := toJSONNumber(candidate)
+		b, bok := toJSONNumber(value)
+		if aok && bok && a == b {
+			return true
+		}
+	}
+	return false
+}
+
+func compactJSON(value any) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
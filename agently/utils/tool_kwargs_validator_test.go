@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+)
+
+func TestValidateKwargsReportsEveryIssue(t *testing.T) {
+	spec := map[string]any{
+		"city":  types.OutputTuple{"string", "city name"},
+		"days":  "integer",
+		"unit":  map[string]any{"type": "string", "enum": []any{"celsius", "fahrenheit"}, "default": "celsius"},
+		"tags":  "[]string",
+		"note":  "free-form text, any shape",
+		"range": map[string]any{"min": "number", "max": map[string]any{"type": "number", "required": false}},
+	}
+	_, err := ValidateKwargs(spec, map[string]any{
+		"days":  2.5,
+		"unit":  "kelvin",
+		"tags":  []any{"a", 3},
+		"note":  map[string]any{"anything": true},
+		"range": map[string]any{"max": "ten"},
+		"extra": "ignored",
+	}, false)
+	var kwargsErr *KwargsError
+	if !errors.As(err, &kwargsErr) {
+		t.Fatalf("expected *KwargsError, got %v", err)
+	}
+	got := map[string]string{}
+	for _, issue := range kwargsErr.Issues {
+		got[issue.Kwarg] = issue.Problem
+	}
+	want := map[string]string{
+		"city":      types.KwargProblemMissing,
+		"days":      types.KwargProblemType,
+		"unit":      types.KwargProblemEnum,
+		"tags[1]":   types.KwargProblemType,
+		"range.min": types.KwargProblemMissing,
+		"range.max": types.KwargProblemType,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected issues: %#v", kwargsErr.Issues)
+	}
+	message := err.Error()
+	for _, part := range []string{
+		"missing required kwargs: city, range.min",
+		`kwarg "days": expected integer, got number`,
+		`kwarg "unit": expected one of ["celsius","fahrenheit"], got "kelvin"`,
+	} {
+		if !strings.Contains(message, part) {
+			t.Fatalf("message %q should contain %q", message, part)
+		}
+	}
+}
+
+func TestValidateKwargsCoercion(t *testing.T) {
+	spec := map[string]any{
+		"count":  "int",
+		"ratio":  "number",
+		"dry":    "bool",
+		"label":  "string",
+		"ids":    "[]integer",
+		"unit":   map[string]any{"type": "string", "default": "celsius"},
+		"filter": "object",
+	}
+	kwargs := map[string]any{
+		"count":  "3",
+		"ratio":  " 0.5 ",
+		"dry":    "TRUE",
+		"label":  42.0,
+		"ids":    `[1, 2]`,
+		"filter": `{"a": 1}`,
+	}
+	if _, err := ValidateKwargs(spec, kwargs, false); err == nil {
+		t.Fatalf("mismatches should fail without coercion")
+	}
+	out, err := ValidateKwargs(spec, kwargs, true)
+	if err != nil {
+		t.Fatalf("coercion failed: %v", err)
+	}
+	want := map[string]any{
+		"count":  3.0,
+		"ratio":  0.5,
+		"dry":    true,
+		"label":  "42",
+		"ids":    []any{1.0, 2.0},
+		"unit":   "celsius",
+		"filter": map[string]any{"a": 1.0},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("unexpected coerced kwargs: %#v", out)
+	}
+	if kwargs["count"] != "3" {
+		t.Fatalf("the caller's kwargs must not be modified")
+	}
+	if _, err := ValidateKwargs(spec, map[string]any{"count": "3.5"}, true); err == nil {
+		t.Fatalf("non-integral strings must not coerce to integer")
+	}
+}
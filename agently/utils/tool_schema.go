@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/AgentEra/Agently-Go/agently/types"
+)
+
+// KwargsToJSONSchema converts ToolInfo.Kwargs into a JSON Schema object
+// usable as provider-native tool parameters.
+//
+// Each kwarg may be a type name ("string", "number", "[]string", ...), a
+// (type, desc) tuple as types.OutputTuple or []any, a nested kwargs map, or a
+// map that already carries schema-like fields ("type"/"$type", "desc"/
+// "description", "enum", "default", "required"). Kwargs are required unless
+// they declare a default or `required: false`.
+func KwargsToJSONSchema(kwargs map[string]any) map[string]any {
+	return kwargSchemaBuilder{}.object(kwargs)
+}
+
+// kwargSchemaBuilder converts kwargs specs. Type names it does not know become
+// described strings for providers; validation sets unknownAsAny instead so a
+// free-form type description never rejects a value.
+type kwargSchemaBuilder struct {
+	unknownAsAny bool
+}
+
+func (b kwargSchemaBuilder) object(kwargs map[string]any) map[string]any {
+	properties := map[string]any{}
+	required := make([]string, 0, len(kwargs))
+	for name, spec := range kwargs {
+		schema, isRequired := b.spec(spec)
+		properties[name] = schema
+		if isRequired {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// ToolInfoToOpenAITool renders info in the OpenAI-compatible `tools` format.
+func ToolInfoToOpenAITool(info types.ToolInfo) map[string]any {
+	return map[string]any{
+		"type": "function",
+		"function": map[string]any{
+			"name":        info.Name,
+			"description": info.Desc,
+			"parameters":  KwargsToJSONSchema(info.Kwargs),
+		},
+	}
+}
+
+func (b kwargSchemaBuilder) spec(spec any) (map[string]any, bool) {
+	switch typed := spec.(type) {
+	case types.OutputTuple:
+		return b.tuple([]any(typed))
+	case []any:
+		if len(typed) >= 1 && len(typed) <= 2 {
+			if _, ok := typed[0].(string); ok {
+				return b.tuple(typed)
+			}
+		}
+		item := map[string]any{"type": "string"}
+		if len(typed) > 0 {
+			item, _ = b.spec(typed[0])
+		}
+		return map[string]any{"type": "array", "items": item}, true
+	case string:
+		return b.typeName(typed), true
+	case map[string]any:
+		return b.mapSpec(typed)
+	case nil:
+		return map[string]any{}, true
+	default:
+		return b.typeName(fmt.Sprint(typed)), true
+	}
+}
+
+func (b kwargSchemaBuilder) tuple(tuple []any) (map[string]any, bool) {
+	if len(tuple) == 0 {
+		return map[string]any{}, true
+	}
+	schema, required := b.spec(tuple[0])
+	if len(tuple) > 1 {
+		if desc := strings.TrimSpace(fmt.Sprint(tuple[1])); desc != "" && desc != "<nil>" {
+			schema["description"] = desc
+		}
+	}
+	return schema, required
+}
+
+func (b kwargSchemaBuilder) mapSpec(spec map[string]any) (map[string]any, bool) {
+	typeValue, hasType := spec["type"]
+	if !hasType {
+		typeValue, hasType = spec["$type"]
+	}
+	if !hasType {
+		// A nested kwargs map describes an object.
+		return b.object(spec), true
+	}
+	var schema map[string]any
+	switch typed := typeValue.(type) {
+	case string:
+		schema = b.typeName(typed)
+	default:
+		schema, _ = b.spec(typed)
+	}
+	required := true
+	for key, value := range spec {
+		switch key {
+		case "type", "$type":
+		case "desc", "$desc", "description":
+			if desc := strings.TrimSpace(fmt.Sprint(value)); desc != "" {
+				schema["description"] = desc
+			}
+		case "default":
+			schema["default"] = value
+			required = false
+		case "required":
+			if b, ok := value.(bool); ok {
+				required = b
+			}
+		case "optional":
+			if b, ok := value.(bool); ok && b {
+				required = false
+			}
+		default:
+			schema[key] = value
+		}
+	}
+	return schema, required
+}
+
+func (b kwargSchemaBuilder) typeName(name string) map[string]any {
+	normalized := strings.ToLower(strings.TrimSpace(name))
+	if strings.HasPrefix(normalized, "[]") {
+		return map[string]any{"type": "array", "items": b.typeName(normalized[2:])}
+	}
+	if strings.HasPrefix(normalized, "list[") && strings.HasSuffix(normalized, "]") {
+		return map[string]any{"type": "array", "items": b.typeName(normalized[5 : len(normalized)-1])}
+	}
+	switch normalized {
+	case "str", "string", "text":
+		return map[string]any{"type": "string"}
+	case "int", "integer", "int64", "int32":
+		return map[string]any{"type": "integer"}
+	case "number", "float", "float64", "float32", "double":
+		return map[string]any{"type": "number"}
+	case "bool", "boolean":
+		return map[string]any{"type": "boolean"}
+	case "list", "array", "slice":
+		return map[string]any{"type": "array"}
+	case "dict", "object", "map":
+		return map[string]any{"type": "object"}
+	case "", "any":
+		return map[string]any{}
+	default:
+		if b.unknownAsAny {
+			return map[string]any{"description": name}
+		}
+		return map[string]any{"type": "string", "description": name}
+	}
+}
+
+// JSONSchemaToKwargs converts a JSON Schema object (as published by MCP
+// servers) into ToolInfo.Kwargs. It is the inverse of KwargsToJSONSchema for
+// the subset both understand; unknown schema keywords are kept on the kwarg.
+func JSONSchemaToKwargs(schema map[string]any) map[string]any {
+	kwargs := map[string]any{}
+	properties, _ := schema["properties"].(map[string]any)
+	required := map[string]struct{}{}
+	switch names := schema["required"].(type) {
+	case []any:
+		for _, name := range names {
+			required[fmt.Sprint(name)] = struct{}{}
+		}
+	case []string:
+		for _, name := range names {
+			required[name] = struct{}{}
+		}
+	}
+	for name, raw := range properties {
+		property, _ := raw.(map[string]any)
+		spec := jsonSchemaPropertyToKwarg(property)
+		_, isRequired := required[name]
+		spec["required"] = isRequired
+		kwargs[name] = spec
+	}
+	return kwargs
+}
+
+func jsonSchemaPropertyToKwarg(property map[string]any) map[string]any {
+	spec := map[string]any{"type": jsonSchemaTypeToKwargType(property)}
+	for key, value := range property {
+		switch key {
+		case "type", "properties", "items", "required":
+		case "description":
+			spec["desc"] = value
+		default:
+			spec[key] = value
+		}
+	}
+	return spec
+}
+
+func jsonSchemaTypeToKwargType(property map[string]any) any {
+	typeName := ""
+	switch typed := property["type"].(type) {
+	case string:
+		typeName = typed
+	case []any:
+		// e.g. ["string", "null"]: use the first non-null type.
+		for _, item := range typed {
+			if name := fmt.Sprint(item); name != "null" {
+				typeName = name
+				break
+			}
+		}
+	}
+	switch typeName {
+	case "object":
+		if _, ok := property["properties"].(map[string]any); ok {
+			return JSONSchemaToKwargs(property)
+		}
+		return "object"
+	case "array":
+		items, _ := property["items"].(map[string]any)
+		if items == nil {
+			return "array"
+		}
+		switch item := jsonSchemaTypeToKwargType(items).(type) {
+		case string:
+			if item == "any" {
+				return "array"
+			}
+			return "[]" + item
+		default:
+			return []any{item}
+		}
+	case "":
+		return "any"
+	default:
+		return typeName
+	}
+}
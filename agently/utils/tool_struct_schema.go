@@ -0,0 +1,374 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// StructToKwargs derives ToolInfo.Kwargs from an argument struct type.
+//
+// Field names come from the `json` tag (falling back to the Go name). A field
+// is required unless its json tag has `omitempty`, it is a pointer, or it sets
+// `required:"false"`. Descriptions come from `desc:"..."`, allowed values from
+// `enum:"a,b,c"` and defaults from `default:"..."`. Fields of embedded structs
+// without a json name are promoted, as encoding/json does; those promoted
+// through an embedded pointer are optional.
+func StructToKwargs(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	kwargs := map[string]any{}
+	if t.Kind() != reflect.Struct {
+		return kwargs
+	}
+	for _, field := range structToolFields(t) {
+		spec := map[string]any{"type": goTypeToKwargType(field.Type)}
+		if desc := strings.TrimSpace(field.Tag.Get("desc")); desc != "" {
+			spec["desc"] = desc
+		}
+		if enum := structFieldEnum(field.StructField); enum != nil {
+			spec["enum"] = enum
+		}
+		if value, ok := field.Tag.Lookup("default"); ok {
+			spec["default"] = convertTagValue(value, field.Type)
+		}
+		spec["required"] = field.required()
+		kwargs[structFieldName(field.StructField)] = spec
+	}
+	return kwargs
+}
+
+// GoTypeToReturns describes a tool result type for ToolInfo.Returns: a type
+// name for scalars and slices, a field map for structs.
+func GoTypeToReturns(t reflect.Type) any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		out := map[string]any{}
+		for _, field := range structToolFields(t) {
+			if desc := strings.TrimSpace(field.Tag.Get("desc")); desc != "" {
+				out[structFieldName(field.StructField)] = []any{GoTypeToReturns(field.Type), desc}
+				continue
+			}
+			out[structFieldName(field.StructField)] = GoTypeToReturns(field.Type)
+		}
+		return out
+	}
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		if isStructType(t.Elem()) {
+			return []any{GoTypeToReturns(t.Elem())}
+		}
+	}
+	return goTypeToKwargType(t)
+}
+
+// DecodeKwargs decodes tool kwargs into target, which must be a pointer to an
+// argument struct. Missing required fields, values outside an `enum` and type
+// mismatches are reported by kwarg name; fields of nested structs are checked
+// too, e.g. "filter.min_temp" or "history[0].min_temp".
+func DecodeKwargs(kwargs map[string]any, target any) error {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Pointer || value.IsNil() {
+		return fmt.Errorf("decode target must be a non-nil pointer, got %T", target)
+	}
+	structType := value.Elem().Type()
+	for structType.Kind() == reflect.Pointer {
+		structType = structType.Elem()
+	}
+	if structType.Kind() == reflect.Struct {
+		missing := make([]string, 0)
+		invalid := checkStructKwargs(kwargs, structType, "", &missing)
+		if len(missing) > 0 {
+			return fmt.Errorf("missing required kwargs: %s", strings.Join(missing, ", "))
+		}
+		if invalid != nil {
+			return invalid
+		}
+	}
+
+	if err := applyStructDefaults(value.Elem()); err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(kwargs)
+	if err != nil {
+		return fmt.Errorf("encode kwargs: %w", err)
+	}
+	if err := json.Unmarshal(encoded, target); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return fmt.Errorf("kwarg %q: expected %s, got %s", typeErr.Field, goTypeToKwargType(typeErr.Type), typeErr.Value)
+		}
+		return fmt.Errorf("decode kwargs: %w", err)
+	}
+	return nil
+}
+
+// checkStructKwargs appends the missing required kwargs of t to missing,
+// descending into nested struct objects and lists, and returns the first
+// value outside its enum.
+func checkStructKwargs(kwargs map[string]any, t reflect.Type, prefix string, missing *[]string) error {
+	var invalid error
+	for _, field := range structToolFields(t) {
+		name := prefix + structFieldName(field.StructField)
+		value, ok := kwargs[structFieldName(field.StructField)]
+		if !ok {
+			if _, hasDefault := field.Tag.Lookup("default"); field.required() && !hasDefault {
+				*missing = append(*missing, name)
+			}
+			continue
+		}
+		if err := checkKwargEnum(name, field.StructField, value); err != nil && invalid == nil {
+			invalid = err
+		}
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		var err error
+		switch {
+		case fieldType.Kind() == reflect.Struct:
+			if object, ok := value.(map[string]any); ok {
+				err = checkStructKwargs(object, fieldType, name+".", missing)
+			}
+		case (fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Array) && isStructType(fieldType.Elem()):
+			items, _ := value.([]any)
+			itemType := fieldType.Elem()
+			for itemType.Kind() == reflect.Pointer {
+				itemType = itemType.Elem()
+			}
+			for i, item := range items {
+				if object, ok := item.(map[string]any); ok {
+					if itemErr := checkStructKwargs(object, itemType, fmt.Sprintf("%s[%d].", name, i), missing); itemErr != nil && err == nil {
+						err = itemErr
+					}
+				}
+			}
+		}
+		if err != nil && invalid == nil {
+			invalid = err
+		}
+	}
+	return invalid
+}
+
+// checkKwargEnum reports a value, or an item of a list value, outside the
+// `enum` of field.
+func checkKwargEnum(name string, field reflect.StructField, value any) error {
+	enum := structFieldEnum(field)
+	if enum == nil || value == nil {
+		return nil
+	}
+	values := []any{value}
+	if items, ok := value.([]any); ok {
+		values = items
+	}
+	for _, item := range values {
+		encoded, _ := json.Marshal(item)
+		allowed := false
+		for _, option := range enum {
+			optionEncoded, _ := json.Marshal(option)
+			if bytes.Equal(encoded, optionEncoded) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("kwarg %q: %s is not one of %s", name, encoded, field.Tag.Get("enum"))
+		}
+	}
+	return nil
+}
+
+// structToolField is a field of an argument struct, possibly promoted from an
+// embedded struct; Index is then the full path for FieldByIndex. optional is
+// set when it is promoted through an embedded pointer.
+type structToolField struct {
+	reflect.StructField
+	optional bool
+}
+
+func (f structToolField) required() bool {
+	return !f.optional && structFieldRequired(f.StructField)
+}
+
+func structToolFields(t reflect.Type) []structToolField {
+	return collectStructToolFields(t, map[reflect.Type]bool{})
+}
+
+func collectStructToolFields(t reflect.Type, visiting map[reflect.Type]bool) []structToolField {
+	if visiting[t] {
+		return nil
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	// Like encoding/json, a field declared on t hides promoted fields of the
+	// same name, and the first promoted field of a name wins.
+	taken := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.IsExported() && field.Tag.Get("json") != "-" && !isEmbeddedStruct(field) {
+			taken[structFieldName(field)] = true
+		}
+	}
+	fields := make([]structToolField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("json") == "-" {
+			continue
+		}
+		if isEmbeddedStruct(field) {
+			embedded := field.Type
+			viaPointer := embedded.Kind() == reflect.Pointer
+			if viaPointer && !field.IsExported() {
+				// encoding/json cannot allocate pointers to unexported structs.
+				continue
+			}
+			for embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			for _, promoted := range collectStructToolFields(embedded, visiting) {
+				name := structFieldName(promoted.StructField)
+				if taken[name] {
+					continue
+				}
+				taken[name] = true
+				promoted.Index = append([]int{i}, promoted.Index...)
+				promoted.optional = promoted.optional || viaPointer
+				fields = append(fields, promoted)
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		fields = append(fields, structToolField{StructField: field})
+	}
+	return fields
+}
+
+// isEmbeddedStruct reports an embedded struct without a json name, whose
+// fields are promoted.
+func isEmbeddedStruct(field reflect.StructField) bool {
+	if !field.Anonymous || !isStructType(field.Type) {
+		return false
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return name == ""
+}
+
+func structFieldEnum(field reflect.StructField) []any {
+	enum := field.Tag.Get("enum")
+	if enum == "" {
+		return nil
+	}
+	values := make([]any, 0)
+	for _, value := range strings.Split(enum, ",") {
+		values = append(values, convertTagValue(strings.TrimSpace(value), field.Type))
+	}
+	return values
+}
+
+func structFieldName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" {
+		return name
+	}
+	return field.Name
+}
+
+func structFieldRequired(field reflect.StructField) bool {
+	if value, ok := field.Tag.Lookup("required"); ok {
+		return strings.TrimSpace(value) != "false"
+	}
+	if _, ok := field.Tag.Lookup("default"); ok {
+		return false
+	}
+	_, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if strings.Contains(options, "omitempty") {
+		return false
+	}
+	return field.Type.Kind() != reflect.Pointer
+}
+
+func goTypeToKwargType(t reflect.Type) any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		if isStructType(t.Elem()) {
+			return []any{StructToKwargs(t.Elem())}
+		}
+		item, _ := goTypeToKwargType(t.Elem()).(string)
+		if item == "" || item == "any" {
+			return "array"
+		}
+		return "[]" + item
+	case reflect.Struct:
+		return StructToKwargs(t)
+	case reflect.Map:
+		return "object"
+	default:
+		return "any"
+	}
+}
+
+func isStructType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+func convertTagValue(raw string, t reflect.Type) any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.String {
+		return raw
+	}
+	var decoded any
+	if err := json.Unmarshal([]byte(raw), &decoded); err == nil {
+		return decoded
+	}
+	return raw
+}
+
+// applyStructDefaults fills fields that declare `default:"..."` before kwargs
+// are decoded over them. Each default is decoded by its kwarg name, so fields
+// promoted from embedded structs are reached the way encoding/json does.
+func applyStructDefaults(value reflect.Value) error {
+	t := value.Type()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	for _, field := range structToolFields(t) {
+		raw, ok := field.Tag.Lookup("default")
+		if !ok {
+			continue
+		}
+		name := structFieldName(field.StructField)
+		encoded, _ := json.Marshal(map[string]any{name: convertTagValue(raw, field.Type)})
+		if err := json.Unmarshal(encoded, value.Addr().Interface()); err != nil {
+			return fmt.Errorf("invalid default for kwarg %q: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type weatherFilter struct {
+	MinTemp float64 `json:"min_temp" desc:"lowest temperature"`
+}
+
+type weatherArgs struct {
+	City    string          `json:"city" desc:"city name"`
+	Unit    string          `json:"unit" enum:"celsius,fahrenheit" default:"celsius"`
+	Days    int             `json:"days,omitempty"`
+	Tags    []string        `json:"tags,omitempty"`
+	Filter  *weatherFilter  `json:"filter"`
+	History []weatherFilter `json:"history,omitempty"`
+	secret  string
+}
+
+func TestStructToKwargsSchema(t *testing.T) {
+	kwargs := StructToKwargs(reflect.TypeOf(weatherArgs{}))
+	if _, ok := kwargs["secret"]; ok {
+		t.Fatalf("unexported fields must be skipped: %#v", kwargs)
+	}
+	schema := KwargsToJSONSchema(kwargs)
+	properties := schema["properties"].(map[string]any)
+	city := properties["city"].(map[string]any)
+	if city["type"] != "string" || city["description"] != "city name" {
+		t.Fatalf("unexpected city schema: %#v", city)
+	}
+	unit := properties["unit"].(map[string]any)
+	if !reflect.DeepEqual(unit["enum"], []any{"celsius", "fahrenheit"}) || unit["default"] != "celsius" {
+		t.Fatalf("unexpected unit schema: %#v", unit)
+	}
+	if tags := properties["tags"].(map[string]any); tags["type"] != "array" || tags["items"].(map[string]any)["type"] != "string" {
+		t.Fatalf("unexpected tags schema: %#v", tags)
+	}
+	filter := properties["filter"].(map[string]any)
+	if filter["type"] != "object" || filter["properties"].(map[string]any)["min_temp"].(map[string]any)["type"] != "number" {
+		t.Fatalf("unexpected nested schema: %#v", filter)
+	}
+	if history := properties["history"].(map[string]any); history["type"] != "array" || history["items"].(map[string]any)["type"] != "object" {
+		t.Fatalf("unexpected struct slice schema: %#v", history)
+	}
+	if !reflect.DeepEqual(schema["required"], []string{"city"}) {
+		t.Fatalf("unexpected required list: %#v", schema["required"])
+	}
+}
+
+func TestDecodeKwargs(t *testing.T) {
+	var args weatherArgs
+	if err := DecodeKwargs(map[string]any{"city": "Paris", "days": 3.0, "filter": map[string]any{"min_temp": 1.5}}, &args); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if args.City != "Paris" || args.Days != 3 || args.Unit != "celsius" || args.Filter == nil || args.Filter.MinTemp != 1.5 {
+		t.Fatalf("unexpected decoded args: %#v", args)
+	}
+
+	err := DecodeKwargs(map[string]any{"days": 1}, &weatherArgs{})
+	if err == nil || !strings.Contains(err.Error(), "missing required kwargs: city") {
+		t.Fatalf("expected missing kwarg error, got %v", err)
+	}
+	err = DecodeKwargs(map[string]any{"city": "Paris", "days": "three"}, &weatherArgs{})
+	if err == nil || !strings.Contains(err.Error(), `kwarg "days": expected integer, got string`) {
+		t.Fatalf("expected type error, got %v", err)
+	}
+}
+
+func TestGoTypeToReturns(t *testing.T) {
+	type report struct {
+		Summary string    `json:"summary" desc:"one line"`
+		Highs   []float64 `json:"highs"`
+	}
+	returns := GoTypeToReturns(reflect.TypeOf(&report{}))
+	want := map[string]any{"summary": []any{"string", "one line"}, "highs": "[]number"}
+	if !reflect.DeepEqual(returns, want) {
+		t.Fatalf("unexpected returns: %#v", returns)
+	}
+	if GoTypeToReturns(reflect.TypeOf(0)) != "integer" {
+		t.Fatalf("unexpected scalar returns")
+	}
+}
+
+type commonArgs struct {
+	Locale string `json:"locale" default:"en"`
+	Trace  bool   `json:"trace,omitempty"`
+}
+
+type PagingArgs struct {
+	Page int `json:"page"`
+}
+
+type searchArgs struct {
+	commonArgs
+	*PagingArgs
+	Query string `json:"query"`
+	Trace string `json:"trace" enum:"on,off"`
+}
+
+func TestStructToKwargsPromotesEmbeddedFields(t *testing.T) {
+	kwargs := StructToKwargs(reflect.TypeOf(searchArgs{}))
+	if _, ok := kwargs["commonArgs"]; ok {
+		t.Fatalf("embedded structs must not become kwargs: %#v", kwargs)
+	}
+	schema := KwargsToJSONSchema(kwargs)
+	properties := schema["properties"].(map[string]any)
+	for _, name := range []string{"locale", "page", "query", "trace"} {
+		if _, ok := properties[name]; !ok {
+			t.Fatalf("expected promoted kwarg %q in %#v", name, properties)
+		}
+	}
+	if trace := properties["trace"].(map[string]any); trace["type"] != "string" {
+		t.Fatalf("the outer field must hide the promoted one: %#v", trace)
+	}
+	if !reflect.DeepEqual(schema["required"], []string{"query", "trace"}) {
+		t.Fatalf("unexpected required list: %#v", schema["required"])
+	}
+
+	var args searchArgs
+	if err := DecodeKwargs(map[string]any{"query": "go", "trace": "on", "page": 2}, &args); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if args.Query != "go" || args.Locale != "en" || args.PagingArgs == nil || args.Page != 2 {
+		t.Fatalf("unexpected decoded args: %#v", args)
+	}
+}
+
+func TestDecodeKwargsChecksEnumAndNestedFields(t *testing.T) {
+	err := DecodeKwargs(map[string]any{"city": "Paris", "unit": "kelvin"}, &weatherArgs{})
+	if err == nil || !strings.Contains(err.Error(), `kwarg "unit": "kelvin" is not one of celsius,fahrenheit`) {
+		t.Fatalf("expected enum error, got %v", err)
+	}
+	type nested struct {
+		Filter  weatherFilter   `json:"filter"`
+		History []weatherFilter `json:"history"`
+	}
+	err = DecodeKwargs(map[string]any{"filter": map[string]any{}, "history": []any{map[string]any{"min_temp": 1}, map[string]any{}}}, &nested{})
+	if err == nil || !strings.Contains(err.Error(), "missing required kwargs: filter.min_temp, history[1].min_temp") {
+		t.Fatalf("expected nested missing kwargs, got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AgentEra/Agently-Go/agently/core"
+	"github.com/AgentEra/Agently-Go/agently/types"
+)
+
+// keywordEmbedder embeds texts as keyword counts over vocabulary.
+func keywordEmbedder(vocabulary ...string) core.Embedder {
+	return func(_ context.Context, texts []string) ([][]float64, error) {
+		out := make([][]float64, len(texts))
+		for i, text := range texts {
+			out[i] = make([]float64, len(vocabulary))
+			for j, word := range vocabulary {
+				out[i][j] = float64(strings.Count(strings.ToLower(text), word))
+			}
+		}
+		return out, nil
+	}
+}
+
+func memoryContents(memories []core.Memory) []string {
+	out := make([]string, 0, len(memories))
+	for _, memory := range memories {
+		out = append(out, memory.Content)
+	}
+	return out
+}
+
+func TestMemoryBankRemembersRecallsAndCorrects(t *testing.T) {
+	ctx := context.Background()
+	settings := core.NewDefaultSettings(nil)
+	settings.Set("memory.top_k", 2)
+	settings.Set("memory.min_score", 0.5)
+	embedder := keywordEmbedder("tea", "coffee", "paris", "berlin", "lives", "likes")
+	bank := core.NewMemoryBank(nil, embedder, nil, settings)
+
+	tea, err := bank.Remember(ctx, "user-1", "The user likes tea")
+	if err != nil {
+		t.Fatalf("remember failed: %v", err)
+	}
+	if _, err := bank.Remember(ctx, "user-1", "The user lives in Paris"); err != nil {
+		t.Fatalf("remember failed: %v", err)
+	}
+	if _, err := bank.Remember(ctx, "user-2", "The user likes coffee"); err != nil {
+		t.Fatalf("remember failed: %v", err)
+	}
+
+	// Restating a fact replaces the memory instead of adding one.
+	again, err := bank.Remember(ctx, "user-1", "the user LIKES TEA")
+	if err != nil || again.ID != tea.ID {
+		t.Fatalf("expected the restated fact to merge into %s, got %s err=%v", tea.ID, again.ID, err)
+	}
+	listed, _ := bank.List(ctx, "user-1")
+	if got := memoryContents(listed); !reflect.DeepEqual(got, []string{"the user LIKES TEA", "The user lives in Paris"}) {
+		t.Fatalf("unexpected memories of user-1: %v", got)
+	}
+
+	matches, err := bank.Recall(ctx, "user-1", "what tea does the user drink")
+	if err != nil {
+		t.Fatalf("recall failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0].ID != tea.ID {
+		t.Fatalf("expected only the tea memory above min_score, got %#v", matches)
+	}
+	if matches, _ := bank.Recall(ctx, "user-2", "tea"); len(matches) != 0 {
+		t.Fatalf("memories must not leak across scopes, got %#v", matches)
+	}
+
+	corrected, err := bank.Correct(ctx, "user-1", tea.ID, "The user likes coffee")
+	if err != nil || corrected.ID != tea.ID || !corrected.CreatedAt.Equal(tea.CreatedAt) {
+		t.Fatalf("unexpected correction %#v err=%v", corrected, err)
+	}
+	if matches, _ := bank.Recall(ctx, "user-1", "coffee"); len(matches) != 1 || matches[0].Content != "The user likes coffee" {
+		t.Fatalf("expected the corrected memory to be re-embedded, got %#v", matches)
+	}
+
+	if err := bank.Delete(ctx, "user-1", tea.ID); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := bank.Delete(ctx, "user-1", tea.ID); !errors.Is(err, core.ErrMemoryNotFound) {
+		t.Fatalf("expected ErrMemoryNotFound, got %v", err)
+	}
+	if _, err := bank.Correct(ctx, "user-1", "missing", "x"); !errors.Is(err, core.ErrMemoryNotFound) {
+		t.Fatalf("expected ErrMemoryNotFound, got %v", err)
+	}
+}
+
+func TestMemoryBankMemorizesTurns(t *testing.T) {
+	ctx := context.Background()
+	settings := core.NewDefaultSettings(nil)
+	settings.Set("memory.min_score", 0.1)
+	requests := []core.MemoryExtractionRequest{}
+	extractor := func(_ context.Context, request core.MemoryExtractionRequest) ([]string, error) {
+		requests = append(requests, request)
+		if strings.Contains(core.FormatChatTranscript(request.Messages), "moved") {
+			return []string{"The user lives in Berlin", " "}, nil
+		}
+		return []string{"The user lives in Paris", "The user likes tea"}, nil
+	}
+	bank := core.NewMemoryBank(nil, keywordEmbedder("tea", "user", "live", "paris", "berlin"), extractor, settings)
+
+	memories, err := bank.MemorizeTurn(ctx, "user-1", []types.ChatMessage{
+		{Role: "user", Content: "I live in Paris and drink tea"},
+		{Role: "assistant", Content: "Nice!"},
+	})
+	if err != nil || len(memories) != 2 {
+		t.Fatalf("expected two memories, got %#v err=%v", memories, err)
+	}
+	if requests[0].Prompt != core.DefaultMemoryExtractPrompt || len(requests[0].Known) != 0 {
+		t.Fatalf("unexpected first extraction request %#v", requests[0])
+	}
+
+	settings.Set("memory.merge_score", 0.6)
+	if _, err := bank.MemorizeTurn(ctx, "user-1", []types.ChatMessage{{Role: "user", Content: "I moved, I live in Berlin now"}}); err != nil {
+		t.Fatalf("memorize failed: %v", err)
+	}
+	if got := memoryContents(requests[1].Known); len(got) == 0 || got[0] != "The user lives in Paris" {
+		t.Fatalf("expected the extractor to see the related memory, got %v", got)
+	}
+	listed, _ := bank.List(ctx, "user-1")
+	if got := memoryContents(listed); !reflect.DeepEqual(got, []string{"The user lives in Berlin", "The user likes tea"}) {
+		t.Fatalf("expected the new fact to replace the old one, got %v", got)
+	}
+
+	if _, err := core.NewMemoryBank(nil, nil, nil, nil).Remember(ctx, "user-1", "x"); !errors.Is(err, core.ErrNoMemoryEmbedder) {
+		t.Fatalf("expected ErrNoMemoryEmbedder, got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AgentEra/Agently-Go/agently/core"
+	"github.com/AgentEra/Agently-Go/agently/testkit"
+	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+type endlessRequester struct {
+	canceled chan struct{}
+}
+
+func (r *endlessRequester) GenerateRequestData() (types.RequestData, error) {
+	return types.RequestData{}, nil
+}
+
+func (r *endlessRequester) RequestModel(_ context.Context, _ types.RequestData) (<-chan types.ResponseMessage, error) {
+	out := make(chan types.ResponseMessage)
+	close(out)
+	return out, nil
+}
+
+func (r *endlessRequester) BroadcastResponse(ctx context.Context, _ <-chan types.ResponseMessage) (<-chan types.ResponseMessage, error) {
+	out := make(chan types.ResponseMessage)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case out <- types.ResponseMessage{Event: types.ResponseEventDelta, Data: "tick "}:
+				time.Sleep(time.Millisecond)
+			case <-ctx.Done():
+				close(r.canceled)
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func TestResponseTypedIterators(t *testing.T) {
+	script := func(_ int) []types.ResponseMessage {
+		return []types.ResponseMessage{
+			{Event: types.ResponseEventDelta, Data: `{"foo":`},
+			{Event: types.ResponseEventDelta, Data: `"bar"}`},
+			{Event: types.ResponseEventError, Data: errors.New("upstream hiccup")},
+			{Event: types.ResponseEventDone, Data: `{"foo":"bar"}`},
+		}
+	}
+	newResponse := func() *core.ModelResponse {
+		req := core.NewModelRequest(newRegressionPluginManager(script, nil), "iterators", core.NewDefaultSettings(nil), nil, nil)
+		req.Input("regression")
+		req.Output(map[string]any{"foo": "string"})
+		return req.GetResponse()
+	}
+
+	ctx, cancel := testkit.TestContext(t, 5*time.Second)
+	defer cancel()
+
+	t.Run("deltas", func(t *testing.T) {
+		text := ""
+		var streamErr error
+		for delta, err := range newResponse().Result.Deltas(ctx) {
+			if err != nil {
+				streamErr = err
+				continue
+			}
+			text += delta
+		}
+		if text != `{"foo":"bar"}` {
+			t.Fatalf("unexpected deltas: %q", text)
+		}
+		if streamErr == nil || streamErr.Error() != "upstream hiccup" {
+			t.Fatalf("expected in-band error, got %v", streamErr)
+		}
+	})
+
+	t.Run("instant", func(t *testing.T) {
+		var final *types.StreamingData
+		errCount := 0
+		for data, err := range newResponse().Result.Instant(ctx) {
+			if err != nil {
+				errCount++
+				continue
+			}
+			if data.Path == "foo" && data.IsComplete {
+				item := data
+				final = &item
+			}
+		}
+		if final == nil || final.Value != "bar" {
+			t.Fatalf("expected completed foo event, got %#v", final)
+		}
+		if errCount != 1 {
+			t.Fatalf("expected 1 in-band error, got %d", errCount)
+		}
+	})
+
+	t.Run("events", func(t *testing.T) {
+		seen := map[types.ResponseEvent]int{}
+		for msg, err := range newResponse().Result.Events(ctx, "done") {
+			if msg.Event == types.ResponseEventError && err == nil {
+				t.Fatalf("error event must carry an error value")
+			}
+			seen[msg.Event]++
+		}
+		if seen[types.ResponseEventDone] != 1 || seen[types.ResponseEventError] != 1 || seen[types.ResponseEventDelta] != 0 {
+			t.Fatalf("unexpected filtered events: %#v", seen)
+		}
+	})
+}
+
+func TestResponseIteratorBreakCancelsRequest(t *testing.T) {
+	requester := &endlessRequester{canceled: make(chan struct{})}
+	manager := newRegressionPluginManager(nil, &atomic.Int32{})
+	_ = manager.Register(core.PluginTypeModelRequester, core.PluginSpec{
+		Name: "EndlessRequester",
+		Creator: core.ModelRequesterCreator(func(_ *core.Prompt, _ *utils.Settings) core.ModelRequester {
+			return requester
+		}),
+	}, true)
+
+	req := core.NewModelRequest(manager, "iterators-break", core.NewDefaultSettings(nil), nil, nil)
+	req.Input("regression")
+
+	ctx, cancel := testkit.TestContext(t, 5*time.Second)
+	defer cancel()
+
+	count := 0
+	for _, err := range req.Deltas(ctx) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		count++
+		if count == 3 {
+			break
+		}
+	}
+	select {
+	case <-requester.canceled:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("breaking out of Deltas should cancel the upstream request")
+	}
+}
@@ -1,7 +1,9 @@
 package core_test
 
 import (
+	"context"
 	"fmt"
+	"reflect"
 	"strings"
 	"sync/atomic"
 	"testing"
@@ -10,6 +12,7 @@ import (
 	"github.com/AgentEra/Agently-Go/agently/core"
 	"github.com/AgentEra/Agently-Go/agently/testkit"
 	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
 )
 
 func TestResponseGetDataAndEnsureKeysRetry(t *testing.T) {
@@ -218,3 +221,558 @@ func TestSessionResizeAndSerializeLoad(t *testing.T) {
 		t.Fatalf("LoadYAML context window mismatch")
 	}
 }
+
+type promptCapturingRequester struct {
+	prompt  *core.Prompt
+	counter *atomic.Int32
+	texts   *[]string
+	script  func(call int) string
+}
+
+func (r *promptCapturingRequester) GenerateRequestData() (types.RequestData, error) {
+	return types.RequestData{}, nil
+}
+
+func (r *promptCapturingRequester) RequestModel(_ context.Context, _ types.RequestData) (<-chan types.ResponseMessage, error) {
+	out := make(chan types.ResponseMessage)
+	close(out)
+	return out, nil
+}
+
+func (r *promptCapturingRequester) BroadcastResponse(_ context.Context, _ <-chan types.ResponseMessage) (<-chan types.ResponseMessage, error) {
+	call := int(r.counter.Add(1))
+	text, _ := r.prompt.ToText()
+	*r.texts = append(*r.texts, text)
+	done := r.script(call)
+	out := make(chan types.ResponseMessage, 4)
+	out <- types.ResponseMessage{Event: types.ResponseEventDelta, Data: done}
+	out <- types.ResponseMessage{Event: types.ResponseEventDone, Data: done}
+	close(out)
+	return out, nil
+}
+
+func TestResponseCorrectiveEnsureRetry(t *testing.T) {
+	counter := &atomic.Int32{}
+	texts := make([]string, 0)
+	manager := newRegressionPluginManager(nil, nil)
+	_ = manager.Register(core.PluginTypeModelRequester, core.PluginSpec{
+		Name: "PromptCapturingRequester",
+		Creator: core.ModelRequesterCreator(func(prompt *core.Prompt, _ *utils.Settings) core.ModelRequester {
+			return &promptCapturingRequester{prompt: prompt, counter: counter, texts: &texts, script: func(call int) string {
+				switch call {
+				case 1:
+					return `{"foo":"bar"}`
+				case 2:
+					return `{"foo":"bar","must":"ok","score":200}`
+				default:
+					return `{"foo":"bar","must":"ok","score":80}`
+				}
+			}}
+		}),
+	}, true)
+
+	req := core.NewModelRequest(manager, "corrective", core.NewDefaultSettings(nil), nil, nil)
+	req.Input("regression")
+	req.Output(map[string]any{"foo": "string", "must": "string", "score": "number"})
+	response := req.GetResponse()
+
+	ctx, cancel := testkit.TestContext(t, 5*time.Second)
+	defer cancel()
+
+	data, err := response.Result.GetData(ctx, core.GetDataOptions{
+		Type:       "parsed",
+		EnsureKeys: []string{"must"},
+		MaxRetries: 3,
+		RetryMode:  core.RetryModeCorrective,
+		Validator: func(data any) []core.EnsureIssue {
+			parsed, _ := data.(map[string]any)
+			if score, ok := parsed["score"].(float64); ok && score > 100 {
+				return []core.EnsureIssue{{Path: "score", Reason: "must be between 0 and 100"}}
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("corrective GetData failed: %v", err)
+	}
+	if parsed, _ := data.(map[string]any); parsed["score"] != float64(80) {
+		t.Fatalf("expected corrected score=80, got %#v", data)
+	}
+	if len(texts) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(texts))
+	}
+	if strings.Contains(texts[0], "CORRECTION REQUIRED") {
+		t.Fatalf("first request must not carry correction: %s", texts[0])
+	}
+	if !strings.Contains(texts[1], `{"foo":"bar"}`) || !strings.Contains(texts[1], "- must: missing") {
+		t.Fatalf("second request should carry previous answer and missing key, got:\n%s", texts[1])
+	}
+	if !strings.Contains(texts[2], "- score: must be between 0 and 100") {
+		t.Fatalf("third request should name invalid path, got:\n%s", texts[2])
+	}
+
+	meta, err := response.Result.GetMeta(ctx)
+	if err != nil {
+		t.Fatalf("GetMeta failed: %v", err)
+	}
+	retries, ok := meta["ensure_retries"].([]map[string]any)
+	if !ok || len(retries) != 2 {
+		t.Fatalf("expected 2 retry records in meta, got %#v", meta["ensure_retries"])
+	}
+	if retries[0]["mode"] != core.RetryModeCorrective || retries[0]["correction"] == nil {
+		t.Fatalf("unexpected retry record: %#v", retries[0])
+	}
+}
+
+func TestResponseGetDataObjectRetriesOnValidator(t *testing.T) {
+	counter := &atomic.Int32{}
+	texts := make([]string, 0)
+	manager := newRegressionPluginManager(nil, nil)
+	_ = manager.Register(core.PluginTypeModelRequester, core.PluginSpec{
+		Name: "PromptCapturingRequester",
+		Creator: core.ModelRequesterCreator(func(prompt *core.Prompt, _ *utils.Settings) core.ModelRequester {
+			return &promptCapturingRequester{prompt: prompt, counter: counter, texts: &texts, script: func(call int) string {
+				if call == 1 {
+					return `{"score":200}`
+				}
+				return `{"score":80}`
+			}}
+		}),
+	}, true)
+
+	req := core.NewModelRequest(manager, "validated-object", core.NewDefaultSettings(nil), nil, nil)
+	req.Input("regression")
+	req.Output(map[string]any{"score": "number"})
+	response := req.GetResponse()
+
+	ctx, cancel := testkit.TestContext(t, 5*time.Second)
+	defer cancel()
+
+	object, err := response.Result.GetDataObject(ctx, core.GetDataOptions{
+		Validator: func(data any) []core.EnsureIssue {
+			parsed, _ := data.(map[string]any)
+			if score, ok := parsed["score"].(float64); ok && score > 100 {
+				return []core.EnsureIssue{{Path: "score", Reason: "must be between 0 and 100"}}
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("GetDataObject failed: %v", err)
+	}
+	if len(texts) != 2 {
+		t.Fatalf("a Validator alone should trigger a retry, got %d requests", len(texts))
+	}
+	if parsed, _ := object.(map[string]any); parsed["score"] != float64(80) {
+		t.Fatalf("expected the object of the retried response, got %#v", object)
+	}
+}
+
+func TestResponseSplitsInlineReasoningTags(t *testing.T) {
+	script := func(_ int) []types.ResponseMessage {
+		return []types.ResponseMessage{
+			{Event: types.ResponseEventDelta, Data: "<thi"},
+			{Event: types.ResponseEventDelta, Data: "nk>check the "},
+			{Event: types.ResponseEventDelta, Data: "input</th"},
+			{Event: types.ResponseEventDelta, Data: "ink>\n{\"foo\":"},
+			{Event: types.ResponseEventDelta, Data: "\"bar\"}"},
+			{Event: types.ResponseEventDone, Data: "<think>check the input</think>\n{\"foo\":\"bar\"}"},
+			{Event: types.ResponseEventReasoningDone, Data: ""},
+		}
+	}
+	newResponse := func(settings map[string]any) *core.ModelResponse {
+		req := core.NewModelRequest(newRegressionPluginManager(script, nil), "reasoning-tags", core.NewDefaultSettings(nil), nil, nil)
+		for key, value := range settings {
+			req.Settings().Set(key, value)
+		}
+		req.Input("regression")
+		req.Output(map[string]any{"foo": "string"})
+		return req.GetResponse()
+	}
+
+	ctx, cancel := testkit.TestContext(t, 5*time.Second)
+	defer cancel()
+
+	response := newResponse(nil)
+	stream, err := response.Result.GetGenerator(ctx, "specific", []string{"reasoning_delta", "reasoning_done", "delta"})
+	if err != nil {
+		t.Fatalf("GetGenerator failed: %v", err)
+	}
+	reasoning, deltas, reasoningDone := "", "", ""
+	for item := range stream {
+		msg := item.(types.ResponseMessage)
+		switch msg.Event {
+		case types.ResponseEventReasoning:
+			reasoning += fmt.Sprint(msg.Data)
+		case types.ResponseEventReasoningDone:
+			reasoningDone = fmt.Sprint(msg.Data)
+		case types.ResponseEventDelta:
+			deltas += fmt.Sprint(msg.Data)
+		}
+	}
+	if reasoning != "check the input" || reasoningDone != "check the input" {
+		t.Fatalf("unexpected reasoning stream=%q done=%q", reasoning, reasoningDone)
+	}
+	if deltas != `{"foo":"bar"}` {
+		t.Fatalf("deltas should only carry the answer, got %q", deltas)
+	}
+	text, err := response.Result.GetText(ctx)
+	if err != nil || text != `{"foo":"bar"}` {
+		t.Fatalf("unexpected text=%q err=%v", text, err)
+	}
+	data, err := response.Result.GetData(ctx, core.GetDataOptions{Type: "parsed"})
+	if err != nil {
+		t.Fatalf("GetData failed: %v", err)
+	}
+	if parsed, _ := data.(map[string]any); parsed["foo"] != "bar" {
+		t.Fatalf("unexpected parsed data: %#v", data)
+	}
+
+	disabled := newResponse(map[string]any{"response.reasoning_tags.enabled": false})
+	rawText, err := disabled.Result.GetText(ctx)
+	if err != nil || !strings.HasPrefix(rawText, "<think>") {
+		t.Fatalf("disabled splitter should keep raw text, got %q err=%v", rawText, err)
+	}
+}
+
+func TestResponseSplitsReasoningWithoutOpenTag(t *testing.T) {
+	script := func(_ int) []types.ResponseMessage {
+		return []types.ResponseMessage{
+			{Event: types.ResponseEventDelta, Data: "check the "},
+			{Event: types.ResponseEventDelta, Data: "input</th"},
+			{Event: types.ResponseEventDelta, Data: "ink>\n{\"foo\":\"bar\"}"},
+			{Event: types.ResponseEventDone, Data: "check the input</think>\n{\"foo\":\"bar\"}"},
+		}
+	}
+	run := func(window int) (reasoning string, reasoningDone string, deltas string, text string) {
+		req := core.NewModelRequest(newRegressionPluginManager(script, nil), "reasoning-close-only", core.NewDefaultSettings(nil), nil, nil)
+		req.Settings().Set("response.reasoning_tags.leading_window", window)
+		req.Input("regression")
+		req.Output(map[string]any{"foo": "string"})
+		response := req.GetResponse()
+
+		ctx, cancel := testkit.TestContext(t, 5*time.Second)
+		defer cancel()
+		stream, err := response.Result.GetGenerator(ctx, "specific", []string{"reasoning_delta", "reasoning_done", "delta"})
+		if err != nil {
+			t.Fatalf("GetGenerator failed: %v", err)
+		}
+		for item := range stream {
+			msg := item.(types.ResponseMessage)
+			switch msg.Event {
+			case types.ResponseEventReasoning:
+				reasoning += fmt.Sprint(msg.Data)
+			case types.ResponseEventReasoningDone:
+				reasoningDone = fmt.Sprint(msg.Data)
+			case types.ResponseEventDelta:
+				deltas += fmt.Sprint(msg.Data)
+			}
+		}
+		if text, err = response.Result.GetText(ctx); err != nil {
+			t.Fatalf("GetText failed: %v", err)
+		}
+		return reasoning, reasoningDone, deltas, text
+	}
+
+	reasoning, reasoningDone, deltas, text := run(64)
+	if reasoning != "check the input" || reasoningDone != "check the input" {
+		t.Fatalf("text before an orphan close tag should be reasoning, stream=%q done=%q", reasoning, reasoningDone)
+	}
+	if deltas != `{"foo":"bar"}` || text != deltas {
+		t.Fatalf("deltas and text should only carry the answer, got deltas=%q text=%q", deltas, text)
+	}
+
+	for _, window := range []int{0, 4} {
+		reasoning, _, deltas, text := run(window)
+		if reasoning != "" || !strings.HasPrefix(deltas, "check the input</think>") {
+			t.Fatalf("window %d: leading text should stream as content, got reasoning=%q deltas=%q", window, reasoning, deltas)
+		}
+		if text != deltas {
+			t.Fatalf("window %d: done text %q should match the deltas %q", window, text, deltas)
+		}
+	}
+}
+
+func TestSessionSerializesToolMessages(t *testing.T) {
+	session := core.NewSession("tool-session", false, core.NewDefaultSettings(nil))
+	session.SetChatHistory([]types.ChatMessage{
+		{Role: "user", Content: "3+4?"},
+		{Role: "assistant", ToolCalls: []types.ToolCall{{ID: "call_sum", Name: "sum", Arguments: `{"a":3,"b":4}`}}},
+		{Role: "tool", ToolCallID: "call_sum", Name: "sum", Content: "7"},
+		{Role: "assistant", Content: "7"},
+	})
+	jsonPayload, err := session.ToJSON()
+	if err != nil {
+		t.Fatalf("session ToJSON failed: %v", err)
+	}
+	yamlPayload, err := session.ToYAML()
+	if err != nil {
+		t.Fatalf("session ToYAML failed: %v", err)
+	}
+	fromJSON := core.NewSession("", false, nil)
+	fromYAML := core.NewSession("", false, nil)
+	if err := fromJSON.LoadJSON(jsonPayload); err != nil {
+		t.Fatalf("session LoadJSON failed: %v", err)
+	}
+	if err := fromYAML.LoadYAML(yamlPayload); err != nil {
+		t.Fatalf("session LoadYAML failed: %v", err)
+	}
+	for name, loaded := range map[string]*core.Session{"json": fromJSON, "yaml": fromYAML} {
+		if !reflect.DeepEqual(loaded.FullContext(), session.FullContext()) || !reflect.DeepEqual(loaded.ContextWindow(), session.ContextWindow()) {
+			t.Fatalf("%s round trip lost tool messages: %#v", name, loaded.FullContext())
+		}
+	}
+}
+
+type wordTokenCounter struct{}
+
+func (wordTokenCounter) CountTokens(text string) int { return len(strings.Fields(text)) }
+
+func TestSessionTrimsContextWindowByTokens(t *testing.T) {
+	settings := core.NewDefaultSettings(nil)
+	settings.Set("session.max_tokens", 30)
+	settings.Set("session.reserved_tokens.system", 5)
+	settings.Set("session.reserved_tokens.output", 5)
+	session := core.NewSession("session-tokens", true, settings).SetTokenCounter(wordTokenCounter{})
+
+	// Each message costs 4 tokens of overhead plus its words.
+	session.SetChatHistory([]types.ChatMessage{
+		{Role: "user", Content: "question"},
+		{Role: "assistant", ToolCalls: []types.ToolCall{{ID: "call-1", Name: "sum", Arguments: "{}"}}},
+		{Role: "tool", ToolCallID: "call-1", Content: "3"},
+		{Role: "assistant", Content: "done"},
+		{Role: "user", Content: "next"},
+	})
+
+	window := session.ContextWindow()
+	if len(window) != 2 || window[0].Role != "assistant" || window[0].Content != "done" {
+		t.Fatalf("expected window trimmed to the last two messages without orphan tool results, got %#v", window)
+	}
+	if len(session.FullContext()) != 5 {
+		t.Fatalf("full context should keep every message, got %d", len(session.FullContext()))
+	}
+	tokens, err := session.ContextTokens()
+	if err != nil || tokens != 10 {
+		t.Fatalf("ContextTokens=%d err=%v, want 10", tokens, err)
+	}
+
+	heuristic := core.NewSession("session-heuristic", true, settings)
+	heuristic.SetChatHistory([]types.ChatMessage{
+		{Role: "user", Content: strings.Repeat("你", 40)},
+		{Role: "user", Content: "short"},
+	})
+	if window := heuristic.ContextWindow(); len(window) != 1 || window[0].Content != "short" {
+		t.Fatalf("expected heuristic counter to trim CJK history, got %#v", window)
+	}
+}
+
+func TestSessionSummarizeStrategyFoldsOldTurnsIntoMemo(t *testing.T) {
+	settings := core.NewDefaultSettings(nil)
+	settings.Set("session.max_length", 40)
+	settings.Set("session.resize_strategy", "summarize")
+	settings.Set("session.summarize.keep_messages", 2)
+	settings.Set("session.summarize.max_length", 200)
+	session := core.NewSession("session-summary", true, settings)
+
+	requests := []core.SessionSummaryRequest{}
+	session.SetSummarizer(func(_ context.Context, request core.SessionSummaryRequest) (string, error) {
+		requests = append(requests, request)
+		return fmt.Sprintf("summary-%d", len(requests)), nil
+	})
+
+	session.SetChatHistory([]types.ChatMessage{
+		{Role: "user", Content: strings.Repeat("a", 15)},
+		{Role: "assistant", ToolCalls: []types.ToolCall{{ID: "call-1", Name: "sum", Arguments: "{}"}}},
+		{Role: "tool", ToolCallID: "call-1", Content: strings.Repeat("b", 15)},
+		{Role: "assistant", Content: strings.Repeat("c", 15)},
+	})
+	if len(requests) != 1 {
+		t.Fatalf("expected one summary request, got %d", len(requests))
+	}
+	first := requests[0]
+	if first.Summary != "" || len(first.Messages) != 3 || first.Messages[2].Role != "tool" {
+		t.Fatalf("expected the tool result to be folded with its call, got %#v", first)
+	}
+	if first.Prompt != core.DefaultSessionSummaryPrompt || first.MaxLength != 200 {
+		t.Fatalf("unexpected summary prompt or length: %#v", first)
+	}
+	if window := session.ContextWindow(); len(window) != 1 || window[0].Content != strings.Repeat("c", 15) {
+		t.Fatalf("unexpected window after summarize: %#v", window)
+	}
+	if session.Summary() != "summary-1" {
+		t.Fatalf("expected summary in memo, got %#v", session.Memo())
+	}
+	if len(session.FullContext()) != 4 {
+		t.Fatalf("full context should keep every message, got %d", len(session.FullContext()))
+	}
+
+	session.AddChatHistory([]types.ChatMessage{
+		{Role: "user", Content: strings.Repeat("d", 15)},
+		{Role: "assistant", Content: strings.Repeat("e", 15)},
+	})
+	if len(requests) != 2 || requests[1].Summary != "summary-1" || len(requests[1].Messages) != 1 {
+		t.Fatalf("expected rolling summary over the oldest turn, got %#v", requests)
+	}
+	if session.Summary() != "summary-2" || len(session.ContextWindow()) != 2 {
+		t.Fatalf("unexpected session after second fold: memo=%#v window=%#v", session.Memo(), session.ContextWindow())
+	}
+
+	failing := core.NewSession("session-summary-failing", true, settings)
+	failing.SetChatHistory([]types.ChatMessage{
+		{Role: "user", Content: strings.Repeat("a", 30)},
+		{Role: "assistant", Content: strings.Repeat("b", 30)},
+	})
+	if len(failing.ContextWindow()) != 1 || failing.Memo() != nil {
+		t.Fatalf("expected window trimmed without summary when no summarizer is set, got window=%#v memo=%#v", failing.ContextWindow(), failing.Memo())
+	}
+}
+
+type summaryContextKey struct{}
+
+func TestSessionSummarizerUsesCallerContextAndKeepsMessages(t *testing.T) {
+	settings := core.NewDefaultSettings(nil)
+	settings.Set("session.max_length", 30)
+	settings.Set("session.resize_strategy", "summarize")
+	settings.Set("session.summarize.keep_messages", 3)
+	settings.Set("session.summarize.timeout", 5)
+	session := core.NewSession("session-summary-ctx", true, settings)
+
+	var got context.Context
+	var folded []types.ChatMessage
+	session.SetSummarizer(func(ctx context.Context, request core.SessionSummaryRequest) (string, error) {
+		got, folded = ctx, request.Messages
+		return "summary", ctx.Err()
+	})
+	ctx := context.WithValue(context.Background(), summaryContextKey{}, "caller")
+	session.AddChatHistoryWithContext(ctx, []types.ChatMessage{
+		{Role: "user", Content: "q1"},
+		{Role: "assistant", Content: "a1"},
+		{Role: "user", Content: "q2"},
+		{Role: "assistant", Content: "a2"},
+		{Role: "user", Content: strings.Repeat("x", 24)},
+		{Role: "assistant", Content: "a3"},
+	})
+	if got == nil || got.Value(summaryContextKey{}) != "caller" {
+		t.Fatalf("the summarizer should run with the caller's context")
+	}
+	if _, ok := got.Deadline(); !ok {
+		t.Fatalf("session.summarize.timeout should bound the caller's context")
+	}
+	// keep_messages counts messages: the newest three stay, three are folded.
+	if len(folded) != 3 || len(session.ContextWindow()) != 3 || session.Summary() != "summary" {
+		t.Fatalf("expected 3 messages folded and 3 kept, folded %#v, window %#v", folded, session.ContextWindow())
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	session.AddChatHistoryWithContext(cancelled, []types.ChatMessage{{Role: "user", Content: strings.Repeat("y", 20)}})
+	if session.Summary() != "summary" || len(session.ContextWindow()) > 3 {
+		t.Fatalf("a cancelled summary should keep the previous summary and still trim, got %q %#v", session.Summary(), session.ContextWindow())
+	}
+}
+
+func TestSessionForkRewindAndEdit(t *testing.T) {
+	settings := core.NewDefaultSettings(nil)
+	settings.Set("session.max_length", 25)
+	session := core.NewSession("history", true, settings)
+	session.RegisterExecutionHandler("custom", func(_ []types.ChatMessage, window []types.ChatMessage, _ any, _ *utils.RuntimeDataNamespace) ([]types.ChatMessage, []types.ChatMessage, any, error) {
+		return nil, window, "custom-ran", nil
+	})
+	session.SetChatHistory([]types.ChatMessage{
+		{Role: "user", Content: "q1"},
+		{Role: "assistant", Content: "a1"},
+		{Role: "user", Content: "q2"},
+		{Role: "assistant", ToolCalls: []types.ToolCall{{ID: "call-1", Name: "sum", Arguments: "{}"}}},
+		{Role: "tool", ToolCallID: "call-1", Content: "3"},
+		{Role: "assistant", Content: "a2"},
+		{Role: "user", Content: strings.Repeat("q", 12)},
+		{Role: "assistant", Content: strings.Repeat("a", 12)},
+	})
+	if session.TurnCount() != 3 || len(session.ContextWindow()) != 2 {
+		t.Fatalf("unexpected setup: turns=%d window=%d", session.TurnCount(), len(session.ContextWindow()))
+	}
+
+	fork := session.Fork("history-fork")
+	if fork.ID() != "history-fork" || !reflect.DeepEqual(fork.FullContext(), session.FullContext()) || !reflect.DeepEqual(fork.ContextWindow(), session.ContextWindow()) {
+		t.Fatalf("fork should copy the current state")
+	}
+	if err := fork.ExecuteStrategy("custom"); err != nil || fork.Memo() != "custom-ran" {
+		t.Fatalf("fork should keep registered handlers, memo=%#v err=%v", fork.Memo(), err)
+	}
+	fork.AddChatHistory([]types.ChatMessage{{Role: "user", Content: "only in fork"}})
+	if len(session.FullContext()) != 8 {
+		t.Fatalf("fork must not share history with the original")
+	}
+
+	atTurn, err := session.ForkAtTurn("history-turn-1", 1)
+	if err != nil {
+		t.Fatalf("ForkAtTurn failed: %v", err)
+	}
+	if full := atTurn.FullContext(); len(full) != 2 || full[1].Content != "a1" {
+		t.Fatalf("expected fork with the first turn only, got %#v", full)
+	}
+	if window := atTurn.ContextWindow(); len(window) != 2 {
+		t.Fatalf("expected fork window rebuilt from the kept turn, got %#v", window)
+	}
+	if _, err := session.ForkAtTurn("bad", 4); err == nil {
+		t.Fatalf("expected error forking past the last turn")
+	}
+
+	if err := session.EditMessage(6, "edited"); err != nil {
+		t.Fatalf("EditMessage failed: %v", err)
+	}
+	if session.FullContext()[6].Content != "edited" || session.ContextWindow()[0].Content != "edited" {
+		t.Fatalf("edit should reach the full context and the window: %#v", session.ContextWindow())
+	}
+	if err := session.EditMessage(8, "x"); err == nil {
+		t.Fatalf("expected error editing past the end")
+	}
+
+	session.Rewind(1)
+	if full := session.FullContext(); len(full) != 6 || full[5].Content != "a2" {
+		t.Fatalf("expected last turn dropped, got %#v", full)
+	}
+	window := session.ContextWindow()
+	if len(window) == 0 || window[len(window)-1].Content != "a2" || window[0].Role == "tool" {
+		t.Fatalf("expected window rebuilt and trimmed after rewinding past it, got %#v", window)
+	}
+	session.Rewind(5)
+	if len(session.FullContext()) != 0 || len(session.ContextWindow()) != 0 {
+		t.Fatalf("expected rewinding every turn to clear the session")
+	}
+}
+
+func TestSessionForkAtTurnResizesOutsideTheParentLock(t *testing.T) {
+	settings := core.NewDefaultSettings(nil)
+	settings.Set("session.max_length", 20)
+	settings.Set("session.resize_strategy", "summarize")
+	settings.Set("session.summarize.keep_messages", 1)
+	parent := core.NewSession("fork-lock", true, settings)
+	parent.SetChatHistory([]types.ChatMessage{
+		{Role: "user", Content: strings.Repeat("a", 15)},
+		{Role: "assistant", Content: strings.Repeat("b", 15)},
+		{Role: "user", Content: "q2"},
+		{Role: "assistant", Content: "a2"},
+	})
+	// The summarizer is copied into the fork and writes to the parent, which
+	// deadlocks if the fork is resized under the parent's lock.
+	parent.SetSummarizer(func(context.Context, core.SessionSummaryRequest) (string, error) {
+		parent.CleanContextWindow()
+		return "summary", nil
+	})
+	forked := make(chan *core.Session, 1)
+	go func() {
+		if atTurn, err := parent.ForkAtTurn("fork-lock-1", 1); err == nil {
+			forked <- atTurn
+		}
+		close(forked)
+	}()
+	select {
+	case fork := <-forked:
+		if fork == nil || len(fork.FullContext()) != 2 || fork.Summary() != "summary" {
+			t.Fatalf("expected the fork summarized, got %#v", fork)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("ForkAtTurn deadlocked resizing the fork")
+	}
+}
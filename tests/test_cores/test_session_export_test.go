@@ -0,0 +1,131 @@
+package core_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AgentEra/Agently-Go/agently/core"
+	"github.com/AgentEra/Agently-Go/agently/types"
+)
+
+func exportFixtureHistory() []types.ChatMessage {
+	return []types.ChatMessage{
+		{Role: "user", Content: "What is 1 + 2?\n\n```\n## user\n```"},
+		{Role: "assistant", ToolCalls: []types.ToolCall{{ID: "call-1", Name: "sum", Arguments: `{"a":1,"b":2}`}}},
+		{Role: "tool", ToolCallID: "call-1", Name: "sum", Content: "3"},
+		{Role: "assistant", Content: "1 + 2 = 3"},
+	}
+}
+
+func TestSessionExportFormatsRoundTrip(t *testing.T) {
+	session := core.NewSession("export-1", true, nil)
+	session.SetChatHistory(exportFixtureHistory())
+	options := core.SessionExportOptions{
+		System: "You are a calculator.",
+		Tools:  []types.ToolInfo{{Name: "sum", Desc: "add numbers", Kwargs: map[string]any{"a": "number", "b": "number"}}},
+	}
+	want := append([]types.ChatMessage{{Role: "system", Content: "You are a calculator."}}, exportFixtureHistory()...)
+
+	for _, format := range []core.SessionExportFormat{core.SessionFormatOpenAI, core.SessionFormatShareGPT, core.SessionFormatMarkdown} {
+		t.Run(string(format), func(t *testing.T) {
+			exported, err := session.Export(format, options)
+			if err != nil {
+				t.Fatalf("export failed: %v", err)
+			}
+			if format != core.SessionFormatMarkdown && bytes.Contains(exported, []byte("\n")) {
+				t.Fatalf("JSON records must fit on one JSONL line:\n%s", exported)
+			}
+			imported, err := core.ImportSession("", format, exported, nil)
+			if err != nil {
+				t.Fatalf("import failed: %v\n%s", err, exported)
+			}
+			if format != core.SessionFormatOpenAI && imported.ID() != "export-1" {
+				t.Fatalf("expected the conversation id to round trip, got %q", imported.ID())
+			}
+			if got := imported.FullContext(); !reflect.DeepEqual(got, want) {
+				t.Fatalf("round trip mismatch:\n got %#v\nwant %#v\n%s", got, want, exported)
+			}
+		})
+	}
+
+	openai, _ := session.Export(core.SessionFormatOpenAI, options)
+	record := map[string]any{}
+	if err := json.Unmarshal(openai, &record); err != nil {
+		t.Fatalf("decode openai record: %v", err)
+	}
+	tools, _ := record["tools"].([]any)
+	if len(tools) != 1 || tools[0].(map[string]any)["type"] != "function" {
+		t.Fatalf("expected tools in the openai record, got %#v", record["tools"])
+	}
+	messages := record["messages"].([]any)
+	if calls, _ := messages[2].(map[string]any)["tool_calls"].([]any); len(calls) != 1 {
+		t.Fatalf("expected assistant tool_calls in the openai record, got %#v", messages[2])
+	}
+
+	sharegpt, _ := session.Export(core.SessionFormatShareGPT, options)
+	if !strings.Contains(string(sharegpt), `"from":"function_call"`) || !strings.Contains(string(sharegpt), `"from":"observation"`) {
+		t.Fatalf("expected function_call and observation turns:\n%s", sharegpt)
+	}
+
+	if _, err := session.Export("csv", options); err == nil {
+		t.Fatalf("expected unsupported format error")
+	}
+}
+
+func TestImportShareGPTFromOtherTools(t *testing.T) {
+	record := `{"id":7,"conversations":[{"from":"human","value":"weather?"},{"from":"function_call","value":"{\"name\":\"weather\",\"arguments\":{\"city\":\"Paris\"}}"},{"from":"observation","value":"sunny"},{"from":"gpt","value":"It is sunny."}]}`
+	session, err := core.ImportSession("", core.SessionFormatShareGPT, []byte(record), nil)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	history := session.FullContext()
+	if session.ID() != "7" || len(history) != 4 {
+		t.Fatalf("unexpected import id=%s history=%#v", session.ID(), history)
+	}
+	call := history[1].ToolCalls[0]
+	if call.Name != "weather" || call.Arguments != `{"city":"Paris"}` || history[2].ToolCallID != call.ID {
+		t.Fatalf("expected the observation linked to the generated call, got %#v", history)
+	}
+}
+
+func TestExportStoredSessionsAsJSONL(t *testing.T) {
+	ctx := context.Background()
+	store, err := core.NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileSessionStore failed: %v", err)
+	}
+	for _, id := range []string{"a", "b"} {
+		session := core.NewSession(id, true, nil)
+		session.SetChatHistory(exportFixtureHistory())
+		if err := core.SaveSessionToStore(ctx, store, session); err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+
+	var out bytes.Buffer
+	written, err := core.ExportStoredSessions(ctx, store, nil, &out, core.SessionFormatShareGPT, core.SessionExportOptions{})
+	if err != nil || written != 2 {
+		t.Fatalf("ExportStoredSessions wrote %d, err=%v", written, err)
+	}
+	scanner := bufio.NewScanner(&out)
+	ids := []string{}
+	for scanner.Scan() {
+		session, err := core.ImportSession("", core.SessionFormatShareGPT, scanner.Bytes(), nil)
+		if err != nil {
+			t.Fatalf("import line failed: %v", err)
+		}
+		ids = append(ids, session.ID())
+	}
+	if !reflect.DeepEqual(ids, []string{"a", "b"}) {
+		t.Fatalf("unexpected exported sessions %v", ids)
+	}
+
+	if _, err := core.ExportStoredSessions(ctx, store, nil, &out, core.SessionFormatMarkdown, core.SessionExportOptions{}); err == nil {
+		t.Fatalf("expected markdown to be rejected for JSONL export")
+	}
+}
@@ -0,0 +1,149 @@
+package core_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/AgentEra/Agently-Go/agently/core"
+	"github.com/AgentEra/Agently-Go/agently/types"
+)
+
+func TestSessionStores(t *testing.T) {
+	openers := map[string]func(t *testing.T, dir string) core.SessionStore{
+		"file": func(t *testing.T, dir string) core.SessionStore {
+			store, err := core.NewFileSessionStore(dir)
+			if err != nil {
+				t.Fatalf("NewFileSessionStore failed: %v", err)
+			}
+			return store
+		},
+		"kv": func(t *testing.T, dir string) core.SessionStore {
+			store, err := core.OpenKVSessionStore(filepath.Join(dir, "sessions.log"))
+			if err != nil {
+				t.Fatalf("OpenKVSessionStore failed: %v", err)
+			}
+			return store
+		},
+	}
+	for name, open := range openers {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			store := open(t, dir)
+			settings := core.NewDefaultSettings(nil)
+			settings.SetCover("session.summarizer", core.SessionSummarizer(func(context.Context, core.SessionSummaryRequest) (string, error) {
+				return "", nil
+			}))
+
+			if _, err := store.Load(ctx, "missing"); !errors.Is(err, core.ErrSessionNotFound) {
+				t.Fatalf("expected ErrSessionNotFound, got %v", err)
+			}
+
+			session := core.NewSession("user/1", true, settings)
+			history := []types.ChatMessage{
+				{Role: "user", Content: "sum 1 and 2"},
+				{Role: "assistant", ToolCalls: []types.ToolCall{{ID: "call-1", Name: "sum", Arguments: `{"a":1,"b":2}`}}},
+				{Role: "tool", ToolCallID: "call-1", Name: "sum", Content: "3"},
+				{Role: "assistant", Content: "3"},
+			}
+			session.SetChatHistory(history)
+			if err := core.SaveSessionToStore(ctx, store, session); err != nil {
+				t.Fatalf("save failed: %v", err)
+			}
+			if session.Version() != 1 {
+				t.Fatalf("expected version 1 after first save, got %d", session.Version())
+			}
+
+			// A second process opens the same store and loads the session.
+			other := open(t, dir)
+			loaded, err := core.LoadSessionFromStore(ctx, other, "user/1", settings)
+			if err != nil {
+				t.Fatalf("load failed: %v", err)
+			}
+			if !reflect.DeepEqual(loaded.FullContext(), session.FullContext()) || loaded.Version() != 1 {
+				t.Fatalf("loaded session mismatch: version=%d %#v", loaded.Version(), loaded.FullContext())
+			}
+
+			loaded.AddChatHistory([]types.ChatMessage{{Role: "user", Content: "again"}})
+			if err := core.SaveSessionToStore(ctx, other, loaded); err != nil {
+				t.Fatalf("save from second process failed: %v", err)
+			}
+			session.AddChatHistory([]types.ChatMessage{{Role: "user", Content: "stale"}})
+			if err := core.SaveSessionToStore(ctx, store, session); !errors.Is(err, core.ErrSessionVersionConflict) {
+				t.Fatalf("expected version conflict for stale save, got %v", err)
+			}
+			stored, err := store.Load(ctx, "user/1")
+			if err != nil || stored.Version != 2 {
+				t.Fatalf("expected the second process's save to win, got version=%d err=%v", stored.Version, err)
+			}
+
+			if err := core.SaveSessionToStore(ctx, store, core.NewSession("user/2", true, settings)); err != nil {
+				t.Fatalf("save second session failed: %v", err)
+			}
+			ids, err := other.List(ctx)
+			if err != nil || !reflect.DeepEqual(ids, []string{"user/1", "user/2"}) {
+				t.Fatalf("unexpected list %v err=%v", ids, err)
+			}
+			if err := other.Delete(ctx, "user/1"); err != nil {
+				t.Fatalf("delete failed: %v", err)
+			}
+			if _, err := store.Load(ctx, "user/1"); !errors.Is(err, core.ErrSessionNotFound) {
+				t.Fatalf("expected deleted session to be gone, got %v", err)
+			}
+		})
+	}
+}
+
+func TestKVSessionStoreCompactsAndRecoversTornWrites(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "sessions.log")
+	store, err := core.OpenKVSessionStore(path)
+	if err != nil {
+		t.Fatalf("OpenKVSessionStore failed: %v", err)
+	}
+	session := core.NewSession("busy", true, nil)
+	for i := 0; i < 300; i++ {
+		session.AddChatHistory([]types.ChatMessage{{Role: "user", Content: "turn"}})
+		if err := core.SaveSessionToStore(ctx, store, session); err != nil {
+			t.Fatalf("save %d failed: %v", i, err)
+		}
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log failed: %v", err)
+	}
+	if lines := bytes.Count(raw, []byte("\n")); lines >= 200 {
+		t.Fatalf("expected superseded records to be compacted away, log has %d records", lines)
+	}
+	stored, err := store.Load(ctx, "busy")
+	if err != nil || stored.Version != 300 {
+		t.Fatalf("unexpected stored session version=%d err=%v", stored.Version, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("open log failed: %v", err)
+	}
+	_, _ = file.WriteString(`{"op":"put","id":"torn","sess`)
+	_ = file.Close()
+
+	reopened, err := core.OpenKVSessionStore(path)
+	if err != nil {
+		t.Fatalf("reopen after torn write failed: %v", err)
+	}
+	if _, err := reopened.Load(ctx, "torn"); !errors.Is(err, core.ErrSessionNotFound) {
+		t.Fatalf("torn record should be dropped, got %v", err)
+	}
+	loaded, err := core.LoadSessionFromStore(ctx, reopened, "busy", nil)
+	if err != nil || len(loaded.FullContext()) != 300 {
+		t.Fatalf("unexpected session after reopen: err=%v", err)
+	}
+	if err := core.SaveSessionToStore(ctx, reopened, loaded); err != nil {
+		t.Fatalf("save after reopen failed: %v", err)
+	}
+}
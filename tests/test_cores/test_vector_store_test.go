@@ -0,0 +1,316 @@
+package core_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AgentEra/Agently-Go/agently/core"
+)
+
+func vectorIDs[T core.VectorDocument | core.VectorMatch](items []T) []string {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		switch typed := any(item).(type) {
+		case core.VectorDocument:
+			ids = append(ids, typed.ID)
+		case core.VectorMatch:
+			ids = append(ids, typed.ID)
+		}
+	}
+	return ids
+}
+
+func TestLocalVectorStorePersistsAndFilters(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "vectors", "docs.json")
+	store, err := core.OpenLocalVectorStore(path)
+	if err != nil {
+		t.Fatalf("OpenLocalVectorStore failed: %v", err)
+	}
+	documents := []core.VectorDocument{
+		{ID: "go", Content: "Go guide", Metadata: map[string]any{"lang": "go", "year": 2024}, Embedding: []float64{1, 0, 0}},
+		{ID: "go-old", Content: "Old Go guide", Metadata: map[string]any{"lang": "go", "year": 2019}, Embedding: []float64{0.9, 0.1, 0}},
+		{ID: "py", Content: "Python guide", Metadata: map[string]any{"lang": "python", "year": 2024}, Embedding: []float64{0, 1, 0}},
+		{ID: "rs", Content: "Rust guide", Metadata: map[string]any{"lang": "rust", "year": 2023}, Embedding: []float64{0, 0, 1}},
+	}
+	if err := store.Upsert(ctx, documents...); err != nil {
+		t.Fatalf("upsert failed: %v", err)
+	}
+	if err := store.Upsert(ctx, core.VectorDocument{ID: "bad", Embedding: []float64{1, 2}}); err == nil {
+		t.Fatalf("expected a dimension mismatch error")
+	}
+	if err := store.Upsert(ctx, core.VectorDocument{Embedding: []float64{1, 2, 3}}); err == nil {
+		t.Fatalf("expected an empty id error")
+	}
+
+	// A second process opens the file, and numbers read back as float64
+	// still match integer filters.
+	reopened, err := core.OpenLocalVectorStore(path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	matches, err := reopened.Query(ctx, []float64{1, 0.05, 0}, 2, nil)
+	if err != nil || !reflect.DeepEqual(vectorIDs(matches), []string{"go", "go-old"}) {
+		t.Fatalf("unexpected query result %v err=%v", vectorIDs(matches), err)
+	}
+	if matches[0].Content != "Go guide" || matches[0].Score <= matches[1].Score {
+		t.Fatalf("expected documents ranked by cosine similarity, got %#v", matches)
+	}
+	matches, _ = reopened.Query(ctx, []float64{1, 0.05, 0}, 5, core.VectorFilter{"year": 2024})
+	if got := vectorIDs(matches); !reflect.DeepEqual(got, []string{"go", "py"}) {
+		t.Fatalf("unexpected filtered result %v", got)
+	}
+	matches, _ = reopened.Query(ctx, []float64{0, 0, 1}, 5, core.VectorFilter{"lang": []string{"python", "rust"}, "year": []any{2023.0}})
+	if got := vectorIDs(matches); !reflect.DeepEqual(got, []string{"rs"}) {
+		t.Fatalf("unexpected any-of filter result %v", got)
+	}
+	if _, err := reopened.Query(ctx, []float64{1, 0}, 1, nil); err == nil {
+		t.Fatalf("expected a query dimension error")
+	}
+
+	got, _ := reopened.Get(ctx, "rs", "missing", "go")
+	if ids := vectorIDs(got); !reflect.DeepEqual(ids, []string{"rs", "go"}) {
+		t.Fatalf("unexpected get result %v", ids)
+	}
+	if err := reopened.Delete(ctx, "go", "missing"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := reopened.Upsert(ctx, core.VectorDocument{ID: "py", Content: "Python 3 guide", Metadata: map[string]any{"lang": "python"}, Embedding: []float64{0, 1, 0}}); err != nil {
+		t.Fatalf("upsert failed: %v", err)
+	}
+
+	final, err := core.OpenLocalVectorStore(path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	listed, _ := final.List(ctx, core.VectorFilter{"lang": []string{"go", "python"}})
+	if ids := vectorIDs(listed); !reflect.DeepEqual(ids, []string{"go-old", "py"}) || listed[1].Content != "Python 3 guide" {
+		t.Fatalf("unexpected documents after reopen %#v", listed)
+	}
+}
+
+func TestLocalVectorStoreLogCompactsAndRecovers(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "log.jsonl")
+	store, err := core.OpenLocalVectorStore(path)
+	if err != nil {
+		t.Fatalf("OpenLocalVectorStore failed: %v", err)
+	}
+	if err := store.Upsert(ctx, core.VectorDocument{ID: "keep", Embedding: []float64{0, 1}}); err != nil {
+		t.Fatalf("upsert failed: %v", err)
+	}
+	for i := 0; i < 600; i++ {
+		if err := store.Upsert(ctx, core.VectorDocument{ID: "hot", Content: fmt.Sprint(i), Embedding: []float64{1, float64(i)}}); err != nil {
+			t.Fatalf("upsert failed: %v", err)
+		}
+	}
+	// Superseded records are compacted away instead of piling up.
+	raw, _ := os.ReadFile(path)
+	if lines := strings.Count(string(raw), "\n"); lines > 300 {
+		t.Fatalf("expected the log compacted, it has %d lines", lines)
+	}
+
+	// A batch half-written by a crash is dropped as a whole.
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	_, _ = file.WriteString(`{"op":"put","documents":[{"id":"torn"`)
+	_ = file.Close()
+	reopened, err := core.OpenLocalVectorStore(path)
+	if err != nil {
+		t.Fatalf("reopen after a torn write failed: %v", err)
+	}
+	got, _ := reopened.Get(ctx, "keep", "hot", "torn")
+	if ids := vectorIDs(got); !reflect.DeepEqual(ids, []string{"keep", "hot"}) || got[1].Content != "599" || got[1].Embedding[1] != 599 {
+		t.Fatalf("unexpected documents after reopen %#v", got)
+	}
+	if err := reopened.Delete(ctx, "keep"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if final, err := core.OpenLocalVectorStore(path); err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	} else if listed, _ := final.List(ctx, nil); !reflect.DeepEqual(vectorIDs(listed), []string{"hot"}) {
+		t.Fatalf("unexpected documents after delete %v", vectorIDs(listed))
+	}
+
+	// Snapshots of the first file format are read and rewritten as a log.
+	legacy := filepath.Join(t.TempDir(), "legacy.json")
+	_ = os.WriteFile(legacy, []byte(`{"format":1,"documents":[{"id":"old","content":"old doc","embedding":[0.5,0.25]}]}`), 0o644)
+	migrated, err := core.OpenLocalVectorStore(legacy)
+	if err != nil {
+		t.Fatalf("open legacy file failed: %v", err)
+	}
+	if got, _ := migrated.Get(ctx, "old"); len(got) != 1 || got[0].Content != "old doc" || !reflect.DeepEqual(got[0].Embedding, []float64{0.5, 0.25}) {
+		t.Fatalf("unexpected legacy document %#v", got)
+	}
+	if raw, _ := os.ReadFile(legacy); !strings.HasPrefix(string(raw), `{"op":"format","format":2}`) {
+		t.Fatalf("expected the legacy file rewritten as a log:\n%s", raw)
+	}
+}
+
+func TestLocalVectorStoreHNSW(t *testing.T) {
+	ctx := context.Background()
+	random := rand.New(rand.NewSource(7))
+	randomVector := func() []float64 {
+		vector := make([]float64, 16)
+		for i := range vector {
+			vector[i] = random.NormFloat64()
+		}
+		return vector
+	}
+	exact := core.NewLocalVectorStore()
+	approximate := core.NewLocalVectorStore().UseHNSW(core.HNSWOptions{M: 8})
+	documents := make([]core.VectorDocument, 0, 600)
+	for i := 0; i < 600; i++ {
+		documents = append(documents, core.VectorDocument{
+			ID:        fmt.Sprintf("doc-%03d", i),
+			Metadata:  map[string]any{"shard": i % 50},
+			Embedding: randomVector(),
+		})
+	}
+	if err := exact.Upsert(ctx, documents...); err != nil {
+		t.Fatalf("upsert failed: %v", err)
+	}
+	for start := 0; start < len(documents); start += 100 {
+		if err := approximate.Upsert(ctx, documents[start:start+100]...); err != nil {
+			t.Fatalf("upsert failed: %v", err)
+		}
+	}
+
+	hits, total := 0, 0
+	for q := 0; q < 20; q++ {
+		query := randomVector()
+		want, _ := exact.Query(ctx, query, 10, nil)
+		got, err := approximate.Query(ctx, query, 10, nil)
+		if err != nil || len(got) != 10 {
+			t.Fatalf("hnsw query returned %d matches, err=%v", len(got), err)
+		}
+		wanted := map[string]bool{}
+		for _, id := range vectorIDs(want) {
+			wanted[id] = true
+		}
+		for _, id := range vectorIDs(got) {
+			if wanted[id] {
+				hits++
+			}
+		}
+		total += len(want)
+	}
+	if recall := float64(hits) / float64(total); recall < 0.9 {
+		t.Fatalf("expected hnsw recall of at least 0.9, got %.2f", recall)
+	}
+
+	// Filters matching few documents fall back to exact results.
+	query := randomVector()
+	want, _ := exact.Query(ctx, query, 5, core.VectorFilter{"shard": 3})
+	got, _ := approximate.Query(ctx, query, 5, core.VectorFilter{"shard": 3})
+	if !reflect.DeepEqual(vectorIDs(got), vectorIDs(want)) {
+		t.Fatalf("filtered hnsw query %v, want %v", vectorIDs(got), vectorIDs(want))
+	}
+
+	// Deleted and replaced documents leave the index, which is rebuilt once
+	// they outnumber the live ones.
+	deleted := vectorIDs(documents[:500])
+	if err := approximate.Delete(ctx, deleted...); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	replaced := documents[550]
+	replaced.Embedding = query
+	if err := approximate.Upsert(ctx, replaced); err != nil {
+		t.Fatalf("upsert failed: %v", err)
+	}
+	got, _ = approximate.Query(ctx, query, 100, nil)
+	if len(got) != 100 || got[0].ID != replaced.ID {
+		t.Fatalf("expected the replaced document first among the live ones, got %d matches", len(got))
+	}
+	for _, match := range got {
+		for _, id := range deleted {
+			if match.ID == id {
+				t.Fatalf("deleted document %s returned", id)
+			}
+		}
+	}
+}
+
+func TestRetrieverAndVectorMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	embedder := keywordEmbedder("tea", "coffee", "user", "paris")
+	retriever := core.NewRetriever(core.NewLocalVectorStore(), embedder)
+	if err := retriever.Add(ctx,
+		core.VectorDocument{ID: "tea", Content: "Green tea and black tea", Metadata: map[string]any{"topic": "drinks"}},
+		core.VectorDocument{ID: "coffee", Content: "Coffee beans", Metadata: map[string]any{"topic": "drinks"}},
+		core.VectorDocument{ID: "paris", Content: "Paris travel notes", Metadata: map[string]any{"topic": "travel"}},
+	); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	matches, err := retriever.Search(ctx, "which tea", 1, core.VectorFilter{"topic": "drinks"})
+	if err != nil || !reflect.DeepEqual(vectorIDs(matches), []string{"tea"}) {
+		t.Fatalf("unexpected search result %v err=%v", vectorIDs(matches), err)
+	}
+
+	path := filepath.Join(t.TempDir(), "memories.json")
+	vectors, err := core.OpenLocalVectorStore(path)
+	if err != nil {
+		t.Fatalf("OpenLocalVectorStore failed: %v", err)
+	}
+	bank := core.NewMemoryBank(core.NewVectorMemoryStore(vectors), embedder, nil, nil)
+	remembered, err := bank.Remember(ctx, "user/1", "The user likes tea")
+	if err != nil {
+		t.Fatalf("remember failed: %v", err)
+	}
+	if _, err := bank.Remember(ctx, "user/2", "The user likes coffee"); err != nil {
+		t.Fatalf("remember failed: %v", err)
+	}
+
+	reopened, err := core.OpenLocalVectorStore(path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	restored := core.NewMemoryBank(core.NewVectorMemoryStore(reopened), embedder, nil, nil)
+	listed, err := restored.List(ctx, "user/1")
+	if err != nil || len(listed) != 1 || listed[0].ID != remembered.ID || !listed[0].CreatedAt.Equal(remembered.CreatedAt) {
+		t.Fatalf("expected the memory to survive a restart, got %#v err=%v", listed, err)
+	}
+	recalled, err := restored.Recall(ctx, "user/1", "coffee or tea")
+	if err != nil || len(recalled) != 1 || recalled[0].Content != "The user likes tea" {
+		t.Fatalf("expected recall within the scope only, got %#v err=%v", recalled, err)
+	}
+}
+
+// BenchmarkLocalVectorStorePersistedUpsert measures single-document upserts
+// into a persisted store that already holds 10k documents; each one appends
+// one log record whatever the store size.
+func BenchmarkLocalVectorStorePersistedUpsert(b *testing.B) {
+	ctx := context.Background()
+	random := rand.New(rand.NewSource(1))
+	embedding := func() []float64 {
+		vector := make([]float64, 384)
+		for i := range vector {
+			vector[i] = random.NormFloat64()
+		}
+		return vector
+	}
+	store, err := core.OpenLocalVectorStore(filepath.Join(b.TempDir(), "bench.jsonl"))
+	if err != nil {
+		b.Fatalf("OpenLocalVectorStore failed: %v", err)
+	}
+	batch := make([]core.VectorDocument, 0, 10000)
+	for i := 0; i < 10000; i++ {
+		batch = append(batch, core.VectorDocument{ID: fmt.Sprintf("doc-%05d", i), Metadata: map[string]any{"n": i}, Embedding: embedding()})
+	}
+	if err := store.Upsert(ctx, batch...); err != nil {
+		b.Fatalf("upsert failed: %v", err)
+	}
+	document := core.VectorDocument{ID: "bench", Embedding: embedding()}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		document.ID = fmt.Sprintf("bench-%d", i%1000)
+		if err := store.Upsert(ctx, document); err != nil {
+			b.Fatalf("upsert failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package extensions_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AgentEra/Agently-Go/agently/builtins/agent_extensions"
+	"github.com/AgentEra/Agently-Go/agently/core"
+	"github.com/AgentEra/Agently-Go/agently/types"
+)
+
+func TestKeyWaiterWithMarkdownSectionsOutput(t *testing.T) {
+	answer := "## answer\nok, the answer\n## steps\n- first\n- second\n"
+	script := func(_ int) []types.ResponseMessage {
+		return []types.ResponseMessage{
+			{Event: types.ResponseEventDelta, Data: "## answer\nok, the "},
+			{Event: types.ResponseEventDelta, Data: "answer\n## st"},
+			{Event: types.ResponseEventDelta, Data: "eps\n- first\n- second\n"},
+			{Event: types.ResponseEventDone, Data: answer},
+		}
+	}
+	agent := agentextensions.NewAgent(newRegressionPluginManager(script, nil), core.NewDefaultSettings(nil), "markdown-sections")
+	prepare := func() {
+		agent.Input("explain")
+		agent.Output(map[string]any{"answer": "string", "steps": []any{"string"}})
+		agent.SetRequestPrompt("output_format", types.OutputMarkdownSections)
+	}
+
+	prepare()
+	promptText, err := agent.GetPromptText()
+	if err != nil {
+		t.Fatalf("GetPromptText failed: %v", err)
+	}
+	if !strings.Contains(promptText, "Data Format: markdown sections") || !strings.Contains(promptText, "## steps\n- <string>") {
+		t.Fatalf("expected markdown sections requirement in prompt, got:\n%s", promptText)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	results := map[string]any{}
+	agent.
+		OnKey("answer", func(value any) any { results["answer"] = value; return nil }).
+		OnKey("steps", func(value any) any { results["steps"] = value; return nil })
+	if _, err := agent.StartWaiter(ctx); err != nil {
+		t.Fatalf("StartWaiter failed: %v", err)
+	}
+	if results["answer"] != "ok, the answer" {
+		t.Fatalf("unexpected answer key: %#v", results["answer"])
+	}
+	if steps, _ := results["steps"].([]any); len(steps) != 2 || steps[1] != "second" {
+		t.Fatalf("unexpected steps key: %#v", results["steps"])
+	}
+
+	prepare()
+	data, err := agent.GetData(ctx, core.GetDataOptions{Type: "parsed", EnsureKeys: []string{"steps[*]"}})
+	if err != nil {
+		t.Fatalf("GetData failed: %v", err)
+	}
+	parsed, _ := data.(map[string]any)
+	if parsed["answer"] != "ok, the answer" {
+		t.Fatalf("unexpected parsed data: %#v", data)
+	}
+}
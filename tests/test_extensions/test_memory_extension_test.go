@@ -0,0 +1,140 @@
+package extensions_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	agentextensions "github.com/AgentEra/Agently-Go/agently/builtins/agent_extensions"
+	"github.com/AgentEra/Agently-Go/agently/core"
+	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+// wordEmbedder embeds texts as counts of a few words.
+func wordEmbedder(_ context.Context, texts []string) ([][]float64, error) {
+	out := make([][]float64, len(texts))
+	for i, text := range texts {
+		lower := strings.ToLower(text)
+		out[i] = []float64{float64(strings.Count(lower, "name")), float64(strings.Count(lower, "tea")), float64(strings.Count(lower, "weather"))}
+	}
+	return out, nil
+}
+
+func TestMemoryExtensionExtractsAndRecallsPerScope(t *testing.T) {
+	prompts := []string{}
+	manager := newRegressionPluginManager(nil, nil)
+	_ = manager.Register(core.PluginTypeModelRequester, core.PluginSpec{
+		Name: "PromptRecordingRequester",
+		Creator: core.ModelRequesterCreator(func(prompt *core.Prompt, _ *utils.Settings) core.ModelRequester {
+			return &promptRecordingRequester{prompt: prompt, prompts: &prompts, reply: func(text string) string {
+				switch {
+				case strings.Contains(text, "known_memories") && strings.Contains(text, "My name is Ada"):
+					return `{"facts": ["The user's name is Ada"]}`
+				case strings.Contains(text, "known_memories"):
+					return `{"facts": []}`
+				}
+				return "ok"
+			}}
+		}),
+	}, true)
+	agent := agentextensions.NewAgent(manager, core.NewDefaultSettings(nil), "memory")
+	agent.SetSettings("memory.min_score", 0.5)
+	agent.UseMemory(nil).SetMemoryEmbedder(wordEmbedder)
+	agent.ActivateSession("chat-1")
+	agent.SetMemoryScope("user-ada")
+
+	agent.Input("Hi! My name is Ada.")
+	if _, err := agent.GetText(); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	agent.WaitMemories()
+	ctx := context.Background()
+	memories, err := agent.ListMemories(ctx)
+	if err != nil || len(memories) != 1 || memories[0].Content != "The user's name is Ada" || memories[0].Scope != "user-ada" {
+		t.Fatalf("expected the extracted fact in the user scope, got %#v err=%v", memories, err)
+	}
+
+	// A new session of the same user recalls the memory.
+	agent.ActivateSession("chat-2")
+	agent.Input("What is my name?")
+	if _, err := agent.GetText(); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	agent.WaitMemories()
+	mainPrompt := ""
+	for _, prompt := range prompts {
+		if strings.Contains(prompt, "What is my name?") && !strings.Contains(prompt, "known_memories") {
+			mainPrompt = prompt
+		}
+	}
+	if !strings.Contains(mainPrompt, "LONG-TERM MEMORIES") || !strings.Contains(mainPrompt, "The user's name is Ada") {
+		t.Fatalf("expected the recalled memory in the prompt:\n%s", mainPrompt)
+	}
+
+	corrected, err := agent.CorrectMemory(ctx, memories[0].ID, "The user's name is Ada Lovelace")
+	if err != nil || corrected.Content != "The user's name is Ada Lovelace" {
+		t.Fatalf("correct failed: %#v err=%v", corrected, err)
+	}
+	if matches, err := agent.RecallMemories(ctx, "name"); err != nil || len(matches) != 1 || matches[0].Content != corrected.Content {
+		t.Fatalf("expected the corrected memory, got %#v err=%v", matches, err)
+	}
+
+	// Without an explicit scope memories belong to the active session.
+	agent.SetMemoryScope("")
+	if agent.MemoryScope() != "chat-2" {
+		t.Fatalf("expected the session scope, got %q", agent.MemoryScope())
+	}
+	if memories, _ := agent.ListMemories(ctx); len(memories) != 0 {
+		t.Fatalf("memories must not leak across scopes, got %#v", memories)
+	}
+	agent.SetMemoryScope("user-ada")
+	if err := agent.DeleteMemory(ctx, memories[0].ID); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if memories, _ := agent.ListMemories(ctx); len(memories) != 0 {
+		t.Fatalf("expected no memories after delete, got %#v", memories)
+	}
+}
+
+func TestMemoryExtensionExtractsInBackground(t *testing.T) {
+	manager := newRegressionPluginManager(func(int) []types.ResponseMessage {
+		return []types.ResponseMessage{{Event: types.ResponseEventDone, Data: "ok"}}
+	}, nil)
+	release := make(chan struct{})
+	extractor := func(_ context.Context, request core.MemoryExtractionRequest) ([]string, error) {
+		<-release
+		return []string{"The user drinks tea"}, nil
+	}
+	agent := agentextensions.NewAgent(manager, core.NewDefaultSettings(nil), "memory-async")
+	agent.UseMemory(nil).SetMemoryEmbedder(wordEmbedder).SetMemoryExtractor(extractor)
+	agent.SetMemoryScope("user")
+
+	// The reply does not wait for the extraction.
+	agent.Input("I drink tea")
+	if _, err := agent.GetText(); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	ctx := context.Background()
+	if memories, _ := agent.ListMemories(ctx); len(memories) != 0 {
+		t.Fatalf("expected the extraction still running, got %#v", memories)
+	}
+	close(release)
+	agent.WaitMemories()
+	if memories, err := agent.ListMemories(ctx); err != nil || len(memories) != 1 || memories[0].Content != "The user drinks tea" {
+		t.Fatalf("expected the fact stored in the background, got %#v err=%v", memories, err)
+	}
+
+	// memory.async_extract false stores it before the reply returns.
+	agent.SetSettings("memory.async_extract", false)
+	agent.SetMemoryExtractor(func(context.Context, core.MemoryExtractionRequest) ([]string, error) {
+		return []string{"The user likes the weather"}, nil
+	})
+	agent.Input("Nice weather")
+	if _, err := agent.GetText(); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if memories, _ := agent.ListMemories(ctx); len(memories) != 2 {
+		t.Fatalf("expected the fact stored synchronously, got %#v", memories)
+	}
+}
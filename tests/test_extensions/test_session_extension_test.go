@@ -2,14 +2,18 @@ package extensions_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/AgentEra/Agently-Go/agently/builtins/agent_extensions"
 	"github.com/AgentEra/Agently-Go/agently/core"
 	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
 )
 
 func TestExtensionsCoreBehaviors(t *testing.T) {
@@ -150,3 +154,453 @@ func TestSessionExtensionInputReplyKeyFiltering(t *testing.T) {
 		t.Fatalf("assistant keyed content missing score: %s", assistantContent)
 	}
 }
+
+type promptRecordingRequester struct {
+	prompt  *core.Prompt
+	prompts *[]string
+	reply   func(prompt string) string
+}
+
+func (r *promptRecordingRequester) GenerateRequestData() (types.RequestData, error) {
+	return types.RequestData{}, nil
+}
+
+func (r *promptRecordingRequester) RequestModel(_ context.Context, _ types.RequestData) (<-chan types.ResponseMessage, error) {
+	out := make(chan types.ResponseMessage)
+	close(out)
+	return out, nil
+}
+
+func (r *promptRecordingRequester) BroadcastResponse(_ context.Context, _ <-chan types.ResponseMessage) (<-chan types.ResponseMessage, error) {
+	text, _ := r.prompt.ToText()
+	*r.prompts = append(*r.prompts, text)
+	reply := r.reply(text)
+	out := make(chan types.ResponseMessage, 2)
+	out <- types.ResponseMessage{Event: types.ResponseEventDelta, Data: reply}
+	out <- types.ResponseMessage{Event: types.ResponseEventDone, Data: reply}
+	close(out)
+	return out, nil
+}
+
+func TestSessionExtensionSummarizesWithAgentModel(t *testing.T) {
+	prompts := []string{}
+	manager := newRegressionPluginManager(nil, nil)
+	_ = manager.Register(core.PluginTypeModelRequester, core.PluginSpec{
+		Name: "PromptRecordingRequester",
+		Creator: core.ModelRequesterCreator(func(prompt *core.Prompt, _ *utils.Settings) core.ModelRequester {
+			return &promptRecordingRequester{prompt: prompt, prompts: &prompts, reply: func(text string) string {
+				if strings.Contains(text, "previous_summary") {
+					return "user likes tea"
+				}
+				return strings.Repeat("r", 20)
+			}}
+		}),
+	}, true)
+	agent := agentextensions.NewAgent(manager, core.NewDefaultSettings(nil), "session-summary")
+	agent.SetSettings("session.input_keys", "input")
+	agent.SetSettings("session.max_length", 50)
+	agent.SetSettings("session.summarize.keep_messages", 2)
+	agent.UseSessionSummary(nil)
+	agent.ActivateSession("session-summary")
+
+	for _, input := range []string{"I like tea very much", "what should I drink"} {
+		agent.Input(input)
+		if _, err := agent.GetText(); err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+	}
+	if got := agent.ActiveSession().Summary(); got != "user likes tea" {
+		t.Fatalf("expected summary from the agent model, got %q (memo %#v)", got, agent.ActiveSession().Memo())
+	}
+	summaryPrompt := ""
+	for _, prompt := range prompts {
+		if strings.Contains(prompt, "previous_summary") {
+			summaryPrompt = prompt
+			break
+		}
+	}
+	if !strings.Contains(summaryPrompt, "I like tea very much") || strings.Contains(summaryPrompt, "CHAT SESSION MEMO") {
+		t.Fatalf("summary request should carry the folded turns without session state:\n%s", summaryPrompt)
+	}
+
+	agent.Input("anything else")
+	if _, err := agent.GetText(); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	last := ""
+	for _, prompt := range prompts {
+		if strings.Contains(prompt, "anything else") && !strings.Contains(prompt, "previous_summary") {
+			last = prompt
+		}
+	}
+	if !strings.Contains(last, "CHAT SESSION MEMO") || !strings.Contains(last, "user likes tea") {
+		t.Fatalf("expected summary injected into the next prompt:\n%s", last)
+	}
+}
+
+func TestSessionExtensionPersistsSessionsInStore(t *testing.T) {
+	script := func(call int) []types.ResponseMessage {
+		reply := fmt.Sprintf("reply-%d", call)
+		return []types.ResponseMessage{
+			{Event: types.ResponseEventDelta, Data: reply},
+			{Event: types.ResponseEventDone, Data: reply},
+		}
+	}
+	store, err := core.NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileSessionStore failed: %v", err)
+	}
+	warnings := make(chan types.EventMessage, 8)
+	newAgent := func() *agentextensions.Agent {
+		settings := core.NewDefaultSettings(nil)
+		center := core.NewEventCenter()
+		core.BindEventCenter(settings, center)
+		center.RegisterHook(types.EventNameLog, func(msg types.EventMessage) {
+			if msg.Level == types.LevelWarning {
+				warnings <- msg
+			}
+		}, "autosave-warnings")
+		agent := agentextensions.NewAgent(newRegressionPluginManager(script, nil), settings, "session-store")
+		agent.SetSettings("session.input_keys", "input")
+		return agent.UseSessionStore(store)
+	}
+	expectConflictWarning := func() {
+		t.Helper()
+		select {
+		case msg := <-warnings:
+			if !strings.Contains(fmt.Sprint(msg.Content), core.ErrSessionVersionConflict.Error()) {
+				t.Fatalf("unexpected warning %#v", msg)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected an autosave warning")
+		}
+	}
+	storedText := func() string {
+		t.Helper()
+		stored, err := store.Load(context.Background(), "chat-1")
+		if err != nil {
+			t.Fatalf("load stored session failed: %v", err)
+		}
+		return fmt.Sprintf("v%d %v", stored.Version, stored.Data)
+	}
+
+	first := newAgent()
+	first.ActivateSession("chat-1")
+	first.Input("remember me")
+	if _, err := first.GetText(); err != nil {
+		t.Fatalf("first turn failed: %v", err)
+	}
+
+	// A restarted service loads the conversation on activation.
+	restarted := newAgent()
+	if err := restarted.ActivateSessionWithContext(context.Background(), "chat-1"); err != nil {
+		t.Fatalf("activate from store failed: %v", err)
+	}
+	history := restarted.ActiveSession().FullContext()
+	if len(history) != 2 || !strings.Contains(fmt.Sprint(history[0].Content), "remember me") || history[1].Content != "reply-1" {
+		t.Fatalf("expected stored history after restart, got %#v", history)
+	}
+	if chat, _ := restarted.AgentPrompt().Get("chat_history", []any{}, true).([]any); len(chat) != 2 {
+		t.Fatalf("expected loaded history synced into the agent prompt, got %#v", chat)
+	}
+	restarted.Input("second turn")
+	if _, err := restarted.GetText(); err != nil {
+		t.Fatalf("second turn failed: %v", err)
+	}
+
+	// The first process still holds version 1 and must not overwrite version
+	// 2. The turn itself succeeds and the conflict is reported as a warning.
+	first.Input("stale turn")
+	if _, err := first.GetText(); err != nil {
+		t.Fatalf("a failed autosave must not fail the turn: %v", err)
+	}
+	expectConflictWarning()
+	if text := storedText(); !strings.HasPrefix(text, "v2 ") || strings.Contains(text, "stale turn") {
+		t.Fatalf("expected stored version 2 without the stale turn, got %s", text)
+	}
+
+	// Force saving keeps the first process's conversation.
+	if err := first.ForceSaveSession(context.Background()); err != nil {
+		t.Fatalf("force save failed: %v", err)
+	}
+	if text := storedText(); !strings.HasPrefix(text, "v3 ") || !strings.Contains(text, "stale turn") || strings.Contains(text, "second turn") {
+		t.Fatalf("expected version 3 holding the stale turn, got %s", text)
+	}
+
+	// The restarted process now conflicts in turn and reloads the stored copy.
+	restarted.Input("third turn")
+	if _, err := restarted.GetText(); err != nil {
+		t.Fatalf("third turn failed: %v", err)
+	}
+	expectConflictWarning()
+	if err := restarted.ReloadSession(context.Background()); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	reloaded := fmt.Sprint(restarted.ActiveSession().FullContext())
+	if restarted.ActiveSession().Version() != 3 || !strings.Contains(reloaded, "stale turn") || strings.Contains(reloaded, "third turn") {
+		t.Fatalf("expected the stored version 3 after reload, got v%d %s", restarted.ActiveSession().Version(), reloaded)
+	}
+	if chat, _ := restarted.AgentPrompt().Get("chat_history", []any{}, true).([]any); !strings.Contains(fmt.Sprint(chat), "stale turn") {
+		t.Fatalf("expected the reloaded history synced into the agent prompt, got %#v", chat)
+	}
+	restarted.Input("fourth turn")
+	if _, err := restarted.GetText(); err != nil {
+		t.Fatalf("fourth turn failed: %v", err)
+	}
+	if text := storedText(); !strings.HasPrefix(text, "v4 ") || !strings.Contains(text, "fourth turn") {
+		t.Fatalf("expected autosave to work again after reload, got %s", text)
+	}
+}
+
+func TestSessionExtensionAutosavesTheSessionOfTheTurn(t *testing.T) {
+	store, err := core.NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileSessionStore failed: %v", err)
+	}
+	var agent *agentextensions.Agent
+	script := func(int) []types.ResponseMessage {
+		// Another session is activated while the turn is running.
+		agent.ActivateSession("b")
+		return []types.ResponseMessage{
+			{Event: types.ResponseEventDelta, Data: "reply"},
+			{Event: types.ResponseEventDone, Data: "reply"},
+		}
+	}
+	agent = agentextensions.NewAgent(newRegressionPluginManager(script, nil), core.NewDefaultSettings(nil), "session-turn")
+	agent.SetSettings("session.input_keys", "input")
+	agent.UseSessionStore(store)
+	agent.ActivateSession("a")
+	agent.Input("for a")
+	if _, err := agent.GetText(); err != nil {
+		t.Fatalf("turn failed: %v", err)
+	}
+	stored, err := store.Load(context.Background(), "a")
+	if err != nil || !strings.Contains(fmt.Sprint(stored.Data), "for a") {
+		t.Fatalf("expected the turn saved to session a, got %#v err=%v", stored, err)
+	}
+	if _, err := store.Load(context.Background(), "b"); !errors.Is(err, core.ErrSessionNotFound) {
+		t.Fatalf("session b should not be saved by a's turn, got %v", err)
+	}
+}
+
+func TestSessionExtensionEvictsSessions(t *testing.T) {
+	manager := newRegressionPluginManager(func(int) []types.ResponseMessage { return nil }, nil)
+	store, err := core.NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileSessionStore failed: %v", err)
+	}
+	agent := agentextensions.NewAgent(manager, core.NewDefaultSettings(nil), "session-lifecycle")
+	agent.UseSessionStore(store)
+	agent.SetSettings("session.max_sessions", 2)
+	evicted := []agentextensions.SessionEviction{}
+	agent.OnSessionEvicted(func(_ context.Context, eviction agentextensions.SessionEviction) {
+		evicted = append(evicted, eviction)
+	})
+
+	agent.ActivateSession("a")
+	agent.AddChatHistory([]types.ChatMessage{{Role: "user", Content: "from a"}})
+	agent.ActivateSession("b")
+	agent.ActivateSession("a")
+	agent.ActivateSession("c")
+	if got := agent.ListSessions(); !reflect.DeepEqual(got, []string{"c", "a"}) {
+		t.Fatalf("expected least recently used session b evicted, got %v", got)
+	}
+	if len(evicted) != 1 || evicted[0].Session.ID() != "b" || evicted[0].Reason != agentextensions.SessionEvictCapacity {
+		t.Fatalf("unexpected evictions %#v", evicted)
+	}
+	if _, err := store.Load(context.Background(), "b"); err != nil {
+		t.Fatalf("expected evicted session flushed to the store: %v", err)
+	}
+
+	// The active session is never evicted, even past idle_ttl.
+	agent.SetSettings("session.idle_ttl", 0.01)
+	time.Sleep(30 * time.Millisecond)
+	if n := agent.EvictIdleSessions(context.Background()); n != 1 || !reflect.DeepEqual(agent.ListSessions(), []string{"c"}) {
+		t.Fatalf("expected idle session a evicted, removed %d, left %v", n, agent.ListSessions())
+	}
+	if last := evicted[len(evicted)-1]; last.Session.ID() != "a" || last.Reason != agentextensions.SessionEvictIdle {
+		t.Fatalf("unexpected idle eviction %#v", last)
+	}
+
+	// Evicted sessions come back from the store.
+	agent.SetSettings("session.idle_ttl", nil)
+	agent.ActivateSession("a")
+	if history := agent.ActiveSession().FullContext(); len(history) != 1 || history[0].Content != "from a" {
+		t.Fatalf("expected session a reloaded from the store, got %#v", history)
+	}
+
+	if err := agent.CloseSession(context.Background(), "a"); err != nil {
+		t.Fatalf("CloseSession failed: %v", err)
+	}
+	if agent.ActiveSession() != nil || !reflect.DeepEqual(agent.ListSessions(), []string{"c"}) {
+		t.Fatalf("expected closed active session deactivated and removed, left %v", agent.ListSessions())
+	}
+	if last := evicted[len(evicted)-1]; last.Session.ID() != "a" || last.Reason != agentextensions.SessionEvictClosed {
+		t.Fatalf("unexpected close eviction %#v", last)
+	}
+	if chat, _ := agent.AgentPrompt().Get("chat_history", []any{}, true).([]any); len(chat) != 0 {
+		t.Fatalf("expected chat_history cleared after closing the active session, got %#v", chat)
+	}
+}
+
+// failingSessionStore fails every save while fail is set.
+type failingSessionStore struct {
+	core.SessionStore
+	fail atomic.Bool
+}
+
+func (s *failingSessionStore) Save(ctx context.Context, session core.StoredSession) (core.StoredSession, error) {
+	if s.fail.Load() {
+		return core.StoredSession{}, errors.New("disk full")
+	}
+	return s.SessionStore.Save(ctx, session)
+}
+
+func TestSessionExtensionKeepsSessionsThatFailToSave(t *testing.T) {
+	manager := newRegressionPluginManager(func(int) []types.ResponseMessage { return nil }, nil)
+	fileStore, err := core.NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileSessionStore failed: %v", err)
+	}
+	store := &failingSessionStore{SessionStore: fileStore}
+	store.fail.Store(true)
+	settings := core.NewDefaultSettings(nil)
+	center := core.NewEventCenter()
+	core.BindEventCenter(settings, center)
+	warnings := make(chan types.EventMessage, 8)
+	center.RegisterHook(types.EventNameLog, func(msg types.EventMessage) {
+		if msg.Level == types.LevelWarning {
+			warnings <- msg
+		}
+	}, "eviction-warnings")
+	agent := agentextensions.NewAgent(manager, settings, "session-save-failure")
+	agent.UseSessionStore(store)
+	agent.SetSettings("session.max_sessions", 1)
+	evicted := 0
+	agent.OnSessionEvicted(func(context.Context, agentextensions.SessionEviction) { evicted++ })
+
+	agent.ActivateSession("a")
+	agent.AddChatHistory([]types.ChatMessage{{Role: "user", Content: "unsaved"}})
+	agent.ActivateSession("b")
+	if got := agent.ListSessions(); !reflect.DeepEqual(got, []string{"b", "a"}) || evicted != 0 {
+		t.Fatalf("a session that failed to save must stay in memory, got %v with %d evictions", got, evicted)
+	}
+	select {
+	case msg := <-warnings:
+		if msg.Meta["session_id"] != "a" || !strings.Contains(fmt.Sprint(msg.Content), "disk full") {
+			t.Fatalf("unexpected warning %#v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected a warning for the failed save")
+	}
+
+	// Once the store recovers the session is saved, then evicted.
+	store.fail.Store(false)
+	agent.ActivateSession("b")
+	if got := agent.ListSessions(); !reflect.DeepEqual(got, []string{"b"}) || evicted != 1 {
+		t.Fatalf("expected session a evicted after a successful save, got %v", got)
+	}
+	stored, err := store.Load(context.Background(), "a")
+	if err != nil || !strings.Contains(fmt.Sprint(stored.Data), "unsaved") {
+		t.Fatalf("expected session a in the store, got %#v err=%v", stored, err)
+	}
+}
+
+func TestSessionExtensionEvictsUnsavedSessionsAfterFailedSaves(t *testing.T) {
+	manager := newRegressionPluginManager(func(int) []types.ResponseMessage { return nil }, nil)
+	fileStore, err := core.NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileSessionStore failed: %v", err)
+	}
+	store := &failingSessionStore{SessionStore: fileStore}
+	store.fail.Store(true)
+	settings := core.NewDefaultSettings(nil)
+	center := core.NewEventCenter()
+	core.BindEventCenter(settings, center)
+	warnings := make(chan string, 8)
+	center.RegisterHook(types.EventNameLog, func(msg types.EventMessage) {
+		if msg.Level == types.LevelWarning {
+			warnings <- fmt.Sprint(msg.Content)
+		}
+	}, "eviction-warnings")
+	agent := agentextensions.NewAgent(manager, settings, "session-save-attempts")
+	agent.UseSessionStore(store)
+	agent.SetSettings("session.max_sessions", 1)
+	agent.SetSettings("session.evict_save_attempts", 2)
+	evicted := []agentextensions.SessionEviction{}
+	agent.OnSessionEvicted(func(_ context.Context, eviction agentextensions.SessionEviction) {
+		evicted = append(evicted, eviction)
+	})
+
+	agent.ActivateSession("a")
+	agent.ActivateSession("b")
+	if got := agent.ListSessions(); !reflect.DeepEqual(got, []string{"b", "a"}) || len(evicted) != 0 {
+		t.Fatalf("the first failed save should keep session a, got %v", got)
+	}
+	agent.ActivateSession("b")
+	if got := agent.ListSessions(); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Fatalf("session a should be evicted after 2 failed saves, got %v", got)
+	}
+	if len(evicted) != 1 || evicted[0].Session.ID() != "a" || evicted[0].SaveErr == nil {
+		t.Fatalf("expected session a evicted with its save error, got %#v", evicted)
+	}
+	last := ""
+	for len(warnings) > 0 {
+		last = <-warnings
+	}
+	if !strings.Contains(last, "evicted unsaved") || !strings.Contains(last, "disk full") {
+		t.Fatalf("expected a warning for the unsaved eviction, got %q", last)
+	}
+
+	// With 0 attempts a session stays until it is saved.
+	agent.SetSettings("session.evict_save_attempts", 0)
+	agent.ActivateSession("c")
+	for i := 0; i < 5; i++ {
+		agent.ActivateSession("c")
+	}
+	if got := agent.ListSessions(); !reflect.DeepEqual(got, []string{"c", "b"}) || len(evicted) != 1 {
+		t.Fatalf("session b must stay while its save fails, got %v", got)
+	}
+}
+
+func TestSessionExtensionHistoryOperationsSyncAgentPrompt(t *testing.T) {
+	manager := newRegressionPluginManager(func(int) []types.ResponseMessage { return nil }, nil)
+	agent := agentextensions.NewAgent(manager, core.NewDefaultSettings(nil), "session-history")
+	agent.ActivateSession("main")
+	agent.SetChatHistory([]types.ChatMessage{
+		{Role: "user", Content: "q1"},
+		{Role: "assistant", Content: "a1"},
+		{Role: "user", Content: "q2"},
+		{Role: "assistant", Content: "a2"},
+	})
+	promptHistory := func() []any {
+		chat, _ := agent.AgentPrompt().Get("chat_history", []any{}, true).([]any)
+		return chat
+	}
+
+	if err := agent.EditChatHistory(2, "q2 edited"); err != nil {
+		t.Fatalf("EditChatHistory failed: %v", err)
+	}
+	if chat := promptHistory(); len(chat) != 4 || chat[2].(map[string]any)["content"] != "q2 edited" {
+		t.Fatalf("expected edit synced into the agent prompt, got %#v", chat)
+	}
+
+	agent.RewindChatHistory(1)
+	if chat := promptHistory(); len(chat) != 2 {
+		t.Fatalf("expected rewind synced into the agent prompt, got %#v", chat)
+	}
+
+	if err := agent.ForkSession(context.Background(), "branch", 0); err != nil {
+		t.Fatalf("ForkSession failed: %v", err)
+	}
+	if agent.ActiveSession().ID() != "branch" || len(promptHistory()) != 0 {
+		t.Fatalf("expected the empty fork active, got %s with %#v", agent.ActiveSession().ID(), promptHistory())
+	}
+	if err := agent.ForkSession(context.Background(), "main"); err == nil {
+		t.Fatalf("expected forking onto an existing session to fail")
+	}
+	agent.ActivateSession("main")
+	if len(promptHistory()) != 2 {
+		t.Fatalf("original session should be unchanged by the fork")
+	}
+}
@@ -3,6 +3,8 @@ package extensions_test
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -138,3 +140,786 @@ func toFloat64(value any) float64 {
 		return 0
 	}
 }
+
+type nativeToolRequester struct {
+	prompt   *core.Prompt
+	counter  *atomic.Int32
+	requests *[][]map[string]any
+	options  *[]map[string]any
+	script   func(call int, messages []map[string]any) []types.ResponseMessage
+}
+
+func (r *nativeToolRequester) GenerateRequestData() (types.RequestData, error) {
+	return types.RequestData{}, nil
+}
+
+func (r *nativeToolRequester) RequestModel(_ context.Context, _ types.RequestData) (<-chan types.ResponseMessage, error) {
+	out := make(chan types.ResponseMessage)
+	close(out)
+	return out, nil
+}
+
+func (r *nativeToolRequester) BroadcastResponse(_ context.Context, _ <-chan types.ResponseMessage) (<-chan types.ResponseMessage, error) {
+	call := int(r.counter.Add(1))
+	messages, _ := r.prompt.ToMessages()
+	options, _ := r.prompt.Get("options", map[string]any{}, true).(map[string]any)
+	*r.requests = append(*r.requests, messages)
+	*r.options = append(*r.options, options)
+	out := make(chan types.ResponseMessage, 16)
+	for _, msg := range r.script(call, messages) {
+		out <- msg
+	}
+	close(out)
+	return out, nil
+}
+
+func newNativeToolAgent(t *testing.T, script func(call int, messages []map[string]any) []types.ResponseMessage) (*agentextensions.Agent, *[][]map[string]any, *[]map[string]any) {
+	t.Helper()
+	requests := make([][]map[string]any, 0)
+	options := make([]map[string]any, 0)
+	counter := &atomic.Int32{}
+	manager := newToolJudgementPluginManager(&atomic.Int32{})
+	_ = manager.Register(core.PluginTypeModelRequester, core.PluginSpec{
+		Name: "NativeToolRequester",
+		Creator: core.ModelRequesterCreator(func(prompt *core.Prompt, _ *utils.Settings) core.ModelRequester {
+			return &nativeToolRequester{prompt: prompt, counter: counter, requests: &requests, options: &options, script: script}
+		}),
+	}, true)
+	agent := agentextensions.NewAgent(manager, core.NewDefaultSettings(nil), "native-tools")
+	agent.SetSettings("tool.mode", "native")
+	if err := agent.RegisterTool(types.ToolInfo{
+		Name:   "sum",
+		Desc:   "sum two ints",
+		Kwargs: map[string]any{"a": "number", "b": types.OutputTuple{"number", "second addend"}},
+	}, func(kwargs map[string]any) (any, error) {
+		return int(toFloat64(kwargs["a"])) + int(toFloat64(kwargs["b"])), nil
+	}); err != nil {
+		t.Fatalf("register tool failed: %v", err)
+	}
+	return agent, &requests, &options
+}
+
+func sumToolCallMessages(id string, args string) []types.ResponseMessage {
+	return []types.ResponseMessage{
+		{Event: types.ResponseEventToolCalls, Data: []any{map[string]any{
+			"index": float64(0), "id": id, "type": "function",
+			"function": map[string]any{"name": "sum", "arguments": args[:4]},
+		}}},
+		{Event: types.ResponseEventToolCalls, Data: []any{map[string]any{
+			"index":    float64(0),
+			"function": map[string]any{"arguments": args[4:]},
+		}}},
+		{Event: types.ResponseEventDone, Data: ""},
+		{Event: types.ResponseEventOriginalDone, Data: map[string]any{"finish_reason": "tool_calls"}},
+	}
+}
+
+func TestToolExtensionNativeToolLoop(t *testing.T) {
+	agent, requests, options := newNativeToolAgent(t, func(call int, messages []map[string]any) []types.ResponseMessage {
+		if call == 1 {
+			return sumToolCallMessages("call_sum", `{"a":3,"b":4}`)
+		}
+		last := messages[len(messages)-1]
+		answer := "tool-not-used"
+		if last["role"] == "tool" && last["tool_call_id"] == "call_sum" && last["content"] == "7" {
+			answer = "tool-used"
+		}
+		done := fmt.Sprintf(`{"answer":"%s"}`, answer)
+		return []types.ResponseMessage{
+			{Event: types.ResponseEventDelta, Data: done},
+			{Event: types.ResponseEventDone, Data: done},
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	agent.Input("3+4=?")
+	agent.Output(map[string]any{"answer": "string"})
+	response := agent.GetResponse()
+	data, err := response.Result.GetData(ctx, core.GetDataOptions{Type: "parsed"})
+	if err != nil {
+		t.Fatalf("native tool request failed: %v", err)
+	}
+	if parsed, _ := data.(map[string]any); parsed["answer"] != "tool-used" {
+		t.Fatalf("expected tool-used answer, got %#v", data)
+	}
+	if len(*requests) != 2 {
+		t.Fatalf("expected 2 model rounds, got %d", len(*requests))
+	}
+
+	tools, _ := (*options)[0]["tools"].([]any)
+	if len(tools) != 1 || (*options)[0]["tool_choice"] != "auto" {
+		t.Fatalf("expected native tool definitions in request options, got %#v", (*options)[0])
+	}
+	function, _ := tools[0].(map[string]any)["function"].(map[string]any)
+	params, _ := function["parameters"].(map[string]any)
+	properties, _ := params["properties"].(map[string]any)
+	if b, _ := properties["b"].(map[string]any); b["type"] != "number" || b["description"] != "second addend" {
+		t.Fatalf("unexpected tool parameters schema: %#v", params)
+	}
+	for _, message := range (*requests)[0] {
+		if content, ok := message["content"].(string); ok && strings.Contains(content, "[TOOLS]") {
+			t.Fatalf("native mode must not render tools into the prompt text")
+		}
+	}
+	assistant := (*requests)[1][len((*requests)[1])-2]
+	if calls, _ := assistant["tool_calls"].([]any); assistant["role"] != "assistant" || len(calls) != 1 {
+		t.Fatalf("expected assistant tool_calls message before tool result, got %#v", assistant)
+	}
+
+	steps, err := response.Result.GetToolSteps(ctx)
+	if err != nil {
+		t.Fatalf("GetToolSteps failed: %v", err)
+	}
+	if len(steps) != 1 || steps[0].Round != 1 || steps[0].Name != "sum" || steps[0].Result != 7 {
+		t.Fatalf("unexpected tool steps: %#v", steps)
+	}
+}
+
+func TestToolExtensionNativeToolLoopMaxRounds(t *testing.T) {
+	agent, requests, options := newNativeToolAgent(t, func(call int, _ []map[string]any) []types.ResponseMessage {
+		if call <= 2 {
+			return sumToolCallMessages(fmt.Sprintf("call_%d", call), `{"a":1,"b":1}`)
+		}
+		return []types.ResponseMessage{{Event: types.ResponseEventDone, Data: "forced answer"}}
+	})
+	agent.SetSettings("tool.max_rounds", 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	agent.Input("loop forever")
+	response := agent.GetResponse()
+	text, err := response.Result.GetText(ctx)
+	if err != nil {
+		t.Fatalf("GetText failed: %v", err)
+	}
+	if text != "forced answer" || len(*requests) != 3 {
+		t.Fatalf("expected final answer after 2 tool rounds, got %q with %d requests", text, len(*requests))
+	}
+	if (*options)[2]["tool_choice"] != "none" {
+		t.Fatalf("last round should disable tool calls, got %#v", (*options)[2]["tool_choice"])
+	}
+	steps, _ := response.Result.GetToolSteps(ctx)
+	if len(steps) != 2 || steps[1].Round != 2 {
+		t.Fatalf("unexpected tool steps: %#v", steps)
+	}
+}
+
+func TestToolExtensionNativeToolLoopKeepsRoundsApart(t *testing.T) {
+	agent, requests, _ := newNativeToolAgent(t, func(call int, messages []map[string]any) []types.ResponseMessage {
+		switch call {
+		case 1:
+			return append([]types.ResponseMessage{{Event: types.ResponseEventDelta, Data: "Let me add. "}}, sumToolCallMessages("call_sum", `{"a":3,"b":4}`)...)
+		case 2:
+			return []types.ResponseMessage{
+				{Event: types.ResponseEventDelta, Data: `{"note":"7"}`},
+				{Event: types.ResponseEventDone, Data: `{"note":"7"}`},
+			}
+		}
+		answer := "clean"
+		for _, message := range messages {
+			if message["role"] == "tool" || message["tool_calls"] != nil {
+				answer = "stale"
+			}
+		}
+		done := fmt.Sprintf(`{"answer":%q}`, answer)
+		return []types.ResponseMessage{
+			{Event: types.ResponseEventDelta, Data: done},
+			{Event: types.ResponseEventDone, Data: done},
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	agent.Input("3+4=?")
+	agent.Output(map[string]any{"answer": "string"})
+	response := agent.GetResponse()
+	stream, err := response.Result.GetGeneratorWithContext(ctx, "all")
+	if err != nil {
+		t.Fatalf("GetGenerator failed: %v", err)
+	}
+	deltas, roundDeltas := "", ""
+	for item := range stream {
+		msg, _ := item.(types.ResponseMessage)
+		switch msg.Event {
+		case types.ResponseEventDelta:
+			deltas += fmt.Sprint(msg.Data)
+		case types.ResponseEventToolRoundDelta:
+			roundDeltas += fmt.Sprint(msg.Data)
+		}
+	}
+	if deltas != `{"note":"7"}` || roundDeltas != "Let me add. " {
+		t.Fatalf("tool round text should not stream as answer deltas, got %q and %q", deltas, roundDeltas)
+	}
+
+	data, err := response.Result.GetData(ctx, core.GetDataOptions{Type: "parsed", EnsureKeys: []string{"answer"}})
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if parsed, _ := data.(map[string]any); parsed["answer"] != "clean" || len(*requests) != 3 {
+		t.Fatalf("retry should not resend the tool messages of the first attempt, got %#v after %d requests", data, len(*requests))
+	}
+}
+
+type reActRequester struct {
+	prompt *core.Prompt
+	script func(prompt *core.Prompt) string
+}
+
+func (r *reActRequester) GenerateRequestData() (types.RequestData, error) {
+	return types.RequestData{}, nil
+}
+
+func (r *reActRequester) RequestModel(_ context.Context, _ types.RequestData) (<-chan types.ResponseMessage, error) {
+	out := make(chan types.ResponseMessage)
+	close(out)
+	return out, nil
+}
+
+func (r *reActRequester) BroadcastResponse(_ context.Context, _ <-chan types.ResponseMessage) (<-chan types.ResponseMessage, error) {
+	done := r.script(r.prompt)
+	out := make(chan types.ResponseMessage, 4)
+	out <- types.ResponseMessage{Event: types.ResponseEventDelta, Data: done}
+	out <- types.ResponseMessage{Event: types.ResponseEventDone, Data: done}
+	close(out)
+	return out, nil
+}
+
+func isReActPlanPrompt(prompt *core.Prompt) bool {
+	output, _ := prompt.Get("output", nil, true).(map[string]any)
+	_, ok := output["action"]
+	return ok
+}
+
+func newReActAgent(t *testing.T, script func(prompt *core.Prompt) string) (*agentextensions.Agent, *[]string) {
+	t.Helper()
+	manager := newToolJudgementPluginManager(&atomic.Int32{})
+	_ = manager.Register(core.PluginTypeModelRequester, core.PluginSpec{
+		Name: "ReActRequester",
+		Creator: core.ModelRequesterCreator(func(prompt *core.Prompt, _ *utils.Settings) core.ModelRequester {
+			return &reActRequester{prompt: prompt, script: script}
+		}),
+	}, true)
+	agent := agentextensions.NewAgent(manager, core.NewDefaultSettings(nil), "react-tools")
+	agent.SetSettings("tool.mode", "react")
+	lookups := make([]string, 0)
+	if err := agent.RegisterTool(types.ToolInfo{
+		Name:   "lookup",
+		Desc:   "look up a fact",
+		Kwargs: map[string]any{"q": "string"},
+	}, func(kwargs map[string]any) (any, error) {
+		query := fmt.Sprint(kwargs["q"])
+		lookups = append(lookups, query)
+		return "fact about " + query, nil
+	}); err != nil {
+		t.Fatalf("register tool failed: %v", err)
+	}
+	return agent, &lookups
+}
+
+func TestToolExtensionReActChainsLookups(t *testing.T) {
+	plans := []string{
+		`{"thought":"need the capital","action":"lookup","kwargs":{"q":"capital"}}`,
+		`{"thought":"need the population","action":"lookup","kwargs":{"q":"population"}}`,
+		`{"thought":"enough","action":"final","kwargs":{}}`,
+	}
+	planCall := 0
+	agent, lookups := newReActAgent(t, func(prompt *core.Prompt) string {
+		if isReActPlanPrompt(prompt) {
+			planCall++
+			return plans[planCall-1]
+		}
+		results, _ := prompt.Get("action_results", nil, true).(map[string]any)
+		if results["step 1: lookup"] == "fact about capital" && results["step 2: lookup"] == "fact about population" {
+			return "chained"
+		}
+		return fmt.Sprintf("missing results: %#v", results)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	agent.Input("tell me about the country")
+	response := agent.GetResponse()
+	text, err := response.Result.GetText(ctx)
+	if err != nil {
+		t.Fatalf("react request failed: %v", err)
+	}
+	if text != "chained" {
+		t.Fatalf("unexpected answer %q", text)
+	}
+	if len(*lookups) != 2 {
+		t.Fatalf("expected 2 lookups, got %v", *lookups)
+	}
+	trace, err := response.Result.GetToolTrace(ctx)
+	if err != nil {
+		t.Fatalf("GetToolTrace failed: %v", err)
+	}
+	if len(trace) != 3 || trace[0].Thought != "need the capital" || trace[1].Observation != "fact about population" || trace[2].Action != "final" {
+		t.Fatalf("unexpected trace: %#v", trace)
+	}
+}
+
+func TestToolExtensionReActStopsOnRepeatedCallAndStepLimit(t *testing.T) {
+	agent, lookups := newReActAgent(t, func(prompt *core.Prompt) string {
+		if isReActPlanPrompt(prompt) {
+			return `{"thought":"again","action":"lookup","kwargs":{"q":"same"}}`
+		}
+		return "answer"
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	agent.Input("loop")
+	response := agent.GetResponse()
+	trace, err := response.Result.GetToolTrace(ctx)
+	if err != nil {
+		t.Fatalf("GetToolTrace failed: %v", err)
+	}
+	if len(*lookups) != 1 || len(trace) != 2 || !strings.Contains(trace[1].Error, "repeated") {
+		t.Fatalf("expected loop detection after one lookup, got lookups=%v trace=%#v", *lookups, trace)
+	}
+
+	step := 0
+	agent, lookups = newReActAgent(t, func(prompt *core.Prompt) string {
+		if isReActPlanPrompt(prompt) {
+			step++
+			return fmt.Sprintf(`{"thought":"more","action":"lookup","kwargs":{"q":"q%d"}}`, step)
+		}
+		return "answer"
+	})
+	agent.SetSettings("tool.react.max_steps", 2)
+	agent.Input("endless")
+	response = agent.GetResponse()
+	trace, err = response.Result.GetToolTrace(ctx)
+	if err != nil {
+		t.Fatalf("GetToolTrace failed: %v", err)
+	}
+	if len(*lookups) != 2 || len(trace) != 2 {
+		t.Fatalf("expected step limit of 2, got lookups=%v trace=%#v", *lookups, trace)
+	}
+}
+
+func nativeToolNames(options map[string]any) []string {
+	tools, _ := options["tools"].([]any)
+	names := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		function, _ := tool.(map[string]any)["function"].(map[string]any)
+		names = append(names, fmt.Sprint(function["name"]))
+	}
+	return names
+}
+
+func TestToolExtensionScopes(t *testing.T) {
+	answer := func(int, []map[string]any) []types.ResponseMessage {
+		return []types.ResponseMessage{{Event: types.ResponseEventDone, Data: "ok"}}
+	}
+	agent, _, options := newNativeToolAgent(t, answer)
+	twin, _, twinOptions := newNativeToolAgent(t, answer)
+
+	global, err := core.NewTool(agent.PluginManager(), core.NewDefaultSettings(nil))
+	if err != nil {
+		t.Fatalf("create global tool failed: %v", err)
+	}
+	agent.SetGlobalTool(global)
+	twin.SetGlobalTool(global)
+	if err := global.Manager().Register(types.ToolInfo{Name: "search"}, func() string { return "found" }); err != nil {
+		t.Fatalf("register global tool failed: %v", err)
+	}
+	if err := agent.UseTools([]string{"search"}); err != nil {
+		t.Fatalf("use global tool failed: %v", err)
+	}
+	if err := agent.RegisterTool(types.ToolInfo{Name: "shared_note"}, func() string { return "note" }, agentextensions.WithToolScope(core.ToolScopeGlobal)); err != nil {
+		t.Fatalf("register global-scoped tool failed: %v", err)
+	}
+	if err := agent.RegisterTool(types.ToolInfo{Name: "tenant_lookup"}, func() string { return "tenant" }, agentextensions.WithToolScope(core.ToolScopeRequest)); err != nil {
+		t.Fatalf("register request-scoped tool failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+	for _, a := range []*agentextensions.Agent{agent, agent, twin} {
+		a.Input("hi")
+		if _, err := a.GetText(ctx); err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+	}
+
+	first := strings.Join(nativeToolNames((*options)[0]), ",")
+	if first != "search,shared_note,sum,tenant_lookup" {
+		t.Fatalf("unexpected tools for first request: %s", first)
+	}
+	if second := strings.Join(nativeToolNames((*options)[1]), ","); second != "search,shared_note,sum" {
+		t.Fatalf("request-scoped tool leaked into the next request: %s", second)
+	}
+	if other := strings.Join(nativeToolNames((*twinOptions)[0]), ","); other != "sum" {
+		t.Fatalf("agent with the same name must not see global tools it did not use: %s", other)
+	}
+
+	if err := agent.UnregisterTools([]string{"search"}, agentextensions.WithToolScope(core.ToolScopeGlobal)); err != nil {
+		t.Fatalf("detach global tool failed: %v", err)
+	}
+	if err := agent.UnregisterTools([]string{"sum"}); err != nil {
+		t.Fatalf("unregister agent tool failed: %v", err)
+	}
+	if _, ok := global.Manager().GetToolFunc("search"); !ok {
+		t.Fatalf("detaching must keep the global tool for other agents")
+	}
+	agent.Input("hi")
+	if _, err := agent.GetText(ctx); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if last := strings.Join(nativeToolNames((*options)[2]), ","); last != "shared_note" {
+		t.Fatalf("unexpected tools after unregister: %s", last)
+	}
+}
+
+func TestToolExtensionRejectsInvalidKwargs(t *testing.T) {
+	agent, _, _ := newNativeToolAgent(t, func(call int, messages []map[string]any) []types.ResponseMessage {
+		if call == 1 {
+			return sumToolCallMessages("call_sum", `{"a":3}`)
+		}
+		last := messages[len(messages)-1]
+		answer := "not-reported"
+		if content, _ := last["content"].(string); strings.Contains(content, `"invalid_kwargs"`) && strings.Contains(content, "missing required kwargs: b") {
+			answer = "reported"
+		}
+		return []types.ResponseMessage{
+			{Event: types.ResponseEventDelta, Data: answer},
+			{Event: types.ResponseEventDone, Data: answer},
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	agent.Input("3+?=?")
+	response := agent.GetResponse()
+	if text, err := response.Result.GetText(ctx); err != nil || text != "reported" {
+		t.Fatalf("invalid kwargs should be reported to the model, got %q %v", text, err)
+	}
+	steps, _ := response.Result.GetToolSteps(ctx)
+	if len(steps) != 1 || steps[0].Result != nil || len(steps[0].InvalidKwargs) != 1 || steps[0].InvalidKwargs[0].Kwarg != "b" {
+		t.Fatalf("unexpected tool steps: %#v", steps)
+	}
+}
+
+func TestToolExtensionJudgeRetriesInvalidKwargsOnce(t *testing.T) {
+	fixRequests := 0
+	agent, lookups := newReActAgent(t, func(prompt *core.Prompt) string {
+		output, _ := prompt.Get("output", nil, true).(map[string]any)
+		switch {
+		case output["use_tool"] != nil:
+			return `{"use_tool":true,"tool_command":{"purpose":"fact","tool_name":"lookup","tool_kwargs":{"query":"capital"}}}`
+		case output["tool_kwargs"] != nil:
+			fixRequests++
+			info, _ := prompt.Get("info", nil, true).(map[string]any)
+			if !strings.Contains(fmt.Sprint(info["problems"]), "missing required kwargs: q") {
+				return `{"tool_kwargs":{}}`
+			}
+			return `{"tool_kwargs":{"q":"capital"}}`
+		}
+		results, _ := prompt.Get("action_results", nil, true).(map[string]any)
+		return fmt.Sprint(results["fact"])
+	})
+	agent.SetSettings("tool.mode", "judge")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	agent.Input("what is the capital?")
+	text, err := agent.GetText(ctx)
+	if err != nil || !strings.Contains(text, "missing required kwargs: q") || fixRequests != 0 || len(*lookups) != 0 {
+		t.Fatalf("without retry the error should reach the answer, got %q %v fixes=%d", text, err, fixRequests)
+	}
+
+	agent.SetSettings("tool.kwargs.retry", true)
+	agent.Input("what is the capital?")
+	text, err = agent.GetText(ctx)
+	if err != nil || text != "fact about capital" || fixRequests != 1 {
+		t.Fatalf("expected one kwargs fix and a successful call, got %q %v fixes=%d", text, err, fixRequests)
+	}
+	if len(*lookups) != 1 || (*lookups)[0] != "capital" {
+		t.Fatalf("unexpected lookups: %v", *lookups)
+	}
+}
+
+func TestToolExtensionReportsDeniedToolCalls(t *testing.T) {
+	agent, _, _ := newNativeToolAgent(t, func(call int, messages []map[string]any) []types.ResponseMessage {
+		if call == 1 {
+			return sumToolCallMessages("call_sum", `{"a":3,"b":4}`)
+		}
+		last := messages[len(messages)-1]
+		answer := "not-reported"
+		if content, _ := last["content"].(string); last["role"] == "tool" && strings.Contains(content, "tool call denied: sum: no sums today") {
+			answer = "reported"
+		}
+		return []types.ResponseMessage{
+			{Event: types.ResponseEventDelta, Data: answer},
+			{Event: types.ResponseEventDone, Data: answer},
+		}
+	})
+	if err := agent.Tool().Manager().Tag([]string{"sum"}, []string{types.ToolTagRequiresApproval}); err != nil {
+		t.Fatalf("tag failed: %v", err)
+	}
+	var asked []types.ToolApprovalRequest
+	agent.SetToolApprover(func(_ context.Context, request types.ToolApprovalRequest) (types.ToolApprovalDecision, error) {
+		asked = append(asked, request)
+		return types.ToolApprovalDecision{Action: types.ToolApprovalDeny, Reason: "no sums today"}, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	agent.Input("3+4=?")
+	response := agent.GetResponse()
+	if text, err := response.Result.GetText(ctx); err != nil || text != "reported" {
+		t.Fatalf("denials should be reported to the model, got %q %v", text, err)
+	}
+	if len(asked) != 1 || asked[0].Tool != "sum" || toFloat64(asked[0].Kwargs["a"]) != 3 {
+		t.Fatalf("unexpected approval requests: %#v", asked)
+	}
+}
+
+func TestToolExtensionIdempotentToolSurvivesEnsureRetry(t *testing.T) {
+	planCall, answerCall := 0, 0
+	agent, _ := newReActAgent(t, func(prompt *core.Prompt) string {
+		if isReActPlanPrompt(prompt) {
+			planCall++
+			if planCall%2 == 1 {
+				return `{"thought":"notify","action":"send_email","kwargs":{"to":"ops@example.com"}}`
+			}
+			return `{"thought":"done","action":"final","kwargs":{}}`
+		}
+		answerCall++
+		results, _ := prompt.Get("action_results", nil, true).(map[string]any)
+		if answerCall == 1 {
+			return `{"status":"drafted"}`
+		}
+		return fmt.Sprintf(`{"status":%q,"sent":true}`, fmt.Sprint(results["step 1: send_email"]))
+	})
+	var sent []string
+	if err := agent.RegisterTool(types.ToolInfo{
+		Name:       "send_email",
+		Desc:       "send an email",
+		Kwargs:     map[string]any{"to": "string"},
+		Idempotent: true,
+	}, func(ctx context.Context, kwargs map[string]any) (any, error) {
+		sent = append(sent, core.ToolIdempotencyKey(ctx))
+		return fmt.Sprintf("mail %d to %v", len(sent), kwargs["to"]), nil
+	}); err != nil {
+		t.Fatalf("register tool failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	agent.Input("notify ops")
+	agent.Output(map[string]any{"status": "string", "sent": "boolean"})
+	data, err := agent.GetResponse().Result.GetData(ctx, core.GetDataOptions{Type: "parsed", EnsureKeys: []string{"sent"}})
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if parsed, _ := data.(map[string]any); parsed["status"] != "mail 1 to ops@example.com" || answerCall != 2 || planCall != 4 {
+		t.Fatalf("retry should reuse the sent mail, got %#v (answers %d, plans %d)", data, answerCall, planCall)
+	}
+	if len(sent) != 1 || sent[0] == "" {
+		t.Fatalf("the email should be sent once with an idempotency key, got %#v", sent)
+	}
+
+	agent.Input("notify ops again")
+	if _, err := agent.GetResponse().Result.GetText(ctx); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if len(sent) != 2 || sent[1] == sent[0] {
+		t.Fatalf("a new response should send again with a new key, got %#v", sent)
+	}
+}
+
+func TestToolExtensionSessionScopedToolCache(t *testing.T) {
+	agent, _ := newReActAgent(t, func(prompt *core.Prompt) string {
+		if isReActPlanPrompt(prompt) {
+			if _, done := prompt.Get("action_results", nil, true).(map[string]any); done {
+				return `{"thought":"done","action":"final","kwargs":{}}`
+			}
+			return `{"thought":"check","action":"rates","kwargs":{"base":"USD"}}`
+		}
+		return "ok"
+	})
+	calls := 0
+	if err := agent.RegisterTool(types.ToolInfo{
+		Name:   "rates",
+		Desc:   "exchange rates",
+		Kwargs: map[string]any{"base": "string"},
+		Cache:  &types.ToolCache{Scope: types.ToolCacheScopeSession},
+	}, func(kwargs map[string]any) (any, error) {
+		calls++
+		return calls, nil
+	}); err != nil {
+		t.Fatalf("register tool failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+	ask := func() {
+		t.Helper()
+		agent.Input("rates?")
+		if _, err := agent.GetResponse().Result.GetText(ctx); err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+	}
+
+	agent.ActivateSession("s1")
+	ask()
+	ask()
+	if calls != 1 {
+		t.Fatalf("the session should reuse the result, got %d calls", calls)
+	}
+	agent.ActivateSession("s2")
+	ask()
+	agent.DeactivateSession()
+	ask()
+	ask()
+	if calls != 4 {
+		t.Fatalf("other sessions and requests without a session should not share results, got %d calls", calls)
+	}
+}
+
+func TestToolExtensionRecordsToolCallsInSession(t *testing.T) {
+	agent, requests, _ := newNativeToolAgent(t, func(call int, _ []map[string]any) []types.ResponseMessage {
+		if call == 1 {
+			return sumToolCallMessages("call_sum", `{"a":3,"b":4}`)
+		}
+		return []types.ResponseMessage{
+			{Event: types.ResponseEventDelta, Data: "seven"},
+			{Event: types.ResponseEventDone, Data: "seven"},
+		}
+	})
+	agent.ActivateSession("tool-history")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+	for _, input := range []string{"3+4=?", "and doubled?"} {
+		agent.Input(input)
+		if _, err := agent.GetResponse().Result.GetText(ctx); err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+	}
+
+	history := agent.ActiveSession().FullContext()
+	if len(history) != 6 || len(history[1].ToolCalls) != 1 || history[1].ToolCalls[0].Arguments != `{"a":3,"b":4}` || history[2].Role != "tool" || history[2].ToolCallID != "call_sum" || history[2].Content != "7" {
+		t.Fatalf("tool calls should be recorded between the turns: %#v", history)
+	}
+	third := (*requests)[2]
+	roles := make([]string, 0, len(third))
+	for _, message := range third {
+		roles = append(roles, fmt.Sprint(message["role"]))
+	}
+	if strings.Join(roles, ",") != "user,assistant,tool,assistant,user" || third[2]["tool_call_id"] != "call_sum" {
+		t.Fatalf("the next request should replay the tool messages: %v %#v", roles, third)
+	}
+}
+
+func TestToolExtensionSharesConcurrencyAcrossManagers(t *testing.T) {
+	names := []string{"agent_a", "global_a", "agent_b", "global_b", "agent_c", "global_c"}
+	agent, _, _ := newNativeToolAgent(t, func(call int, _ []map[string]any) []types.ResponseMessage {
+		if call > 1 {
+			return []types.ResponseMessage{{Event: types.ResponseEventDone, Data: "ok"}}
+		}
+		deltas := make([]any, 0, len(names))
+		for i, name := range names {
+			deltas = append(deltas, map[string]any{
+				"index": float64(i), "id": "call_" + name, "type": "function",
+				"function": map[string]any{"name": name, "arguments": "{}"},
+			})
+		}
+		return []types.ResponseMessage{
+			{Event: types.ResponseEventToolCalls, Data: deltas},
+			{Event: types.ResponseEventDone, Data: ""},
+			{Event: types.ResponseEventOriginalDone, Data: map[string]any{"finish_reason": "tool_calls"}},
+		}
+	})
+	agent.SetSettings("tool.concurrency", 2)
+
+	var running, peak atomic.Int32
+	slow := func() string {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			seen := peak.Load()
+			if current <= seen || peak.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		time.Sleep(30 * time.Millisecond)
+		return "done"
+	}
+	global, err := core.NewTool(agent.PluginManager(), core.NewDefaultSettings(nil))
+	if err != nil {
+		t.Fatalf("create global tool failed: %v", err)
+	}
+	agent.SetGlobalTool(global)
+	for _, name := range names {
+		if strings.HasPrefix(name, "global_") {
+			if err := global.Manager().Register(types.ToolInfo{Name: name}, slow); err != nil {
+				t.Fatalf("register global tool failed: %v", err)
+			}
+			if err := agent.UseTools([]string{name}); err != nil {
+				t.Fatalf("use global tool failed: %v", err)
+			}
+		} else if err := agent.RegisterTool(types.ToolInfo{Name: name}, slow); err != nil {
+			t.Fatalf("register agent tool failed: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+	agent.Input("run everything")
+	if _, err := agent.GetText(ctx); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if got := peak.Load(); got != 2 {
+		t.Fatalf("tool.concurrency should bound calls across managers, peak=%d", got)
+	}
+}
+
+func TestToolExtensionRequestScopeIsSnapshotted(t *testing.T) {
+	agent, _, options := newNativeToolAgent(t, func(int, []map[string]any) []types.ResponseMessage {
+		return []types.ResponseMessage{{Event: types.ResponseEventDone, Data: "ok"}}
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("tenant_%d", i)
+			if err := agent.RegisterTool(types.ToolInfo{Name: name}, func() string { return name }, agentextensions.WithToolScope(core.ToolScopeRequest)); err != nil {
+				t.Errorf("register %s failed: %v", name, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	pending, err := agent.Request().RequestTool()
+	if err != nil {
+		t.Fatalf("request tool failed: %v", err)
+	}
+	agent.Input("hi")
+	response := agent.GetResponse()
+	if err := pending.Manager().Register(types.ToolInfo{Name: "late"}, func() string { return "late" }); err != nil {
+		t.Fatalf("register late tool failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+	if _, err := response.Result.GetTextWithContext(ctx); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	names := strings.Join(nativeToolNames((*options)[0]), ",")
+	if names != "sum,tenant_0,tenant_1,tenant_2,tenant_3,tenant_4,tenant_5,tenant_6,tenant_7" {
+		t.Fatalf("the response should keep the request tools registered before it was created: %s", names)
+	}
+}
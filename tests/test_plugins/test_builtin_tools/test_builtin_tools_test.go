@@ -0,0 +1,338 @@
+package builtintools_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tm "github.com/AgentEra/Agently-Go/agently/builtins/plugins/tool_manager"
+	"github.com/AgentEra/Agently-Go/agently/builtins/tools"
+	"github.com/AgentEra/Agently-Go/agently/core"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+func newToolManager(t *testing.T, builtins []tools.Tool, tags ...string) core.ToolManager {
+	t.Helper()
+	settings := utils.NewSettings("Tool-Settings", map[string]any{}, core.NewDefaultSettings(nil))
+	manager := tm.New(settings)
+	if err := tools.Register(manager, builtins, tags...); err != nil {
+		t.Fatalf("register builtin tools failed: %v", err)
+	}
+	return manager
+}
+
+func TestCmdTool(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cmd := &tools.Cmd{AllowedCommands: []string{"echo", "pwd", "sleep", "ls"}, WorkDir: root}
+	manager := newToolManager(t, cmd.Tools(), "shell")
+	ctx := context.Background()
+
+	if names := manager.GetToolList([]string{"shell", tools.Tag}); len(names) != 1 || names[0].Name != "cmd" {
+		t.Fatalf("cmd should be registered with tags: %#v", names)
+	}
+	if _, ok := manager.GetToolInfo(nil)["cmd"].Kwargs["command"]; !ok {
+		t.Fatalf("cmd kwargs should be derived from CmdArgs")
+	}
+
+	value, err := manager.CallTool(ctx, "cmd", map[string]any{"command": "echo", "args": []any{"hello", "$HOME;", "`id`"}})
+	result, _ := value.(tools.CmdResult)
+	if err != nil || result.Stdout != "hello $HOME; `id`\n" || result.ExitCode != 0 {
+		t.Fatalf("arguments should pass through without a shell: %#v %v", value, err)
+	}
+
+	for _, command := range []string{"rm", "/bin/echo", "../echo", ""} {
+		if _, err := cmd.Run(ctx, tools.CmdArgs{Command: command}); err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Fatalf("command %q should be rejected, got %v", command, err)
+		}
+	}
+
+	result, err = cmd.Run(ctx, tools.CmdArgs{Command: "pwd", Dir: "sub"})
+	resolvedRoot, _ := filepath.EvalSymlinks(root)
+	if err != nil || strings.TrimSpace(result.Stdout) != filepath.Join(resolvedRoot, "sub") {
+		t.Fatalf("unexpected pwd result: %#v %v", result, err)
+	}
+	for _, dir := range []string{"..", "../..", "/"} {
+		if _, err := cmd.Run(ctx, tools.CmdArgs{Command: "pwd", Dir: dir}); err == nil || !strings.Contains(err.Error(), "outside") {
+			t.Fatalf("dir %q should escape the jail, got %v", dir, err)
+		}
+	}
+
+	result, err = cmd.Run(ctx, tools.CmdArgs{Command: "ls", Args: []string{"missing-file"}})
+	if err != nil || result.ExitCode == 0 || result.Stderr == "" {
+		t.Fatalf("non-zero exit should be reported in the result: %#v %v", result, err)
+	}
+
+	limited := &tools.Cmd{AllowedCommands: []string{"echo", "sleep"}, WorkDir: root, MaxOutput: 4, Timeout: 100 * time.Millisecond}
+	result, err = limited.Run(ctx, tools.CmdArgs{Command: "echo", Args: []string{"truncate me"}})
+	if err != nil || result.Stdout != "trun" || !result.Truncated {
+		t.Fatalf("output should be truncated: %#v %v", result, err)
+	}
+	started := time.Now()
+	result, err = limited.Run(ctx, tools.CmdArgs{Command: "sleep", Args: []string{"5"}})
+	if err != nil || !result.TimedOut || time.Since(started) > 3*time.Second {
+		t.Fatalf("sleep should time out: %#v %v", result, err)
+	}
+}
+
+func TestCmdToolConfinesArgsAndUsesEnvPath(t *testing.T) {
+	root := t.TempDir()
+	ctx := context.Background()
+	cmd := &tools.Cmd{AllowedCommands: []string{"ls", "greet"}, WorkDir: root}
+	for _, arg := range []string{"/etc", "..", "sub/../../etc", "--file=/etc/passwd", "~/secrets", "-f/etc/passwd", "-o../x", "-xf/etc", "if=/etc/shadow", "of=out=../x"} {
+		if _, err := cmd.Run(ctx, tools.CmdArgs{Command: "ls", Args: []string{arg}}); err == nil || !strings.Contains(err.Error(), "outside the work dir") {
+			t.Fatalf("argument %q should be rejected, got %v", arg, err)
+		}
+	}
+	if result, err := cmd.Run(ctx, tools.CmdArgs{Command: "ls", Args: []string{"-a", "./"}}); err != nil || result.ExitCode != 0 {
+		t.Fatalf("relative arguments should pass: %#v %v", result, err)
+	}
+	open := &tools.Cmd{AllowedCommands: []string{"ls"}, WorkDir: root, AllowPathArgs: true}
+	if result, err := open.Run(ctx, tools.CmdArgs{Command: "ls", Args: []string{"/"}}); err != nil || result.ExitCode != 0 {
+		t.Fatalf("AllowPathArgs should pass absolute arguments: %#v %v", result, err)
+	}
+
+	// The binary comes from the PATH of Env, not the process PATH.
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "greet"), []byte("#!/bin/sh\necho from env\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cmd.Run(ctx, tools.CmdArgs{Command: "greet"}); err == nil {
+		t.Fatalf("greet should not be found in the process PATH")
+	}
+	withEnv := &tools.Cmd{AllowedCommands: []string{"greet", "ls"}, WorkDir: root, Env: []string{"PATH=" + bin}}
+	if result, err := withEnv.Run(ctx, tools.CmdArgs{Command: "greet"}); err != nil || result.Stdout != "from env\n" {
+		t.Fatalf("greet should run from the Env PATH: %#v %v", result, err)
+	}
+	if _, err := withEnv.Run(ctx, tools.CmdArgs{Command: "ls"}); err == nil || !strings.Contains(err.Error(), "PATH of Env") {
+		t.Fatalf("ls should not be found in the Env PATH, got %v", err)
+	}
+}
+
+func TestCmdToolUsesMinimalEnv(t *testing.T) {
+	root := t.TempDir()
+	ctx := context.Background()
+	t.Setenv("AGENTLY_CMD_SECRET", "leak")
+	cmd := &tools.Cmd{AllowedCommands: []string{"env"}, WorkDir: root}
+	result, err := cmd.Run(ctx, tools.CmdArgs{Command: "env"})
+	if err != nil || result.ExitCode != 0 {
+		t.Fatalf("env failed: %#v %v", result, err)
+	}
+	if strings.Contains(result.Stdout, "AGENTLY_CMD_SECRET") || !strings.Contains(result.Stdout, "HOME="+root+"\n") ||
+		!strings.Contains(result.Stdout, "PATH=") {
+		t.Fatalf("expected only PATH, LANG and HOME set to the work dir, got %q", result.Stdout)
+	}
+
+	inherit := &tools.Cmd{AllowedCommands: []string{"env"}, WorkDir: root, InheritEnv: true}
+	if result, err := inherit.Run(ctx, tools.CmdArgs{Command: "env"}); err != nil || !strings.Contains(result.Stdout, "AGENTLY_CMD_SECRET=leak") {
+		t.Fatalf("InheritEnv should pass the process environment: %#v %v", result, err)
+	}
+}
+
+func TestFileTools(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	mustWrite := func(path string, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustWrite(filepath.Join(root, "notes.txt"), "hello notes")
+	mustWrite(filepath.Join(root, "big.txt"), strings.Repeat("x", 100))
+	mustWrite(filepath.Join(root, "blob.bin"), "a\x00b")
+	mustWrite(filepath.Join(outside, "secret.txt"), "secret")
+	if err := os.Mkdir(filepath.Join(root, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	files := &tools.Files{Roots: []string{root}, MaxFileBytes: 32}
+	manager := newToolManager(t, files.Tools())
+	ctx := context.Background()
+
+	value, err := manager.CallTool(ctx, "read_file", map[string]any{"path": "notes.txt"})
+	read, _ := value.(tools.ReadFileResult)
+	if err != nil || read.Content != "hello notes" || read.Truncated {
+		t.Fatalf("unexpected read_file result: %#v %v", value, err)
+	}
+	if read, err := files.ReadFile(ctx, tools.ReadFileArgs{Path: filepath.Join(root, "big.txt")}); err != nil || len(read.Content) != 32 || !read.Truncated || read.Size != 100 {
+		t.Fatalf("large files should be truncated: %#v %v", read, err)
+	}
+	if _, err := files.ReadFile(ctx, tools.ReadFileArgs{Path: "blob.bin"}); err == nil {
+		t.Fatalf("binary files should be rejected")
+	}
+	for _, path := range []string{"../" + filepath.Base(outside) + "/secret.txt", filepath.Join(outside, "secret.txt"), "escape/secret.txt"} {
+		if _, err := files.ReadFile(ctx, tools.ReadFileArgs{Path: path}); err == nil || !strings.Contains(err.Error(), "outside the allowed roots") {
+			t.Fatalf("path %q should be rejected, got %v", path, err)
+		}
+	}
+	if _, err := files.ReadFile(ctx, tools.ReadFileArgs{Path: "missing.txt"}); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("missing files should be reported, got %v", err)
+	}
+
+	value, err = manager.CallTool(ctx, "list_dir", map[string]any{})
+	listed, _ := value.(tools.ListDirResult)
+	if err != nil || len(listed.Entries) != 5 {
+		t.Fatalf("unexpected list_dir result: %#v %v", value, err)
+	}
+	types := map[string]string{}
+	for _, entry := range listed.Entries {
+		types[entry.Name] = entry.Type
+	}
+	if types["docs"] != "dir" || types["escape"] != "symlink" || types["notes.txt"] != "file" {
+		t.Fatalf("unexpected entry types: %#v", types)
+	}
+	if _, err := files.ListDir(ctx, tools.ListDirArgs{Path: "escape"}); err == nil {
+		t.Fatalf("listing through a symlink out of the roots should be rejected")
+	}
+	capped := &tools.Files{Roots: []string{root}, MaxEntries: 2}
+	if listed, err := capped.ListDir(ctx, tools.ListDirArgs{}); err != nil || len(listed.Entries) != 2 || !listed.Truncated {
+		t.Fatalf("entries should be capped: %#v %v", listed, err)
+	}
+}
+
+const testPage = `<!DOCTYPE html>
+<html><head><title>Test &amp; Page</title><style>body { color: red }</style></head>
+<body>
+<script>alert("no")</script>
+<!-- a comment -->
+<h1>Main   Heading</h1>
+<p>First <strong>bold</strong> paragraph with a <a href="/docs/intro">relative link</a>.</p>
+<ul><li>one</li><li>two<ol><li>nested</li></ol></li></ul>
+<pre>line 1
+  line 2</pre>
+<p>Caf&eacute; &lt;tag&gt;</p>
+</body></html>`
+
+func TestBrowseTool(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(testPage))
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(strings.Repeat("abc", 100)))
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte{0x89, 'P', 'N', 'G'})
+	})
+	mux.HandleFunc("/away", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://example.invalid/", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	browse := &tools.Browse{AllowedHosts: []string{"127.0.0.1"}, AllowPrivateNetworks: true}
+	manager := newToolManager(t, browse.Tools())
+	ctx := context.Background()
+
+	value, err := manager.CallTool(ctx, "browse", map[string]any{"url": server.URL + "/page"})
+	page, _ := value.(tools.BrowseResult)
+	if err != nil || page.Title != "Test & Page" {
+		t.Fatalf("unexpected browse result: %#v %v", value, err)
+	}
+	expected := strings.Join([]string{
+		"# Main Heading",
+		"",
+		"First **bold** paragraph with a [relative link](" + server.URL + "/docs/intro).",
+		"",
+		"- one",
+		"- two",
+		"  1. nested",
+		"",
+		"```",
+		"line 1",
+		"  line 2",
+		"```",
+		"",
+		"Café <tag>",
+	}, "\n")
+	if page.Content != expected {
+		t.Fatalf("unexpected markdown:\n%s\n--- want ---\n%s", page.Content, expected)
+	}
+
+	capped := &tools.Browse{MaxChars: 10, AllowPrivateNetworks: true}
+	plain, err := capped.Fetch(ctx, tools.BrowseArgs{URL: server.URL + "/plain"})
+	if err != nil || plain.Content != "abcabcabca" || !plain.Truncated {
+		t.Fatalf("content should be capped: %#v %v", plain, err)
+	}
+	small := &tools.Browse{MaxBytes: 6, AllowPrivateNetworks: true}
+	if plain, err := small.Fetch(ctx, tools.BrowseArgs{URL: server.URL + "/plain"}); err != nil || plain.Content != "abcabc" || !plain.Truncated {
+		t.Fatalf("download should be capped: %#v %v", plain, err)
+	}
+
+	for _, target := range []string{"file:///etc/passwd", server.URL + "/image", server.URL + "/missing", server.URL + "/away"} {
+		if _, err := browse.Fetch(ctx, tools.BrowseArgs{URL: target}); err == nil {
+			t.Fatalf("fetching %s should fail", target)
+		}
+	}
+	if _, err := (&tools.Browse{AllowedHosts: []string{"example.com"}}).Fetch(ctx, tools.BrowseArgs{URL: server.URL + "/page"}); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("hosts outside the allowlist should be rejected, got %v", err)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestBrowseRefusesPrivateNetworks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("internal"))
+	}))
+	t.Cleanup(server.Close)
+	ctx := context.Background()
+	browse := &tools.Browse{}
+
+	// Literal addresses are refused up front, names once resolved.
+	localhost := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	for _, target := range []string{server.URL, localhost, "http://[::1]/", "http://169.254.169.254/latest/meta-data"} {
+		if _, err := browse.Fetch(ctx, tools.BrowseArgs{URL: target}); err == nil || !strings.Contains(err.Error(), "private") {
+			t.Fatalf("fetching %s should be refused, got %v", target, err)
+		}
+	}
+
+	// A public page redirecting to an internal address.
+	redirecting := &tools.Browse{Client: &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host != "public.example" {
+			t.Fatalf("the redirect must not be followed to %s", req.URL)
+		}
+		return &http.Response{
+			StatusCode: http.StatusFound,
+			Header:     http.Header{"Location": []string{server.URL}},
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	})}}
+	if _, err := redirecting.Fetch(ctx, tools.BrowseArgs{URL: "http://public.example/"}); err == nil || !strings.Contains(err.Error(), "private") {
+		t.Fatalf("redirects to private addresses should be refused, got %v", err)
+	}
+
+	// A custom dialer resolving a public name to an internal address.
+	rebinding := &tools.Browse{Client: &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	}}}
+	if _, err := rebinding.Fetch(ctx, tools.BrowseArgs{URL: "http://public.example/"}); err == nil || !strings.Contains(err.Error(), "private") {
+		t.Fatalf("connections to private addresses should be refused, got %v", err)
+	}
+
+	allowed := &tools.Browse{AllowPrivateNetworks: true}
+	if page, err := allowed.Fetch(ctx, tools.BrowseArgs{URL: localhost}); err != nil || page.Content != "internal" {
+		t.Fatalf("AllowPrivateNetworks should allow internal hosts: %#v %v", page, err)
+	}
+}
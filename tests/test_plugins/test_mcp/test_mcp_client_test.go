@@ -0,0 +1,473 @@
+package mcp_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AgentEra/Agently-Go/agently/builtins/mcp"
+	tm "github.com/AgentEra/Agently-Go/agently/builtins/plugins/tool_manager"
+	"github.com/AgentEra/Agently-Go/agently/core"
+	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+const testServerEnv = "AGENTLY_MCP_TEST_SERVER"
+
+// TestMain turns the test binary into a stdio MCP server when it is spawned
+// by the stdio tests: the fake server for client tests, or the Agently server.
+func TestMain(m *testing.M) {
+	switch os.Getenv(testServerEnv) {
+	case "stdio":
+		serveStdio()
+		os.Exit(0)
+	case "agently":
+		serveAgentlyStdio()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   any             `json:"error,omitempty"`
+}
+
+// fakeServer implements the MCP methods the client needs. notify is used for
+// server-initiated notifications.
+type fakeServer struct {
+	mu        sync.Mutex
+	extra     bool
+	cancelled map[string]chan struct{}
+	notify    func(rpcMessage)
+}
+
+func newFakeServer(notify func(rpcMessage)) *fakeServer {
+	return &fakeServer{cancelled: map[string]chan struct{}{}, notify: notify}
+}
+
+func (s *fakeServer) tools() []map[string]any {
+	tools := []map[string]any{
+		{
+			"name":        "add",
+			"description": "add two numbers",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"a": map[string]any{"type": "number", "description": "first"},
+					"b": map[string]any{"type": "number"},
+				},
+				"required": []any{"a", "b"},
+			},
+		},
+		{"name": "fail", "inputSchema": map[string]any{"type": "object"}},
+		{"name": "slow", "inputSchema": map[string]any{"type": "object"}},
+		{"name": "enable_extra", "inputSchema": map[string]any{"type": "object"}},
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.extra {
+		tools = append(tools, map[string]any{
+			"name":        "extra",
+			"description": "appears after a list change",
+			"inputSchema": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"mode": map[string]any{"type": "string", "enum": []any{"x", "y"}}},
+			},
+		})
+	}
+	return tools
+}
+
+// handle returns the response for requests and nil for notifications.
+func (s *fakeServer) handle(message rpcMessage) *rpcMessage {
+	if len(message.ID) == 0 {
+		if message.Method == "notifications/cancelled" {
+			var params struct {
+				RequestID json.RawMessage `json:"requestId"`
+			}
+			_ = json.Unmarshal(message.Params, &params)
+			s.mu.Lock()
+			if ch, ok := s.cancelled[string(params.RequestID)]; ok {
+				close(ch)
+				delete(s.cancelled, string(params.RequestID))
+			}
+			s.mu.Unlock()
+		}
+		return nil
+	}
+	reply := &rpcMessage{JSONRPC: "2.0", ID: message.ID}
+	switch message.Method {
+	case "initialize":
+		reply.Result = map[string]any{
+			"protocolVersion": mcp.ProtocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{"listChanged": true}},
+			"serverInfo":      map[string]any{"name": "fake", "version": "0.1"},
+		}
+	case "tools/list":
+		reply.Result = map[string]any{"tools": s.tools()}
+	case "tools/call":
+		var params struct {
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		_ = json.Unmarshal(message.Params, &params)
+		reply.Result = s.callTool(string(message.ID), params.Name, params.Arguments)
+	default:
+		reply.Error = map[string]any{"code": -32601, "message": "method not found"}
+	}
+	return reply
+}
+
+func (s *fakeServer) callTool(id string, name string, args map[string]any) any {
+	text := func(value string, isError bool) map[string]any {
+		return map[string]any{"content": []any{map[string]any{"type": "text", "text": value}}, "isError": isError}
+	}
+	switch name {
+	case "add":
+		a, _ := args["a"].(float64)
+		b, _ := args["b"].(float64)
+		return map[string]any{
+			"content":           []any{map[string]any{"type": "text", "text": fmt.Sprint(a + b)}},
+			"structuredContent": map[string]any{"sum": a + b},
+		}
+	case "fail":
+		return text("it broke", true)
+	case "slow":
+		ch := make(chan struct{})
+		s.mu.Lock()
+		s.cancelled[id] = ch
+		s.mu.Unlock()
+		select {
+		case <-ch:
+			return text("cancelled", true)
+		case <-time.After(5 * time.Second):
+			return text("finished", false)
+		}
+	case "enable_extra":
+		s.mu.Lock()
+		s.extra = true
+		s.mu.Unlock()
+		s.notify(rpcMessage{JSONRPC: "2.0", Method: "notifications/tools/list_changed"})
+		return text("enabled", false)
+	case "extra":
+		return text("extra:"+fmt.Sprint(args["mode"]), false)
+	}
+	return text("unknown tool "+name, true)
+}
+
+func serveStdio() {
+	var writeMu sync.Mutex
+	write := func(message any) {
+		encoded, _ := json.Marshal(message)
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		_, _ = os.Stdout.Write(append(encoded, '\n'))
+	}
+	server := newFakeServer(func(message rpcMessage) { write(message) })
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 1024), 1024*1024)
+	var wg sync.WaitGroup
+	for scanner.Scan() {
+		var message rpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if reply := server.handle(message); reply != nil {
+				write(reply)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// newHTTPServer serves the streamable HTTP transport: tools/call answers as
+// an SSE stream, everything else as JSON, and notifications go out on GET.
+func newHTTPServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	notifications := make(chan rpcMessage, 8)
+	server := newFakeServer(func(message rpcMessage) { notifications <- message })
+	var sessions sync.Map
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			if _, ok := sessions.Load(r.Header.Get("Mcp-Session-Id")); !ok {
+				http.Error(w, "unknown session", http.StatusNotFound)
+				return
+			}
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case message := <-notifications:
+					encoded, _ := json.Marshal(message)
+					fmt.Fprintf(w, "event: message\ndata: %s\n\n", encoded)
+					w.(http.Flusher).Flush()
+				case <-r.Context().Done():
+					return
+				}
+			}
+		case http.MethodDelete:
+			sessions.Delete(r.Header.Get("Mcp-Session-Id"))
+			w.WriteHeader(http.StatusOK)
+		case http.MethodPost:
+			var message rpcMessage
+			if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if message.Method == "initialize" {
+				sessions.Store("session-1", true)
+				w.Header().Set("Mcp-Session-Id", "session-1")
+			} else if _, ok := sessions.Load(r.Header.Get("Mcp-Session-Id")); !ok {
+				http.Error(w, "unknown session", http.StatusNotFound)
+				return
+			} else if r.Header.Get("MCP-Protocol-Version") != mcp.ProtocolVersion {
+				http.Error(w, "missing protocol version", http.StatusBadRequest)
+				return
+			}
+			reply := server.handle(message)
+			if reply == nil {
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			encoded, _ := json.Marshal(reply)
+			if message.Method == "tools/call" {
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", encoded)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(encoded)
+		}
+	})
+	httpServer := httptest.NewServer(handler)
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+func newStdioClient(t *testing.T) *mcp.Client {
+	t.Helper()
+	transport := mcp.NewStdioTransport(os.Args[0], "-test.run=^$")
+	transport.Env = []string{testServerEnv + "=stdio"}
+	return mcp.NewClient("fake", transport)
+}
+
+func exerciseClient(t *testing.T, client *mcp.Client) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+	if client.ServerInfo().Name != "fake" {
+		t.Fatalf("unexpected server info: %#v", client.ServerInfo())
+	}
+
+	settings := utils.NewSettings("Tool-Settings", map[string]any{}, core.NewDefaultSettings(nil))
+	manager := tm.New(settings)
+	set, err := mcp.RegisterTools(ctx, client, manager, "agent-x")
+	if err != nil {
+		t.Fatalf("register tools failed: %v", err)
+	}
+	if names := strings.Join(set.Names(), ","); names != "add,enable_extra,fail,slow" {
+		t.Fatalf("unexpected tools: %s", names)
+	}
+	info := manager.GetToolInfo([]string{"mcp-fake"})["add"]
+	a, _ := info.Kwargs["a"].(map[string]any)
+	if info.Desc != "add two numbers" || a["type"] != "number" || a["desc"] != "first" || a["required"] != true {
+		t.Fatalf("unexpected converted tool info: %#v", info)
+	}
+	if len(manager.GetToolList([]string{"agent-x"})) != 4 {
+		t.Fatalf("tools should carry the given tags")
+	}
+
+	result, err := manager.CallTool(ctx, "add", map[string]any{"a": 2, "b": 5})
+	if err != nil {
+		t.Fatalf("call add failed: %v", err)
+	}
+	if sum, _ := result.(map[string]any)["sum"].(float64); sum != 7 {
+		t.Fatalf("unexpected add result: %#v", result)
+	}
+	if _, err := manager.CallTool(ctx, "fail", nil); err == nil || err.Error() != "it broke" {
+		t.Fatalf("expected tool error result, got %v", err)
+	}
+
+	slowCtx, slowCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	started := time.Now()
+	if _, err := manager.CallTool(slowCtx, "slow", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected cancelled slow call, got %v", err)
+	}
+	slowCancel()
+	if time.Since(started) > 2*time.Second {
+		t.Fatalf("cancellation took too long")
+	}
+
+	if _, err := manager.CallTool(ctx, "enable_extra", nil); err != nil {
+		t.Fatalf("enable_extra failed: %v", err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, ok := manager.GetToolFunc("extra"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("tool list change was not picked up")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if result, err := manager.CallTool(ctx, "extra", map[string]any{"mode": "y"}); err != nil || result != "extra:y" {
+		t.Fatalf("unexpected extra result: %v %v", result, err)
+	}
+	extra, _ := manager.GetToolInfo(nil)["extra"].Kwargs["mode"].(map[string]any)
+	if fmt.Sprint(extra["enum"]) != "[x y]" || extra["required"] != false {
+		t.Fatalf("unexpected extra kwargs: %#v", extra)
+	}
+
+	if err := set.Close(); err != nil {
+		t.Fatalf("close tool set failed: %v", err)
+	}
+	if len(manager.GetToolList(nil)) != 0 {
+		t.Fatalf("closing the tool set should unregister its tools")
+	}
+}
+
+func TestMCPClientStdio(t *testing.T) {
+	client := newStdioClient(t)
+	exerciseClient(t, client)
+	select {
+	case <-client.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatalf("client should be done after close")
+	}
+	if _, err := client.ListTools(context.Background()); !errors.Is(err, mcp.ErrClientClosed) {
+		t.Fatalf("expected ErrClientClosed, got %v", err)
+	}
+}
+
+func TestMCPClientStreamableHTTP(t *testing.T) {
+	server := newHTTPServer(t)
+	exerciseClient(t, mcp.NewHTTPClient("fake", server.URL))
+}
+
+func TestMCPToolSetKeepsOtherTools(t *testing.T) {
+	server := newHTTPServer(t)
+	client := mcp.NewHTTPClient("fake", server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	settings := utils.NewSettings("Tool-Settings", map[string]any{}, core.NewDefaultSettings(nil))
+	// The user replaces one of the set's tools below.
+	settings.Set("tool.name_collision", "replace")
+	manager := tm.New(settings)
+	if err := manager.Register(types.ToolInfo{Name: "add"}, func() string { return "local add" }); err != nil {
+		t.Fatalf("register local tool failed: %v", err)
+	}
+	set, err := mcp.RegisterTools(ctx, client, manager)
+	if err != nil {
+		t.Fatalf("register tools failed: %v", err)
+	}
+	if names := strings.Join(set.Names(), ","); names != "enable_extra,fail,fake_add,slow" {
+		t.Fatalf("a taken name should get the server prefix: %s", names)
+	}
+	if result, err := manager.CallTool(ctx, "add", nil); err != nil || result != "local add" {
+		t.Fatalf("the local tool must stay in place, got %v %v", result, err)
+	}
+	result, err := manager.CallTool(ctx, "fake_add", map[string]any{"a": 2, "b": 5})
+	if sum, _ := result.(map[string]any)["sum"].(float64); err != nil || sum != 7 {
+		t.Fatalf("the prefixed tool should call the server, got %#v %v", result, err)
+	}
+
+	if err := manager.Register(types.ToolInfo{Name: "slow"}, func() string { return "local slow" }); err != nil {
+		t.Fatalf("replace tool failed: %v", err)
+	}
+	if err := set.Refresh(ctx); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if names := strings.Join(set.Names(), ","); names != "enable_extra,fail,fake_add,fake_slow" {
+		t.Fatalf("a replaced tool should move to the prefixed name: %s", names)
+	}
+	if err := set.Close(); err != nil {
+		t.Fatalf("close tool set failed: %v", err)
+	}
+	remaining := make([]string, 0)
+	for _, info := range manager.GetToolList(nil) {
+		remaining = append(remaining, info.Name)
+	}
+	if strings.Join(remaining, ",") != "add,slow" {
+		t.Fatalf("closing must only remove the set's own tools, left %v", remaining)
+	}
+}
+
+func TestMCPToolSetRefreshesInPlaceAndStopsAfterClose(t *testing.T) {
+	server := newHTTPServer(t)
+	client := mcp.NewHTTPClient("fake", server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	// The default "error" collision policy must not break refreshing tools
+	// the set already owns.
+	manager := tm.New(utils.NewSettings("Tool-Settings", map[string]any{}, core.NewDefaultSettings(nil)))
+	set, err := mcp.RegisterTools(ctx, client, manager, "agent-x")
+	if err != nil {
+		t.Fatalf("register tools failed: %v", err)
+	}
+	if err := set.Refresh(ctx); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if len(manager.GetToolList([]string{"agent-x"})) != 4 {
+		t.Fatalf("refreshed tools should keep their tags")
+	}
+	if _, err := manager.CallTool(ctx, "add", map[string]any{"a": 1, "b": 1}); err != nil {
+		t.Fatalf("refreshed tool should stay callable: %v", err)
+	}
+
+	if err := set.Close(); err != nil {
+		t.Fatalf("close tool set failed: %v", err)
+	}
+	if err := set.Refresh(ctx); err != nil || len(manager.GetToolList(nil)) != 0 {
+		t.Fatalf("refresh after close must not register tools, got %v %d", err, len(manager.GetToolList(nil)))
+	}
+	changed := make(chan struct{}, 1)
+	client.OnToolsChanged(func() { changed <- struct{}{} })
+	if _, err := client.CallTool(ctx, "enable_extra", nil); err != nil {
+		t.Fatalf("enable_extra failed: %v", err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("tool list change notification not received")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if len(manager.GetToolList(nil)) != 0 {
+		t.Fatalf("a closed set must not follow tool list changes")
+	}
+}
@@ -0,0 +1,414 @@
+package mcp_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AgentEra/Agently-Go/agently/builtins/mcp"
+	pg "github.com/AgentEra/Agently-Go/agently/builtins/plugins/prompt_generator"
+	rp "github.com/AgentEra/Agently-Go/agently/builtins/plugins/response_parser"
+	tm "github.com/AgentEra/Agently-Go/agently/builtins/plugins/tool_manager"
+	"github.com/AgentEra/Agently-Go/agently/core"
+	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+type weatherArgs struct {
+	City string `json:"city" desc:"city name"`
+	Days int    `json:"days,omitempty" default:"1"`
+}
+
+// newServedManager builds the tools published by the Agently MCP server in
+// these tests. cancelled is closed when the wait tool sees its context end.
+func newServedManager(t testing.TB, cancelled chan struct{}) core.ToolManager {
+	settings := utils.NewSettings("Tool-Settings", map[string]any{}, core.NewDefaultSettings(nil))
+	manager := tm.New(settings)
+	register := func(info types.ToolInfo, fn any) {
+		if err := manager.Register(info, fn); err != nil {
+			if t != nil {
+				t.Fatalf("register %s failed: %v", info.Name, err)
+			}
+			panic(err)
+		}
+	}
+	register(types.ToolInfo{Name: "weather", Desc: "forecast for a city", Tags: []string{"public"}},
+		func(args weatherArgs) (map[string]any, error) {
+			return map[string]any{"city": args.City, "days": args.Days}, nil
+		})
+	register(types.ToolInfo{
+		Name:   "echo",
+		Desc:   "echo text",
+		Kwargs: map[string]any{"text": types.OutputTuple{"string", "text to echo"}},
+		Tags:   []string{"public"},
+	}, func(kwargs map[string]any) (any, error) {
+		return kwargs["text"], nil
+	})
+	register(types.ToolInfo{Name: "broken", Tags: []string{"public"}}, func() (any, error) {
+		return nil, errors.New("broken on purpose")
+	})
+	register(types.ToolInfo{Name: "wait", Tags: []string{"public"}}, func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		if cancelled != nil {
+			close(cancelled)
+		}
+		return nil, ctx.Err()
+	})
+	register(types.ToolInfo{Name: "private"}, func() (any, error) { return "hidden", nil })
+	return manager
+}
+
+func newServer(manager core.ToolManager) *mcp.Server {
+	return mcp.NewServer(
+		mcp.Implementation{Name: "agently-test", Version: "0.1"},
+		manager,
+		mcp.WithToolTags("public"),
+		mcp.WithInstructions("use the weather tool"),
+	)
+}
+
+func serveAgentlyStdio() {
+	_ = newServer(newServedManager(nil, nil)).ServeStdio(context.Background(), os.Stdin, os.Stdout)
+}
+
+func exerciseServer(t *testing.T, client *mcp.Client) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+	if client.ServerInfo().Name != "agently-test" || client.Instructions() != "use the weather tool" {
+		t.Fatalf("unexpected server info: %#v %q", client.ServerInfo(), client.Instructions())
+	}
+
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("list tools failed: %v", err)
+	}
+	names := make([]string, 0, len(tools))
+	schemas := map[string]map[string]any{}
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+		schemas[tool.Name] = tool.InputSchema
+	}
+	if strings.Join(names, ",") != "broken,echo,wait,weather" {
+		t.Fatalf("only tagged tools should be published, got %v", names)
+	}
+	weather := schemas["weather"]
+	properties, _ := weather["properties"].(map[string]any)
+	city, _ := properties["city"].(map[string]any)
+	if weather["type"] != "object" || city["type"] != "string" || city["description"] != "city name" {
+		t.Fatalf("unexpected weather schema: %#v", weather)
+	}
+	if fmt.Sprint(weather["required"]) != "[city]" {
+		t.Fatalf("unexpected required list: %#v", weather["required"])
+	}
+
+	result, err := client.CallTool(ctx, "weather", map[string]any{"city": "Paris"})
+	if err != nil {
+		t.Fatalf("call weather failed: %v", err)
+	}
+	value, err := result.Value()
+	structured, _ := value.(map[string]any)
+	if err != nil || structured["city"] != "Paris" || structured["days"] != float64(1) {
+		t.Fatalf("unexpected weather result: %#v %v", value, err)
+	}
+	if result, err := client.CallTool(ctx, "echo", map[string]any{"text": "hi"}); err != nil || result.Content[0].Text != "hi" {
+		t.Fatalf("unexpected echo result: %#v %v", result, err)
+	}
+
+	result, err = client.CallTool(ctx, "broken", nil)
+	if err != nil || !result.IsError || result.Content[0].Text != "broken on purpose" {
+		t.Fatalf("tool errors should come back as isError results: %#v %v", result, err)
+	}
+	result, err = client.CallTool(ctx, "weather", map[string]any{"days": 2})
+	if err != nil || !result.IsError || !strings.Contains(result.Content[0].Text, "missing required kwargs: city") {
+		t.Fatalf("invalid kwargs should come back as isError results: %#v %v", result, err)
+	}
+	var rpcErr *mcp.RPCError
+	if _, err := client.CallTool(ctx, "private", nil); !errors.As(err, &rpcErr) {
+		t.Fatalf("untagged tools should be unknown, got %v", err)
+	}
+}
+
+func TestMCPServerStdio(t *testing.T) {
+	transport := mcp.NewStdioTransport(os.Args[0], "-test.run=^$")
+	transport.Env = []string{testServerEnv + "=agently"}
+	exerciseServer(t, mcp.NewClient("agently", transport))
+}
+
+func TestMCPServerStreamableHTTP(t *testing.T) {
+	cancelled := make(chan struct{})
+	server := newServer(newServedManager(t, cancelled))
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	exerciseServer(t, mcp.NewHTTPClient("agently", httpServer.URL))
+
+	client := mcp.NewHTTPClient("agently", httpServer.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer waitCancel()
+	if _, err := client.CallTool(waitCtx, "wait", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected cancelled call, got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("the server should cancel the running tool")
+	}
+
+	changed := make(chan struct{}, 1)
+	client.OnToolsChanged(func() { changed <- struct{}{} })
+	// The notification stream is opened asynchronously after initialize.
+	deadline := time.After(3 * time.Second)
+	for notified := false; !notified; {
+		server.NotifyToolsChanged()
+		select {
+		case <-changed:
+			notified = true
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("tools list_changed was not delivered")
+		}
+	}
+}
+
+type echoAgentRequester struct {
+	prompt *core.Prompt
+}
+
+func (r *echoAgentRequester) GenerateRequestData() (types.RequestData, error) {
+	return types.RequestData{}, nil
+}
+
+func (r *echoAgentRequester) RequestModel(_ context.Context, _ types.RequestData) (<-chan types.ResponseMessage, error) {
+	out := make(chan types.ResponseMessage)
+	close(out)
+	return out, nil
+}
+
+func (r *echoAgentRequester) BroadcastResponse(_ context.Context, _ <-chan types.ResponseMessage) (<-chan types.ResponseMessage, error) {
+	text := fmt.Sprintf("%v says: %v", r.prompt.Get("system", "", true), r.prompt.Get("input", "", true))
+	out := make(chan types.ResponseMessage, 2)
+	out <- types.ResponseMessage{Event: types.ResponseEventDelta, Data: text}
+	out <- types.ResponseMessage{Event: types.ResponseEventDone, Data: text}
+	close(out)
+	return out, nil
+}
+
+func newEchoAgent() *core.BaseAgent {
+	settings := core.NewDefaultSettings(nil)
+	manager := core.NewPluginManager(settings, nil, "mcp-agent-plugin-manager")
+	_ = manager.Register(core.PluginTypePromptGenerator, core.PluginSpec{
+		Name:            pg.PluginName,
+		DefaultSettings: pg.DefaultSettings,
+		Creator:         core.PromptGeneratorCreator(pg.New),
+	}, true)
+	_ = manager.Register(core.PluginTypeResponseParser, core.PluginSpec{
+		Name:            rp.PluginName,
+		DefaultSettings: rp.DefaultSettings,
+		Creator:         core.ResponseParserCreator(rp.New),
+	}, true)
+	_ = manager.Register(core.PluginTypeModelRequester, core.PluginSpec{
+		Name: "EchoAgentRequester",
+		Creator: core.ModelRequesterCreator(func(prompt *core.Prompt, _ *utils.Settings) core.ModelRequester {
+			return &echoAgentRequester{prompt: prompt}
+		}),
+	}, true)
+	agent := core.NewBaseAgent(manager, settings, "echo-agent")
+	agent.SetAgentPrompt("system", "translator")
+	return agent
+}
+
+func TestMCPServerAgentTool(t *testing.T) {
+	server := mcp.NewServer(mcp.Implementation{Name: "agents", Version: "0.1"}, nil)
+	server.AddAgent("translator", "ask the translator agent", newEchoAgent())
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	client := mcp.NewHTTPClient("agents", httpServer.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	tools, err := client.ListTools(ctx)
+	if err != nil || len(tools) != 1 || tools[0].Name != "translator" {
+		t.Fatalf("unexpected agent tools: %#v %v", tools, err)
+	}
+	properties, _ := tools[0].InputSchema["properties"].(map[string]any)
+	if _, ok := properties["input"]; !ok {
+		t.Fatalf("agent tool should take an input: %#v", tools[0].InputSchema)
+	}
+	result, err := client.CallTool(ctx, "translator", map[string]any{"input": "bonjour"})
+	if err != nil || result.IsError || result.Content[0].Text != "translator says: bonjour" {
+		t.Fatalf("unexpected agent result: %#v %v", result, err)
+	}
+}
+
+func postInitialize(t *testing.T, url string, header http.Header) *http.Response {
+	t.Helper()
+	body := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"` + mcp.ProtocolVersion + `"}}`
+	request, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("new request failed: %v", err)
+	}
+	request.Header = header.Clone()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json, text/event-stream")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("post failed: %v", err)
+	}
+	_ = response.Body.Close()
+	return response
+}
+
+func TestMCPServerChecksOrigin(t *testing.T) {
+	server := mcp.NewServer(mcp.Implementation{Name: "agently-test"}, newServedManager(t, nil),
+		mcp.WithAllowedOrigins("https://app.example.com"))
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	cases := []struct {
+		origin string
+		status int
+	}{
+		{"", http.StatusOK},
+		{httpServer.URL, http.StatusOK},
+		{"https://app.example.com", http.StatusOK},
+		{"https://evil.example.com", http.StatusForbidden},
+		{"http://localhost.evil.example.com", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		header := http.Header{}
+		if tc.origin != "" {
+			header.Set("Origin", tc.origin)
+		}
+		if response := postInitialize(t, httpServer.URL, header); response.StatusCode != tc.status {
+			t.Fatalf("origin %q: expected %d, got %d", tc.origin, tc.status, response.StatusCode)
+		}
+	}
+}
+
+func TestMCPServerExpiresIdleSessions(t *testing.T) {
+	server := mcp.NewServer(mcp.Implementation{Name: "agently-test"}, newServedManager(t, nil),
+		mcp.WithSessionIdleTimeout(100*time.Millisecond))
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	ping := func(sessionID string) int {
+		request, _ := http.NewRequest(http.MethodPost, httpServer.URL, strings.NewReader(`{"jsonrpc":"2.0","id":2,"method":"ping"}`))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Mcp-Session-Id", sessionID)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("ping failed: %v", err)
+		}
+		_ = response.Body.Close()
+		return response.StatusCode
+	}
+	sessionID := postInitialize(t, httpServer.URL, http.Header{}).Header.Get("Mcp-Session-Id")
+	if sessionID == "" {
+		t.Fatalf("initialize should return a session id")
+	}
+	for i := 0; i < 3; i++ {
+		time.Sleep(50 * time.Millisecond)
+		if status := ping(sessionID); status != http.StatusOK {
+			t.Fatalf("a session in use should stay alive, got %d", status)
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+	if status := ping(sessionID); status != http.StatusNotFound {
+		t.Fatalf("an idle session should expire, got %d", status)
+	}
+}
+
+func TestMCPServerLimitsRequestBodies(t *testing.T) {
+	server := mcp.NewServer(mcp.Implementation{Name: "agently-test"}, newServedManager(t, nil), mcp.WithMaxRequestBytes(64))
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	if response := postInitialize(t, httpServer.URL, http.Header{}); response.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for a body over the limit, got %d", response.StatusCode)
+	}
+
+	defaults := httptest.NewServer(mcp.NewServer(mcp.Implementation{Name: "agently-test"}, newServedManager(t, nil)))
+	t.Cleanup(defaults.Close)
+	if response := postInitialize(t, defaults.URL, http.Header{}); response.StatusCode != http.StatusOK {
+		t.Fatalf("the default limit should accept initialize, got %d", response.StatusCode)
+	}
+}
+
+func TestMCPServerKeepsConcurrentStdioSessions(t *testing.T) {
+	cancelled := make(chan struct{})
+	server := mcp.NewServer(mcp.Implementation{Name: "agently-test"}, newServedManager(t, cancelled),
+		mcp.WithToolTags("public"), mcp.WithSessionIdleTimeout(20*time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type stdioHost struct {
+		in  *io.PipeWriter
+		out *bufio.Reader
+	}
+	send := func(host stdioHost, message string) {
+		t.Helper()
+		if _, err := io.WriteString(host.in, message+"\n"); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	ping := func(host stdioHost, id int) {
+		t.Helper()
+		send(host, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"ping"}`, id))
+		line, err := host.out.ReadString('\n')
+		if err != nil || !strings.Contains(line, fmt.Sprintf(`"id":%d`, id)) {
+			t.Fatalf("expected ping %d answered, got %q %v", id, line, err)
+		}
+	}
+	hosts := make([]stdioHost, 2)
+	for i := range hosts {
+		inReader, inWriter := io.Pipe()
+		outReader, outWriter := io.Pipe()
+		go func() { _ = server.ServeStdio(ctx, inReader, outWriter) }()
+		t.Cleanup(func() { _ = inWriter.Close(); _ = outReader.Close() })
+		hosts[i] = stdioHost{in: inWriter, out: bufio.NewReader(outReader)}
+		ping(hosts[i], i+1)
+	}
+
+	// An HTTP session expires idle sessions; the stdio ones must survive.
+	time.Sleep(50 * time.Millisecond)
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	postInitialize(t, httpServer.URL, http.Header{})
+	for i, host := range hosts {
+		ping(host, i+10)
+	}
+
+	// Ending the first host must not cancel the tools of the second.
+	send(hosts[1], `{"jsonrpc":"2.0","id":20,"method":"tools/call","params":{"name":"wait","arguments":{}}}`)
+	time.Sleep(50 * time.Millisecond)
+	_ = hosts[0].in.Close()
+	select {
+	case <-cancelled:
+		t.Fatalf("closing one stdio host cancelled another host's tool")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -2,11 +2,17 @@ package modelrequester_test
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	entry "github.com/AgentEra/Agently-Go/agently"
 	mr "github.com/AgentEra/Agently-Go/agently/builtins/plugins/model_requester"
+	"github.com/AgentEra/Agently-Go/agently/core"
 	"github.com/AgentEra/Agently-Go/agently/types"
 )
 
@@ -106,3 +112,95 @@ func TestOpenAICompatibleBroadcastResponseSemantic(t *testing.T) {
 		t.Fatalf("missing semantic events: delta=%v done=%v meta=%v messages=%#v", foundDelta, foundDone, foundMeta, messages)
 	}
 }
+
+func TestOpenAICompatibleChatHistoryToolMessages(t *testing.T) {
+	main := entry.NewAgently()
+	main.SetSettings("OpenAICompatible", map[string]any{"model_type": "chat"}, false)
+
+	history := []types.ChatMessage{
+		{Role: "user", Content: "weather in Paris and Rome?"},
+		{Role: "assistant", ToolCalls: []types.ToolCall{
+			{ID: "call_1", Name: "weather", Arguments: `{"city":"Paris"}`},
+			{ID: "call_2", Name: "weather", Arguments: `{"city":"Rome"}`},
+		}},
+		{Role: "tool", ToolCallID: "call_1", Name: "weather", Content: "sunny"},
+		{Role: "tool", ToolCallID: "call_2", Name: "weather", Content: "rain"},
+		{Role: "assistant", Content: "Paris is sunny,"},
+		{Role: "assistant", Content: "Rome is rainy."},
+	}
+	chat := make([]any, 0, len(history))
+	for _, message := range history {
+		chat = append(chat, message.ToMap())
+	}
+	req := main.CreateRequest("tool-history")
+	req.Prompt().Set("chat_history", chat)
+	req.Input("and tomorrow?")
+
+	data, err := mr.New(req.Prompt(), req.Settings()).GenerateRequestData()
+	if err != nil {
+		t.Fatalf("GenerateRequestData failed: %v", err)
+	}
+	messages, _ := data.Data["messages"].([]map[string]any)
+	roles := make([]string, 0, len(messages))
+	for _, message := range messages {
+		roles = append(roles, fmt.Sprint(message["role"]))
+	}
+	if strings.Join(roles, ",") != "user,assistant,tool,tool,assistant,user" {
+		t.Fatalf("tool messages should keep their roles and order: %v", roles)
+	}
+	calls, _ := messages[1]["tool_calls"].([]any)
+	first, _ := calls[0].(map[string]any)
+	function, _ := first["function"].(map[string]any)
+	if len(calls) != 2 || messages[1]["content"] != nil || first["id"] != "call_1" || function["arguments"] != `{"city":"Paris"}` {
+		t.Fatalf("unexpected assistant tool_calls message: %#v", messages[1])
+	}
+	if messages[3]["tool_call_id"] != "call_2" || messages[3]["name"] != "weather" || messages[3]["content"] != "rain" {
+		t.Fatalf("unexpected tool message: %#v", messages[3])
+	}
+	if content := fmt.Sprint(messages[4]["content"]); !strings.Contains(content, "Paris is sunny,") || !strings.Contains(content, "Rome is rainy.") {
+		t.Fatalf("plain assistant messages should still merge: %#v", messages[4])
+	}
+}
+
+func TestOpenAICompatibleRequestEmbeddings(t *testing.T) {
+	var payload map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"object":"list","data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0.5]}]}`))
+	}))
+	defer server.Close()
+
+	main := entry.NewAgently()
+	main.SetSettings("OpenAICompatible", map[string]any{
+		"base_url": server.URL + "/v1",
+		"model":    "qwen2.5:7b",
+		"default_model": map[string]any{
+			"embeddings": "nomic-embed-text",
+		},
+	}, false)
+	agent := main.CreateAgent("embeddings")
+
+	embeddings, err := core.AgentEmbedder(agent.BaseAgent)(context.Background(), []string{"first", "second"})
+	if err != nil {
+		t.Fatalf("embeddings request failed: %v", err)
+	}
+	if fmt.Sprint(embeddings) != "[[1 0.5] [0 1]]" {
+		t.Fatalf("expected embeddings in input order, got %v", embeddings)
+	}
+	if payload["model"] != "nomic-embed-text" || fmt.Sprint(payload["input"]) != "[first second]" || payload["stream"] != false {
+		t.Fatalf("unexpected embeddings payload %#v", payload)
+	}
+
+	agent.SetSettings("embedding.model", "bge-m3")
+	if _, err := core.AgentEmbedder(agent.BaseAgent)(context.Background(), []string{"a", "b"}); err != nil {
+		t.Fatalf("embeddings request failed: %v", err)
+	}
+	if payload["model"] != "bge-m3" {
+		t.Fatalf("expected embedding.model to pick the model, got %#v", payload["model"])
+	}
+}
@@ -105,3 +105,57 @@ func TestResponseParserStreamTypes(t *testing.T) {
 		t.Fatalf("expected instant answer path event, got %#v", instantItems)
 	}
 }
+
+func TestResponseParserRepairsLenientJSON(t *testing.T) {
+	main := entry.NewAgently()
+	req := main.CreateRequest("response-parser-repair")
+	req.Input("lenient json")
+	req.Output(map[string]any{"answer": "string", "ok": "bool"})
+
+	done := "```json\n{answer: 'hello', // greeting\n \"ok\": True,}\n```"
+	response := make(chan types.ResponseMessage, 4)
+	response <- types.ResponseMessage{Event: types.ResponseEventDelta, Data: done}
+	response <- types.ResponseMessage{Event: types.ResponseEventDone, Data: done}
+	close(response)
+
+	parser := rp.New("agent", "resp", req.Prompt(), response, req.Settings())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	parsed, err := parser.GetData(ctx, "parsed")
+	if err != nil {
+		t.Fatalf("GetData(parsed) failed: %v", err)
+	}
+	data, ok := parsed.(map[string]any)
+	if !ok || data["answer"] != "hello" || data["ok"] != true {
+		t.Fatalf("unexpected repaired data: %#v", parsed)
+	}
+
+	all, err := parser.GetData(ctx, "all")
+	if err != nil {
+		t.Fatalf("GetData(all) failed: %v", err)
+	}
+	result, ok := all.(types.ModelResult)
+	if !ok {
+		t.Fatalf("expected ModelResult, got %T", all)
+	}
+	if len(result.Repairs) == 0 {
+		t.Fatalf("expected applied repairs to be reported, got none")
+	}
+
+	strict := main.CreateRequest("response-parser-strict")
+	strict.Settings().Set("response.json_repair", "off")
+	strict.Input("strict json")
+	strict.Output(map[string]any{"answer": "string", "ok": "bool"})
+	strictResponse := make(chan types.ResponseMessage, 4)
+	strictResponse <- types.ResponseMessage{Event: types.ResponseEventDone, Data: done}
+	close(strictResponse)
+	strictParser := rp.New("agent", "resp-strict", strict.Prompt(), strictResponse, strict.Settings())
+	strictParsed, err := strictParser.GetData(ctx, "parsed")
+	if err != nil {
+		t.Fatalf("GetData(parsed) strict failed: %v", err)
+	}
+	if strictParsed != nil {
+		t.Fatalf("expected strict mode to reject lenient json, got %#v", strictParsed)
+	}
+}
@@ -0,0 +1,601 @@
+package toolmanager_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tm "github.com/AgentEra/Agently-Go/agently/builtins/plugins/tool_manager"
+	"github.com/AgentEra/Agently-Go/agently/core"
+	"github.com/AgentEra/Agently-Go/agently/types"
+	"github.com/AgentEra/Agently-Go/agently/utils"
+)
+
+func newToolManager(t *testing.T, concurrency int) core.ToolManager {
+	t.Helper()
+	settings := utils.NewSettings("Tool-Settings", map[string]any{}, core.NewDefaultSettings(nil))
+	settings.Set("tool.concurrency", concurrency)
+	return tm.New(settings)
+}
+
+func TestCallToolsRunsConcurrentlyInCallOrder(t *testing.T) {
+	manager := newToolManager(t, 2)
+	var running, peak atomic.Int32
+	if err := manager.Register(types.ToolInfo{Name: "slow_echo"}, func(ctx context.Context, kwargs map[string]any) (any, error) {
+		now := running.Add(1)
+		defer running.Add(-1)
+		for {
+			old := peak.Load()
+			if now <= old || peak.CompareAndSwap(old, now) {
+				break
+			}
+		}
+		delay, _ := kwargs["delay"].(int)
+		select {
+		case <-time.After(time.Duration(delay) * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return kwargs["value"], nil
+	}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+
+	calls := []types.ToolStep{
+		{CallID: "a", Name: "slow_echo", Kwargs: map[string]any{"value": "first", "delay": 60}},
+		{CallID: "b", Name: "slow_echo", Kwargs: map[string]any{"value": "second", "delay": 10}},
+		{CallID: "c", Name: "slow_echo", Kwargs: map[string]any{"value": "third", "delay": 30}},
+		{CallID: "d", Name: "missing"},
+	}
+	steps := core.CallTools(context.Background(), manager, calls, 0)
+	if len(steps) != 4 {
+		t.Fatalf("expected 4 steps, got %#v", steps)
+	}
+	for i, want := range []string{"first", "second", "third"} {
+		if steps[i].CallID != calls[i].CallID || steps[i].Result != want || steps[i].Error != "" {
+			t.Fatalf("step %d out of order or failed: %#v", i, steps[i])
+		}
+	}
+	if !strings.Contains(steps[3].Error, "not found") {
+		t.Fatalf("expected missing tool error, got %#v", steps[3])
+	}
+	if peak.Load() != 2 {
+		t.Fatalf("expected concurrency cap of 2 to be reached, peak=%d", peak.Load())
+	}
+}
+
+func TestCallToolTimeoutAndPanicRecovery(t *testing.T) {
+	manager := newToolManager(t, 0)
+	cancelled := make(chan struct{})
+	_ = manager.Register(types.ToolInfo{Name: "hang", Timeout: 0.05}, func(ctx context.Context, _ map[string]any) (any, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	})
+	_ = manager.Register(types.ToolInfo{Name: "boom"}, func(map[string]any) (any, error) {
+		panic("kaboom")
+	})
+	_ = manager.Register(types.ToolInfo{Name: "ok"}, func() string { return "fine" })
+	_ = manager.Register(types.ToolInfo{Name: "wait"}, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	started := time.Now()
+	if _, err := manager.CallTool(context.Background(), "hang", nil); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if time.Since(started) > time.Second {
+		t.Fatalf("timeout was not enforced")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatalf("tool context was not cancelled")
+	}
+
+	steps := core.CallTools(context.Background(), manager, []types.ToolStep{{Name: "boom"}, {Name: "ok"}}, 0)
+	if !strings.Contains(steps[0].Error, "panicked: kaboom") || steps[1].Result != "fine" {
+		t.Fatalf("expected panic converted to error result, got %#v", steps)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := manager.CallTool(ctx, "wait", nil); err == nil {
+		t.Fatalf("expected cancelled context error")
+	}
+}
+
+// baseToolManager exposes only the core.ToolManager methods of the manager it
+// wraps, like a third-party manager written before ToolManagerExtension.
+type baseToolManager struct{ core.ToolManager }
+
+func TestToolHelpersWithoutManagerExtension(t *testing.T) {
+	manager := baseToolManager{newToolManager(t, 0)}
+	_ = manager.Register(types.ToolInfo{Name: "echo"}, func(kwargs map[string]any) (any, error) {
+		return kwargs["text"], nil
+	})
+	_ = manager.Register(types.ToolInfo{Name: "typed", Kwargs: map[string]any{"n": []any{"integer", "count"}}}, func(map[string]any) (any, error) {
+		return nil, nil
+	})
+
+	steps := core.CallTools(context.Background(), manager, []types.ToolStep{
+		{Name: "echo", Kwargs: map[string]any{"text": "hi"}},
+		{Name: "typed", Kwargs: map[string]any{"n": "many"}},
+		{Name: "missing"},
+	}, 0)
+	if steps[0].Result != "hi" || steps[0].Error != "" {
+		t.Fatalf("expected echo result, got %#v", steps[0])
+	}
+	if len(steps[1].InvalidKwargs) == 0 || steps[2].Error == "" {
+		t.Fatalf("expected kwargs issues and missing tool error, got %#v", steps[1:])
+	}
+
+	if err := core.UnregisterTools(manager, []string{"echo"}); err == nil {
+		t.Fatalf("expected error unregistering through a manager without the extension")
+	}
+	if err := core.UntagTools(manager, []string{"echo"}, []string{"a"}); err == nil {
+		t.Fatalf("expected error untagging through a manager without the extension")
+	}
+}
+
+type forecastArgs struct {
+	City string `json:"city" desc:"city name"`
+	Days int    `json:"days" enum:"1,3,7" default:"1"`
+}
+
+type forecast struct {
+	City  string    `json:"city"`
+	Highs []float64 `json:"highs"`
+}
+
+func TestRegisterTypedTool(t *testing.T) {
+	manager := newToolManager(t, 0)
+	if err := manager.Register(types.ToolInfo{Name: "forecast", Desc: "weather forecast"}, func(_ context.Context, args forecastArgs) (forecast, error) {
+		highs := make([]float64, args.Days)
+		return forecast{City: args.City, Highs: highs}, nil
+	}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+
+	info := manager.GetToolInfo(nil)["forecast"]
+	city, _ := info.Kwargs["city"].(map[string]any)
+	if city["type"] != "string" || city["desc"] != "city name" || city["required"] != true {
+		t.Fatalf("unexpected derived kwargs: %#v", info.Kwargs)
+	}
+	returns, _ := info.Returns.(map[string]any)
+	if returns["city"] != "string" || returns["highs"] != "[]number" {
+		t.Fatalf("unexpected derived returns: %#v", info.Returns)
+	}
+
+	result, err := manager.CallTool(context.Background(), "forecast", map[string]any{"city": "Oslo", "days": 3.0})
+	if err != nil {
+		t.Fatalf("typed call failed: %v", err)
+	}
+	if typed, ok := result.(forecast); !ok || typed.City != "Oslo" || len(typed.Highs) != 3 {
+		t.Fatalf("unexpected typed result: %#v", result)
+	}
+
+	if _, err := manager.CallTool(context.Background(), "forecast", map[string]any{"city": 42}); err == nil ||
+		!strings.Contains(err.Error(), `kwarg "city": expected string, got number`) {
+		t.Fatalf("expected clear decode error, got %v", err)
+	}
+}
+
+func TestToolManagerConcurrentUseAndCollisionPolicies(t *testing.T) {
+	manager := newToolManager(t, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("tool_%d", i%4)
+			_ = manager.Register(types.ToolInfo{Name: name}, func() int { return i })
+			_ = manager.Tag([]string{name}, []string{"shared"})
+			_, _ = manager.CallTool(context.Background(), name, nil)
+			_ = manager.GetToolList([]string{"shared"})
+			if i%5 == 0 {
+				_ = core.UnregisterTools(manager, []string{name})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	_ = manager.Register(types.ToolInfo{Name: "dup", Tags: []string{"a", "b"}}, func() string { return "first" })
+	if err := manager.Register(types.ToolInfo{Name: "dup"}, func() string { return "second" }); !errors.Is(err, core.ErrToolNameConflict) {
+		t.Fatalf("default policy should refuse a taken name, got %v", err)
+	}
+	replaceManager := tm.New(utils.NewSettings("replace", map[string]any{"tool": map[string]any{"name_collision": "replace"}}, core.NewDefaultSettings(nil)))
+	_ = replaceManager.Register(types.ToolInfo{Name: "dup"}, func() string { return "first" })
+	_ = replaceManager.Register(types.ToolInfo{Name: "dup"}, func() string { return "second" })
+	if result, _ := replaceManager.CallTool(context.Background(), "dup", nil); result != "second" {
+		t.Fatalf("replace policy should replace, got %v", result)
+	}
+
+	keepManager := tm.New(utils.NewSettings("keep", map[string]any{"tool": map[string]any{"name_collision": "keep"}}, core.NewDefaultSettings(nil)))
+	strictManager := tm.New(utils.NewSettings("strict", map[string]any{"tool": map[string]any{"name_collision": "error"}}, core.NewDefaultSettings(nil)))
+	for _, m := range []core.ToolManager{keepManager, strictManager} {
+		if err := m.Register(types.ToolInfo{Name: "dup"}, func() string { return "first" }); err != nil {
+			t.Fatalf("first register failed: %v", err)
+		}
+	}
+	if err := keepManager.Register(types.ToolInfo{Name: "dup"}, func() string { return "second" }); err != nil {
+		t.Fatalf("keep policy should not fail: %v", err)
+	}
+	if result, _ := keepManager.CallTool(context.Background(), "dup", nil); result != "first" {
+		t.Fatalf("keep policy should keep the first tool, got %v", result)
+	}
+	if err := strictManager.Register(types.ToolInfo{Name: "dup"}, func() string { return "second" }); !errors.Is(err, core.ErrToolNameConflict) {
+		t.Fatalf("error policy should return ErrToolNameConflict, got %v", err)
+	}
+	_ = strictManager.Tag([]string{"dup"}, []string{"old"})
+	if err := core.ReplaceTool(strictManager, types.ToolInfo{Name: "dup", Tags: []string{"new"}}, func() string { return "third" }); err != nil {
+		t.Fatalf("replace should ignore the collision policy: %v", err)
+	}
+	if result, _ := strictManager.CallTool(context.Background(), "dup", nil); result != "third" ||
+		len(strictManager.GetToolList([]string{"old"})) != 0 || len(strictManager.GetToolList([]string{"new"})) != 1 {
+		t.Fatalf("replace should swap the tool and its tags, got %v", result)
+	}
+
+	if err := core.UntagTools(manager, []string{"dup"}, []string{"a"}); err != nil {
+		t.Fatalf("untag failed: %v", err)
+	}
+	if len(manager.GetToolList([]string{"a"})) != 0 || len(manager.GetToolList([]string{"b"})) != 1 {
+		t.Fatalf("untag should only remove the given tag")
+	}
+	if err := core.UnregisterTools(manager, []string{"dup"}); err != nil {
+		t.Fatalf("unregister failed: %v", err)
+	}
+	if _, ok := manager.GetToolFunc("dup"); ok || len(manager.GetToolList([]string{"b"})) != 0 {
+		t.Fatalf("unregister should drop the tool and its tags")
+	}
+	if err := core.UnregisterTools(manager, []string{"dup"}); err == nil {
+		t.Fatalf("expected error for unknown tool")
+	}
+}
+
+func TestCallToolApproval(t *testing.T) {
+	settings := utils.NewSettings("Tool-Settings", map[string]any{}, core.NewDefaultSettings(nil))
+	manager := tm.New(settings)
+	var ran []map[string]any
+	deleteFile := func(kwargs map[string]any) (any, error) {
+		ran = append(ran, kwargs)
+		return "deleted " + fmt.Sprint(kwargs["path"]), nil
+	}
+	if err := manager.Register(types.ToolInfo{Name: "delete_file", Kwargs: map[string]any{"path": "string"}, RequiresApproval: true}, deleteFile); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if err := manager.Register(types.ToolInfo{Name: "drop_table", Kwargs: map[string]any{"path": "string"}}, deleteFile); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if err := manager.Tag([]string{"drop_table"}, []string{types.ToolTagRequiresApproval}); err != nil {
+		t.Fatalf("tag failed: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := manager.CallTool(ctx, "delete_file", map[string]any{"path": "a.txt"}); !errors.Is(err, core.ErrToolCallDenied) || !strings.Contains(err.Error(), "no approver") {
+		t.Fatalf("calls without an approver should be denied, got %v", err)
+	}
+
+	var asked []types.ToolApprovalRequest
+	core.SetToolApprover(settings, func(_ context.Context, request types.ToolApprovalRequest) (types.ToolApprovalDecision, error) {
+		asked = append(asked, request)
+		switch request.Kwargs["path"] {
+		case "secret.txt":
+			return types.ToolApprovalDecision{Action: types.ToolApprovalDeny, Reason: "protected file"}, nil
+		case "draft.txt":
+			return types.ToolApprovalDecision{Action: types.ToolApprovalEdit, Kwargs: map[string]any{"path": "draft.bak"}}, nil
+		case "broken.txt":
+			return types.ToolApprovalDecision{Action: types.ToolApprovalEdit, Kwargs: map[string]any{"path": 1}}, nil
+		}
+		return types.ToolApprovalDecision{Action: types.ToolApprovalAllow}, nil
+	})
+
+	if value, err := manager.CallTool(ctx, "delete_file", map[string]any{"path": "a.txt"}); err != nil || value != "deleted a.txt" {
+		t.Fatalf("allowed call failed: %#v %v", value, err)
+	}
+	if _, err := manager.CallTool(ctx, "drop_table", map[string]any{"path": "secret.txt"}); !errors.Is(err, core.ErrToolCallDenied) || !strings.Contains(err.Error(), "protected file") {
+		t.Fatalf("tagged tool should be denied with the reason, got %v", err)
+	}
+	if value, err := manager.CallTool(ctx, "delete_file", map[string]any{"path": "draft.txt"}); err != nil || value != "deleted draft.bak" {
+		t.Fatalf("edited kwargs should be used: %#v %v", value, err)
+	}
+	var kwargsErr *utils.KwargsError
+	if _, err := manager.CallTool(ctx, "delete_file", map[string]any{"path": "broken.txt"}); !errors.As(err, &kwargsErr) {
+		t.Fatalf("edited kwargs should be validated, got %v", err)
+	}
+	if _, err := manager.CallTool(ctx, "delete_file", map[string]any{}); !errors.As(err, &kwargsErr) {
+		t.Fatalf("invalid kwargs should fail before approval, got %v", err)
+	}
+	if len(asked) != 4 || len(ran) != 2 || asked[0].Tool != "delete_file" || asked[0].ID == "" || asked[0].ID == asked[1].ID {
+		t.Fatalf("unexpected approvals %#v and runs %#v", asked, ran)
+	}
+}
+
+func TestCallToolApprovalWithCache(t *testing.T) {
+	settings := utils.NewSettings("Tool-Settings", map[string]any{}, core.NewDefaultSettings(nil))
+	manager := tm.New(settings)
+	var ran []string
+	if err := manager.Register(types.ToolInfo{
+		Name:             "read_file",
+		Kwargs:           map[string]any{"path": "string"},
+		RequiresApproval: true,
+		Cache:            &types.ToolCache{Scope: types.ToolCacheScopeGlobal},
+	}, func(kwargs map[string]any) (any, error) {
+		ran = append(ran, fmt.Sprint(kwargs["path"]))
+		return "content of " + fmt.Sprint(kwargs["path"]), nil
+	}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	asked := 0
+	core.SetToolApprover(settings, func(_ context.Context, request types.ToolApprovalRequest) (types.ToolApprovalDecision, error) {
+		asked++
+		switch request.Kwargs["path"] {
+		case "secret.txt":
+			return types.ToolApprovalDecision{Action: types.ToolApprovalEdit, Kwargs: map[string]any{"path": "public.txt"}}, nil
+		case "denied.txt":
+			return types.ToolApprovalDecision{Action: types.ToolApprovalDeny}, nil
+		}
+		return types.ToolApprovalDecision{Action: types.ToolApprovalAllow}, nil
+	})
+	ctx := context.Background()
+
+	// The edited call is cached under the approved kwargs, not the requested ones.
+	if value, err := manager.CallTool(ctx, "read_file", map[string]any{"path": "secret.txt"}); err != nil || value != "content of public.txt" {
+		t.Fatalf("edited call failed: %#v %v", value, err)
+	}
+	if value, err := manager.CallTool(ctx, "read_file", map[string]any{"path": "public.txt"}); err != nil || value != "content of public.txt" {
+		t.Fatalf("call with the approved kwargs should hit the cache: %#v %v", value, err)
+	}
+	if len(ran) != 1 || asked != 2 {
+		t.Fatalf("expected one run and an approval per call, got runs %v and %d approvals", ran, asked)
+	}
+
+	// A cached result still needs approval.
+	if value, err := manager.CallTool(ctx, "read_file", map[string]any{"path": "denied.txt"}); !errors.Is(err, core.ErrToolCallDenied) {
+		t.Fatalf("expected denial, got %#v %v", value, err)
+	}
+	ran = nil
+	core.SetToolApprover(settings, func(context.Context, types.ToolApprovalRequest) (types.ToolApprovalDecision, error) {
+		return types.ToolApprovalDecision{Action: types.ToolApprovalDeny}, nil
+	})
+	if _, err := manager.CallTool(ctx, "read_file", map[string]any{"path": "public.txt"}); !errors.Is(err, core.ErrToolCallDenied) || len(ran) != 0 {
+		t.Fatalf("a cached result must not skip approval, got %v", err)
+	}
+}
+
+func TestCallToolAsyncApproval(t *testing.T) {
+	center := core.NewEventCenter()
+	parent := core.NewDefaultSettings(nil)
+	parent.Set("runtime.event_center", center)
+	settings := utils.NewSettings("Tool-Settings", map[string]any{}, parent)
+	manager := tm.New(settings)
+	if err := manager.Register(types.ToolInfo{Name: "deploy", Kwargs: map[string]any{"env": "string"}, RequiresApproval: true, Timeout: 0.05}, func(kwargs map[string]any) (any, error) {
+		return "deployed " + fmt.Sprint(kwargs["env"]), nil
+	}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	queue := core.NewToolApprovalQueue(settings)
+	core.SetToolApprover(settings, queue.Approve)
+	events := make(chan types.ToolApprovalRequest, 2)
+	center.RegisterHook(types.EventNameSystem, func(message types.EventMessage) {
+		content, _ := message.Content.(map[string]any)
+		if request, ok := content["data"].(types.ToolApprovalRequest); ok && content["type"] == types.SystemEventToolApproval {
+			events <- request
+		}
+	}, "approval-hook")
+
+	steps := make(chan []types.ToolStep, 1)
+	go func() {
+		steps <- core.CallTools(context.Background(), manager, []types.ToolStep{
+			{CallID: "1", Name: "deploy", Kwargs: map[string]any{"env": "staging"}},
+			{CallID: "2", Name: "deploy", Kwargs: map[string]any{"env": "prod"}},
+		}, 2)
+	}()
+	requests := map[string]types.ToolApprovalRequest{}
+	for len(requests) < 2 {
+		select {
+		case request := <-events:
+			requests[fmt.Sprint(request.Kwargs["env"])] = request
+		case <-time.After(2 * time.Second):
+			t.Fatalf("approval events were not emitted")
+		}
+	}
+	// Waiting for a decision is not limited by the tool timeout.
+	time.Sleep(100 * time.Millisecond)
+	if pending := queue.Pending(); len(pending) != 2 {
+		t.Fatalf("expected 2 pending approvals, got %#v", pending)
+	}
+	if err := queue.Resolve(requests["prod"].ID, types.ToolApprovalDecision{Action: types.ToolApprovalDeny, Reason: "freeze"}); err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	if err := queue.Resolve(requests["staging"].ID, types.ToolApprovalDecision{Action: types.ToolApprovalAllow}); err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	if err := queue.Resolve(requests["staging"].ID, types.ToolApprovalDecision{Action: types.ToolApprovalAllow}); !errors.Is(err, core.ErrToolApprovalNotFound) {
+		t.Fatalf("resolving twice should fail, got %v", err)
+	}
+	var result []types.ToolStep
+	select {
+	case result = <-steps:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("tool calls did not resume")
+	}
+	if result[0].Result != "deployed staging" || result[1].Result != nil || !strings.Contains(result[1].Error, "freeze") {
+		t.Fatalf("unexpected steps: %#v", result)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := manager.CallTool(ctx, "deploy", map[string]any{"env": "dev"}); !errors.Is(err, context.DeadlineExceeded) || len(queue.Pending()) != 0 {
+		t.Fatalf("abandoned approvals should end with the context, got %v %#v", err, queue.Pending())
+	}
+}
+
+func TestCallToolResultCache(t *testing.T) {
+	settings := utils.NewSettings("Tool-Settings", map[string]any{}, core.NewDefaultSettings(nil))
+	settings.Set("tool.concurrency", 4)
+	settings.Set("tool.name_collision", "replace")
+	manager := tm.New(settings)
+	var calls atomic.Int32
+	lookup := func(ctx context.Context, kwargs map[string]any) (any, error) {
+		n := calls.Add(1)
+		if kwargs["q"] == "fail" {
+			return nil, errors.New("lookup failed")
+		}
+		time.Sleep(20 * time.Millisecond)
+		return fmt.Sprintf("%v#%d", kwargs["q"], n), nil
+	}
+	for _, info := range []types.ToolInfo{
+		{Name: "global_lookup", Kwargs: map[string]any{"q": "string", "n": map[string]any{"type": "number", "required": false}}, Cache: &types.ToolCache{Scope: types.ToolCacheScopeGlobal, TTL: 0.1}},
+		{Name: "response_lookup", Kwargs: map[string]any{"q": "string"}, Cache: &types.ToolCache{}},
+		{Name: "plain_lookup", Kwargs: map[string]any{"q": "string"}},
+	} {
+		if err := manager.Register(info, lookup); err != nil {
+			t.Fatalf("register failed: %v", err)
+		}
+	}
+	ctx := context.Background()
+
+	first, _ := manager.CallTool(ctx, "global_lookup", map[string]any{"q": "a", "n": 1})
+	again, _ := manager.CallTool(ctx, "global_lookup", map[string]any{"n": 1.0, "q": "a"})
+	other, _ := manager.CallTool(ctx, "global_lookup", map[string]any{"q": "b"})
+	if first != "a#1" || again != first || other != "b#2" {
+		t.Fatalf("same kwargs should share one result: %v %v %v", first, again, other)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if expired, _ := manager.CallTool(ctx, "global_lookup", map[string]any{"q": "a", "n": 1}); expired != "a#3" {
+		t.Fatalf("results should expire after the TTL, got %v", expired)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := manager.CallTool(ctx, "global_lookup", map[string]any{"q": "fail"}); err == nil {
+			t.Fatalf("failures should be returned")
+		}
+	}
+	if calls.Load() != 5 {
+		t.Fatalf("failures must not be cached, got %d calls", calls.Load())
+	}
+
+	calls.Store(0)
+	if _, err := manager.CallTool(ctx, "response_lookup", map[string]any{"q": "a"}); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if _, err := manager.CallTool(ctx, "response_lookup", map[string]any{"q": "a"}); err != nil || calls.Load() != 2 {
+		t.Fatalf("response-scoped tools are not cached outside a response, got %d calls", calls.Load())
+	}
+	calls.Store(0)
+	responseCtx := core.WithToolResultCache(ctx, types.ToolCacheScopeResponse, core.NewToolResultCache())
+	steps := core.CallTools(responseCtx, manager, []types.ToolStep{
+		{Name: "response_lookup", Kwargs: map[string]any{"q": "a"}},
+		{Name: "response_lookup", Kwargs: map[string]any{"q": "a"}},
+		{Name: "plain_lookup", Kwargs: map[string]any{"q": "a"}},
+		{Name: "plain_lookup", Kwargs: map[string]any{"q": "a"}},
+	}, 4)
+	if steps[0].Result != steps[1].Result || steps[0].Cached == steps[1].Cached || steps[2].Cached || steps[3].Cached || calls.Load() != 3 {
+		t.Fatalf("concurrent calls with the same kwargs should run once: %#v (%d calls)", steps, calls.Load())
+	}
+	if _, err := manager.CallTool(ctx, "global_lookup", map[string]any{"q": "a", "n": 1}); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	calls.Store(0)
+	if err := manager.Register(types.ToolInfo{Name: "global_lookup", Kwargs: map[string]any{"q": "string", "n": "number"}, Cache: &types.ToolCache{Scope: types.ToolCacheScopeGlobal}}, lookup); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if value, _ := manager.CallTool(ctx, "global_lookup", map[string]any{"q": "a", "n": 1}); value != "a#1" {
+		t.Fatalf("re-registering a tool should drop its cached results, got %v", value)
+	}
+}
+
+func TestToolResultCacheEvictsAndSweeps(t *testing.T) {
+	ctx := context.Background()
+	cache := core.NewToolResultCache().SetMaxEntries(3)
+	runs := 0
+	call := func(key string, ttl time.Duration) bool {
+		_, hit, err := cache.Do(ctx, "lookup", key, ttl, func() (any, error) {
+			runs++
+			return key, nil
+		})
+		if err != nil {
+			t.Fatalf("Do failed: %v", err)
+		}
+		return hit
+	}
+	call("a", 0)
+	call("b", 0)
+	call("c", 0)
+	call("a", 0)
+	call("d", 0)
+	if cache.Len() != 3 || !call("a", 0) || call("b", 0) {
+		t.Fatalf("expected the least recently used result b dropped, len=%d", cache.Len())
+	}
+
+	// Expired results are swept as new ones come in, not only on lookup.
+	unbounded := core.NewToolResultCache()
+	for i := 0; i < 50; i++ {
+		if _, _, err := unbounded.Do(ctx, "lookup", fmt.Sprint("short-", i), time.Millisecond, func() (any, error) { return i, nil }); err != nil {
+			t.Fatalf("Do failed: %v", err)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	for i := 0; i < 50; i++ {
+		if _, _, err := unbounded.Do(ctx, "lookup", fmt.Sprint("long-", i), 0, func() (any, error) { return i, nil }); err != nil {
+			t.Fatalf("Do failed: %v", err)
+		}
+	}
+	if n := unbounded.Len(); n != 50 {
+		t.Fatalf("expected expired results swept, %d left", n)
+	}
+
+	// tool.cache.max_entries bounds the global cache of a tool manager.
+	settings := utils.NewSettings("Tool-Settings", map[string]any{}, core.NewDefaultSettings(nil))
+	settings.Set("tool.cache.max_entries", 2)
+	manager := tm.New(settings)
+	var calls atomic.Int32
+	if err := manager.Register(types.ToolInfo{Name: "lookup", Kwargs: map[string]any{"q": "string"}, Cache: &types.ToolCache{Scope: types.ToolCacheScopeGlobal}}, func(_ context.Context, kwargs map[string]any) (any, error) {
+		calls.Add(1)
+		return kwargs["q"], nil
+	}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	for _, q := range []string{"a", "b", "c", "a"} {
+		if _, err := manager.CallTool(ctx, "lookup", map[string]any{"q": q}); err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+	}
+	if calls.Load() != 4 {
+		t.Fatalf("expected a evicted from the bounded global cache, got %d calls", calls.Load())
+	}
+}
+
+func TestCallToolIdempotencyKey(t *testing.T) {
+	manager := newToolManager(t, 2)
+	var sent []string
+	if err := manager.Register(types.ToolInfo{Name: "send_email", Kwargs: map[string]any{"to": "string"}, Idempotent: true}, func(ctx context.Context, kwargs map[string]any) (any, error) {
+		sent = append(sent, core.ToolIdempotencyKey(ctx))
+		return "sent", nil
+	}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	response := core.NewToolResultCache()
+	ctx := core.WithToolResultCache(context.Background(), types.ToolCacheScopeResponse, response)
+	for i := 0; i < 3; i++ {
+		if _, err := manager.CallTool(ctx, "send_email", map[string]any{"to": "a@example.com"}); err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+	}
+	if _, err := manager.CallTool(ctx, "send_email", map[string]any{"to": "b@example.com"}); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	otherResponse := core.WithToolResultCache(context.Background(), types.ToolCacheScopeResponse, core.NewToolResultCache())
+	if _, err := manager.CallTool(otherResponse, "send_email", map[string]any{"to": "a@example.com"}); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if len(sent) != 3 || sent[0] == "" || sent[0] == sent[1] || sent[0] == sent[2] || !strings.HasPrefix(sent[0], response.ID()) {
+		t.Fatalf("idempotent tools should run once per response and kwargs with distinct keys: %#v", sent)
+	}
+}